@@ -0,0 +1,111 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/observiq/observiq-otel-collector/internal/admin"
+	"github.com/observiq/observiq-otel-collector/internal/service"
+	"go.uber.org/zap"
+)
+
+const (
+	// statusTimeout bounds how long to wait for the running collector to return its status
+	statusTimeout = 10 * time.Second
+
+	// adminStopTimeout bounds how long to wait for admin API requests in progress when stopping
+	adminStopTimeout = 5 * time.Second
+)
+
+// errCollectorNotRunning is returned after printing the status of a collector that isn't running
+var errCollectorNotRunning = errors.New("collector is not running")
+
+// printStatus writes the status of the running collector to out.
+// Returns errCollectorNotRunning if the collector isn't running so the status can be used as a health check.
+func printStatus(out io.Writer, cfg admin.Config) error {
+	ctx, cancel := context.WithTimeout(context.Background(), statusTimeout)
+	defer cancel()
+
+	status, err := admin.FetchStatus(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Version:   %s (commit %s, built %s)\n", status.Version.Version, status.Version.Commit, status.Version.Date)
+	fmt.Fprintf(out, "Mode:      %s\n", status.Mode)
+
+	switch {
+	case status.Collector.Running:
+		fmt.Fprintln(out, "Collector: running")
+	case status.Collector.Error != "":
+		fmt.Fprintf(out, "Collector: not running: %s\n", status.Collector.Error)
+	default:
+		fmt.Fprintln(out, "Collector: not running")
+	}
+
+	if status.OpAMP != nil {
+		fmt.Fprintf(out, "OpAMP:     %s to %s since %s\n", status.OpAMP.State, status.OpAMP.Endpoint, status.OpAMP.Since.Format(time.RFC3339))
+		if status.OpAMP.LastError != "" {
+			fmt.Fprintf(out, "           %d failed attempts, last error: %s\n", status.OpAMP.Attempts, status.OpAMP.LastError)
+		}
+	}
+
+	if status.LogLevel != "" {
+		fmt.Fprintf(out, "Log level: %s (set at runtime)\n", status.LogLevel)
+	}
+
+	if len(status.Configs) > 0 {
+		fmt.Fprintf(out, "\n%-16s %-64s %s\n", "CONFIG", "HASH", "PATH")
+		for _, config := range status.Configs {
+			hash := config.Hash
+			if config.Error != "" {
+				hash = "unreadable"
+			}
+			fmt.Fprintf(out, "%-16s %-64s %s\n", config.Name, hash, config.Path)
+		}
+	}
+
+	if !status.Collector.Running {
+		return errCollectorNotRunning
+	}
+	return nil
+}
+
+// startAdminServer starts serving the admin API for the service if it's enabled. Returns nil if it isn't.
+func startAdminServer(logger *zap.Logger, cfg admin.Config, svc service.RunnableService) (*admin.Server, error) {
+	if !cfg.Enabled() {
+		return nil, nil
+	}
+
+	adminSvc, ok := svc.(admin.Service)
+	if !ok {
+		return nil, errors.New("service doesn't support the admin API")
+	}
+
+	server, err := admin.NewServer(logger, cfg, adminSvc)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := server.Start(); err != nil {
+		return nil, err
+	}
+	return server, nil
+}
@@ -0,0 +1,108 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/observiq/observiq-otel-collector/collector"
+	colmocks "github.com/observiq/observiq-otel-collector/collector/mocks"
+	"github.com/observiq/observiq-otel-collector/internal/admin"
+	"github.com/observiq/observiq-otel-collector/internal/service"
+	"github.com/observiq/observiq-otel-collector/internal/service/mocks"
+	"github.com/observiq/observiq-otel-collector/opamp/observiq"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// newAdminConfig creates a config for an admin socket in a temp dir with a short path
+func newAdminConfig(t *testing.T) admin.Config {
+	dir, err := os.MkdirTemp("", "admin")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	return admin.Config{Socket: filepath.Join(dir, "admin.sock")}
+}
+
+func TestPrintStatus(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		status      *collector.Status
+		expected    []string
+		expectedErr error
+	}{
+		{
+			desc:     "Collector running",
+			status:   &collector.Status{Running: true},
+			expected: []string{"Mode:      standalone", "Collector: running", "CONFIG", observiq.LoggingConfigName, "unreadable"},
+		},
+		{
+			desc:        "Collector stopped",
+			status:      &collector.Status{Running: false, Err: errors.New("cannot build pipelines")},
+			expected:    []string{"Collector: not running: cannot build pipelines"},
+			expectedErr: errCollectorNotRunning,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			col := colmocks.NewMockCollector(t)
+			col.On("LastStatus").Return(tc.status)
+
+			cfg := newAdminConfig(t)
+			cfg.ConfigPaths = map[string]string{observiq.LoggingConfigName: filepath.Join(t.TempDir(), observiq.LoggingConfigName)}
+
+			server, err := startAdminServer(zap.NewNop(), cfg, service.NewStandaloneCollectorService(col, nil, ""))
+			require.NoError(t, err)
+			defer server.Stop(context.Background())
+
+			out := &bytes.Buffer{}
+			err = printStatus(out, cfg)
+			if tc.expectedErr == nil {
+				require.NoError(t, err)
+			} else {
+				require.ErrorIs(t, err, tc.expectedErr)
+			}
+
+			for _, expected := range tc.expected {
+				require.Contains(t, out.String(), expected)
+			}
+		})
+	}
+}
+
+func TestStartAdminServer(t *testing.T) {
+	t.Run("Disabled", func(t *testing.T) {
+		server, err := startAdminServer(zap.NewNop(), admin.Config{}, &mocks.RunnableService{})
+		require.NoError(t, err)
+		require.Nil(t, server)
+	})
+
+	t.Run("Service doesn't support the API", func(t *testing.T) {
+		server, err := startAdminServer(zap.NewNop(), newAdminConfig(t), &mocks.RunnableService{})
+		require.EqualError(t, err, "service doesn't support the admin API")
+		require.Nil(t, server)
+	})
+
+	t.Run("Collector not listening", func(t *testing.T) {
+		err := printStatus(&bytes.Buffer{}, newAdminConfig(t))
+		require.ErrorContains(t, err, "failed to request status")
+	})
+}
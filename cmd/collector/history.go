@@ -0,0 +1,114 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/observiq/observiq-otel-collector/collector"
+	"github.com/observiq/observiq-otel-collector/opamp"
+	"github.com/observiq/observiq-otel-collector/opamp/observiq"
+)
+
+// managedConfigPaths maps the name of each managed config to its path
+type managedConfigPaths map[string]string
+
+// configPath returns the path of the named config
+func (m managedConfigPaths) configPath(configName string) (string, error) {
+	configPath, ok := m[configName]
+	if !ok {
+		return "", fmt.Errorf("unknown config %s, must be one of %s, %s, or %s", configName, observiq.CollectorConfigName, observiq.ManagerConfigName, observiq.LoggingConfigName)
+	}
+	return configPath, nil
+}
+
+// printHistory writes the stored versions of the named config to out
+func printHistory(out io.Writer, paths managedConfigPaths, configName string) error {
+	configPath, err := paths.configPath(configName)
+	if err != nil {
+		return err
+	}
+
+	entries, err := opamp.NewConfigHistory(configPath, opamp.DefaultHistorySize).Entries()
+	if err != nil {
+		return err
+	}
+
+	if len(entries) == 0 {
+		fmt.Fprintf(out, "No history for %s\n", configName)
+		return nil
+	}
+
+	fmt.Fprintf(out, "%-8s %-26s %-9s %s\n", "VERSION", "TIMESTAMP", "ORIGIN", "HASH")
+	for _, entry := range entries {
+		fmt.Fprintf(out, "%-8d %-26s %-9s %s\n", entry.Version, entry.Timestamp.Format(time.RFC3339), entry.Origin, entry.Hash)
+	}
+
+	return nil
+}
+
+// rollbackConfig restores a version of a config from its history.
+// The target has the form <config name>:<version>, for example collector.yaml:3.
+func rollbackConfig(col collector.Collector, paths managedConfigPaths, target string) error {
+	configName, versionStr, ok := cutLast(target, ":")
+	if !ok {
+		return fmt.Errorf("invalid rollback target %s, expected <config>:<version>", target)
+	}
+
+	version, err := strconv.Atoi(versionStr)
+	if err != nil {
+		return fmt.Errorf("invalid version %s: %w", versionStr, err)
+	}
+
+	configPath, err := paths.configPath(configName)
+	if err != nil {
+		return err
+	}
+
+	history := opamp.NewConfigHistory(configPath, opamp.DefaultHistorySize)
+	_, contents, err := history.Get(version)
+	if err != nil {
+		return fmt.Errorf("failed to get version %d of %s: %w", version, configName, err)
+	}
+
+	if configName == observiq.CollectorConfigName {
+		if err := col.ValidateConfig(context.Background(), contents); err != nil {
+			return fmt.Errorf("version %d of %s is not a valid collector config: %w", version, configName, err)
+		}
+	}
+
+	if err := opamp.WriteFileAtomic(configPath, contents, 0600); err != nil {
+		return fmt.Errorf("failed to restore %s: %w", configName, err)
+	}
+
+	if _, err := history.Record(contents, opamp.OriginRollback); err != nil {
+		return fmt.Errorf("restored %s but failed to record history: %w", configName, err)
+	}
+
+	return nil
+}
+
+// cutLast slices s around the last instance of sep
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
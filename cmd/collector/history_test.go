@@ -0,0 +1,119 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	colmocks "github.com/observiq/observiq-otel-collector/collector/mocks"
+	"github.com/observiq/observiq-otel-collector/opamp"
+	"github.com/observiq/observiq-otel-collector/opamp/observiq"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrintHistory(t *testing.T) {
+	tmpDir := t.TempDir()
+	paths := managedConfigPaths{observiq.LoggingConfigName: filepath.Join(tmpDir, observiq.LoggingConfigName)}
+
+	out := &bytes.Buffer{}
+	require.NoError(t, printHistory(out, paths, observiq.LoggingConfigName))
+	require.Contains(t, out.String(), "No history for logging.yaml")
+
+	_, err := opamp.NewConfigHistory(paths[observiq.LoggingConfigName], opamp.DefaultHistorySize).Record([]byte("level: info"), opamp.OriginRemote)
+	require.NoError(t, err)
+
+	out.Reset()
+	require.NoError(t, printHistory(out, paths, observiq.LoggingConfigName))
+	require.Contains(t, out.String(), "VERSION")
+	require.Contains(t, out.String(), "remote")
+
+	err = printHistory(out, paths, "other.yaml")
+	require.ErrorContains(t, err, "unknown config other.yaml")
+}
+
+func TestRollbackConfig(t *testing.T) {
+	setup := func(t *testing.T) (managedConfigPaths, string) {
+		collectorPath := filepath.Join(t.TempDir(), observiq.CollectorConfigName)
+		history := opamp.NewConfigHistory(collectorPath, opamp.DefaultHistorySize)
+		_, err := history.Record([]byte("version: 1"), opamp.OriginLocal)
+		require.NoError(t, err)
+		_, err = history.Record([]byte("version: 2"), opamp.OriginRemote)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(collectorPath, []byte("version: 2"), 0600))
+
+		return managedConfigPaths{observiq.CollectorConfigName: collectorPath}, collectorPath
+	}
+
+	testCases := []struct {
+		desc     string
+		testFunc func(*testing.T)
+	}{
+		{
+			desc: "Invalid target",
+			testFunc: func(t *testing.T) {
+				paths, _ := setup(t)
+				col := colmocks.NewMockCollector(t)
+
+				require.ErrorContains(t, rollbackConfig(col, paths, "collector.yaml"), "expected <config>:<version>")
+				require.ErrorContains(t, rollbackConfig(col, paths, "collector.yaml:one"), "invalid version")
+				require.ErrorContains(t, rollbackConfig(col, paths, "other.yaml:1"), "unknown config")
+				require.ErrorIs(t, rollbackConfig(col, paths, "collector.yaml:5"), opamp.ErrVersionNotFound)
+			},
+		},
+		{
+			desc: "Invalid collector config",
+			testFunc: func(t *testing.T) {
+				paths, collectorPath := setup(t)
+				col := colmocks.NewMockCollector(t)
+				col.On("ValidateConfig", mock.Anything, []byte("version: 1")).Return(errors.New("bad config"))
+
+				err := rollbackConfig(col, paths, "collector.yaml:1")
+				require.ErrorContains(t, err, "not a valid collector config")
+
+				data, err := os.ReadFile(collectorPath)
+				require.NoError(t, err)
+				require.Equal(t, []byte("version: 2"), data)
+			},
+		},
+		{
+			desc: "Successful rollback",
+			testFunc: func(t *testing.T) {
+				paths, collectorPath := setup(t)
+				col := colmocks.NewMockCollector(t)
+				col.On("ValidateConfig", mock.Anything, []byte("version: 1")).Return(nil)
+
+				require.NoError(t, rollbackConfig(col, paths, "collector.yaml:1"))
+
+				data, err := os.ReadFile(collectorPath)
+				require.NoError(t, err)
+				require.Equal(t, []byte("version: 1"), data)
+
+				latest, _, err := opamp.NewConfigHistory(collectorPath, opamp.DefaultHistorySize).Latest()
+				require.NoError(t, err)
+				require.Equal(t, 3, latest.Version)
+				require.Equal(t, opamp.OriginRollback, latest.Origin)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, tc.testFunc)
+	}
+}
@@ -15,18 +15,23 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	_ "time/tzdata"
 
-	"github.com/google/uuid"
 	"github.com/observiq/observiq-otel-collector/collector"
+	"github.com/observiq/observiq-otel-collector/internal/admin"
 	"github.com/observiq/observiq-otel-collector/internal/logging"
 	"github.com/observiq/observiq-otel-collector/internal/service"
 	"github.com/observiq/observiq-otel-collector/internal/version"
 	"github.com/observiq/observiq-otel-collector/opamp"
+	"github.com/observiq/observiq-otel-collector/opamp/observiq"
 	"github.com/spf13/pflag"
 	"go.uber.org/zap"
 	"gopkg.in/yaml.v3"
@@ -39,15 +44,27 @@ const (
 	secretkeyENV = "OPAMP_SECRET_KEY" //#nosec G101
 	labelsENV    = "OPAMP_LABELS"
 	agentNameENV = "OPAMP_AGENT_NAME"
+
+	agentIDStrategyENV   = "OPAMP_AGENT_ID_STRATEGY"
+	agentIDAttributesENV = "OPAMP_AGENT_ID_ATTRIBUTES"
 )
 
 func main() {
 	collectorConfigPaths := pflag.StringSlice("config", []string{"./config.yaml"}, "the collector config path")
 	managerConfigPath := pflag.String("manager", "./manager.yaml", "The configuration for remote management")
 	loggingConfigPath := pflag.String("logging", "./logging.yaml", "the collector logging config path")
+	pluginsDir := pflag.String("plugins", "./plugins", "the directory of plugins the server may update in managed mode")
 
 	_ = pflag.String("log-level", "", "not implemented") // TEMP(jsirianni): Required for OTEL k8s operator
 	var showVersion = pflag.BoolP("version", "v", false, "prints the version of the collector")
+	var showHistory = pflag.String("history", "", "prints the stored versions of a managed config (collector.yaml, manager.yaml, or logging.yaml)")
+	var rollback = pflag.String("rollback", "", "restores a stored version of a managed config, in the form <config>:<version>, then exits")
+	adminSocket := pflag.String("admin-socket", "", "the unix socket the local admin API listens on. The API is disabled unless a socket or address is set")
+	adminSocketMode := pflag.Uint32("admin-socket-mode", uint32(admin.DefaultSocketMode), "the file mode of the admin socket, such as 0660 to allow the collector's group")
+	adminAddress := pflag.String("admin-address", "", "the localhost address and port the local admin API listens on instead of a socket")
+	var showStatus = pflag.Bool("status", false, "prints the status of the running collector from its admin API, then exits")
+	supervise := pflag.Bool("supervise", false, "runs the collector in a child process supervised by this one, so a failing collector doesn't take down remote management")
+	memoryLimit := pflag.Uint64("memory-limit", 0, "the memory in MiB a supervised collector may use before it's restarted. Zero disables the limit")
 	pflag.Parse()
 
 	if *showVersion {
@@ -62,39 +79,116 @@ func main() {
 		log.Fatalf("Failed to get log options: %v", err)
 	}
 
-	// logOpts will override options here
-	logger, err := zap.NewProduction(logOpts...)
+	// logOpts will override options here. The logger follows the logging config when it's reloaded.
+	logger, err := logging.NewProcessLogger(logOpts...)
 	if err != nil {
 		log.Fatalf("Failed to set up logger: %v", err)
 	}
 
+	// This process is the collector supervised by another
+	if socket, ok := os.LookupEnv(collector.SupervisorSocketENV); ok {
+		runSupervised(logger, socket, *collectorConfigPaths, logOpts)
+		return
+	}
+
 	var runnableService service.RunnableService
 
-	col := collector.New(*collectorConfigPaths, version.Version(), logOpts)
+	var col collector.Collector
+	if *supervise {
+		col = collector.NewSupervised(logger, *collectorConfigPaths, *loggingConfigPath, *memoryLimit*1024*1024, logOpts)
+	} else {
+		col = collector.New(*collectorConfigPaths, version.Version(), logOpts)
+	}
+
+	configPaths := managedConfigPaths{
+		observiq.CollectorConfigName: (*collectorConfigPaths)[0],
+		observiq.ManagerConfigName:   *managerConfigPath,
+		observiq.LoggingConfigName:   *loggingConfigPath,
+	}
+
+	if *showHistory != "" {
+		if err := printHistory(os.Stdout, configPaths, *showHistory); err != nil {
+			logger.Fatal("Failed to print config history", zap.Error(err))
+		}
+		return
+	}
+
+	adminConfig := admin.Config{
+		Socket:      *adminSocket,
+		SocketMode:  os.FileMode(*adminSocketMode),
+		Address:     *adminAddress,
+		ConfigPaths: map[string]string{},
+	}
+	for name, path := range configPaths {
+		adminConfig.ConfigPaths[name] = path
+	}
+
+	if *showStatus {
+		if err := printStatus(os.Stdout, adminConfig); err != nil {
+			logger.Fatal("Failed to get collector status", zap.Error(err))
+		}
+		return
+	}
+
+	if *rollback != "" {
+		if err := rollbackConfig(col, configPaths, *rollback); err != nil {
+			logger.Fatal("Failed to roll back config", zap.Error(err))
+		}
+		logger.Info("Config rolled back, restart the collector to apply it", zap.String("rollback", *rollback))
+		return
+	}
 
 	// See if manager config file exists. If so run in remote managed mode otherwise standalone mode
 	if err := checkManagerConfig(managerConfigPath); err == nil {
 		logger.Info("Starting In Managed Mode")
 
-		runnableService, err = service.NewManagedCollectorService(col, logger, *managerConfigPath, (*collectorConfigPaths)[0], *loggingConfigPath)
+		runnableService, err = service.NewManagedCollectorService(col, logger, *managerConfigPath, (*collectorConfigPaths)[0], *loggingConfigPath, *pluginsDir)
 		if err != nil {
 			logger.Fatal("Failed to initiate managed mode", zap.Error(err))
 		}
 	} else if errors.Is(err, os.ErrNotExist) {
 		logger.Info("Starting Standalone Mode")
-		runnableService = service.NewStandaloneCollectorService(col)
+		runnableService = service.NewStandaloneCollectorService(col, *collectorConfigPaths, *loggingConfigPath)
+
+		// The manager config only exists in managed mode
+		delete(adminConfig.ConfigPaths, observiq.ManagerConfigName)
 	} else {
 		logger.Fatal("Error while searching for management config", zap.Error(err))
 	}
 
+	adminServer, err := startAdminServer(logger, adminConfig, runnableService)
+	if err != nil {
+		logger.Fatal("Failed to start admin API", zap.Error(err))
+	}
+
 	// Run service
 	err = service.RunService(logger, runnableService)
+
+	if adminServer != nil {
+		stopCtx, cancel := context.WithTimeout(context.Background(), adminStopTimeout)
+		if stopErr := adminServer.Stop(stopCtx); stopErr != nil {
+			logger.Warn("Failed to stop admin API", zap.Error(stopErr))
+		}
+		cancel()
+	}
+
 	if err != nil {
 		logger.Fatal("RunService returned error", zap.Error(err))
 	}
 
 }
 
+// runSupervised runs the collector until the supervisor stops it or goes away.
+// Interrupts also reach this process, but the supervisor decides when the collector stops.
+func runSupervised(logger *zap.Logger, socket string, configPaths []string, logOpts []zap.Option) {
+	signal.Ignore(os.Interrupt, syscall.SIGTERM)
+
+	col := collector.New(configPaths, version.Version(), logOpts)
+	if err := collector.RunSupervised(context.Background(), socket, col); err != nil {
+		logger.Fatal("Supervised collector stopped", zap.Error(err))
+	}
+}
+
 func logOptions(loggingConfigPath *string) ([]zap.Option, error) {
 	if loggingConfigPath == nil {
 		return nil, nil
@@ -130,7 +224,19 @@ func checkManagerConfig(configPath *string) error {
 
 		newConfig.AgentID, ok = os.LookupEnv(agentIDENV)
 		if !ok {
-			newConfig.AgentID = uuid.New().String()
+			// Record how the ID was generated so collisions can be traced back to the strategy
+			if strategy, ok := os.LookupEnv(agentIDStrategyENV); ok {
+				newConfig.AgentIDStrategy = opamp.AgentIDStrategy(strategy)
+			}
+			if attributes, ok := os.LookupEnv(agentIDAttributesENV); ok {
+				newConfig.AgentIDAttributes = splitList(attributes)
+			}
+
+			agentID, err := opamp.NewAgentID(newConfig.AgentIDStrategy, newConfig.AgentIDAttributes)
+			if err != nil {
+				return fmt.Errorf("failed to generate agent ID: %w", err)
+			}
+			newConfig.AgentID = agentID
 		}
 
 		if sk, ok := os.LookupEnv(secretkeyENV); ok {
@@ -159,3 +265,14 @@ func checkManagerConfig(configPath *string) error {
 	// Return non os.ErrNotExist
 	return statErr
 }
+
+// splitList splits a comma separated list, ignoring empty items
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -78,3 +78,34 @@ func TestCheckManagerConfig(t *testing.T) {
 	err := checkManagerConfig(&manager)
 	require.NoError(t, err)
 }
+
+func TestCheckManagerConfigAgentIDStrategy(t *testing.T) {
+	t.Setenv(endpointENV, "0.0.0.0")
+	t.Setenv(agentIDStrategyENV, string(opamp.AgentIDStrategyHostAttributes))
+	t.Setenv(agentIDAttributesENV, "host.name, ")
+
+	tmpdir := t.TempDir()
+	manager := filepath.Join(tmpdir, "manager.yaml")
+	err := checkManagerConfig(&manager)
+	require.NoError(t, err)
+
+	actual, err := opamp.ParseConfig(manager)
+	require.NoError(t, err)
+	require.Equal(t, opamp.AgentIDStrategyHostAttributes, actual.AgentIDStrategy)
+	require.Equal(t, []string{"host.name"}, actual.AgentIDAttributes)
+
+	// The same host derives the same ID
+	expectedID, err := opamp.NewAgentID(opamp.AgentIDStrategyHostAttributes, []string{"host.name"})
+	require.NoError(t, err)
+	require.Equal(t, expectedID, actual.AgentID)
+}
+
+func TestCheckManagerConfigUnknownAgentIDStrategy(t *testing.T) {
+	t.Setenv(endpointENV, "0.0.0.0")
+	t.Setenv(agentIDStrategyENV, "serial-number")
+
+	manager := filepath.Join(t.TempDir(), "manager.yaml")
+	err := checkManagerConfig(&manager)
+	require.ErrorIs(t, err, opamp.ErrUnknownAgentIDStrategy)
+	require.NoFileExists(t, manager)
+}
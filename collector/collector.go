@@ -19,6 +19,7 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.opentelemetry.io/collector/service"
@@ -32,18 +33,33 @@ type Collector interface {
 	Restart(context.Context) error
 	SetLoggingOpts([]zap.Option)
 	GetLoggingOpts() []zap.Option
+	SetConfigPaths([]string)
 	Status() <-chan *Status
+	LastStatus() *Status
+	Running() bool
+	ValidateConfig(context.Context, []byte) error
+	ValidateConfigFiles(context.Context) error
 }
 
 // collector is the standard implementation of the Collector interface.
 type collector struct {
-	configPaths []string
 	version     string
 	loggingOpts []zap.Option
 	mux         sync.Mutex
 	svc         *service.Collector
 	statusChan  chan *Status
 	wg          *sync.WaitGroup
+
+	// running is 1 while the collector is running. It's read without the mutex, which is held through restarts.
+	running int32
+
+	// statusMux guards the last status sent, which is read without consuming the status channel
+	statusMux  sync.Mutex
+	lastStatus *Status
+
+	// pathsMux guards the config paths, which are set and read outside of restarts
+	pathsMux    sync.Mutex
+	configPaths []string
 }
 
 // New returns a new collector.
@@ -67,9 +83,28 @@ func (c *collector) SetLoggingOpts(opts []zap.Option) {
 	c.loggingOpts = opts
 }
 
+// SetConfigPaths sets the config files the collector runs with. These will take effect on next restart
+func (c *collector) SetConfigPaths(paths []string) {
+	c.pathsMux.Lock()
+	defer c.pathsMux.Unlock()
+	c.configPaths = paths
+}
+
+// getConfigPaths returns the config files the collector runs with
+func (c *collector) getConfigPaths() []string {
+	c.pathsMux.Lock()
+	defer c.pathsMux.Unlock()
+	return c.configPaths
+}
+
 // Run will run the collector. This function will return an error
 // if the collector was unable to startup.
 func (c *collector) Run(ctx context.Context) error {
+	return c.run(ctx, ctx)
+}
+
+// run starts the collector. The startCtx bounds startup and the collector runs until runCtx is done or it's stopped.
+func (c *collector) run(startCtx, runCtx context.Context) error {
 	c.mux.Lock()
 	defer c.mux.Unlock()
 
@@ -79,7 +114,7 @@ func (c *collector) Run(ctx context.Context) error {
 
 	// The OT collector only supports using settings once during the lifetime
 	// of a single collector instance. We must remake the settings on each startup.
-	settings, err := NewSettings(c.configPaths, c.version, c.loggingOpts)
+	settings, err := NewSettings(c.getConfigPaths(), c.version, c.loggingOpts)
 	if err != nil {
 		return err
 	}
@@ -102,7 +137,7 @@ func (c *collector) Run(ctx context.Context) error {
 
 	go func() {
 		defer wg.Done()
-		err := svc.Run(ctx)
+		err := svc.Run(runCtx)
 		c.sendStatus(false, err)
 
 		if err != nil {
@@ -113,7 +148,7 @@ func (c *collector) Run(ctx context.Context) error {
 	// A race condition exists in the OT collector where the shutdown channel
 	// is not guaranteed to be initialized before the shutdown function is called.
 	// We protect against this by waiting for startup to finish before unlocking the mutex.
-	return c.waitForStartup(ctx, startupErr)
+	return c.waitForStartup(startCtx, startupErr)
 }
 
 // Stop will stop the collector.
@@ -131,9 +166,10 @@ func (c *collector) Stop() {
 }
 
 // Restart will restart the collector.
+// The context only bounds startup. The restarted collector runs until it's stopped.
 func (c *collector) Restart(ctx context.Context) error {
 	c.Stop()
-	return c.Run(ctx)
+	return c.run(ctx, context.Background())
 }
 
 // waitForStartup waits for the service to startup before exiting.
@@ -163,10 +199,33 @@ func (c *collector) Status() <-chan *Status {
 	return c.statusChan
 }
 
+// Running returns true if the collector has started and hasn't since stopped
+func (c *collector) Running() bool {
+	return atomic.LoadInt32(&c.running) == 1
+}
+
+// LastStatus returns the most recent status of the collector, or nil if it hasn't been run
+func (c *collector) LastStatus() *Status {
+	c.statusMux.Lock()
+	defer c.statusMux.Unlock()
+	return c.lastStatus
+}
+
 // sendStatus will set the status of the collector
 func (c *collector) sendStatus(running bool, err error) {
+	if running {
+		atomic.StoreInt32(&c.running, 1)
+	} else {
+		atomic.StoreInt32(&c.running, 0)
+	}
+
+	status := &Status{running, err}
+	c.statusMux.Lock()
+	c.lastStatus = status
+	c.statusMux.Unlock()
+
 	select {
-	case c.statusChan <- &Status{running, err}:
+	case c.statusChan <- status:
 	default:
 	}
 }
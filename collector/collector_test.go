@@ -18,6 +18,7 @@ import (
 	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -26,16 +27,23 @@ func TestCollectorRunValid(t *testing.T) {
 	ctx := context.Background()
 
 	collector := New([]string{"./test/valid.yaml"}, "0.0.0", nil)
+	require.False(t, collector.Running())
+	require.Nil(t, collector.LastStatus())
+
 	err := collector.Run(ctx)
 	require.NoError(t, err)
+	require.True(t, collector.Running())
 
 	status := <-collector.Status()
 	require.True(t, status.Running)
 	require.NoError(t, status.Err)
+	require.Equal(t, status, collector.LastStatus())
 
 	collector.Stop()
+	require.False(t, collector.Running())
 	status = <-collector.Status()
 	require.False(t, status.Running)
+	require.Equal(t, status, collector.LastStatus())
 }
 
 func TestCollectorRunMultiple(t *testing.T) {
@@ -70,6 +78,7 @@ func TestCollectorRunInvalidConfig(t *testing.T) {
 	require.False(t, status.Running)
 	require.Error(t, status.Err)
 	require.Contains(t, status.Err.Error(), "cannot build pipelines")
+	require.Equal(t, status, collector.LastStatus())
 }
 
 // There currently exists a limitation in the collector lifecycle regarding context.
@@ -131,6 +140,34 @@ func TestCollectorRestart(t *testing.T) {
 	require.False(t, status.Running)
 }
 
+func TestCollectorRestartOutlivesContext(t *testing.T) {
+	collector := New([]string{"./test/valid.yaml"}, "0.0.0", nil)
+	err := collector.Run(context.Background())
+	require.NoError(t, err)
+	defer collector.Stop()
+
+	status := <-collector.Status()
+	require.True(t, status.Running)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err = collector.Restart(ctx)
+	require.NoError(t, err)
+
+	status = <-collector.Status()
+	require.False(t, status.Running)
+
+	status = <-collector.Status()
+	require.True(t, status.Running)
+
+	// Cancelling the restart context after startup must not stop the collector
+	cancel()
+	select {
+	case status := <-collector.Status():
+		t.Fatalf("unexpected status after cancel: %+v", status)
+	case <-time.After(500 * time.Millisecond):
+	}
+}
+
 func TestCollectorPrematureStop(t *testing.T) {
 	collector := New([]string{"./test/valid.yaml"}, "0.0.0", nil)
 	collector.Stop()
@@ -35,6 +35,22 @@ func (_m *MockCollector) GetLoggingOpts() []zap.Option {
 	return r0
 }
 
+// LastStatus provides a mock function with given fields:
+func (_m *MockCollector) LastStatus() *collector.Status {
+	ret := _m.Called()
+
+	var r0 *collector.Status
+	if rf, ok := ret.Get(0).(func() *collector.Status); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*collector.Status)
+		}
+	}
+
+	return r0
+}
+
 // Restart provides a mock function with given fields: _a0
 func (_m *MockCollector) Restart(_a0 context.Context) error {
 	ret := _m.Called(_a0)
@@ -63,6 +79,25 @@ func (_m *MockCollector) Run(_a0 context.Context) error {
 	return r0
 }
 
+// Running provides a mock function with given fields:
+func (_m *MockCollector) Running() bool {
+	ret := _m.Called()
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func() bool); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	return r0
+}
+
+// SetConfigPaths provides a mock function with given fields: _a0
+func (_m *MockCollector) SetConfigPaths(_a0 []string) {
+	_m.Called(_a0)
+}
+
 // SetLoggingOpts provides a mock function with given fields: _a0
 func (_m *MockCollector) SetLoggingOpts(_a0 []zap.Option) {
 	_m.Called(_a0)
@@ -89,6 +124,34 @@ func (_m *MockCollector) Stop() {
 	_m.Called()
 }
 
+// ValidateConfig provides a mock function with given fields: _a0, _a1
+func (_m *MockCollector) ValidateConfig(_a0 context.Context, _a1 []byte) error {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, []byte) error); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ValidateConfigFiles provides a mock function with given fields: _a0
+func (_m *MockCollector) ValidateConfigFiles(_a0 context.Context) error {
+	ret := _m.Called(_a0)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context) error); ok {
+		r0 = rf(_a0)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // NewMockCollector creates a new instance of MockCollector. It also registers the testing.TB interface on the mock and a cleanup function to assert the mocks expectations.
 func NewMockCollector(t testing.TB) *MockCollector {
 	mock := &MockCollector{}
@@ -0,0 +1,120 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"runtime"
+	"time"
+)
+
+var (
+	// heartbeatInterval is how often the supervised collector reports its health
+	heartbeatInterval = 5 * time.Second
+
+	// memoryUsage returns the memory in bytes this process has obtained from the OS
+	memoryUsage = func() uint64 {
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+		return stats.Sys
+	}
+)
+
+// errSupervisorGone is returned when the connection to the supervisor closes without it stopping the collector
+var errSupervisorGone = errors.New("supervisor connection closed")
+
+// RunSupervised runs the collector in a child process of a supervisor, reporting its health on the socket.
+// It returns once the supervisor stops the collector, the supervisor goes away, or the collector stops on its own.
+func RunSupervised(ctx context.Context, socket string, col Collector) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", socket)
+	if err != nil {
+		return fmt.Errorf("failed to connect to supervisor: %w", err)
+	}
+	defer conn.Close()
+
+	encoder := json.NewEncoder(conn)
+	report := func(running bool, err error) error {
+		msg := healthMessage{Running: running, Memory: memoryUsage()}
+		if err != nil {
+			msg.Error = err.Error()
+		}
+		return encoder.Encode(msg)
+	}
+
+	if err := col.Run(ctx); err != nil {
+		_ = report(false, err)
+		return err
+	}
+	defer col.Stop()
+
+	if err := report(true, nil); err != nil {
+		return fmt.Errorf("failed to report health: %w", err)
+	}
+
+	commands := make(chan supervisorCommand, 1)
+	go readCommands(conn, commands)
+
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case cmd, ok := <-commands:
+			if !ok {
+				return errSupervisorGone
+			}
+			if cmd.Command == commandStop {
+				return nil
+			}
+
+		case status := <-col.Status():
+			if status.Running {
+				continue
+			}
+
+			err := status.Err
+			if err == nil {
+				err = errors.New("collector stopped")
+			}
+			_ = report(false, err)
+			return err
+
+		case <-ticker.C:
+			if err := report(true, nil); err != nil {
+				return fmt.Errorf("failed to report health: %w", err)
+			}
+		}
+	}
+}
+
+// readCommands decodes commands from the supervisor until the connection closes
+func readCommands(conn net.Conn, commands chan<- supervisorCommand) {
+	defer close(commands)
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		var cmd supervisorCommand
+		if err := json.Unmarshal(scanner.Bytes(), &cmd); err != nil {
+			continue
+		}
+		commands <- cmd
+	}
+}
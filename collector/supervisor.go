@@ -0,0 +1,641 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"go.uber.org/zap"
+)
+
+// SupervisorSocketENV is set in the environment of a supervised collector process to the socket it reports its health on
+const SupervisorSocketENV = "OIQ_SUPERVISOR_SOCKET"
+
+const (
+	// healthSocketName is the name of the socket created in the supervisor's temporary directory
+	healthSocketName = "health.sock"
+
+	// commandStop tells the supervised collector to stop and exit
+	commandStop = "stop"
+)
+
+var (
+	// defaultHeartbeatTimeout is how long the supervisor waits for health from the collector process before killing it
+	defaultHeartbeatTimeout = 30 * time.Second
+
+	// childStopTimeout is how long the collector process has to stop before it's killed
+	childStopTimeout = 30 * time.Second
+
+	// childRestartTimeout bounds startup when the collector process is restarted after it failed
+	childRestartTimeout = time.Minute
+
+	// defaultStableDuration is how long a collector process must run before failing for it not to count towards giving up
+	defaultStableDuration = time.Minute
+
+	// defaultMaxRestartFailures is how many collector processes may fail in a row before the collector is reported as stopped
+	defaultMaxRestartFailures = 5
+
+	// childCommand returns the command that runs the supervised collector with the arguments
+	childCommand = func(args []string) (*exec.Cmd, error) {
+		executable, err := os.Executable()
+		if err != nil {
+			return nil, fmt.Errorf("failed to find collector executable: %w", err)
+		}
+		return exec.Command(executable, args...), nil // #nosec G204 -- runs this executable
+	}
+)
+
+// healthMessage is sent by the supervised collector on startup, on every heartbeat, and when it stops
+type healthMessage struct {
+	Running bool   `json:"running"`
+	Error   string `json:"error,omitempty"`
+
+	// Memory is the memory in bytes the collector process has obtained from the OS
+	Memory uint64 `json:"memory"`
+}
+
+// supervisorCommand is sent by the supervisor to the supervised collector
+type supervisorCommand struct {
+	Command string `json:"command"`
+}
+
+// supervisor implements the Collector interface by running the collector in a child process of this executable.
+// A panic or memory blowup in a component only takes down the child, which is restarted.
+type supervisor struct {
+	logger            *zap.Logger
+	loggingConfigPath string
+	memoryLimit       uint64
+	heartbeatTimeout  time.Duration
+	mux               sync.Mutex
+	child             *childProcess
+	statusChan        chan *Status
+
+	// loggingMux guards the logging options, which are set and read outside of restarts
+	loggingMux  sync.Mutex
+	loggingOpts []zap.Option
+
+	// pathsMux guards the config paths, which are set and read outside of restarts
+	pathsMux    sync.Mutex
+	configPaths []string
+
+	// running is 1 while the collector process is running. It's read without the mutex, which is held through restarts.
+	running int32
+
+	// restarting is 1 while a collector process that failed is replaced.
+	// The collector is still reported as running so the restart isn't mistaken for the collector stopping.
+	restarting int32
+
+	// recoverCancel is closed to stop replacing a failed collector process. Nil unless one is being replaced.
+	recoverCancel      chan struct{}
+	restartBackOff     backoff.BackOff
+	restartFailures    int
+	maxRestartFailures int
+	stableDuration     time.Duration
+
+	// statusMux guards the last status sent, which is read without consuming the status channel
+	statusMux  sync.Mutex
+	lastStatus *Status
+}
+
+// NewSupervised returns a collector that runs in a child process, reading its configs and logging config from the paths.
+// The child process is restarted if it uses more than memoryLimit bytes. A memoryLimit of zero disables the limit.
+func NewSupervised(logger *zap.Logger, configPaths []string, loggingConfigPath string, memoryLimit uint64, loggingOpts []zap.Option) Collector {
+	return &supervisor{
+		logger:             logger.Named("supervisor"),
+		configPaths:        configPaths,
+		loggingConfigPath:  loggingConfigPath,
+		memoryLimit:        memoryLimit,
+		heartbeatTimeout:   defaultHeartbeatTimeout,
+		loggingOpts:        loggingOpts,
+		statusChan:         make(chan *Status, 10),
+		restartBackOff:     newRestartBackOff(),
+		maxRestartFailures: defaultMaxRestartFailures,
+		stableDuration:     defaultStableDuration,
+	}
+}
+
+// newRestartBackOff returns the backoff between starting collector processes after one fails
+func newRestartBackOff() backoff.BackOff {
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = time.Second
+	b.MaxInterval = 30 * time.Second
+	b.MaxElapsedTime = 0
+	b.Reset()
+	return b
+}
+
+// GetLoggingOpts returns the current logging options
+func (s *supervisor) GetLoggingOpts() []zap.Option {
+	s.loggingMux.Lock()
+	defer s.loggingMux.Unlock()
+	return s.loggingOpts
+}
+
+// SetLoggingOpts sets the logging options. The collector process reads the logging config itself on next restart.
+func (s *supervisor) SetLoggingOpts(opts []zap.Option) {
+	s.loggingMux.Lock()
+	defer s.loggingMux.Unlock()
+	s.loggingOpts = opts
+}
+
+// SetConfigPaths sets the config files the collector process runs with. These will take effect on next restart
+func (s *supervisor) SetConfigPaths(paths []string) {
+	s.pathsMux.Lock()
+	defer s.pathsMux.Unlock()
+	s.configPaths = paths
+}
+
+// getConfigPaths returns the config files the collector process runs with
+func (s *supervisor) getConfigPaths() []string {
+	s.pathsMux.Lock()
+	defer s.pathsMux.Unlock()
+	return s.configPaths
+}
+
+// Run starts the collector process. This function will return an error
+// if the collector was unable to startup.
+func (s *supervisor) Run(ctx context.Context) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.child != nil {
+		return errors.New("service already running")
+	}
+	s.cancelRecovery()
+
+	child, err := s.startChild(ctx)
+	if err != nil {
+		s.sendStatus(false, err)
+		return err
+	}
+
+	s.child = child
+	go s.watch(child)
+
+	s.sendStatus(true, nil)
+	return nil
+}
+
+// Stop stops the collector process, killing it if it doesn't stop in time
+func (s *supervisor) Stop() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	// A failed collector process being replaced is reported as running until it's stopped
+	recovering := s.recoverCancel != nil
+	s.cancelRecovery()
+
+	if s.child == nil {
+		if recovering {
+			s.sendStatus(false, nil)
+		}
+		return
+	}
+
+	s.child.stop(childStopTimeout)
+	s.child = nil
+	s.sendStatus(false, nil)
+}
+
+// Restart will restart the collector process.
+// The context only bounds startup. The restarted collector runs until it's stopped.
+func (s *supervisor) Restart(ctx context.Context) error {
+	s.Stop()
+	return s.Run(ctx)
+}
+
+// ValidateConfig parses the config contents and validates them against the registered factories without running them.
+// Validation doesn't run any components so it's done in this process.
+func (s *supervisor) ValidateConfig(ctx context.Context, contents []byte) error {
+	return validateConfig(ctx, contents)
+}
+
+// ValidateConfigFiles validates the config files the collector runs with, as they are now, without running them
+func (s *supervisor) ValidateConfigFiles(ctx context.Context) error {
+	return validateLocations(ctx, s.getConfigPaths())
+}
+
+// Status will return the status of the collector.
+func (s *supervisor) Status() <-chan *Status {
+	return s.statusChan
+}
+
+// Running returns true if the collector process has started and hasn't since stopped
+func (s *supervisor) Running() bool {
+	return atomic.LoadInt32(&s.running) == 1 || atomic.LoadInt32(&s.restarting) == 1
+}
+
+// LastStatus returns the most recent status of the collector, or nil if it hasn't been run
+func (s *supervisor) LastStatus() *Status {
+	s.statusMux.Lock()
+	defer s.statusMux.Unlock()
+	return s.lastStatus
+}
+
+// sendStatus will set the status of the collector
+func (s *supervisor) sendStatus(running bool, err error) {
+	if running {
+		atomic.StoreInt32(&s.running, 1)
+	} else {
+		atomic.StoreInt32(&s.running, 0)
+	}
+
+	status := &Status{running, err}
+	s.statusMux.Lock()
+	s.lastStatus = status
+	s.statusMux.Unlock()
+
+	select {
+	case s.statusChan <- status:
+	default:
+	}
+}
+
+// startChild starts a collector process and waits until it reports the collector is running
+func (s *supervisor) startChild(ctx context.Context) (*childProcess, error) {
+	dir, err := os.MkdirTemp("", "observiq-supervisor-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create supervisor directory: %w", err)
+	}
+
+	socket := filepath.Join(dir, healthSocketName)
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to listen for collector health: %w", err)
+	}
+
+	args := []string{"--logging", s.loggingConfigPath}
+	for _, path := range s.getConfigPaths() {
+		args = append(args, "--config", path)
+	}
+
+	cmd, err := childCommand(args)
+	if err != nil {
+		_ = listener.Close()
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+	cmd.Env = append(os.Environ(), fmt.Sprintf("%s=%s", SupervisorSocketENV, socket))
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Start(); err != nil {
+		_ = listener.Close()
+		_ = os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to start collector process: %w", err)
+	}
+
+	child := &childProcess{
+		started:  time.Now(),
+		cmd:      cmd,
+		dir:      dir,
+		listener: listener,
+		health:   make(chan healthMessage),
+		exited:   make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go child.wait()
+
+	if err := child.waitForStartup(ctx); err != nil {
+		child.stop(0)
+		return nil, err
+	}
+
+	s.logger.Info("Collector process started", zap.Int("pid", cmd.Process.Pid))
+	return child, nil
+}
+
+// watch kills the collector process if it stops responding and restarts it if it goes over the memory limit.
+// It hands the process over to be recovered once it exits without being stopped.
+func (s *supervisor) watch(child *childProcess) {
+	timer := time.NewTimer(s.heartbeatTimeout)
+	defer timer.Stop()
+
+	health := child.health
+	var lastErr error
+
+	for {
+		select {
+		case <-child.done:
+			return
+
+		case msg, ok := <-health:
+			if !ok {
+				// The process is exiting, which is handled once it has
+				health = nil
+				continue
+			}
+
+			if !msg.Running {
+				if msg.Error != "" {
+					lastErr = errors.New(msg.Error)
+				}
+				continue
+			}
+
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(s.heartbeatTimeout)
+
+			if s.memoryLimit > 0 && msg.Memory > s.memoryLimit {
+				s.logger.Warn("Collector process is over the memory limit, restarting it",
+					zap.Uint64("memory", msg.Memory),
+					zap.Uint64("limit", s.memoryLimit),
+				)
+				atomic.StoreInt32(&s.restarting, 1)
+				go s.recoverChild(child, fmt.Errorf("collector process went over the memory limit of %d bytes", s.memoryLimit))
+				return
+			}
+
+		case <-timer.C:
+			s.logger.Error("Collector process stopped responding, killing it", zap.Duration("timeout", s.heartbeatTimeout))
+			lastErr = errors.New("collector process stopped responding")
+			_ = child.cmd.Process.Kill()
+
+		case <-child.exited:
+			err := lastErr
+			switch {
+			case err != nil:
+			case child.exitErr != nil:
+				err = fmt.Errorf("collector process exited unexpectedly: %w", child.exitErr)
+			default:
+				err = errors.New("collector process exited unexpectedly")
+			}
+
+			s.logger.Error("Collector process stopped, restarting it", zap.Error(err))
+			atomic.StoreInt32(&s.restarting, 1)
+			go s.recoverChild(child, err)
+			return
+		}
+	}
+}
+
+// recoverChild replaces a collector process that exited, stopped responding, or went over the memory limit.
+// New processes are started with backoff. A process that didn't stay up for the stable duration counts as a failure,
+// and the collector is reported as stopped once maxRestartFailures fail in a row.
+// The collector is reported as running in the meantime so recovering isn't mistaken for the collector failing.
+func (s *supervisor) recoverChild(child *childProcess, reason error) {
+	s.mux.Lock()
+
+	// The process was stopped or restarted while waiting for the mutex
+	if s.child != child {
+		if s.recoverCancel == nil {
+			atomic.StoreInt32(&s.restarting, 0)
+		}
+		s.mux.Unlock()
+		return
+	}
+
+	child.stop(childStopTimeout)
+	s.child = nil
+
+	if time.Since(child.started) >= s.stableDuration {
+		s.restartFailures = 0
+		s.restartBackOff.Reset()
+	} else {
+		s.restartFailures++
+	}
+
+	cancel := make(chan struct{})
+	s.recoverCancel = cancel
+	s.mux.Unlock()
+
+	err := reason
+	for {
+		if s.giveUpRecovering(cancel, err) {
+			return
+		}
+
+		timer := time.NewTimer(s.nextRestartDelay())
+		select {
+		case <-timer.C:
+		case <-cancel:
+			timer.Stop()
+			return
+		}
+
+		var done bool
+		if done, err = s.restartRecovered(cancel); done {
+			return
+		}
+	}
+}
+
+// giveUpRecovering reports the collector as stopped with the error if too many restarts have failed in a row.
+// It returns true if recovering should stop, including if it was cancelled.
+func (s *supervisor) giveUpRecovering(cancel chan struct{}, err error) bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.recoverCancel != cancel {
+		return true
+	}
+
+	if s.restartFailures < s.maxRestartFailures {
+		return false
+	}
+
+	err = fmt.Errorf("collector process failed %d times in a row: %w", s.restartFailures, err)
+	s.logger.Error("Giving up restarting collector process", zap.Error(err))
+	s.recoverCancel = nil
+	atomic.StoreInt32(&s.restarting, 0)
+	s.sendStatus(false, err)
+	return true
+}
+
+// nextRestartDelay returns how long to wait before starting the next collector process
+func (s *supervisor) nextRestartDelay() time.Duration {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.restartBackOff.NextBackOff()
+}
+
+// restartRecovered starts a new collector process unless recovering was cancelled.
+// It returns true once recovering is done, or the error the process failed to start with.
+func (s *supervisor) restartRecovered(cancel chan struct{}) (bool, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.recoverCancel != cancel {
+		return true, nil
+	}
+
+	ctx, cancelStart := context.WithTimeout(context.Background(), childRestartTimeout)
+	defer cancelStart()
+
+	newChild, err := s.startChild(ctx)
+	if err != nil {
+		s.restartFailures++
+		s.logger.Error("Failed to restart collector process", zap.Int("failures", s.restartFailures), zap.Error(err))
+		return false, fmt.Errorf("failed to restart collector process: %w", err)
+	}
+
+	s.child = newChild
+	s.recoverCancel = nil
+	atomic.StoreInt32(&s.restarting, 0)
+	go s.watch(newChild)
+	return true, nil
+}
+
+// cancelRecovery stops recovering a collector process, if it is.
+// mux must be held.
+func (s *supervisor) cancelRecovery() {
+	if s.recoverCancel != nil {
+		close(s.recoverCancel)
+		s.recoverCancel = nil
+	}
+	atomic.StoreInt32(&s.restarting, 0)
+	s.restartFailures = 0
+	s.restartBackOff.Reset()
+}
+
+// childProcess is a running collector process and the connection it reports its health on
+type childProcess struct {
+	started  time.Time
+	cmd      *exec.Cmd
+	dir      string
+	listener net.Listener
+	conn     net.Conn
+
+	// health receives messages from the process until its connection closes
+	health chan healthMessage
+
+	// exited is closed once the process exits, after exitErr is set
+	exited  chan struct{}
+	exitErr error
+
+	// done is closed when the supervisor is finished with the process
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// wait waits for the process to exit, then stops accepting its connection
+func (c *childProcess) wait() {
+	c.exitErr = c.cmd.Wait()
+	close(c.exited)
+	_ = c.listener.Close()
+}
+
+// waitForStartup accepts the connection from the process and waits for it to report the collector is running
+func (c *childProcess) waitForStartup(ctx context.Context) error {
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := c.listener.Accept()
+		if err == nil {
+			accepted <- conn
+		}
+	}()
+
+	select {
+	case c.conn = <-accepted:
+	case <-c.exited:
+		return c.exitError()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	go c.readHealth()
+
+	select {
+	case msg, ok := <-c.health:
+		switch {
+		case !ok:
+			<-c.exited
+			return c.exitError()
+		case !msg.Running:
+			// Let the process finish logging why it failed before it's stopped
+			select {
+			case <-c.exited:
+			case <-ctx.Done():
+			}
+			return errors.New(msg.Error)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// readHealth decodes health messages from the connection until it closes
+func (c *childProcess) readHealth() {
+	defer close(c.health)
+
+	scanner := bufio.NewScanner(c.conn)
+	for scanner.Scan() {
+		var msg healthMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			continue
+		}
+
+		select {
+		case c.health <- msg:
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// exitError returns the error for the process exiting before the collector was running
+func (c *childProcess) exitError() error {
+	if c.exitErr != nil {
+		return fmt.Errorf("collector process exited: %w", c.exitErr)
+	}
+	return errors.New("collector process exited")
+}
+
+// stop tells the process to stop, kills it if it hasn't exited after the timeout, then removes its socket.
+// It's safe to call more than once.
+func (c *childProcess) stop(timeout time.Duration) {
+	c.stopOnce.Do(func() {
+		close(c.done)
+
+		if c.conn != nil {
+			_ = c.conn.SetWriteDeadline(time.Now().Add(time.Second))
+			_ = json.NewEncoder(c.conn).Encode(supervisorCommand{Command: commandStop})
+		}
+
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+
+		select {
+		case <-c.exited:
+		case <-timer.C:
+			_ = c.cmd.Process.Kill()
+			<-c.exited
+		}
+
+		if c.conn != nil {
+			_ = c.conn.Close()
+		}
+		_ = os.RemoveAll(c.dir)
+	})
+}
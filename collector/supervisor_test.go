@@ -0,0 +1,465 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// supervisorTestBehaviorENV tells the helper process how the supervised collector should behave
+const supervisorTestBehaviorENV = "SUPERVISOR_TEST_BEHAVIOR"
+
+// TestSupervisedHelperProcess isn't a real test. It runs as the supervised collector process in the tests below.
+func TestSupervisedHelperProcess(t *testing.T) {
+	socket, ok := os.LookupEnv(SupervisorSocketENV)
+	if !ok {
+		return
+	}
+
+	var configPaths []string
+	for i, arg := range os.Args {
+		if arg == "--config" && i+1 < len(os.Args) {
+			configPaths = append(configPaths, os.Args[i+1])
+		}
+	}
+
+	heartbeatInterval = 50 * time.Millisecond
+	switch os.Getenv(supervisorTestBehaviorENV) {
+	case "memory":
+		memoryUsage = func() uint64 { return 1 << 40 }
+	case "hang":
+		heartbeatInterval = time.Hour
+	case "exit":
+		// Exit on the first heartbeat after reporting the collector is running
+		var reports int32
+		memoryUsage = func() uint64 {
+			if atomic.AddInt32(&reports, 1) > 1 {
+				os.Exit(3)
+			}
+			return 0
+		}
+	}
+
+	if err := RunSupervised(context.Background(), socket, New(configPaths, "0.0.0", nil)); err != nil {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// useHelperProcess runs the supervised collector as the helper process with the behavior
+func useHelperProcess(t *testing.T, behavior string) {
+	t.Setenv(supervisorTestBehaviorENV, behavior)
+
+	original := childCommand
+	childCommand = func(args []string) (*exec.Cmd, error) {
+		args = append([]string{"-test.run=^TestSupervisedHelperProcess$", "--"}, args...)
+		return exec.Command(os.Args[0], args...), nil // #nosec G204 -- runs the test binary
+	}
+	t.Cleanup(func() { childCommand = original })
+}
+
+// childPID returns the process ID of the running collector process, or zero if there isn't one
+func childPID(s *supervisor) int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.child == nil {
+		return 0
+	}
+	return s.child.cmd.Process.Pid
+}
+
+func TestSupervisedRunValid(t *testing.T) {
+	useHelperProcess(t, "")
+
+	collector := NewSupervised(zap.NewNop(), []string{"./test/valid.yaml"}, "./logging.yaml", 0, nil)
+	require.False(t, collector.Running())
+	require.Nil(t, collector.LastStatus())
+
+	err := collector.Run(context.Background())
+	require.NoError(t, err)
+	require.True(t, collector.Running())
+
+	status := <-collector.Status()
+	require.True(t, status.Running)
+	require.NoError(t, status.Err)
+	require.Equal(t, status, collector.LastStatus())
+
+	dir := collector.(*supervisor).child.dir
+	require.DirExists(t, dir)
+
+	collector.Stop()
+	require.False(t, collector.Running())
+	status = <-collector.Status()
+	require.False(t, status.Running)
+	require.NoError(t, status.Err)
+	require.NoDirExists(t, dir)
+}
+
+func TestSupervisedRunInvalidConfig(t *testing.T) {
+	useHelperProcess(t, "")
+
+	collector := NewSupervised(zap.NewNop(), []string{"./test/invalid.yaml"}, "./logging.yaml", 0, nil)
+	err := collector.Run(context.Background())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "cannot build pipelines")
+	require.False(t, collector.Running())
+
+	status := <-collector.Status()
+	require.False(t, status.Running)
+	require.Equal(t, err, status.Err)
+}
+
+func TestSupervisedRunTwice(t *testing.T) {
+	useHelperProcess(t, "")
+
+	collector := NewSupervised(zap.NewNop(), []string{"./test/valid.yaml"}, "./logging.yaml", 0, nil)
+	err := collector.Run(context.Background())
+	require.NoError(t, err)
+	defer collector.Stop()
+
+	err = collector.Run(context.Background())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "service already running")
+}
+
+func TestSupervisedRestart(t *testing.T) {
+	useHelperProcess(t, "")
+
+	collector := NewSupervised(zap.NewNop(), []string{"./test/valid.yaml"}, "./logging.yaml", 0, nil)
+	err := collector.Run(context.Background())
+	require.NoError(t, err)
+	defer collector.Stop()
+
+	status := <-collector.Status()
+	require.True(t, status.Running)
+	pid := childPID(collector.(*supervisor))
+
+	err = collector.Restart(context.Background())
+	require.NoError(t, err)
+	require.True(t, collector.Running())
+	require.NotEqual(t, pid, childPID(collector.(*supervisor)))
+
+	status = <-collector.Status()
+	require.False(t, status.Running)
+
+	status = <-collector.Status()
+	require.True(t, status.Running)
+}
+
+func TestSupervisedProcessExits(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		testFunc func(*testing.T)
+	}{
+		{
+			desc: "Restarts a process that exited",
+			testFunc: func(t *testing.T) {
+				useHelperProcess(t, "exit")
+
+				collector := NewSupervised(zap.NewNop(), []string{"./test/valid.yaml"}, "./logging.yaml", 0, nil)
+				sup := collector.(*supervisor)
+				sup.restartBackOff = backoff.NewConstantBackOff(10 * time.Millisecond)
+
+				// Every process counts as stable so restarting never gives up
+				sup.stableDuration = 0
+
+				err := collector.Run(context.Background())
+				require.NoError(t, err)
+				defer collector.Stop()
+
+				status := <-collector.Status()
+				require.True(t, status.Running)
+				pid := childPID(sup)
+
+				require.Eventually(t, func() bool {
+					newPID := childPID(sup)
+					return newPID != 0 && newPID != pid
+				}, 20*time.Second, 10*time.Millisecond)
+
+				// Restarts aren't reported as the collector stopping
+				require.True(t, collector.Running())
+				require.Equal(t, 0, len(collector.Status()))
+			},
+		},
+		{
+			desc: "Reports stopped after repeated failures",
+			testFunc: func(t *testing.T) {
+				useHelperProcess(t, "exit")
+
+				collector := NewSupervised(zap.NewNop(), []string{"./test/valid.yaml"}, "./logging.yaml", 0, nil)
+				sup := collector.(*supervisor)
+				sup.restartBackOff = backoff.NewConstantBackOff(10 * time.Millisecond)
+				sup.maxRestartFailures = 2
+
+				err := collector.Run(context.Background())
+				require.NoError(t, err)
+				defer collector.Stop()
+
+				status := <-collector.Status()
+				require.True(t, status.Running)
+
+				select {
+				case status = <-collector.Status():
+				case <-time.After(20 * time.Second):
+					t.Fatal("timed out waiting for the collector to be reported as stopped")
+				}
+				require.False(t, status.Running)
+				require.Error(t, status.Err)
+				require.Contains(t, status.Err.Error(), "collector process failed 2 times in a row")
+				require.Contains(t, status.Err.Error(), "collector process exited unexpectedly")
+				require.False(t, collector.Running())
+				require.Zero(t, childPID(sup))
+			},
+		},
+		{
+			desc: "Stop cancels restarting",
+			testFunc: func(t *testing.T) {
+				useHelperProcess(t, "exit")
+
+				collector := NewSupervised(zap.NewNop(), []string{"./test/valid.yaml"}, "./logging.yaml", 0, nil)
+				sup := collector.(*supervisor)
+				sup.restartBackOff = backoff.NewConstantBackOff(time.Hour)
+
+				err := collector.Run(context.Background())
+				require.NoError(t, err)
+
+				status := <-collector.Status()
+				require.True(t, status.Running)
+
+				require.Eventually(t, func() bool {
+					return childPID(sup) == 0
+				}, 20*time.Second, 10*time.Millisecond)
+				require.True(t, collector.Running())
+
+				collector.Stop()
+				require.False(t, collector.Running())
+				status = <-collector.Status()
+				require.False(t, status.Running)
+				require.NoError(t, status.Err)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, tc.testFunc)
+	}
+}
+
+func TestSupervisedStopsResponding(t *testing.T) {
+	useHelperProcess(t, "hang")
+
+	collector := NewSupervised(zap.NewNop(), []string{"./test/valid.yaml"}, "./logging.yaml", 0, nil)
+	sup := collector.(*supervisor)
+	sup.heartbeatTimeout = 500 * time.Millisecond
+	sup.restartBackOff = backoff.NewConstantBackOff(10 * time.Millisecond)
+	sup.maxRestartFailures = 2
+
+	err := collector.Run(context.Background())
+	require.NoError(t, err)
+	defer collector.Stop()
+
+	status := <-collector.Status()
+	require.True(t, status.Running)
+	pid := childPID(sup)
+
+	// The process that stopped responding is replaced
+	require.Eventually(t, func() bool {
+		newPID := childPID(sup)
+		return newPID != 0 && newPID != pid
+	}, 10*time.Second, 10*time.Millisecond)
+	require.True(t, collector.Running())
+
+	select {
+	case status = <-collector.Status():
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the collector to be reported as stopped")
+	}
+	require.False(t, status.Running)
+	require.Contains(t, status.Err.Error(), "collector process stopped responding")
+	require.False(t, collector.Running())
+}
+
+func TestSupervisedMemoryLimit(t *testing.T) {
+	useHelperProcess(t, "memory")
+
+	collector := NewSupervised(zap.NewNop(), []string{"./test/valid.yaml"}, "./logging.yaml", 1<<30, nil)
+	collector.(*supervisor).restartBackOff = backoff.NewConstantBackOff(10 * time.Millisecond)
+
+	err := collector.Run(context.Background())
+	require.NoError(t, err)
+	defer collector.Stop()
+
+	status := <-collector.Status()
+	require.True(t, status.Running)
+	pid := childPID(collector.(*supervisor))
+
+	require.Eventually(t, func() bool {
+		newPID := childPID(collector.(*supervisor))
+		return newPID != 0 && newPID != pid
+	}, 20*time.Second, 50*time.Millisecond)
+
+	// Restarts to enforce the limit aren't reported as the collector stopping
+	require.True(t, collector.Running())
+	require.Equal(t, 0, len(collector.Status()))
+}
+
+func TestSupervisedLoggingOpts(t *testing.T) {
+	collector := NewSupervised(zap.NewNop(), []string{"./test/valid.yaml"}, "./logging.yaml", 0, nil)
+	require.Nil(t, collector.GetLoggingOpts())
+
+	// Options may be set while they're read elsewhere
+	opts := []zap.Option{zap.AddCaller()}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		collector.SetLoggingOpts(opts)
+	}()
+	_ = collector.GetLoggingOpts()
+	<-done
+
+	require.Equal(t, opts, collector.GetLoggingOpts())
+}
+
+func TestSupervisedPrematureStop(t *testing.T) {
+	collector := NewSupervised(zap.NewNop(), []string{"./test/valid.yaml"}, "./logging.yaml", 0, nil)
+	collector.Stop()
+	require.Equal(t, 0, len(collector.Status()))
+}
+
+func TestSupervisedValidateConfig(t *testing.T) {
+	collector := NewSupervised(zap.NewNop(), []string{"./test/valid.yaml"}, "./logging.yaml", 0, nil)
+	require.NoError(t, collector.ValidateConfigFiles(context.Background()))
+
+	err := collector.ValidateConfig(context.Background(), []byte("receivers: [unclosed"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "cannot resolve the configuration")
+}
+
+// acceptSupervised listens on a socket for RunSupervised and returns the accepted connection
+func acceptSupervised(t *testing.T) (string, <-chan net.Conn) {
+	socket := filepath.Join(t.TempDir(), healthSocketName)
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			accepted <- conn
+		}
+	}()
+	return socket, accepted
+}
+
+func TestRunSupervised(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		testFunc func(*testing.T)
+	}{
+		{
+			desc: "Stops when the supervisor sends stop",
+			testFunc: func(t *testing.T) {
+				socket, accepted := acceptSupervised(t)
+				col := New([]string{"./test/valid.yaml"}, "0.0.0", nil)
+
+				errChan := make(chan error, 1)
+				go func() { errChan <- RunSupervised(context.Background(), socket, col) }()
+
+				conn := <-accepted
+				defer conn.Close()
+
+				var msg healthMessage
+				scanner := bufio.NewScanner(conn)
+				require.True(t, scanner.Scan())
+				require.NoError(t, json.Unmarshal(scanner.Bytes(), &msg))
+				require.True(t, msg.Running)
+				require.NotZero(t, msg.Memory)
+
+				require.NoError(t, json.NewEncoder(conn).Encode(supervisorCommand{Command: commandStop}))
+				require.NoError(t, <-errChan)
+				require.False(t, col.Running())
+			},
+		},
+		{
+			desc: "Stops when the supervisor goes away",
+			testFunc: func(t *testing.T) {
+				socket, accepted := acceptSupervised(t)
+				col := New([]string{"./test/valid.yaml"}, "0.0.0", nil)
+
+				errChan := make(chan error, 1)
+				go func() { errChan <- RunSupervised(context.Background(), socket, col) }()
+
+				conn := <-accepted
+				scanner := bufio.NewScanner(conn)
+				require.True(t, scanner.Scan())
+				require.NoError(t, conn.Close())
+
+				require.ErrorIs(t, <-errChan, errSupervisorGone)
+				require.False(t, col.Running())
+			},
+		},
+		{
+			desc: "Reports the collector failing to start",
+			testFunc: func(t *testing.T) {
+				socket, accepted := acceptSupervised(t)
+				col := New([]string{"./test/invalid.yaml"}, "0.0.0", nil)
+
+				errChan := make(chan error, 1)
+				go func() { errChan <- RunSupervised(context.Background(), socket, col) }()
+
+				conn := <-accepted
+				defer conn.Close()
+
+				var msg healthMessage
+				scanner := bufio.NewScanner(conn)
+				require.True(t, scanner.Scan())
+				require.NoError(t, json.Unmarshal(scanner.Bytes(), &msg))
+				require.False(t, msg.Running)
+				require.Contains(t, msg.Error, "cannot build pipelines")
+
+				require.Error(t, <-errChan)
+			},
+		},
+		{
+			desc: "Returns an error if the supervisor isn't listening",
+			testFunc: func(t *testing.T) {
+				col := New([]string{"./test/valid.yaml"}, "0.0.0", nil)
+				err := RunSupervised(context.Background(), filepath.Join(t.TempDir(), healthSocketName), col)
+				require.Error(t, err)
+				require.Contains(t, err.Error(), "failed to connect to supervisor")
+				require.False(t, col.Running())
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, tc.testFunc)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/observiq/observiq-otel-collector/factories"
+	"go.opentelemetry.io/collector/confmap"
+	"go.opentelemetry.io/collector/confmap/converter/expandconverter"
+	"go.opentelemetry.io/collector/confmap/provider/fileprovider"
+	"go.opentelemetry.io/collector/confmap/provider/yamlprovider"
+	"go.opentelemetry.io/collector/service"
+)
+
+// ValidateConfig parses the config contents and validates them against the registered factories without running them.
+// The returned error identifies the component or pipeline that is invalid.
+func (c *collector) ValidateConfig(ctx context.Context, contents []byte) error {
+	return validateConfig(ctx, contents)
+}
+
+// ValidateConfigFiles validates the config files the collector runs with, as they are now, without running them
+func (c *collector) ValidateConfigFiles(ctx context.Context) error {
+	return validateLocations(ctx, c.getConfigPaths())
+}
+
+// validateConfig resolves and validates the contents the same way the collector does on startup
+func validateConfig(ctx context.Context, contents []byte) error {
+	return validateLocations(ctx, []string{fmt.Sprintf("%s:%s", yamlprovider.New().Scheme(), contents)})
+}
+
+// validateLocations resolves and validates the config at the locations the same way the collector does on startup
+func validateLocations(ctx context.Context, locations []string) error {
+	factories, err := factories.DefaultFactories()
+	if err != nil {
+		return fmt.Errorf("failed to load factories: %w", err)
+	}
+
+	ymp := yamlprovider.New()
+	fmp := fileprovider.New()
+	provider, err := service.NewConfigProvider(service.ConfigProviderSettings{
+		Locations: locations,
+		MapProviders: map[string]confmap.Provider{
+			ymp.Scheme(): ymp,
+			fmp.Scheme(): fmp,
+		},
+		MapConverters: []confmap.Converter{expandconverter.New()},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create config provider: %w", err)
+	}
+	defer func() { _ = provider.Shutdown(ctx) }()
+
+	if _, err := provider.Get(ctx, factories); err != nil {
+		return err
+	}
+
+	return nil
+}
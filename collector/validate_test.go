@@ -0,0 +1,147 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollectorValidateConfig(t *testing.T) {
+	validContents, err := os.ReadFile("./test/valid.yaml")
+	require.NoError(t, err)
+
+	testCases := []struct {
+		desc        string
+		contents    []byte
+		expectedErr string
+	}{
+		{
+			desc:     "Valid config",
+			contents: validContents,
+		},
+		{
+			desc:        "Invalid yaml",
+			contents:    []byte("receivers: [unclosed"),
+			expectedErr: "cannot resolve the configuration",
+		},
+		{
+			desc: "Unknown component type",
+			contents: []byte(`
+receivers:
+  unknown:
+exporters:
+  nop:
+service:
+  pipelines:
+    logs:
+      receivers: [unknown]
+      exporters: [nop]
+`),
+			expectedErr: `unknown receivers type "unknown"`,
+		},
+		{
+			desc: "Invalid component config",
+			contents: []byte(`
+receivers:
+  hostmetrics:
+    collection_interval: never
+exporters:
+  nop:
+service:
+  pipelines:
+    metrics:
+      receivers: [hostmetrics]
+      exporters: [nop]
+`),
+			expectedErr: `error reading receivers configuration for "hostmetrics"`,
+		},
+		{
+			desc: "Broken pipeline",
+			contents: []byte(`
+receivers:
+  filelog:
+    include: ["./var/log/syslog.log"]
+exporters:
+  nop:
+service:
+  pipelines:
+    logs:
+      receivers: [filelog]
+      exporters: [missing]
+`),
+			expectedErr: `pipeline "logs" references exporter "missing" which does not exist`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			collector := New(nil, "0.0.0", nil)
+			err := collector.ValidateConfig(context.Background(), tc.contents)
+			if tc.expectedErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tc.expectedErr)
+		})
+	}
+}
+
+func TestCollectorValidateConfigFiles(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		configPaths func(t *testing.T) []string
+		expectedErr string
+	}{
+		{
+			desc: "Valid config",
+			configPaths: func(*testing.T) []string {
+				return []string{"./test/valid.yaml"}
+			},
+		},
+		{
+			desc: "Invalid config",
+			configPaths: func(t *testing.T) []string {
+				path := filepath.Join(t.TempDir(), "config.yaml")
+				require.NoError(t, os.WriteFile(path, []byte("receivers: [unclosed"), 0600))
+				return []string{path}
+			},
+			expectedErr: "cannot resolve the configuration",
+		},
+		{
+			desc: "Missing config",
+			configPaths: func(t *testing.T) []string {
+				return []string{filepath.Join(t.TempDir(), "config.yaml")}
+			},
+			expectedErr: "cannot resolve the configuration",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			collector := New(tc.configPaths(t), "0.0.0", nil)
+			err := collector.ValidateConfigFiles(context.Background())
+			if tc.expectedErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tc.expectedErr)
+		})
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package admin contains a local API for checking on and acting on a running collector
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/observiq/observiq-otel-collector/collector"
+	"github.com/observiq/observiq-otel-collector/opamp"
+)
+
+// DefaultSocketMode only allows the user running the collector to use the API
+const DefaultSocketMode os.FileMode = 0600
+
+// Modes the collector runs in
+const (
+	ModeManaged    = "managed"
+	ModeStandalone = "standalone"
+)
+
+// Config configures where the API listens. The API is disabled unless a socket or address is set.
+type Config struct {
+	// Socket is the path of the unix socket the API listens on
+	Socket string
+
+	// SocketMode is the file mode of the socket, which limits who can use the API
+	SocketMode os.FileMode
+
+	// Address is the localhost address and port the API listens on instead of a socket
+	Address string
+
+	// ConfigPaths are the configs reported in the status, keyed by name
+	ConfigPaths map[string]string
+}
+
+// Enabled returns true if the API should listen on a socket or address
+func (c Config) Enabled() bool {
+	return c.Socket != "" || c.Address != ""
+}
+
+// Validate checks only one of the socket or address is set and the address is on the loopback interface
+func (c Config) Validate() error {
+	switch {
+	case c.Socket != "" && c.Address != "":
+		return errors.New("admin socket and address must not both be set")
+	case c.Address != "":
+		host, _, err := net.SplitHostPort(c.Address)
+		if err != nil {
+			return fmt.Errorf("invalid admin address: %w", err)
+		}
+		if !isLoopback(host) {
+			return fmt.Errorf("admin address %s must be on localhost", c.Address)
+		}
+	}
+	return nil
+}
+
+// network returns the network and address the API listens on
+func (c Config) network() (string, string) {
+	if c.Socket != "" {
+		return "unix", c.Socket
+	}
+	return "tcp", c.Address
+}
+
+// isLoopback returns true if the host only resolves to the loopback interface
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Service is the service running the collector that the API reports on and acts on
+type Service interface {
+	// CollectorStatus returns the most recent status of the collector, or nil if it hasn't been run
+	CollectorStatus() *collector.Status
+
+	// RestartCollector restarts the collector with its current configs
+	RestartCollector(ctx context.Context) error
+}
+
+// ConnectionReporter is implemented by services connected to an OpAMP server
+type ConnectionReporter interface {
+	// ConnectionStatus returns the current status of the connection to the server
+	ConnectionStatus() opamp.ConnectionStatus
+}
+
+// Status is what the collector is doing, returned by the status endpoint
+type Status struct {
+	Version   VersionInfo      `json:"version"`
+	Mode      string           `json:"mode"`
+	Collector CollectorStatus  `json:"collector"`
+	Configs   []ConfigStatus   `json:"configs"`
+	OpAMP     *ConnectionState `json:"opamp,omitempty"`
+
+	// LogLevel is the level set through the API, which overrides the configured level. Empty if not overridden.
+	LogLevel string `json:"log_level,omitempty"`
+}
+
+// VersionInfo identifies the build of the collector
+type VersionInfo struct {
+	Version string `json:"version"`
+	Commit  string `json:"commit"`
+	Date    string `json:"date"`
+}
+
+// CollectorStatus is the most recent status of the collector
+type CollectorStatus struct {
+	Running bool   `json:"running"`
+	Error   string `json:"error,omitempty"`
+}
+
+// ConfigStatus is the path and hash of a config. Error is set if the config couldn't be read.
+type ConfigStatus struct {
+	Name  string `json:"name"`
+	Path  string `json:"path"`
+	Hash  string `json:"hash,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// ConnectionState is the state of the connection to the OpAMP server
+type ConnectionState struct {
+	State       opamp.ConnectionState `json:"state"`
+	Endpoint    string                `json:"endpoint,omitempty"`
+	Since       time.Time             `json:"since"`
+	Attempts    int                   `json:"attempts,omitempty"`
+	LastError   string                `json:"last_error,omitempty"`
+	NextAttempt *time.Time            `json:"next_attempt,omitempty"`
+}
+
+// logLevelRequest changes the log level. An empty level returns to the configured level.
+type logLevelRequest struct {
+	Level string `json:"level"`
+}
+
+// errorResponse is returned when a request fails
+type errorResponse struct {
+	Error string `json:"error"`
+}
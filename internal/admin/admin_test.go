@@ -0,0 +1,86 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package admin
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigValidate(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		cfg         Config
+		enabled     bool
+		expectedErr string
+	}{
+		{
+			desc: "Disabled",
+		},
+		{
+			desc:    "Socket",
+			cfg:     Config{Socket: "/tmp/admin.sock"},
+			enabled: true,
+		},
+		{
+			desc:    "Localhost address",
+			cfg:     Config{Address: "localhost:9999"},
+			enabled: true,
+		},
+		{
+			desc:    "Loopback IPv6 address",
+			cfg:     Config{Address: "[::1]:9999"},
+			enabled: true,
+		},
+		{
+			desc:        "Socket and address",
+			cfg:         Config{Socket: "/tmp/admin.sock", Address: "localhost:9999"},
+			enabled:     true,
+			expectedErr: "admin socket and address must not both be set",
+		},
+		{
+			desc:        "Address on all interfaces",
+			cfg:         Config{Address: ":9999"},
+			enabled:     true,
+			expectedErr: "admin address :9999 must be on localhost",
+		},
+		{
+			desc:        "Remote address",
+			cfg:         Config{Address: "10.0.0.5:9999"},
+			enabled:     true,
+			expectedErr: "admin address 10.0.0.5:9999 must be on localhost",
+		},
+		{
+			desc:        "Missing port",
+			cfg:         Config{Address: "localhost"},
+			enabled:     true,
+			expectedErr: "invalid admin address",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			assert.Equal(t, tc.enabled, tc.cfg.Enabled())
+
+			err := tc.cfg.Validate()
+			if tc.expectedErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tc.expectedErr)
+			}
+		})
+	}
+}
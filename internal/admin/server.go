@@ -0,0 +1,341 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package admin
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/observiq/observiq-otel-collector/internal/logging"
+	"github.com/observiq/observiq-otel-collector/internal/version"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Paths served by the API
+const (
+	statusPath   = "/status"
+	healthPath   = "/health"
+	restartPath  = "/restart"
+	logLevelPath = "/log-level"
+)
+
+// restartTimeout bounds how long the collector may take to start after a restart
+const restartTimeout = 30 * time.Second
+
+// Server serves the API on a unix socket or localhost address
+type Server struct {
+	logger     *zap.Logger
+	cfg        Config
+	svc        Service
+	httpServer *http.Server
+	listener   net.Listener
+	serveDone  chan struct{}
+}
+
+// NewServer creates a server for the service. It doesn't listen until started.
+func NewServer(logger *zap.Logger, cfg Config, svc Service) (*Server, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		logger: logger.Named("admin"),
+		cfg:    cfg,
+		svc:    svc,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(statusPath, s.handleStatus)
+	mux.HandleFunc(healthPath, s.handleHealth)
+	mux.HandleFunc(restartPath, s.handleRestart)
+	mux.HandleFunc(logLevelPath, s.handleLogLevel)
+	s.httpServer = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	return s, nil
+}
+
+// Start listens on the socket or address and serves the API in the background
+func (s *Server) Start() error {
+	listener, err := s.listen()
+	if err != nil {
+		return err
+	}
+	s.listener = listener
+	s.serveDone = make(chan struct{})
+
+	go func() {
+		defer close(s.serveDone)
+		if err := s.httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error("Admin API stopped", zap.Error(err))
+		}
+	}()
+
+	s.logger.Info("Admin API listening", zap.String("address", listener.Addr().String()))
+	return nil
+}
+
+// listen creates the listener, replacing a socket left behind by a previous run and restricting it to the socket mode.
+// The socket is created accessible only by its owner so no one else can connect before the mode is set.
+func (s *Server) listen() (net.Listener, error) {
+	network, address := s.cfg.network()
+	if network == "unix" {
+		if err := removeStaleSocket(address); err != nil {
+			return nil, err
+		}
+	}
+
+	listener, err := listenRestricted(network, address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", address, err)
+	}
+
+	if network == "unix" {
+		mode := s.cfg.SocketMode
+		if mode == 0 {
+			mode = DefaultSocketMode
+		}
+		if err := os.Chmod(address, mode); err != nil {
+			_ = listener.Close()
+			return nil, fmt.Errorf("failed to set admin socket mode: %w", err)
+		}
+	}
+
+	return listener, nil
+}
+
+// listenRestricted listens with a restrictive umask for unix sockets
+func listenRestricted(network, address string) (net.Listener, error) {
+	if network == "unix" {
+		restore := restrictUmask()
+		defer restore()
+	}
+	return net.Listen(network, address)
+}
+
+// removeStaleSocket removes a socket at the path. Anything else at the path is left alone.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(filepath.Clean(path))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return nil
+	case err != nil:
+		return fmt.Errorf("failed to check admin socket: %w", err)
+	case info.Mode()&os.ModeSocket == 0:
+		return fmt.Errorf("admin socket %s exists and is not a socket", path)
+	}
+
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to remove stale admin socket: %w", err)
+	}
+	return nil
+}
+
+// Stop stops serving the API, waiting for requests in progress until the context is done
+func (s *Server) Stop(ctx context.Context) error {
+	if s.listener == nil {
+		return nil
+	}
+
+	if err := s.httpServer.Shutdown(ctx); err != nil {
+		return fmt.Errorf("failed to stop admin API: %w", err)
+	}
+	<-s.serveDone
+	return nil
+}
+
+// handleStatus returns what the collector is doing
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	writeJSON(w, http.StatusOK, s.status())
+}
+
+// handleHealth returns OK while the collector is running and service unavailable otherwise
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	collectorStatus := s.collectorStatus()
+	code := http.StatusOK
+	if !collectorStatus.Running {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, collectorStatus)
+}
+
+// handleRestart restarts the collector
+func (s *Server) handleRestart(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	s.logger.Info("Restarting collector from admin API")
+	ctx, cancel := context.WithTimeout(r.Context(), restartTimeout)
+	defer cancel()
+
+	if err := s.svc.RestartCollector(ctx); err != nil {
+		s.logger.Error("Failed to restart collector from admin API", zap.Error(err))
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, s.collectorStatus())
+}
+
+// handleLogLevel overrides the log level, or returns to the configured level if the level is empty
+func (s *Server) handleLogLevel(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	var req logLevelRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024)).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("invalid request: %s", err)})
+		return
+	}
+
+	if req.Level == "" {
+		logging.ClearLevel()
+		s.logger.Info("Log level returned to configured level from admin API")
+		writeJSON(w, http.StatusOK, logLevelRequest{Level: logLevelOverride()})
+		return
+	}
+
+	var level zapcore.Level
+	if err := level.UnmarshalText([]byte(req.Level)); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("invalid level: %s", req.Level)})
+		return
+	}
+
+	logging.SetLevel(level)
+	s.logger.Info("Log level changed from admin API", zap.Stringer("level", level))
+	writeJSON(w, http.StatusOK, logLevelRequest{Level: logLevelOverride()})
+}
+
+// status collects the status returned by the status endpoint
+func (s *Server) status() Status {
+	status := Status{
+		Version: VersionInfo{
+			Version: version.Version(),
+			Commit:  version.GitHash(),
+			Date:    version.Date(),
+		},
+		Mode:      ModeStandalone,
+		Collector: s.collectorStatus(),
+		Configs:   configStatuses(s.cfg.ConfigPaths),
+		LogLevel:  logLevelOverride(),
+	}
+
+	if reporter, ok := s.svc.(ConnectionReporter); ok {
+		status.Mode = ModeManaged
+		status.OpAMP = connectionState(reporter)
+	}
+	return status
+}
+
+// collectorStatus returns the most recent status of the collector
+func (s *Server) collectorStatus() CollectorStatus {
+	status := s.svc.CollectorStatus()
+	if status == nil {
+		return CollectorStatus{}
+	}
+
+	collectorStatus := CollectorStatus{Running: status.Running}
+	if status.Err != nil {
+		collectorStatus.Error = status.Err.Error()
+	}
+	return collectorStatus
+}
+
+// configStatuses returns the path and hash of each config sorted by name
+func configStatuses(configPaths map[string]string) []ConfigStatus {
+	statuses := make([]ConfigStatus, 0, len(configPaths))
+	for name, path := range configPaths {
+		status := ConfigStatus{Name: name, Path: path}
+
+		contents, err := os.ReadFile(filepath.Clean(path))
+		if err != nil {
+			status.Error = err.Error()
+		} else {
+			hash := sha256.Sum256(contents)
+			status.Hash = hex.EncodeToString(hash[:])
+		}
+		statuses = append(statuses, status)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
+
+// connectionState returns the state of the connection to the OpAMP server
+func connectionState(reporter ConnectionReporter) *ConnectionState {
+	connStatus := reporter.ConnectionStatus()
+	state := &ConnectionState{
+		State:     connStatus.State,
+		Endpoint:  connStatus.Endpoint,
+		Since:     connStatus.Since,
+		Attempts:  connStatus.Attempts,
+		LastError: connStatus.LastError,
+	}
+	if !connStatus.NextAttempt.IsZero() {
+		nextAttempt := connStatus.NextAttempt
+		state.NextAttempt = &nextAttempt
+	}
+	return state
+}
+
+// logLevelOverride returns the log level set through the API, or empty if the configured level is used
+func logLevelOverride() string {
+	level, ok := logging.LevelOverride()
+	if !ok {
+		return ""
+	}
+	return level.String()
+}
+
+// allowMethod writes method not allowed and returns false if the request doesn't use the method
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+
+	w.Header().Set("Allow", method)
+	writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: fmt.Sprintf("method %s not allowed", r.Method)})
+	return false
+}
+
+// writeJSON writes the value as the JSON response body with the status code
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,439 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package admin
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/observiq/observiq-otel-collector/collector"
+	"github.com/observiq/observiq-otel-collector/internal/logging"
+	"github.com/observiq/observiq-otel-collector/internal/version"
+	"github.com/observiq/observiq-otel-collector/opamp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// fakeService reports the status it's set to and counts restarts
+type fakeService struct {
+	status     *collector.Status
+	restartErr error
+	restarts   int32
+}
+
+func (f *fakeService) CollectorStatus() *collector.Status {
+	return f.status
+}
+
+func (f *fakeService) RestartCollector(context.Context) error {
+	atomic.AddInt32(&f.restarts, 1)
+	return f.restartErr
+}
+
+// fakeManagedService is a service connected to an OpAMP server
+type fakeManagedService struct {
+	*fakeService
+	connStatus opamp.ConnectionStatus
+}
+
+func (f *fakeManagedService) ConnectionStatus() opamp.ConnectionStatus {
+	return f.connStatus
+}
+
+// startTestServer starts a server on a localhost port for the service and stops it when the test ends
+func startTestServer(t *testing.T, cfg Config, svc Service) *Server {
+	if !cfg.Enabled() {
+		cfg.Address = "127.0.0.1:0"
+	}
+
+	s, err := NewServer(zap.NewNop(), cfg, svc)
+	require.NoError(t, err)
+	require.NoError(t, s.Start())
+	t.Cleanup(func() { require.NoError(t, s.Stop(context.Background())) })
+	return s
+}
+
+// doRequest sends a request to the server and returns the status code and body
+func doRequest(t *testing.T, s *Server, method, path, body string) (int, string) {
+	addr := s.listener.Addr()
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, addr.Network(), addr.String())
+			},
+		},
+	}
+	defer client.CloseIdleConnections()
+
+	req, err := http.NewRequest(method, "http://admin"+path, strings.NewReader(body))
+	require.NoError(t, err)
+
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, string(respBody)
+}
+
+// shortTempDir creates a temp dir for sockets, whose paths are limited in length
+func shortTempDir(t *testing.T) string {
+	dir, err := os.MkdirTemp("", "admin")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func TestServerStatus(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		testFunc func(*testing.T)
+	}{
+		{
+			desc: "Standalone",
+			testFunc: func(t *testing.T) {
+				dir := t.TempDir()
+				configPath := filepath.Join(dir, "config.yaml")
+				contents := []byte("receivers:\n")
+				require.NoError(t, os.WriteFile(configPath, contents, 0600))
+				hash := sha256.Sum256(contents)
+
+				svc := &fakeService{status: &collector.Status{Running: true}}
+				s := startTestServer(t, Config{
+					ConfigPaths: map[string]string{
+						"logging.yaml":   filepath.Join(dir, "logging.yaml"),
+						"collector.yaml": configPath,
+					},
+				}, svc)
+
+				code, body := doRequest(t, s, http.MethodGet, statusPath, "")
+				require.Equal(t, http.StatusOK, code)
+
+				var status Status
+				require.NoError(t, json.Unmarshal([]byte(body), &status))
+				assert.Equal(t, VersionInfo{Version: version.Version(), Commit: version.GitHash(), Date: version.Date()}, status.Version)
+				assert.Equal(t, ModeStandalone, status.Mode)
+				assert.Equal(t, CollectorStatus{Running: true}, status.Collector)
+				assert.Nil(t, status.OpAMP)
+				assert.Empty(t, status.LogLevel)
+
+				require.Len(t, status.Configs, 2)
+				assert.Equal(t, ConfigStatus{Name: "collector.yaml", Path: configPath, Hash: hex.EncodeToString(hash[:])}, status.Configs[0])
+				assert.Equal(t, "logging.yaml", status.Configs[1].Name)
+				assert.Empty(t, status.Configs[1].Hash)
+				assert.NotEmpty(t, status.Configs[1].Error)
+			},
+		},
+		{
+			desc: "Managed",
+			testFunc: func(t *testing.T) {
+				since := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+				nextAttempt := since.Add(time.Minute)
+				svc := &fakeManagedService{
+					fakeService: &fakeService{status: &collector.Status{Running: false, Err: errors.New("cannot build pipelines")}},
+					connStatus: opamp.ConnectionStatus{
+						State:       opamp.ConnectionStateBackoff,
+						Endpoint:    "wss://opamp.example.com/v1/opamp",
+						Since:       since,
+						Attempts:    3,
+						LastError:   "connection refused",
+						NextAttempt: nextAttempt,
+					},
+				}
+				s := startTestServer(t, Config{}, svc)
+
+				code, body := doRequest(t, s, http.MethodGet, statusPath, "")
+				require.Equal(t, http.StatusOK, code)
+
+				var status Status
+				require.NoError(t, json.Unmarshal([]byte(body), &status))
+				assert.Equal(t, ModeManaged, status.Mode)
+				assert.Equal(t, CollectorStatus{Running: false, Error: "cannot build pipelines"}, status.Collector)
+				assert.Empty(t, status.Configs)
+
+				require.NotNil(t, status.OpAMP)
+				assert.Equal(t, opamp.ConnectionStateBackoff, status.OpAMP.State)
+				assert.Equal(t, "wss://opamp.example.com/v1/opamp", status.OpAMP.Endpoint)
+				assert.True(t, since.Equal(status.OpAMP.Since))
+				assert.Equal(t, 3, status.OpAMP.Attempts)
+				assert.Equal(t, "connection refused", status.OpAMP.LastError)
+				require.NotNil(t, status.OpAMP.NextAttempt)
+				assert.True(t, nextAttempt.Equal(*status.OpAMP.NextAttempt))
+			},
+		},
+		{
+			desc: "Method not allowed",
+			testFunc: func(t *testing.T) {
+				s := startTestServer(t, Config{}, &fakeService{})
+
+				code, body := doRequest(t, s, http.MethodPost, statusPath, "")
+				assert.Equal(t, http.StatusMethodNotAllowed, code)
+				assert.Contains(t, body, "method POST not allowed")
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, tc.testFunc)
+	}
+}
+
+func TestServerHealth(t *testing.T) {
+	testCases := []struct {
+		desc         string
+		status       *collector.Status
+		expectedCode int
+	}{
+		{
+			desc:         "Collector running",
+			status:       &collector.Status{Running: true},
+			expectedCode: http.StatusOK,
+		},
+		{
+			desc:         "Collector stopped",
+			status:       &collector.Status{Running: false, Err: errors.New("exporter failed")},
+			expectedCode: http.StatusServiceUnavailable,
+		},
+		{
+			desc:         "Collector not started",
+			expectedCode: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			s := startTestServer(t, Config{}, &fakeService{status: tc.status})
+
+			code, _ := doRequest(t, s, http.MethodGet, healthPath, "")
+			assert.Equal(t, tc.expectedCode, code)
+		})
+	}
+}
+
+func TestServerRestart(t *testing.T) {
+	testCases := []struct {
+		desc         string
+		restartErr   error
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			desc:         "Collector restarts",
+			expectedCode: http.StatusOK,
+			expectedBody: `{"running":true}`,
+		},
+		{
+			desc:         "Collector fails to restart",
+			restartErr:   errors.New("failed to restart collector: address already in use"),
+			expectedCode: http.StatusInternalServerError,
+			expectedBody: `{"error":"failed to restart collector: address already in use"}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			svc := &fakeService{status: &collector.Status{Running: true}, restartErr: tc.restartErr}
+			s := startTestServer(t, Config{}, svc)
+
+			code, body := doRequest(t, s, http.MethodPost, restartPath, "")
+			assert.Equal(t, tc.expectedCode, code)
+			assert.JSONEq(t, tc.expectedBody, body)
+			assert.Equal(t, int32(1), atomic.LoadInt32(&svc.restarts))
+
+			// Restarting is only allowed with POST
+			code, _ = doRequest(t, s, http.MethodGet, restartPath, "")
+			assert.Equal(t, http.StatusMethodNotAllowed, code)
+			assert.Equal(t, int32(1), atomic.LoadInt32(&svc.restarts))
+		})
+	}
+}
+
+func TestServerLogLevel(t *testing.T) {
+	t.Cleanup(logging.ClearLevel)
+	s := startTestServer(t, Config{}, &fakeService{})
+
+	code, body := doRequest(t, s, http.MethodPost, logLevelPath, `{"level":"debug"}`)
+	require.Equal(t, http.StatusOK, code)
+	assert.JSONEq(t, `{"level":"debug"}`, body)
+
+	level, ok := logging.LevelOverride()
+	require.True(t, ok)
+	assert.Equal(t, "debug", level.String())
+
+	_, body = doRequest(t, s, http.MethodGet, statusPath, "")
+	assert.Contains(t, body, `"log_level":"debug"`)
+
+	code, body = doRequest(t, s, http.MethodPost, logLevelPath, `{"level":"loud"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.JSONEq(t, `{"error":"invalid level: loud"}`, body)
+
+	code, _ = doRequest(t, s, http.MethodPost, logLevelPath, `level=debug`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	// An empty level returns to the configured level
+	code, body = doRequest(t, s, http.MethodPost, logLevelPath, `{"level":""}`)
+	require.Equal(t, http.StatusOK, code)
+	assert.JSONEq(t, `{"level":""}`, body)
+
+	_, ok = logging.LevelOverride()
+	assert.False(t, ok)
+}
+
+func TestServerSocket(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		testFunc func(*testing.T)
+	}{
+		{
+			desc: "Serves status over the socket",
+			testFunc: func(t *testing.T) {
+				socket := filepath.Join(shortTempDir(t), "admin.sock")
+				cfg := Config{Socket: socket}
+
+				s, err := NewServer(zap.NewNop(), cfg, &fakeService{status: &collector.Status{Running: true}})
+				require.NoError(t, err)
+				require.NoError(t, s.Start())
+
+				if runtime.GOOS != "windows" {
+					info, err := os.Stat(socket)
+					require.NoError(t, err)
+					assert.Equal(t, DefaultSocketMode, info.Mode().Perm())
+				}
+
+				status, err := FetchStatus(context.Background(), cfg)
+				require.NoError(t, err)
+				assert.True(t, status.Collector.Running)
+
+				require.NoError(t, s.Stop(context.Background()))
+				_, err = os.Stat(socket)
+				assert.True(t, errors.Is(err, os.ErrNotExist))
+			},
+		},
+		{
+			desc: "Socket mode",
+			testFunc: func(t *testing.T) {
+				if runtime.GOOS == "windows" {
+					t.Skip("file modes aren't supported on windows")
+				}
+
+				socket := filepath.Join(shortTempDir(t), "admin.sock")
+				startTestServer(t, Config{Socket: socket, SocketMode: 0660}, &fakeService{})
+
+				info, err := os.Stat(socket)
+				require.NoError(t, err)
+				assert.Equal(t, os.FileMode(0660), info.Mode().Perm())
+			},
+		},
+		{
+			desc: "Replaces a stale socket",
+			testFunc: func(t *testing.T) {
+				socket := filepath.Join(shortTempDir(t), "admin.sock")
+
+				// A listener that isn't unlinked on close leaves the socket behind, like a collector that crashed
+				stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: socket, Net: "unix"})
+				require.NoError(t, err)
+				stale.SetUnlinkOnClose(false)
+				require.NoError(t, stale.Close())
+
+				startTestServer(t, Config{Socket: socket}, &fakeService{})
+
+				_, err = FetchStatus(context.Background(), Config{Socket: socket})
+				require.NoError(t, err)
+			},
+		},
+		{
+			desc: "Doesn't replace a file",
+			testFunc: func(t *testing.T) {
+				path := filepath.Join(shortTempDir(t), "admin.sock")
+				require.NoError(t, os.WriteFile(path, []byte("not a socket"), 0600))
+
+				s, err := NewServer(zap.NewNop(), Config{Socket: path}, &fakeService{})
+				require.NoError(t, err)
+				assert.ErrorContains(t, s.Start(), "exists and is not a socket")
+
+				contents, err := os.ReadFile(path)
+				require.NoError(t, err)
+				assert.Equal(t, "not a socket", string(contents))
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, tc.testFunc)
+	}
+}
+
+func TestNewServerInvalidConfig(t *testing.T) {
+	s, err := NewServer(zap.NewNop(), Config{Address: "0.0.0.0:9999"}, &fakeService{})
+	assert.EqualError(t, err, "admin address 0.0.0.0:9999 must be on localhost")
+	assert.Nil(t, s)
+}
+
+func TestFetchStatus(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		testFunc func(*testing.T)
+	}{
+		{
+			desc: "Over localhost",
+			testFunc: func(t *testing.T) {
+				s := startTestServer(t, Config{}, &fakeService{status: &collector.Status{Running: true}})
+
+				status, err := FetchStatus(context.Background(), Config{Address: s.listener.Addr().String()})
+				require.NoError(t, err)
+				assert.Equal(t, ModeStandalone, status.Mode)
+				assert.True(t, status.Collector.Running)
+			},
+		},
+		{
+			desc: "Not configured",
+			testFunc: func(t *testing.T) {
+				status, err := FetchStatus(context.Background(), Config{})
+				assert.EqualError(t, err, "admin socket or address must be set")
+				assert.Nil(t, status)
+			},
+		},
+		{
+			desc: "Not listening",
+			testFunc: func(t *testing.T) {
+				socket := filepath.Join(shortTempDir(t), "admin.sock")
+
+				status, err := FetchStatus(context.Background(), Config{Socket: socket})
+				assert.ErrorContains(t, err, "failed to request status")
+				assert.Nil(t, status)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, tc.testFunc)
+	}
+}
@@ -0,0 +1,28 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+
+package admin
+
+import "syscall"
+
+// restrictUmask sets the umask so new files are only accessible by their owner and returns a function restoring it.
+// The umask is process wide, so it should only be held while creating the socket.
+func restrictUmask() func() {
+	previous := syscall.Umask(0077)
+	return func() {
+		syscall.Umask(previous)
+	}
+}
@@ -86,6 +86,9 @@ func (l *LoggerConfig) Options() ([]zap.Option, error) {
 		return nil, err
 	}
 
+	// Tee logs to the telemetry core so they can be forwarded to a destination set at runtime
+	core = zapcore.NewTee(core, newTelemetryCore(newOverridableLevel(l.Level)))
+
 	opt := zap.WrapCore(func(c zapcore.Core) zapcore.Core {
 		return core
 	})
@@ -96,11 +99,12 @@ func (l *LoggerConfig) Options() ([]zap.Option, error) {
 // core returns the logging core specified in the config.
 // An unknown output will return a nop core.
 func (l *LoggerConfig) core() (zapcore.Core, error) {
+	level := newOverridableLevel(l.Level)
 	switch l.Output {
 	case fileOutput:
-		return zapcore.NewCore(newEncoder(), zapcore.AddSync(l.File), l.Level), nil
+		return zapcore.NewCore(newEncoder(), zapcore.AddSync(l.File), level), nil
 	case stdOutput:
-		return zapcore.NewCore(newEncoder(), zapcore.Lock(os.Stdout), l.Level), nil
+		return zapcore.NewCore(newEncoder(), zapcore.Lock(os.Stdout), level), nil
 	default:
 		return nil, fmt.Errorf("unrecognized output type: %s", l.Output)
 	}
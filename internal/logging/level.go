@@ -0,0 +1,85 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"sync"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// levelOverride holds the level set at runtime.
+// It is shared by every logger created from a LoggerConfig so the level can change without recreating loggers.
+var levelOverride = &levelHolder{}
+
+// SetLevel overrides the configured level of every logger created from a LoggerConfig, including ones created later.
+// The override lasts until the process exits or ClearLevel is called.
+func SetLevel(level zapcore.Level) {
+	levelOverride.set(&level)
+}
+
+// ClearLevel removes the level override so loggers use their configured level again
+func ClearLevel() {
+	levelOverride.set(nil)
+}
+
+// LevelOverride returns the level set at runtime and true if the configured level is overridden
+func LevelOverride() (zapcore.Level, bool) {
+	level := levelOverride.get()
+	if level == nil {
+		return zapcore.InfoLevel, false
+	}
+	return *level, true
+}
+
+// levelHolder guards access to a level that may be swapped at any time
+type levelHolder struct {
+	mux   sync.RWMutex
+	level *zapcore.Level
+}
+
+func (h *levelHolder) set(level *zapcore.Level) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	h.level = level
+}
+
+func (h *levelHolder) get() *zapcore.Level {
+	h.mux.RLock()
+	defer h.mux.RUnlock()
+	return h.level
+}
+
+// overridableLevel enables the configured level unless the level is overridden at runtime
+type overridableLevel struct {
+	configured zapcore.Level
+	holder     *levelHolder
+}
+
+// newOverridableLevel returns a level enabler for the configured level that follows the runtime override
+func newOverridableLevel(configured zapcore.Level) *overridableLevel {
+	return &overridableLevel{
+		configured: configured,
+		holder:     levelOverride,
+	}
+}
+
+// Enabled returns true if the level is at or above the overridden level if set, otherwise the configured level
+func (o *overridableLevel) Enabled(level zapcore.Level) bool {
+	if override := o.holder.get(); override != nil {
+		return override.Enabled(level)
+	}
+	return o.configured.Enabled(level)
+}
@@ -0,0 +1,85 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestOverridableLevel(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		testFunc func(*testing.T)
+	}{
+		{
+			desc: "Configured level without override",
+			testFunc: func(t *testing.T) {
+				level := &overridableLevel{configured: zapcore.InfoLevel, holder: &levelHolder{}}
+
+				require.False(t, level.Enabled(zapcore.DebugLevel))
+				require.True(t, level.Enabled(zapcore.InfoLevel))
+			},
+		},
+		{
+			desc: "Override replaces configured level",
+			testFunc: func(t *testing.T) {
+				holder := &levelHolder{}
+				level := &overridableLevel{configured: zapcore.InfoLevel, holder: holder}
+
+				debug := zapcore.DebugLevel
+				holder.set(&debug)
+				require.True(t, level.Enabled(zapcore.DebugLevel))
+
+				errorLevel := zapcore.ErrorLevel
+				holder.set(&errorLevel)
+				require.False(t, level.Enabled(zapcore.WarnLevel))
+				require.True(t, level.Enabled(zapcore.ErrorLevel))
+
+				holder.set(nil)
+				require.False(t, level.Enabled(zapcore.DebugLevel))
+				require.True(t, level.Enabled(zapcore.WarnLevel))
+			},
+		},
+		{
+			desc: "Set and clear the shared override",
+			testFunc: func(t *testing.T) {
+				t.Cleanup(ClearLevel)
+
+				_, ok := LevelOverride()
+				require.False(t, ok)
+
+				level := newOverridableLevel(zapcore.InfoLevel)
+				SetLevel(zapcore.DebugLevel)
+
+				override, ok := LevelOverride()
+				require.True(t, ok)
+				require.Equal(t, zapcore.DebugLevel, override)
+				require.True(t, level.Enabled(zapcore.DebugLevel))
+
+				ClearLevel()
+				_, ok = LevelOverride()
+				require.False(t, ok)
+				require.False(t, level.Enabled(zapcore.DebugLevel))
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, tc.testFunc)
+	}
+}
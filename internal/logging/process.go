@@ -0,0 +1,91 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// processHolder holds the core the process's own loggers write to
+var processHolder = &coreHolder{}
+
+// NewProcessLogger creates the process's own logger with the options.
+// Loggers derived from it switch to the options set by SetProcessLoggingOpts, so a reloaded logging config applies to them.
+func NewProcessLogger(opts ...zap.Option) (*zap.Logger, error) {
+	if err := SetProcessLoggingOpts(opts...); err != nil {
+		return nil, err
+	}
+
+	return zap.New(&processCore{holder: processHolder}, zap.AddCaller(), zap.AddStacktrace(zapcore.ErrorLevel)), nil
+}
+
+// SetProcessLoggingOpts replaces the options of the logger created by NewProcessLogger
+func SetProcessLoggingOpts(opts ...zap.Option) error {
+	logger, err := zap.NewProduction(opts...)
+	if err != nil {
+		return err
+	}
+
+	processHolder.set(logger.Core())
+	return nil
+}
+
+// processCore writes to the core in the holder at the time of each entry
+type processCore struct {
+	holder *coreHolder
+	fields []zapcore.Field
+}
+
+// Enabled is true if the current core is enabled for the level
+func (p *processCore) Enabled(level zapcore.Level) bool {
+	return p.holder.get().Enabled(level)
+}
+
+// With adds fields to entries written to whichever core is current
+func (p *processCore) With(fields []zapcore.Field) zapcore.Core {
+	combined := make([]zapcore.Field, 0, len(p.fields)+len(fields))
+	combined = append(combined, p.fields...)
+	combined = append(combined, fields...)
+
+	return &processCore{
+		holder: p.holder,
+		fields: combined,
+	}
+}
+
+// Check lets the current core decide whether to write the entry, so its sampling still applies
+func (p *processCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	return p.current().Check(entry, checked)
+}
+
+// Write writes to the current core
+func (p *processCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	return p.current().Write(entry, fields)
+}
+
+// Sync syncs the current core
+func (p *processCore) Sync() error {
+	return p.holder.get().Sync()
+}
+
+// current returns the current core with the fields added to this one
+func (p *processCore) current() zapcore.Core {
+	core := p.holder.get()
+	if len(p.fields) > 0 {
+		core = core.With(p.fields)
+	}
+	return core
+}
@@ -0,0 +1,54 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestProcessLogger(t *testing.T) {
+	withCore := func(core zapcore.Core) zap.Option {
+		return zap.WrapCore(func(zapcore.Core) zapcore.Core { return core })
+	}
+
+	t.Cleanup(func() { processHolder.set(zapcore.NewNopCore()) })
+
+	firstCore, firstLogs := observer.New(zapcore.InfoLevel)
+	logger, err := NewProcessLogger(withCore(firstCore))
+	require.NoError(t, err)
+
+	named := logger.Named("service").With(zap.String("component", "test"))
+	named.Debug("filtered")
+	named.Info("first")
+
+	// Loggers already created switch to the new options
+	secondCore, secondLogs := observer.New(zapcore.DebugLevel)
+	require.NoError(t, SetProcessLoggingOpts(withCore(secondCore)))
+	named.Debug("second")
+
+	require.Equal(t, 1, firstLogs.Len())
+	require.Equal(t, "first", firstLogs.All()[0].Message)
+
+	require.Equal(t, 1, secondLogs.Len())
+	entry := secondLogs.All()[0]
+	require.Equal(t, "second", entry.Message)
+	require.Equal(t, "service", entry.LoggerName)
+	require.Equal(t, map[string]interface{}{"component": "test"}, entry.ContextMap())
+}
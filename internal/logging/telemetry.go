@@ -0,0 +1,116 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"sync"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// telemetryHolder holds the core that the collector's own logs are forwarded to.
+// It is shared by every logger created from a LoggerConfig so the destination can change without recreating loggers.
+var telemetryHolder = &coreHolder{}
+
+// SetTelemetryCore sets the core that the collector's own logs are forwarded to in addition to the configured output.
+// Passing nil stops forwarding.
+func SetTelemetryCore(core zapcore.Core) {
+	telemetryHolder.set(core)
+}
+
+// coreHolder guards access to a core that may be swapped at any time
+type coreHolder struct {
+	mux  sync.RWMutex
+	core zapcore.Core
+}
+
+func (h *coreHolder) set(core zapcore.Core) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	h.core = core
+}
+
+func (h *coreHolder) get() zapcore.Core {
+	h.mux.RLock()
+	defer h.mux.RUnlock()
+	return h.core
+}
+
+// telemetryCore is a zapcore.Core that forwards entries to the core in its holder, if one is set
+type telemetryCore struct {
+	zapcore.LevelEnabler
+	holder *coreHolder
+	fields []zapcore.Field
+}
+
+// newTelemetryCore returns a core that forwards entries at or above the level to the telemetry core
+func newTelemetryCore(level zapcore.LevelEnabler) *telemetryCore {
+	return &telemetryCore{
+		LevelEnabler: level,
+		holder:       telemetryHolder,
+	}
+}
+
+// Enabled returns true if the level is enabled and there is a core to forward to
+func (t *telemetryCore) Enabled(level zapcore.Level) bool {
+	return t.LevelEnabler.Enabled(level) && t.holder.get() != nil
+}
+
+// With adds structured context to the core.
+// The fields are held rather than passed to the held core so they survive the held core changing.
+func (t *telemetryCore) With(fields []zapcore.Field) zapcore.Core {
+	combined := make([]zapcore.Field, 0, len(t.fields)+len(fields))
+	combined = append(combined, t.fields...)
+	combined = append(combined, fields...)
+
+	return &telemetryCore{
+		LevelEnabler: t.LevelEnabler,
+		holder:       t.holder,
+		fields:       combined,
+	}
+}
+
+// Check adds the core to the checked entry if the entry should be logged
+func (t *telemetryCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if t.Enabled(entry.Level) {
+		return checked.AddCore(entry, t)
+	}
+	return checked
+}
+
+// Write forwards the entry to the held core
+func (t *telemetryCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	core := t.holder.get()
+	if core == nil {
+		return nil
+	}
+
+	if len(t.fields) > 0 {
+		combined := make([]zapcore.Field, 0, len(t.fields)+len(fields))
+		combined = append(combined, t.fields...)
+		fields = append(combined, fields...)
+	}
+
+	return core.Write(entry, fields)
+}
+
+// Sync syncs the held core
+func (t *telemetryCore) Sync() error {
+	core := t.holder.get()
+	if core == nil {
+		return nil
+	}
+	return core.Sync()
+}
@@ -0,0 +1,100 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestTelemetryCore(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		testFunc func(*testing.T)
+	}{
+		{
+			desc: "No core set",
+			testFunc: func(t *testing.T) {
+				holder := &coreHolder{}
+				core := &telemetryCore{LevelEnabler: zapcore.InfoLevel, holder: holder}
+
+				require.False(t, core.Enabled(zapcore.InfoLevel))
+				require.NoError(t, core.Write(zapcore.Entry{Message: "dropped"}, nil))
+				require.NoError(t, core.Sync())
+			},
+		},
+		{
+			desc: "Forwards enabled entries with fields",
+			testFunc: func(t *testing.T) {
+				holder := &coreHolder{}
+				core := &telemetryCore{LevelEnabler: zapcore.InfoLevel, holder: holder}
+				observedCore, logs := observer.New(zapcore.DebugLevel)
+				holder.set(observedCore)
+
+				logger := zap.New(core).With(zap.String("component", "test"))
+				logger.Debug("filtered")
+				logger.Info("forwarded", zap.Int("count", 1))
+
+				require.Equal(t, 1, logs.Len())
+				entry := logs.All()[0]
+				require.Equal(t, "forwarded", entry.Message)
+				require.Equal(t, map[string]interface{}{"component": "test", "count": int64(1)}, entry.ContextMap())
+			},
+		},
+		{
+			desc: "Core changes after logger is created",
+			testFunc: func(t *testing.T) {
+				holder := &coreHolder{}
+				core := &telemetryCore{LevelEnabler: zapcore.InfoLevel, holder: holder}
+				logger := zap.New(core).With(zap.String("component", "test"))
+
+				logger.Info("before")
+
+				observedCore, logs := observer.New(zapcore.DebugLevel)
+				holder.set(observedCore)
+				logger.Info("during")
+
+				holder.set(nil)
+				logger.Info("after")
+
+				require.Equal(t, 1, logs.Len())
+				require.Equal(t, "during", logs.All()[0].Message)
+				require.Equal(t, map[string]interface{}{"component": "test"}, logs.All()[0].ContextMap())
+			},
+		},
+		{
+			desc: "SetTelemetryCore",
+			testFunc: func(t *testing.T) {
+				t.Cleanup(func() { SetTelemetryCore(nil) })
+
+				observedCore, logs := observer.New(zapcore.DebugLevel)
+				SetTelemetryCore(observedCore)
+
+				logger := zap.New(newTelemetryCore(zapcore.InfoLevel))
+				logger.Info("forwarded")
+
+				require.Equal(t, 1, logs.Len())
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, tc.testFunc)
+	}
+}
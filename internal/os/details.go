@@ -0,0 +1,343 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package os
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"os"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/host"
+	"github.com/shirou/gopsutil/v3/mem"
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// HostDetails are non-identifying details about the host and the process running on it.
+// Details that can't be determined are left as their zero value.
+type HostDetails struct {
+	IPAddresses      []string
+	CPUCount         int
+	TotalMemory      uint64
+	KernelVersion    string
+	BootTime         time.Time
+	ProcessStartTime time.Time
+
+	ContainerID string
+
+	KubernetesPodName   string
+	KubernetesNamespace string
+	KubernetesNodeName  string
+
+	CloudProvider string
+	CloudRegion   string
+}
+
+// Copy creates a deep copy of the details
+func (d HostDetails) Copy() HostDetails {
+	detailsCpy := d
+	if d.IPAddresses != nil {
+		detailsCpy.IPAddresses = append([]string{}, d.IPAddresses...)
+	}
+	return detailsCpy
+}
+
+// Cloud providers detected from the host
+const (
+	CloudProviderAWS   = "aws"
+	CloudProviderAzure = "azure"
+	CloudProviderGCP   = "gcp"
+)
+
+// Environment variables read for Kubernetes details.
+// The pod, namespace, and node are expected to be set from the downward API.
+const (
+	kubernetesServiceHostEnv = "KUBERNETES_SERVICE_HOST"
+	kubernetesPodNameEnv     = "K8S_POD_NAME"
+	kubernetesNamespaceEnv   = "K8S_NAMESPACE"
+	kubernetesNodeNameEnv    = "K8S_NODE_NAME"
+)
+
+// Files read for container, Kubernetes, and cloud details
+const (
+	cgroupFile             = "/proc/self/cgroup"
+	mountInfoFile          = "/proc/self/mountinfo"
+	serviceAccountNSFile   = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+	dmiSysVendorFile       = "/sys/class/dmi/id/sys_vendor"
+	dmiProductNameFile     = "/sys/class/dmi/id/product_name"
+	dmiChassisAssetTagFile = "/sys/class/dmi/id/chassis_asset_tag"
+)
+
+// azureChassisAssetTag is the chassis asset tag of Azure virtual machines
+const azureChassisAssetTag = "7783-7084-3265-9085-8269-3286-77"
+
+// containerIDRegex matches the 64 character hex IDs used by container runtimes
+var containerIDRegex = regexp.MustCompile(`[0-9a-f]{64}`)
+
+// system is the source of host details. It is replaced with a fake in tests.
+type system interface {
+	InterfaceAddrs() ([]net.Addr, error)
+	NumCPU() int
+	TotalMemory() (uint64, error)
+	KernelVersion() (string, error)
+	BootTime() (time.Time, error)
+	ProcessStartTime() (time.Time, error)
+	Getenv(key string) string
+	ReadFile(name string) ([]byte, error)
+	HostID() (string, error)
+}
+
+// Details collects the details of the host.
+// Collection is best effort and only reads local sources, so it never makes network calls.
+func Details() HostDetails {
+	return collectDetails(realSystem{})
+}
+
+// collectDetails collects the details of the host from the system
+func collectDetails(sys system) HostDetails {
+	details := HostDetails{
+		IPAddresses: ipAddresses(sys),
+		CPUCount:    sys.NumCPU(),
+	}
+
+	if totalMemory, err := sys.TotalMemory(); err == nil {
+		details.TotalMemory = totalMemory
+	}
+
+	if kernelVersion, err := sys.KernelVersion(); err == nil {
+		details.KernelVersion = kernelVersion
+	}
+
+	if bootTime, err := sys.BootTime(); err == nil {
+		details.BootTime = bootTime
+	}
+
+	if startTime, err := sys.ProcessStartTime(); err == nil {
+		details.ProcessStartTime = startTime
+	}
+
+	details.ContainerID = containerID(sys)
+
+	if sys.Getenv(kubernetesServiceHostEnv) != "" {
+		details.KubernetesPodName = kubernetesPodName(sys)
+		details.KubernetesNamespace = kubernetesNamespace(sys)
+		details.KubernetesNodeName = sys.Getenv(kubernetesNodeNameEnv)
+	}
+
+	details.CloudProvider = cloudProvider(sys)
+	details.CloudRegion = cloudRegion(sys, details.CloudProvider)
+
+	return details
+}
+
+// ipAddresses returns the sorted addresses of the host, excluding loopback and link local addresses
+func ipAddresses(sys system) []string {
+	addrs, err := sys.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+
+	var addresses []string
+	for _, addr := range addrs {
+		var ip net.IP
+		switch v := addr.(type) {
+		case *net.IPNet:
+			ip = v.IP
+		case *net.IPAddr:
+			ip = v.IP
+		default:
+			ip = net.ParseIP(strings.Split(addr.String(), "/")[0])
+		}
+
+		if ip == nil || ip.IsLoopback() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() {
+			continue
+		}
+		addresses = append(addresses, ip.String())
+	}
+
+	sort.Strings(addresses)
+	return addresses
+}
+
+// containerID finds the ID of the container the process is running in from its cgroups or mounts
+func containerID(sys system) string {
+	if data, err := sys.ReadFile(cgroupFile); err == nil {
+		if id := containerIDRegex.Find(data); id != nil {
+			return string(id)
+		}
+	}
+
+	// Under cgroup v2 the ID is only visible in the paths of files the runtime mounts into the container
+	data, err := sys.ReadFile(mountInfoFile)
+	if err != nil {
+		return ""
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.Contains(line, "/containers/") && !strings.Contains(line, "/sandboxes/") {
+			continue
+		}
+		if id := containerIDRegex.FindString(line); id != "" {
+			return id
+		}
+	}
+
+	return ""
+}
+
+// kubernetesPodName returns the pod name from the downward API, falling back to the hostname Kubernetes sets to it
+func kubernetesPodName(sys system) string {
+	if podName := sys.Getenv(kubernetesPodNameEnv); podName != "" {
+		return podName
+	}
+	return sys.Getenv("HOSTNAME")
+}
+
+// kubernetesNamespace returns the namespace from the downward API, falling back to the mounted service account
+func kubernetesNamespace(sys system) string {
+	if namespace := sys.Getenv(kubernetesNamespaceEnv); namespace != "" {
+		return namespace
+	}
+
+	data, err := sys.ReadFile(serviceAccountNSFile)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// cloudProvider detects the cloud provider from the environment of managed runtimes or the host's DMI data
+func cloudProvider(sys system) string {
+	switch {
+	case sys.Getenv("AWS_EXECUTION_ENV") != "", sys.Getenv("ECS_CONTAINER_METADATA_URI_V4") != "":
+		return CloudProviderAWS
+	case sys.Getenv("K_SERVICE") != "":
+		return CloudProviderGCP
+	case sys.Getenv("WEBSITE_SITE_NAME") != "":
+		return CloudProviderAzure
+	}
+
+	readDMI := func(name string) string {
+		data, err := sys.ReadFile(name)
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(string(data))
+	}
+
+	vendor := readDMI(dmiSysVendorFile)
+	product := readDMI(dmiProductNameFile)
+	switch {
+	case strings.Contains(vendor, "Amazon"), strings.HasPrefix(product, "Amazon EC2"):
+		return CloudProviderAWS
+	case strings.Contains(vendor, "Google"), strings.Contains(product, "Google Compute Engine"):
+		return CloudProviderGCP
+	case readDMI(dmiChassisAssetTagFile) == azureChassisAssetTag:
+		return CloudProviderAzure
+	}
+
+	return ""
+}
+
+// cloudRegion returns the region of the cloud provider if it's set in the environment
+func cloudRegion(sys system, provider string) string {
+	switch provider {
+	case CloudProviderAWS:
+		if region := sys.Getenv("AWS_REGION"); region != "" {
+			return region
+		}
+		return sys.Getenv("AWS_DEFAULT_REGION")
+	case CloudProviderAzure:
+		return sys.Getenv("REGION_NAME")
+	default:
+		return ""
+	}
+}
+
+// realSystem reads details from the running host
+type realSystem struct{}
+
+// InterfaceAddrs returns the addresses of the host's network interfaces
+func (realSystem) InterfaceAddrs() ([]net.Addr, error) {
+	return net.InterfaceAddrs()
+}
+
+// NumCPU returns the number of logical CPUs
+func (realSystem) NumCPU() int {
+	return runtime.NumCPU()
+}
+
+// TotalMemory returns the total memory of the host in bytes
+func (realSystem) TotalMemory() (uint64, error) {
+	stat, err := mem.VirtualMemory()
+	if err != nil {
+		return 0, err
+	}
+	return stat.Total, nil
+}
+
+// KernelVersion returns the version of the host's kernel
+func (realSystem) KernelVersion() (string, error) {
+	return host.KernelVersion()
+}
+
+// BootTime returns the time the host booted
+func (realSystem) BootTime() (time.Time, error) {
+	bootTime, err := host.BootTime()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(int64(bootTime), 0).UTC(), nil
+}
+
+// ProcessStartTime returns the time this process started
+func (realSystem) ProcessStartTime() (time.Time, error) {
+	proc, err := process.NewProcess(int32(os.Getpid()))
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	createTime, err := proc.CreateTime()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(createTime).UTC(), nil
+}
+
+// Getenv returns the value of the environment variable
+func (realSystem) Getenv(key string) string {
+	return os.Getenv(key)
+}
+
+// ReadFile returns the contents of the file
+func (realSystem) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name) //#nosec G304
+}
+
+// HostID returns the platform's unique ID for the host
+func (realSystem) HostID() (string, error) {
+	info, err := getHostInfo()
+	if err != nil {
+		return "", err
+	}
+	return info.HostID, nil
+}
@@ -0,0 +1,288 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package os
+
+import (
+	"errors"
+	"io/fs"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSystem is a system with fixed details
+type fakeSystem struct {
+	addrs     []net.Addr
+	numCPU    int
+	memory    uint64
+	kernel    string
+	bootTime  time.Time
+	startTime time.Time
+	env       map[string]string
+	files     map[string]string
+	hostID    string
+}
+
+func (f fakeSystem) InterfaceAddrs() ([]net.Addr, error) {
+	if f.addrs == nil {
+		return nil, errors.New("no interfaces")
+	}
+	return f.addrs, nil
+}
+
+func (f fakeSystem) NumCPU() int {
+	return f.numCPU
+}
+
+func (f fakeSystem) TotalMemory() (uint64, error) {
+	if f.memory == 0 {
+		return 0, errors.New("no memory")
+	}
+	return f.memory, nil
+}
+
+func (f fakeSystem) KernelVersion() (string, error) {
+	if f.kernel == "" {
+		return "", errors.New("no kernel")
+	}
+	return f.kernel, nil
+}
+
+func (f fakeSystem) BootTime() (time.Time, error) {
+	if f.bootTime.IsZero() {
+		return time.Time{}, errors.New("no boot time")
+	}
+	return f.bootTime, nil
+}
+
+func (f fakeSystem) ProcessStartTime() (time.Time, error) {
+	if f.startTime.IsZero() {
+		return time.Time{}, errors.New("no start time")
+	}
+	return f.startTime, nil
+}
+
+func (f fakeSystem) Getenv(key string) string {
+	return f.env[key]
+}
+
+func (f fakeSystem) ReadFile(name string) ([]byte, error) {
+	contents, ok := f.files[name]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	return []byte(contents), nil
+}
+
+func (f fakeSystem) HostID() (string, error) {
+	if f.hostID == "" {
+		return "", errors.New("no host ID")
+	}
+	return f.hostID, nil
+}
+
+func TestCollectDetails(t *testing.T) {
+	bootTime := time.Date(2022, 8, 1, 12, 0, 0, 0, time.UTC)
+	startTime := time.Date(2022, 8, 2, 12, 0, 0, 0, time.UTC)
+	containerID := "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+	testCases := []struct {
+		name     string
+		sys      fakeSystem
+		expected HostDetails
+	}{
+		{
+			name:     "Nothing available",
+			sys:      fakeSystem{},
+			expected: HostDetails{},
+		},
+		{
+			name: "Bare metal host",
+			sys: fakeSystem{
+				addrs: []net.Addr{
+					&net.IPNet{IP: net.ParseIP("192.168.1.10"), Mask: net.CIDRMask(24, 32)},
+					&net.IPNet{IP: net.ParseIP("127.0.0.1"), Mask: net.CIDRMask(8, 32)},
+					&net.IPNet{IP: net.ParseIP("fe80::1"), Mask: net.CIDRMask(64, 128)},
+					&net.IPNet{IP: net.ParseIP("2001:db8::10"), Mask: net.CIDRMask(64, 128)},
+					&net.IPNet{IP: net.ParseIP("10.0.0.5"), Mask: net.CIDRMask(8, 32)},
+				},
+				numCPU:    8,
+				memory:    16 << 30,
+				kernel:    "5.15.0-41-generic",
+				bootTime:  bootTime,
+				startTime: startTime,
+			},
+			expected: HostDetails{
+				IPAddresses:      []string{"10.0.0.5", "192.168.1.10", "2001:db8::10"},
+				CPUCount:         8,
+				TotalMemory:      16 << 30,
+				KernelVersion:    "5.15.0-41-generic",
+				BootTime:         bootTime,
+				ProcessStartTime: startTime,
+			},
+		},
+		{
+			name: "Container from cgroup",
+			sys: fakeSystem{
+				files: map[string]string{
+					cgroupFile: "0::/system.slice/docker-" + containerID + ".scope\n",
+				},
+			},
+			expected: HostDetails{
+				ContainerID: containerID,
+			},
+		},
+		{
+			name: "Container from mountinfo",
+			sys: fakeSystem{
+				files: map[string]string{
+					cgroupFile:    "0::/\n",
+					mountInfoFile: "1 2 8:1 / / rw - overlay overlay rw\n3 1 8:1 /var/lib/docker/containers/" + containerID + "/hostname /etc/hostname rw - ext4 /dev/sda1 rw\n",
+				},
+			},
+			expected: HostDetails{
+				ContainerID: containerID,
+			},
+		},
+		{
+			name: "Kubernetes from downward API",
+			sys: fakeSystem{
+				env: map[string]string{
+					kubernetesServiceHostEnv: "10.96.0.1",
+					kubernetesPodNameEnv:     "collector-abc",
+					kubernetesNamespaceEnv:   "observiq",
+					kubernetesNodeNameEnv:    "node-1",
+				},
+			},
+			expected: HostDetails{
+				KubernetesPodName:   "collector-abc",
+				KubernetesNamespace: "observiq",
+				KubernetesNodeName:  "node-1",
+			},
+		},
+		{
+			name: "Kubernetes without downward API",
+			sys: fakeSystem{
+				env: map[string]string{
+					kubernetesServiceHostEnv: "10.96.0.1",
+					"HOSTNAME":               "collector-abc",
+				},
+				files: map[string]string{
+					serviceAccountNSFile: "default\n",
+				},
+			},
+			expected: HostDetails{
+				KubernetesPodName:   "collector-abc",
+				KubernetesNamespace: "default",
+			},
+		},
+		{
+			name: "Kubernetes env ignored outside of Kubernetes",
+			sys: fakeSystem{
+				env: map[string]string{
+					kubernetesPodNameEnv: "collector-abc",
+				},
+			},
+			expected: HostDetails{},
+		},
+		{
+			name: "AWS from DMI",
+			sys: fakeSystem{
+				env: map[string]string{
+					"AWS_REGION": "us-east-1",
+				},
+				files: map[string]string{
+					dmiSysVendorFile: "Amazon EC2\n",
+				},
+			},
+			expected: HostDetails{
+				CloudProvider: CloudProviderAWS,
+				CloudRegion:   "us-east-1",
+			},
+		},
+		{
+			name: "GCP from DMI",
+			sys: fakeSystem{
+				files: map[string]string{
+					dmiSysVendorFile:   "Google\n",
+					dmiProductNameFile: "Google Compute Engine\n",
+				},
+			},
+			expected: HostDetails{
+				CloudProvider: CloudProviderGCP,
+			},
+		},
+		{
+			name: "Azure from DMI",
+			sys: fakeSystem{
+				files: map[string]string{
+					dmiSysVendorFile:       "Microsoft Corporation\n",
+					dmiChassisAssetTagFile: azureChassisAssetTag + "\n",
+				},
+			},
+			expected: HostDetails{
+				CloudProvider: CloudProviderAzure,
+			},
+		},
+		{
+			name: "AWS from managed runtime",
+			sys: fakeSystem{
+				env: map[string]string{
+					"ECS_CONTAINER_METADATA_URI_V4": "http://169.254.170.2/v4/abc",
+					"AWS_DEFAULT_REGION":            "us-west-2",
+				},
+			},
+			expected: HostDetails{
+				CloudProvider: CloudProviderAWS,
+				CloudRegion:   "us-west-2",
+			},
+		},
+		{
+			name: "Region ignored without provider",
+			sys: fakeSystem{
+				env: map[string]string{
+					"AWS_REGION": "us-east-1",
+				},
+			},
+			expected: HostDetails{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, collectDetails(tc.sys))
+		})
+	}
+}
+
+func TestHostDetailsCopy(t *testing.T) {
+	details := HostDetails{
+		IPAddresses: []string{"10.0.0.5"},
+		CPUCount:    4,
+	}
+
+	detailsCpy := details.Copy()
+	require.Equal(t, details, detailsCpy)
+
+	detailsCpy.IPAddresses[0] = "10.0.0.6"
+	require.Equal(t, "10.0.0.5", details.IPAddresses[0])
+}
+
+func TestDetails(t *testing.T) {
+	details := Details()
+	require.NotZero(t, details.CPUCount)
+}
@@ -0,0 +1,75 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package os
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// ErrInvalidMachineID is returned when the host's machine ID is missing or a placeholder shared by other hosts
+var ErrInvalidMachineID = errors.New("invalid machine ID")
+
+// machineIDFiles are read in order for the machine ID on Linux
+var machineIDFiles = []string{
+	"/etc/machine-id",
+	"/var/lib/dbus/machine-id",
+}
+
+// MachineID returns the unique ID the OS assigns to the host.
+// It's identifying, so it's only used to derive agent IDs and never reported.
+func MachineID() (string, error) {
+	return collectMachineID(realSystem{}, runtime.GOOS)
+}
+
+// collectMachineID reads the machine ID from the system
+func collectMachineID(sys system, goos string) (string, error) {
+	var machineID string
+	switch goos {
+	case "linux":
+		// gopsutil prefers the boot ID over the machine ID, which changes every boot
+		for _, name := range machineIDFiles {
+			data, err := sys.ReadFile(name)
+			if err == nil {
+				machineID = string(data)
+				break
+			}
+		}
+	default:
+		hostID, err := sys.HostID()
+		if err != nil {
+			return "", fmt.Errorf("failed to read host ID: %w", err)
+		}
+		machineID = hostID
+	}
+
+	machineID = strings.ToLower(strings.TrimSpace(machineID))
+	if !isValidMachineID(machineID) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidMachineID, machineID)
+	}
+
+	return machineID, nil
+}
+
+// isValidMachineID checks the ID isn't empty or a placeholder left in images before first boot
+func isValidMachineID(machineID string) bool {
+	if machineID == "" || machineID == "uninitialized" {
+		return false
+	}
+
+	return strings.Trim(machineID, "0-") != ""
+}
@@ -0,0 +1,96 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package os
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollectMachineID(t *testing.T) {
+	testCases := []struct {
+		name        string
+		sys         fakeSystem
+		goos        string
+		expected    string
+		expectedErr error
+	}{
+		{
+			name: "Linux machine ID",
+			sys: fakeSystem{
+				files: map[string]string{
+					"/etc/machine-id": "0123456789ABCDEF0123456789abcdef\n",
+				},
+			},
+			goos:     "linux",
+			expected: "0123456789abcdef0123456789abcdef",
+		},
+		{
+			name: "Linux dbus machine ID",
+			sys: fakeSystem{
+				files: map[string]string{
+					"/var/lib/dbus/machine-id": "0123456789abcdef0123456789abcdef\n",
+				},
+			},
+			goos:     "linux",
+			expected: "0123456789abcdef0123456789abcdef",
+		},
+		{
+			name:        "Linux missing machine ID",
+			sys:         fakeSystem{},
+			goos:        "linux",
+			expectedErr: ErrInvalidMachineID,
+		},
+		{
+			name: "Linux uninitialized machine ID",
+			sys: fakeSystem{
+				files: map[string]string{
+					"/etc/machine-id": "uninitialized\n",
+				},
+			},
+			goos:        "linux",
+			expectedErr: ErrInvalidMachineID,
+		},
+		{
+			name: "Windows host ID",
+			sys: fakeSystem{
+				hostID: "5A1B2C3D-0000-1111-2222-333344445555",
+			},
+			goos:     "windows",
+			expected: "5a1b2c3d-0000-1111-2222-333344445555",
+		},
+		{
+			name: "Zero host ID",
+			sys: fakeSystem{
+				hostID: "00000000-0000-0000-0000-000000000000",
+			},
+			goos:        "darwin",
+			expectedErr: ErrInvalidMachineID,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			machineID, err := collectMachineID(tc.sys, tc.goos)
+			if tc.expectedErr != nil {
+				require.ErrorIs(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, machineID)
+		})
+	}
+}
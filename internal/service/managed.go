@@ -28,6 +28,7 @@ import (
 type ManagedCollectorService struct {
 	logger *zap.Logger
 	client opamp.Client
+	col    collector.Collector
 
 	// Config paths
 	managerConfigPath   string
@@ -36,12 +37,16 @@ type ManagedCollectorService struct {
 }
 
 // NewManagedCollectorService creates a new ManagedCollectorService
-func NewManagedCollectorService(col collector.Collector, logger *zap.Logger, managerConfigPath, collectorConfigPath, loggerConfigPath string) (*ManagedCollectorService, error) {
+func NewManagedCollectorService(col collector.Collector, logger *zap.Logger, managerConfigPath, collectorConfigPath, loggerConfigPath, pluginsDir string) (*ManagedCollectorService, error) {
 	opampConfig, err := opamp.ParseConfig(managerConfigPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse manager config: %w", err)
 	}
 
+	if err := opamp.EnsureAgentID(managerConfigPath, opampConfig); err != nil {
+		return nil, fmt.Errorf("failed to set agent ID: %w", err)
+	}
+
 	// Create client Args
 	clientArgs := &observiq.NewClientArgs{
 		DefaultLogger:       logger,
@@ -50,6 +55,7 @@ func NewManagedCollectorService(col collector.Collector, logger *zap.Logger, man
 		ManagerConfigPath:   managerConfigPath,
 		CollectorConfigPath: collectorConfigPath,
 		LoggerConfigPath:    loggerConfigPath,
+		PluginsDir:          pluginsDir,
 	}
 
 	// Create new client
@@ -60,6 +66,7 @@ func NewManagedCollectorService(col collector.Collector, logger *zap.Logger, man
 
 	return &ManagedCollectorService{
 		client:              client,
+		col:                 col,
 		logger:              logger,
 		managerConfigPath:   managerConfigPath,
 		collectorConfigPath: collectorConfigPath,
@@ -88,8 +95,29 @@ func (m *ManagedCollectorService) Stop(ctx context.Context) error {
 	return nil
 }
 
-// Error returns an empty error channel. This will never send errors.
+// Health returns true while the collector is running, summarizing its state and the connection to the platform
+func (m *ManagedCollectorService) Health() (bool, string) {
+	running := m.col.Running()
+	return running, fmt.Sprintf("%s; OpAMP %s", collectorSummary(running), m.client.ConnectionStatus().State)
+}
+
+// CollectorStatus returns the most recent status of the collector
+func (m *ManagedCollectorService) CollectorStatus() *collector.Status {
+	return m.col.LastStatus()
+}
+
+// RestartCollector restarts the collector once any remote config being applied is done
+func (m *ManagedCollectorService) RestartCollector(ctx context.Context) error {
+	return m.client.RestartCollector(ctx)
+}
+
+// ConnectionStatus returns the current status of the connection to the platform
+func (m *ManagedCollectorService) ConnectionStatus() opamp.ConnectionStatus {
+	return m.client.ConnectionStatus()
+}
+
+// Error returns the client's error channel. It receives an error once the collector or the connection
+// to the platform fails and the failure policy gives up on recovering it.
 func (m *ManagedCollectorService) Error() <-chan error {
-	// send new channel that's never used
-	return make(<-chan error)
+	return m.client.Error()
 }
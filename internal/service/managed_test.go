@@ -19,7 +19,9 @@ import (
 	"errors"
 	"testing"
 
+	"github.com/observiq/observiq-otel-collector/collector"
 	colmocks "github.com/observiq/observiq-otel-collector/collector/mocks"
+	"github.com/observiq/observiq-otel-collector/opamp"
 	"github.com/observiq/observiq-otel-collector/opamp/mocks"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -32,7 +34,7 @@ import (
 // in it's own package so we don't do robust testing here.
 func TestNewManagedCollectorService_BadManagerConfig(t *testing.T) {
 	mockCol := colmocks.NewMockCollector(t)
-	managedService, err := NewManagedCollectorService(mockCol, zap.NewNop(), "./bad_manger.yaml", "./bad_collector.yaml", "./bad_logging.yaml")
+	managedService, err := NewManagedCollectorService(mockCol, zap.NewNop(), "./bad_manger.yaml", "./bad_collector.yaml", "./bad_logging.yaml", "./plugins")
 	assert.ErrorContains(t, err, "failed to parse manager config")
 	assert.Nil(t, managedService)
 }
@@ -124,8 +126,92 @@ func TestManageCollectorServiceStop(t *testing.T) {
 }
 
 func TestManageCollectorServiceError(t *testing.T) {
-	// Just test we return a non-nil channel
-	m := &ManagedCollectorService{}
-	errChan := m.Error()
-	require.NotNil(t, errChan)
+	errChan := make(chan error, 1)
+	mockClient := mocks.NewMockClient(t)
+	mockClient.On("Error").Return((<-chan error)(errChan))
+
+	m := &ManagedCollectorService{
+		client: mockClient,
+		logger: zap.NewNop(),
+	}
+
+	expectedErr := errors.New("collector is not running")
+	errChan <- expectedErr
+
+	serviceErrChan := m.Error()
+	require.NotNil(t, serviceErrChan)
+	assert.Equal(t, expectedErr, <-serviceErrChan)
+}
+
+func TestManageCollectorServiceHealth(t *testing.T) {
+	testCases := []struct {
+		desc            string
+		running         bool
+		state           opamp.ConnectionState
+		expectedHealthy bool
+		expectedSummary string
+	}{
+		{
+			desc:            "Collector running and connected",
+			running:         true,
+			state:           opamp.ConnectionStateConnected,
+			expectedHealthy: true,
+			expectedSummary: "Collector running; OpAMP connected",
+		},
+		{
+			desc:            "Collector running while reconnecting",
+			running:         true,
+			state:           opamp.ConnectionStateBackoff,
+			expectedHealthy: true,
+			expectedSummary: "Collector running; OpAMP backoff",
+		},
+		{
+			desc:            "Collector not running",
+			running:         false,
+			state:           opamp.ConnectionStateConnected,
+			expectedHealthy: false,
+			expectedSummary: "Collector not running; OpAMP connected",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			mockCol := colmocks.NewMockCollector(t)
+			mockCol.On("Running").Return(tc.running)
+
+			mockClient := mocks.NewMockClient(t)
+			mockClient.On("ConnectionStatus").Return(opamp.ConnectionStatus{State: tc.state})
+
+			m := &ManagedCollectorService{
+				client: mockClient,
+				col:    mockCol,
+				logger: zap.NewNop(),
+			}
+
+			healthy, summary := m.Health()
+			assert.Equal(t, tc.expectedHealthy, healthy)
+			assert.Equal(t, tc.expectedSummary, summary)
+		})
+	}
+}
+
+func TestManageCollectorServiceAdmin(t *testing.T) {
+	status := &collector.Status{Running: true}
+	mockCol := colmocks.NewMockCollector(t)
+	mockCol.On("LastStatus").Return(status)
+
+	connStatus := opamp.ConnectionStatus{State: opamp.ConnectionStateConnected, Endpoint: "ws://localhost:1234"}
+	mockClient := mocks.NewMockClient(t)
+	mockClient.On("ConnectionStatus").Return(connStatus)
+	mockClient.On("RestartCollector", mock.Anything).Return(errors.New("oops"))
+
+	m := &ManagedCollectorService{
+		client: mockClient,
+		col:    mockCol,
+		logger: zap.NewNop(),
+	}
+
+	assert.Equal(t, status, m.CollectorStatus())
+	assert.Equal(t, connStatus, m.ConnectionStatus())
+	assert.EqualError(t, m.RestartCollector(context.Background()), "oops")
 }
@@ -0,0 +1,207 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// notifySocketEnv is set by systemd to the socket notifications are sent to
+	notifySocketEnv = "NOTIFY_SOCKET"
+
+	// watchdogUsecEnv is set by systemd to the watchdog timeout in microseconds
+	watchdogUsecEnv = "WATCHDOG_USEC"
+
+	// watchdogPIDEnv is set by systemd to the process the watchdog is for
+	watchdogPIDEnv = "WATCHDOG_PID"
+)
+
+// Notification states sent to systemd
+const (
+	notifyReady     = "READY=1"
+	notifyReloading = "RELOADING=1"
+	notifyStopping  = "STOPPING=1"
+	notifyWatchdog  = "WATCHDOG=1"
+	notifyStatus    = "STATUS="
+)
+
+// statusInterval is how often the status is checked
+var statusInterval = 10 * time.Second
+
+// notifier sends service state notifications to systemd.
+// A nil notifier sends nothing, so callers don't need to check if the collector was started by systemd.
+type notifier struct {
+	conn *net.UnixConn
+
+	// watchdogInterval is how often the watchdog must be notified. Zero if the watchdog is disabled.
+	watchdogInterval time.Duration
+}
+
+// newNotifier creates a notifier for the socket in NOTIFY_SOCKET.
+// Returns nil if the collector wasn't started by systemd with Type=notify.
+func newNotifier() (*notifier, error) {
+	socket := os.Getenv(notifySocketEnv)
+	if socket == "" {
+		return nil, nil
+	}
+
+	// A leading @ denotes a socket in the abstract namespace
+	if strings.HasPrefix(socket, "@") {
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to notify socket: %w", err)
+	}
+
+	watchdogInterval, err := watchdogTimeout()
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	return &notifier{
+		conn:             conn,
+		watchdogInterval: watchdogInterval,
+	}, nil
+}
+
+// watchdogTimeout returns the watchdog timeout set by systemd for this process, or zero if the watchdog is disabled
+func watchdogTimeout() (time.Duration, error) {
+	usec := os.Getenv(watchdogUsecEnv)
+	if usec == "" {
+		return 0, nil
+	}
+
+	// The watchdog is for another process, such as a parent that passed its environment on
+	if pid := os.Getenv(watchdogPIDEnv); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0, nil
+	}
+
+	timeout, err := strconv.ParseInt(usec, 10, 64)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("invalid %s: %s", watchdogUsecEnv, usec)
+	}
+
+	return time.Duration(timeout) * time.Microsecond, nil
+}
+
+// notify sends the states to systemd
+func (n *notifier) notify(states ...string) error {
+	if n == nil {
+		return nil
+	}
+
+	if _, err := n.conn.Write([]byte(strings.Join(states, "\n"))); err != nil {
+		return fmt.Errorf("failed to notify systemd: %w", err)
+	}
+	return nil
+}
+
+// ready notifies systemd the service has started along with its status
+func (n *notifier) ready(svc RunnableService) error {
+	_, summary := serviceHealth(svc)
+	return n.notify(notifyReady, notifyStatus+summary)
+}
+
+// reloading notifies systemd the service is reloading its configs. It's followed by ready once reloaded.
+func (n *notifier) reloading() error {
+	return n.notify(notifyReloading, notifyStatus+"Reloading")
+}
+
+// stopping notifies systemd the service is stopping
+func (n *notifier) stopping() error {
+	return n.notify(notifyStopping, notifyStatus+"Stopping")
+}
+
+// watchdog notifies systemd the service is still alive
+func (n *notifier) watchdog() error {
+	return n.notify(notifyWatchdog)
+}
+
+// watchdogTicks returns a channel that ticks whenever the watchdog should be notified, along with a function to stop it.
+// The watchdog is notified at half its timeout so a single late notification doesn't trigger it.
+// The channel never ticks if the watchdog is disabled.
+func (n *notifier) watchdogTicks() (<-chan time.Time, func()) {
+	if n == nil || n.watchdogInterval <= 0 {
+		return nil, func() {}
+	}
+
+	ticker := time.NewTicker(n.watchdogInterval / 2)
+	return ticker.C, ticker.Stop
+}
+
+// monitor updates the status when it changes until done is closed.
+// The collector's health is only reported in the status. The watchdog is only affected by services reporting their liveness.
+func (n *notifier) monitor(logger *zap.Logger, svc RunnableService, done <-chan struct{}) {
+	if n == nil {
+		return
+	}
+
+	ticker := time.NewTicker(statusInterval)
+	defer ticker.Stop()
+
+	_, lastSummary := serviceHealth(svc)
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		_, summary := serviceHealth(svc)
+		if summary == lastSummary {
+			continue
+		}
+		lastSummary = summary
+
+		if err := n.notify(notifyStatus + summary); err != nil {
+			logger.Warn("Failed to update systemd", zap.Error(err))
+		}
+	}
+}
+
+// close closes the connection to the notify socket
+func (n *notifier) close() error {
+	if n == nil {
+		return nil
+	}
+	return n.conn.Close()
+}
+
+// serviceHealth returns the health of the service if it reports it, otherwise it's assumed healthy while running
+func serviceHealth(svc RunnableService) (healthy bool, summary string) {
+	if reporter, ok := svc.(HealthReporter); ok {
+		return reporter.Health()
+	}
+	return true, "Running"
+}
+
+// serviceAlive returns the liveness of the service if it reports it, otherwise it's assumed alive while running
+func serviceAlive(svc RunnableService) bool {
+	if reporter, ok := svc.(LivenessReporter); ok {
+		return reporter.Alive()
+	}
+	return true
+}
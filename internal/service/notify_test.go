@@ -0,0 +1,378 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+
+package service
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/observiq/observiq-otel-collector/internal/service/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// reportingService is a runnable service that reports the health it's set to
+type reportingService struct {
+	*mocks.RunnableService
+	healthy int32
+}
+
+func (r *reportingService) Health() (bool, string) {
+	if atomic.LoadInt32(&r.healthy) == 1 {
+		return true, "Collector running"
+	}
+	return false, "Collector not running"
+}
+
+// livenessService is a reporting service that also reports its liveness, which follows its health
+type livenessService struct {
+	*reportingService
+}
+
+func (l *livenessService) Alive() bool {
+	healthy, _ := l.Health()
+	return healthy
+}
+
+func (r *reportingService) setHealthy(healthy bool) {
+	if healthy {
+		atomic.StoreInt32(&r.healthy, 1)
+	} else {
+		atomic.StoreInt32(&r.healthy, 0)
+	}
+}
+
+// newFakeNotifySocket listens on a socket set as NOTIFY_SOCKET and returns the notifications it receives
+func newFakeNotifySocket(t *testing.T) <-chan string {
+	// Socket paths are limited in length so the socket isn't put in the test's temp dir
+	dir, err := os.MkdirTemp("", "notify")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	socket := filepath.Join(dir, "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	t.Setenv(notifySocketEnv, socket)
+
+	received := make(chan string, 100)
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+			received <- string(buf[:n])
+		}
+	}()
+	return received
+}
+
+// nextNotification waits for the next notification sent to the fake socket
+func nextNotification(t *testing.T, received <-chan string) string {
+	select {
+	case notification := <-received:
+		return notification
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for notification")
+		return ""
+	}
+}
+
+func TestNewNotifier(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		testFunc func(*testing.T)
+	}{
+		{
+			desc: "Not started by systemd",
+			testFunc: func(t *testing.T) {
+				t.Setenv(notifySocketEnv, "")
+
+				n, err := newNotifier()
+				require.NoError(t, err)
+				require.Nil(t, n)
+
+				// A nil notifier does nothing
+				assert.NoError(t, n.ready(&mocks.RunnableService{}))
+				assert.NoError(t, n.stopping())
+				assert.NoError(t, n.close())
+			},
+		},
+		{
+			desc: "Sends notifications",
+			testFunc: func(t *testing.T) {
+				received := newFakeNotifySocket(t)
+				t.Setenv(watchdogUsecEnv, "")
+
+				n, err := newNotifier()
+				require.NoError(t, err)
+				defer n.close()
+				assert.Zero(t, n.watchdogInterval)
+
+				require.NoError(t, n.ready(&mocks.RunnableService{}))
+				assert.Equal(t, "READY=1\nSTATUS=Running", nextNotification(t, received))
+
+				require.NoError(t, n.reloading())
+				assert.Equal(t, "RELOADING=1\nSTATUS=Reloading", nextNotification(t, received))
+
+				require.NoError(t, n.stopping())
+				assert.Equal(t, "STOPPING=1\nSTATUS=Stopping", nextNotification(t, received))
+			},
+		},
+		{
+			desc: "Socket doesn't exist",
+			testFunc: func(t *testing.T) {
+				t.Setenv(notifySocketEnv, filepath.Join(t.TempDir(), "missing.sock"))
+
+				n, err := newNotifier()
+				assert.ErrorContains(t, err, "failed to connect to notify socket")
+				assert.Nil(t, n)
+			},
+		},
+		{
+			desc: "Invalid watchdog timeout",
+			testFunc: func(t *testing.T) {
+				newFakeNotifySocket(t)
+				t.Setenv(watchdogUsecEnv, "soon")
+				t.Setenv(watchdogPIDEnv, "")
+
+				n, err := newNotifier()
+				assert.EqualError(t, err, "invalid WATCHDOG_USEC: soon")
+				assert.Nil(t, n)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, tc.testFunc)
+	}
+}
+
+func TestWatchdogTimeout(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		usec     string
+		pid      string
+		expected time.Duration
+	}{
+		{
+			desc:     "Watchdog disabled",
+			expected: 0,
+		},
+		{
+			desc:     "Watchdog enabled",
+			usec:     "30000000",
+			expected: 30 * time.Second,
+		},
+		{
+			desc:     "Watchdog for this process",
+			usec:     "30000000",
+			pid:      strconv.Itoa(os.Getpid()),
+			expected: 30 * time.Second,
+		},
+		{
+			desc:     "Watchdog for another process",
+			usec:     "30000000",
+			pid:      strconv.Itoa(os.Getpid() + 1),
+			expected: 0,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Setenv(watchdogUsecEnv, tc.usec)
+			t.Setenv(watchdogPIDEnv, tc.pid)
+
+			timeout, err := watchdogTimeout()
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, timeout)
+		})
+	}
+}
+
+func TestNotifierMonitor(t *testing.T) {
+	received := newFakeNotifySocket(t)
+	t.Setenv(watchdogUsecEnv, "40000")
+	t.Setenv(watchdogPIDEnv, "")
+
+	previousInterval := statusInterval
+	statusInterval = 20 * time.Millisecond
+	t.Cleanup(func() { statusInterval = previousInterval })
+
+	n, err := newNotifier()
+	require.NoError(t, err)
+	defer n.close()
+
+	svc := &reportingService{RunnableService: &mocks.RunnableService{}}
+	svc.setHealthy(true)
+
+	done := make(chan struct{})
+	monitorDone := make(chan struct{})
+	go func() {
+		n.monitor(zap.NewNop(), svc, done)
+		close(monitorDone)
+	}()
+
+	// Nothing is sent while the status is unchanged, including the watchdog
+	select {
+	case notification := <-received:
+		t.Fatalf("unexpected notification while unchanged: %s", notification)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Only the status is updated when the health changes
+	svc.setHealthy(false)
+	assert.Equal(t, "STATUS=Collector not running", nextNotification(t, received))
+
+	svc.setHealthy(true)
+	assert.Equal(t, "STATUS=Collector running", nextNotification(t, received))
+
+	close(done)
+	select {
+	case <-monitorDone:
+	case <-time.After(time.Second):
+		t.Fatal("monitor didn't stop")
+	}
+}
+
+func TestRunServiceInteractiveWatchdog(t *testing.T) {
+	received := newFakeNotifySocket(t)
+	t.Setenv(watchdogUsecEnv, "40000")
+	t.Setenv(watchdogPIDEnv, "")
+
+	n, err := newNotifier()
+	require.NoError(t, err)
+	defer n.close()
+
+	// Without liveness, as in managed mode, the watchdog is notified even though the collector isn't running
+	svc := &reportingService{RunnableService: &mocks.RunnableService{}}
+	svc.On("Start", mock.Anything).Return(nil)
+	svc.On("Error").Return((<-chan error)(make(chan error)))
+	svc.On("Stop", mock.Anything).Return(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	svcDone := make(chan error)
+	go func() {
+		svcDone <- runServiceInteractive(ctx, zap.NewNop(), svc, n, nil)
+	}()
+
+	assert.Equal(t, "READY=1\nSTATUS=Collector not running", nextNotification(t, received))
+	assert.Equal(t, "WATCHDOG=1", nextNotification(t, received))
+	assert.Equal(t, "WATCHDOG=1", nextNotification(t, received))
+
+	cancel()
+	for notification := nextNotification(t, received); notification != "STOPPING=1\nSTATUS=Stopping"; notification = nextNotification(t, received) {
+		assert.Equal(t, "WATCHDOG=1", notification)
+	}
+
+	select {
+	case err := <-svcDone:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for service done")
+	}
+}
+
+func TestRunServiceInteractiveWatchdogLiveness(t *testing.T) {
+	received := newFakeNotifySocket(t)
+	t.Setenv(watchdogUsecEnv, "40000")
+	t.Setenv(watchdogPIDEnv, "")
+
+	n, err := newNotifier()
+	require.NoError(t, err)
+	defer n.close()
+
+	// The watchdog isn't notified until the collector is running
+	svc := &livenessService{reportingService: &reportingService{RunnableService: &mocks.RunnableService{}}}
+	svc.On("Start", mock.Anything).Return(nil)
+	svc.On("Error").Return((<-chan error)(make(chan error)))
+	svc.On("Stop", mock.Anything).Return(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	svcDone := make(chan error)
+	go func() {
+		svcDone <- runServiceInteractive(ctx, zap.NewNop(), svc, n, nil)
+	}()
+
+	assert.Equal(t, "READY=1\nSTATUS=Collector not running", nextNotification(t, received))
+	select {
+	case notification := <-received:
+		t.Fatalf("unexpected notification while the collector isn't running: %s", notification)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	svc.setHealthy(true)
+	for notification := nextNotification(t, received); notification != "WATCHDOG=1"; notification = nextNotification(t, received) {
+		assert.Equal(t, "STATUS=Collector running", notification)
+	}
+
+	cancel()
+	for notification := nextNotification(t, received); notification != "STOPPING=1\nSTATUS=Stopping"; notification = nextNotification(t, received) {
+		assert.Contains(t, []string{"WATCHDOG=1", "STATUS=Collector running"}, notification)
+	}
+
+	select {
+	case err := <-svcDone:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for service done")
+	}
+}
+
+func TestRunServiceInteractiveNotifies(t *testing.T) {
+	received := newFakeNotifySocket(t)
+	t.Setenv(watchdogUsecEnv, "")
+
+	n, err := newNotifier()
+	require.NoError(t, err)
+	defer n.close()
+
+	svc := &reportingService{RunnableService: &mocks.RunnableService{}}
+	svc.setHealthy(true)
+	svc.On("Start", mock.Anything).Return(nil)
+	svc.On("Error").Return((<-chan error)(make(chan error)))
+	svc.On("Stop", mock.Anything).Return(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	svcDone := make(chan error)
+	go func() {
+		svcDone <- runServiceInteractive(ctx, zap.NewNop(), svc, n, nil)
+	}()
+
+	assert.Equal(t, "READY=1\nSTATUS=Collector running", nextNotification(t, received))
+
+	cancel()
+	assert.Equal(t, "STOPPING=1\nSTATUS=Stopping", nextNotification(t, received))
+
+	select {
+	case err := <-svcDone:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for service done")
+	}
+}
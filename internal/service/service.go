@@ -17,6 +17,7 @@ package service
 import (
 	"context"
 	"fmt"
+	"os"
 	"time"
 
 	"go.uber.org/zap"
@@ -38,20 +39,72 @@ type RunnableService interface {
 	Error() <-chan error
 }
 
+// HealthReporter is implemented by services that can report their health to the service manager
+type HealthReporter interface {
+	// Health returns true if the service is healthy along with a short summary of its state
+	Health() (healthy bool, summary string)
+}
+
+// LivenessReporter is implemented by services that are only alive while their collector is.
+// The systemd watchdog isn't notified while the service isn't alive, so systemd restarts it.
+type LivenessReporter interface {
+	// Alive returns true while the service is doing its work
+	Alive() bool
+}
+
+// Reloader is implemented by services that can reload their configs while running
+type Reloader interface {
+	// Reload re-reads the service's configs and applies them. The service keeps its previous configs if the new ones are invalid.
+	Reload(ctx context.Context) error
+}
+
 // runServiceInteractive runs the service in an "interactive" mode (responds to SIGINT and SIGTERM).
 // This mode is always used in linux, and is used in Windows when the collector
 // is not running as a service.
-func runServiceInteractive(ctx context.Context, logger *zap.Logger, svc RunnableService) error {
+// The service is reloaded each time reload receives, which may be nil if reloading isn't triggered.
+// The notifier, which may be nil, is told when the service is ready, its health, and when it's stopping,
+// and its watchdog is notified while this loop runs and the service is alive.
+func runServiceInteractive(ctx context.Context, logger *zap.Logger, svc RunnableService, n *notifier, reload <-chan os.Signal) error {
 	if err := svc.Start(ctx); err != nil {
 		return fmt.Errorf("failed to start service: %w", err)
 	}
 
+	if err := n.ready(svc); err != nil {
+		logger.Warn("Failed to notify systemd the service is ready", zap.Error(err))
+	}
+
+	monitorDone := make(chan struct{})
+	go n.monitor(logger, svc, monitorDone)
+
+	// The watchdog is notified from this loop, so it fires if the service stops responding or isn't alive
+	watchdog, stopWatchdog := n.watchdogTicks()
+	defer stopWatchdog()
+
 	var svcErr error
 	// Service is started; Wait for a stop signal.
-	select {
-	case <-ctx.Done():
-	case svcErr = <-svc.Error():
-		logger.Error("Unexpected error while running service", zap.Error(svcErr))
+	for running := true; running; {
+		select {
+		case <-ctx.Done():
+			running = false
+		case svcErr = <-svc.Error():
+			logger.Error("Unexpected error while running service", zap.Error(svcErr))
+			running = false
+		case <-reload:
+			reloadService(ctx, logger, svc, n)
+		case <-watchdog:
+			if !serviceAlive(svc) {
+				logger.Warn("Not notifying systemd watchdog while the collector isn't running")
+				continue
+			}
+			if err := n.watchdog(); err != nil {
+				logger.Warn("Failed to notify systemd watchdog", zap.Error(err))
+			}
+		}
+	}
+
+	close(monitorDone)
+	if err := n.stopping(); err != nil {
+		logger.Warn("Failed to notify systemd the service is stopping", zap.Error(err))
 	}
 
 	stopTimeoutCtx, stopCancel := context.WithTimeout(context.Background(), stopTimeout)
@@ -63,3 +116,30 @@ func runServiceInteractive(ctx context.Context, logger *zap.Logger, svc Runnable
 
 	return svcErr
 }
+
+// reloadService reloads the service if it supports it, keeping systemd informed while it does
+func reloadService(ctx context.Context, logger *zap.Logger, svc RunnableService, n *notifier) {
+	reloader, ok := svc.(Reloader)
+	if !ok {
+		logger.Warn("Ignoring reload, which this mode doesn't support")
+		return
+	}
+
+	logger.Info("Reloading configs")
+	if err := n.reloading(); err != nil {
+		logger.Warn("Failed to notify systemd the service is reloading", zap.Error(err))
+	}
+
+	reloadCtx, cancel := context.WithTimeout(ctx, startTimeout)
+	defer cancel()
+
+	if err := reloader.Reload(reloadCtx); err != nil {
+		logger.Error("Failed to reload configs", zap.Error(err))
+	} else {
+		logger.Info("Reloaded configs")
+	}
+
+	if err := n.ready(svc); err != nil {
+		logger.Warn("Failed to notify systemd the service is ready", zap.Error(err))
+	}
+}
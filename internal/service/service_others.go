@@ -18,6 +18,7 @@ package service
 
 import (
 	"context"
+	"os"
 	"os/signal"
 	"syscall"
 
@@ -29,5 +30,17 @@ func RunService(logger *zap.Logger, rSvc RunnableService) error {
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
-	return runServiceInteractive(ctx, logger, rSvc)
+	// Only notifies when started by systemd with Type=notify
+	n, err := newNotifier()
+	if err != nil {
+		logger.Warn("Failed to set up systemd notifications", zap.Error(err))
+	}
+	defer n.close()
+
+	// SIGHUP reloads configs, as it does for most daemons
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	defer signal.Stop(reload)
+
+	return runServiceInteractive(ctx, logger, rSvc, n, reload)
 }
@@ -17,6 +17,8 @@ package service
 import (
 	"context"
 	"errors"
+	"os"
+	"syscall"
 	"testing"
 	"time"
 
@@ -39,7 +41,7 @@ func TestRunServiceInteractive(t *testing.T) {
 		var err error
 		svcDone := make(chan struct{})
 		go func() {
-			err = runServiceInteractive(ctx, zap.NewNop(), svc)
+			err = runServiceInteractive(ctx, zap.NewNop(), svc, nil, nil)
 			close(svcDone)
 		}()
 
@@ -68,7 +70,7 @@ func TestRunServiceInteractive(t *testing.T) {
 		var err error
 		svcDone := make(chan struct{})
 		go func() {
-			err = runServiceInteractive(ctx, zap.NewNop(), svc)
+			err = runServiceInteractive(ctx, zap.NewNop(), svc, nil, nil)
 			close(svcDone)
 		}()
 
@@ -99,7 +101,7 @@ func TestRunServiceInteractive(t *testing.T) {
 		var err error
 		svcDone := make(chan struct{})
 		go func() {
-			err = runServiceInteractive(ctx, zap.NewNop(), svc)
+			err = runServiceInteractive(ctx, zap.NewNop(), svc, nil, nil)
 			close(svcDone)
 		}()
 
@@ -127,7 +129,7 @@ func TestRunServiceInteractive(t *testing.T) {
 		var err error
 		svcDone := make(chan struct{})
 		go func() {
-			err = runServiceInteractive(ctx, zap.NewNop(), svc)
+			err = runServiceInteractive(ctx, zap.NewNop(), svc, nil, nil)
 			close(svcDone)
 		}()
 
@@ -162,7 +164,7 @@ func TestRunServiceInteractive(t *testing.T) {
 		var err error
 		svcDone := make(chan struct{})
 		go func() {
-			err = runServiceInteractive(ctx, zap.NewNop(), svc)
+			err = runServiceInteractive(ctx, zap.NewNop(), svc, nil, nil)
 			close(svcDone)
 		}()
 
@@ -175,4 +177,88 @@ func TestRunServiceInteractive(t *testing.T) {
 		require.Error(t, err)
 		require.ErrorIs(t, err, stopErr)
 	})
+	t.Run("Reload signal reloads service", func(t *testing.T) {
+		svc := &reloadableService{RunnableService: &mocks.RunnableService{}, reloaded: make(chan struct{}, 1)}
+		svc.On("Start", mock.Anything).Return(nil)
+		svc.On("Error").Return((<-chan error)(make(chan error)))
+		svc.On("Stop", mock.Anything).Return(nil)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		reload := make(chan os.Signal, 1)
+		svcDone := make(chan error)
+		go func() {
+			svcDone <- runServiceInteractive(ctx, zap.NewNop(), svc, nil, reload)
+		}()
+
+		reload <- syscall.SIGHUP
+		select {
+		case <-svc.reloaded: // OK
+		case <-time.After(1 * time.Second):
+			t.Fatalf("Timed out waiting for reload")
+		}
+
+		// A failed reload keeps the service running
+		svc.err = errors.New("invalid config")
+		reload <- syscall.SIGHUP
+		select {
+		case <-svc.reloaded: // OK
+		case <-time.After(1 * time.Second):
+			t.Fatalf("Timed out waiting for reload")
+		}
+
+		select {
+		case <-svcDone:
+			t.Fatalf("Service stopped after failed reload")
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		cancel()
+		select {
+		case err := <-svcDone:
+			require.NoError(t, err)
+		case <-time.After(1 * time.Second):
+			t.Fatalf("Timed out waiting for service done")
+		}
+	})
+
+	t.Run("Reload ignored by service that doesn't support it", func(t *testing.T) {
+		svc := &mocks.RunnableService{}
+		svc.On("Start", mock.Anything).Return(nil)
+		svc.On("Error").Return((<-chan error)(make(chan error)))
+		svc.On("Stop", mock.Anything).Return(nil)
+
+		ctx, cancel := context.WithCancel(context.Background())
+
+		reload := make(chan os.Signal, 1)
+		svcDone := make(chan error)
+		go func() {
+			svcDone <- runServiceInteractive(ctx, zap.NewNop(), svc, nil, reload)
+		}()
+
+		reload <- syscall.SIGHUP
+		<-time.After(100 * time.Millisecond)
+		cancel()
+
+		select {
+		case err := <-svcDone:
+			require.NoError(t, err)
+		case <-time.After(1 * time.Second):
+			t.Fatalf("Timed out waiting for service done")
+		}
+	})
+}
+
+// reloadableService is a runnable service that signals each time it's reloaded
+type reloadableService struct {
+	*mocks.RunnableService
+	reloaded chan struct{}
+	err      error
+}
+
+func (r *reloadableService) Reload(context.Context) error {
+	err := r.err
+	r.reloaded <- struct{}{}
+	return err
 }
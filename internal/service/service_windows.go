@@ -60,7 +60,7 @@ func RunService(logger *zap.Logger, rSvc RunnableService) error {
 		ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 		defer cancel()
 
-		return runServiceInteractive(ctx, logger, rSvc)
+		return runServiceInteractive(ctx, logger, rSvc, nil, nil)
 	}
 }
 
@@ -18,26 +18,43 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"sync"
+	"sync/atomic"
 
 	"github.com/observiq/observiq-otel-collector/collector"
+	"github.com/observiq/observiq-otel-collector/internal/logging"
+	"go.uber.org/zap"
 )
 
 // StandaloneCollectorService is a RunnableService that runs the collector in standalone mode.
 type StandaloneCollectorService struct {
-	col      collector.Collector
-	doneChan chan struct{}
-	errChan  chan error
-	wg       *sync.WaitGroup
+	col               collector.Collector
+	loggingConfigPath string
+	doneChan          chan struct{}
+	errChan           chan error
+	wg                *sync.WaitGroup
+
+	// lastGood are the contents of the config files the collector last started with
+	lastGood *configSnapshot
+
+	// reloading is the number of restarts in progress, from reloads or the admin API,
+	// so a restart isn't mistaken for the collector stopping
+	reloading *int32
 }
 
-// NewStandaloneCollectorService creates a new StandaloneCollectorService
-func NewStandaloneCollectorService(c collector.Collector) StandaloneCollectorService {
+// NewStandaloneCollectorService creates a new StandaloneCollectorService.
+// The logging config and the collector's config files are read again when the service is reloaded.
+func NewStandaloneCollectorService(c collector.Collector, configPaths []string, loggingConfigPath string) StandaloneCollectorService {
 	return StandaloneCollectorService{
-		col:      c,
-		doneChan: make(chan struct{}, 1),
-		errChan:  make(chan error, 1),
-		wg:       &sync.WaitGroup{},
+		col:               c,
+		loggingConfigPath: loggingConfigPath,
+		doneChan:          make(chan struct{}, 1),
+		errChan:           make(chan error, 1),
+		wg:                &sync.WaitGroup{},
+		lastGood:          &configSnapshot{paths: configPaths},
+		reloading:         new(int32),
 	}
 }
 
@@ -47,6 +64,7 @@ func (s StandaloneCollectorService) Start(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("failed while starting collector: %w", err)
 	}
+	s.lastGood.capture()
 
 	// monitor status for errors, so we don't zombie the service
 	s.wg.Add(1)
@@ -56,24 +74,154 @@ func (s StandaloneCollectorService) Start(ctx context.Context) error {
 
 // monitorStatus monitors the collector's status for errors, and reports them
 // to the error channel to trigger a shutdown.
+// Statuses sent while restarting, or by a collector that has since started again, are ignored.
 func (s StandaloneCollectorService) monitorStatus() {
 	defer s.wg.Done()
 	statusChan := s.col.Status()
 	for {
 		select {
 		case status := <-statusChan:
-			if status.Err != nil {
-				s.errChan <- status.Err
-			} else if !status.Running {
-				// If we aren't running, bail out. Otherwise the collector is effectively a "zombie" process.
-				s.errChan <- errors.New("collector unexpectedly stopped running")
+			if status.Running || atomic.LoadInt32(s.reloading) > 0 || s.col.Running() {
+				continue
+			}
+
+			// If we aren't running, bail out. Otherwise the collector is effectively a "zombie" process.
+			err := status.Err
+			if err == nil {
+				err = errors.New("collector unexpectedly stopped running")
 			}
+			s.reportError(err)
 		case <-s.doneChan:
 			return
 		}
 	}
 }
 
+// reportError reports an unrecoverable error unless one is already waiting to be read
+func (s StandaloneCollectorService) reportError(err error) {
+	select {
+	case s.errChan <- err:
+	default:
+	}
+}
+
+// beginRestart marks a restart in progress so the collector's statuses during it are ignored
+func (s StandaloneCollectorService) beginRestart() {
+	atomic.AddInt32(s.reloading, 1)
+}
+
+// endRestart marks a restart done. Since statuses were ignored during the restart,
+// an error is reported if the restart left the collector stopped.
+func (s StandaloneCollectorService) endRestart(restartErr error) {
+	if atomic.AddInt32(s.reloading, -1) > 0 || s.col.Running() {
+		return
+	}
+
+	if restartErr == nil {
+		restartErr = errors.New("collector unexpectedly stopped running")
+	}
+	s.reportError(restartErr)
+}
+
+// Reload reads the logging config and validates the collector's config files, then restarts the collector with them.
+// The collector keeps running with its previous configs if either is invalid.
+// If the collector fails to restart, it's restarted with its previous logging options and copies of its last good config files.
+// On success the process's own logger also switches to the logging config.
+func (s StandaloneCollectorService) Reload(ctx context.Context) (returnErr error) {
+	loggerConfig, err := logging.NewLoggerConfig(s.loggingConfigPath)
+	if err != nil {
+		return fmt.Errorf("failed to read logging config: %w", err)
+	}
+
+	loggingOpts, err := loggerConfig.Options()
+	if err != nil {
+		return fmt.Errorf("invalid logging config: %w", err)
+	}
+
+	// The config files are validated as they are now, even if the collector runs from copies of them
+	s.col.SetConfigPaths(s.lastGood.paths)
+	if err := s.col.ValidateConfigFiles(ctx); err != nil {
+		s.col.SetConfigPaths(s.lastGood.activePaths())
+		return fmt.Errorf("invalid collector config: %w", err)
+	}
+
+	s.beginRestart()
+	defer func() {
+		s.endRestart(returnErr)
+	}()
+
+	previousOpts := s.col.GetLoggingOpts()
+	s.col.SetLoggingOpts(loggingOpts)
+	if err := s.col.Restart(ctx); err != nil {
+		return s.recoverReload(err, previousOpts)
+	}
+	s.lastGood.capture()
+
+	if err := logging.SetProcessLoggingOpts(loggingOpts...); err != nil {
+		return fmt.Errorf("failed to reload service logger: %w", err)
+	}
+
+	return nil
+}
+
+// recoverReload restarts the collector with its previous logging options and copies of its last good config files
+// after it failed to restart with reloaded ones. The config files themselves are left as they are.
+// The restart must not be cancelled or the collector would be left stopped.
+func (s StandaloneCollectorService) recoverReload(restartErr error, previousOpts []zap.Option) error {
+	s.col.SetLoggingOpts(previousOpts)
+
+	paths, err := s.lastGood.restore()
+	if err != nil {
+		restartErr = fmt.Errorf("%w, and failed to restore the last good config: %s", restartErr, err)
+	} else {
+		s.col.SetConfigPaths(paths)
+	}
+
+	if err := s.col.Restart(context.Background()); err != nil {
+		return fmt.Errorf("failed to restart collector: %s, and failed to restart it with its previous config: %w", restartErr, err)
+	}
+
+	return fmt.Errorf("failed to restart collector, restarted it with its previous config: %w", restartErr)
+}
+
+// CollectorStatus returns the most recent status of the collector
+func (s StandaloneCollectorService) CollectorStatus() *collector.Status {
+	return s.col.LastStatus()
+}
+
+// RestartCollector restarts the collector with its current configs
+func (s StandaloneCollectorService) RestartCollector(ctx context.Context) (returnErr error) {
+	s.beginRestart()
+	defer func() {
+		s.endRestart(returnErr)
+	}()
+
+	if err := s.col.Restart(ctx); err != nil {
+		return fmt.Errorf("failed to restart collector: %w", err)
+	}
+	return nil
+}
+
+// Health returns true while the collector is running
+func (s StandaloneCollectorService) Health() (bool, string) {
+	running := s.col.Running()
+	return running, collectorSummary(running)
+}
+
+// Alive returns true while the collector is running or restarting.
+// Nothing else restarts a standalone collector, so the service is restarted by systemd if it stays down.
+func (s StandaloneCollectorService) Alive() bool {
+	return atomic.LoadInt32(s.reloading) > 0 || s.col.Running()
+}
+
+// collectorSummary summarizes whether the collector is running for the service manager
+func collectorSummary(running bool) string {
+	if running {
+		return "Collector running"
+	}
+	return "Collector not running"
+}
+
 // Error returns a channel that can emit asynchronous, unrecoverable errors
 func (s StandaloneCollectorService) Error() <-chan error {
 	return s.errChan
@@ -87,6 +235,7 @@ func (s StandaloneCollectorService) Stop(ctx context.Context) error {
 	go func() {
 		s.col.Stop()
 		s.wg.Wait()
+		s.lastGood.cleanup()
 		close(collectorStoppedChan)
 	}()
 
@@ -97,3 +246,96 @@ func (s StandaloneCollectorService) Stop(ctx context.Context) error {
 		return fmt.Errorf("failed while waiting for service shutdown: %w", ctx.Err())
 	}
 }
+
+// configSnapshot holds the contents of config files so the collector can run from copies of them after the files change
+type configSnapshot struct {
+	paths []string
+
+	mux      sync.Mutex
+	contents map[string][]byte
+
+	// dir holds the copies of the config files once restored. Empty unless restored.
+	dir         string
+	copiedPaths []string
+}
+
+// capture records the current contents of the config files and removes any copies. Files that can't be read aren't recorded.
+func (c *configSnapshot) capture() {
+	contents := make(map[string][]byte, len(c.paths))
+	for _, path := range c.paths {
+		data, err := os.ReadFile(filepath.Clean(path))
+		if err != nil {
+			continue
+		}
+		contents[path] = data
+	}
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.contents = contents
+	c.removeCopies()
+}
+
+// restore writes the recorded contents to copies in a directory only this user can access and returns their paths.
+// Config files without recorded contents are used as they are.
+func (c *configSnapshot) restore() ([]string, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if c.dir != "" {
+		return c.copiedPaths, nil
+	}
+
+	dir, err := os.MkdirTemp("", "observiq-last-good-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create directory for last good config: %w", err)
+	}
+
+	copiedPaths := make([]string, 0, len(c.paths))
+	for i, path := range c.paths {
+		contents, ok := c.contents[path]
+		if !ok {
+			copiedPaths = append(copiedPaths, path)
+			continue
+		}
+
+		// Prefixed with the index so files with the same name don't collide
+		copiedPath := filepath.Join(dir, fmt.Sprintf("%d-%s", i, filepath.Base(path)))
+		if err := os.WriteFile(copiedPath, contents, 0600); err != nil {
+			_ = os.RemoveAll(dir)
+			return nil, fmt.Errorf("failed to copy last good config %s: %w", path, err)
+		}
+		copiedPaths = append(copiedPaths, copiedPath)
+	}
+
+	c.dir, c.copiedPaths = dir, copiedPaths
+	return copiedPaths, nil
+}
+
+// activePaths returns the paths of the copies if restored, otherwise the config files
+func (c *configSnapshot) activePaths() []string {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if c.dir != "" {
+		return c.copiedPaths
+	}
+	return c.paths
+}
+
+// cleanup removes any copies
+func (c *configSnapshot) cleanup() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.removeCopies()
+}
+
+// removeCopies removes the copies of the config files. The mutex must be held.
+func (c *configSnapshot) removeCopies() {
+	if c.dir == "" {
+		return
+	}
+
+	_ = os.RemoveAll(c.dir)
+	c.dir, c.copiedPaths = "", nil
+}
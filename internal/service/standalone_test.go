@@ -17,6 +17,9 @@ package service
 import (
 	"context"
 	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -24,6 +27,7 @@ import (
 	"github.com/observiq/observiq-otel-collector/collector/mocks"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
 )
 
 func TestStandaloneCollectorService(t *testing.T) {
@@ -36,7 +40,7 @@ func TestStandaloneCollectorService(t *testing.T) {
 		col.On("Status").Return((<-chan *collector.Status)(make(chan *collector.Status)))
 		col.On("Stop", mock.Anything).Return(nil)
 
-		srv := NewStandaloneCollectorService(col)
+		srv := NewStandaloneCollectorService(col, nil, "")
 
 		var err error
 		startedChan := make(chan struct{})
@@ -78,7 +82,7 @@ func TestStandaloneCollectorService(t *testing.T) {
 
 		col.On("Run", ctx).Return(runError)
 
-		srv := NewStandaloneCollectorService(col)
+		srv := NewStandaloneCollectorService(col, nil, "")
 
 		var err error
 		startedChan := make(chan struct{})
@@ -108,7 +112,7 @@ func TestStandaloneCollectorService(t *testing.T) {
 		col.On("Status").Return((<-chan *collector.Status)(make(chan *collector.Status))).Maybe()
 		col.On("Stop", mock.Anything).Run(func(args mock.Arguments) { time.Sleep(100 * time.Second) }).Maybe()
 
-		srv := NewStandaloneCollectorService(col)
+		srv := NewStandaloneCollectorService(col, nil, "")
 
 		var err error
 		startedChan := make(chan struct{})
@@ -159,8 +163,9 @@ func TestStandaloneCollectorService(t *testing.T) {
 		col.On("Run", ctx).Return(nil)
 		col.On("Status").Return((<-chan *collector.Status)(colStatus))
 		col.On("Stop", mock.Anything).Return(nil)
+		col.On("Running").Return(false)
 
-		srv := NewStandaloneCollectorService(col)
+		srv := NewStandaloneCollectorService(col, nil, "")
 
 		var err error
 		startedChan := make(chan struct{})
@@ -202,8 +207,9 @@ func TestStandaloneCollectorService(t *testing.T) {
 		col.On("Run", ctx).Return(nil)
 		col.On("Status").Return((<-chan *collector.Status)(colStatus))
 		col.On("Stop", mock.Anything).Return(nil)
+		col.On("Running").Return(false)
 
-		srv := NewStandaloneCollectorService(col)
+		srv := NewStandaloneCollectorService(col, nil, "")
 
 		var err error
 		startedChan := make(chan struct{})
@@ -232,3 +238,254 @@ func TestStandaloneCollectorService(t *testing.T) {
 		require.Equal(t, 0, len(srv.Error()), "error channel has elements in it!")
 	})
 }
+
+func TestStandaloneCollectorServiceHealth(t *testing.T) {
+	col := mocks.NewMockCollector(t)
+	col.On("Running").Return(true).Once()
+	col.On("Running").Return(false).Once()
+
+	srv := NewStandaloneCollectorService(col, nil, "")
+
+	healthy, summary := srv.Health()
+	require.True(t, healthy)
+	require.Equal(t, "Collector running", summary)
+
+	healthy, summary = srv.Health()
+	require.False(t, healthy)
+	require.Equal(t, "Collector not running", summary)
+}
+
+func TestStandaloneCollectorServiceAlive(t *testing.T) {
+	col := mocks.NewMockCollector(t)
+	col.On("Running").Return(true).Once()
+	col.On("Running").Return(false)
+
+	srv := NewStandaloneCollectorService(col, nil, "")
+	require.True(t, srv.Alive())
+	require.False(t, srv.Alive())
+
+	// A collector stopped while it restarts is still alive
+	srv.beginRestart()
+	require.True(t, srv.Alive())
+}
+
+func TestStandaloneCollectorServiceReload(t *testing.T) {
+	t.Run("Collector restarts with reloaded configs", func(t *testing.T) {
+		col := mocks.NewMockCollector(t)
+		colStatus := make(chan *collector.Status, 1)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		col.On("Run", ctx).Return(nil)
+		col.On("Status").Return((<-chan *collector.Status)(colStatus))
+		col.On("Stop", mock.Anything).Return(nil)
+		col.On("SetConfigPaths", []string(nil)).Return()
+		col.On("ValidateConfigFiles", mock.Anything).Return(nil)
+		col.On("GetLoggingOpts").Return(nil)
+		col.On("SetLoggingOpts", mock.Anything).Return().Once()
+		col.On("Running").Return(true)
+
+		// The collector stops while it restarts
+		restarted := make(chan struct{})
+		col.On("Restart", mock.Anything).Return(nil).Run(func(mock.Arguments) {
+			colStatus <- &collector.Status{Running: false}
+			<-restarted
+		})
+
+		srv := NewStandaloneCollectorService(col, nil, filepath.Join(t.TempDir(), "logging.yaml"))
+		require.NoError(t, srv.Start(ctx))
+		defer srv.Stop(context.Background())
+
+		reloaded := make(chan error)
+		go func() {
+			reloaded <- srv.Reload(context.Background())
+		}()
+
+		time.Sleep(100 * time.Millisecond)
+		close(restarted)
+		require.NoError(t, <-reloaded)
+
+		select {
+		case err := <-srv.Error():
+			t.Fatalf("reload was mistaken for the collector stopping: %s", err)
+		case <-time.After(200 * time.Millisecond):
+		}
+	})
+
+	t.Run("Invalid logging config", func(t *testing.T) {
+		col := mocks.NewMockCollector(t)
+
+		loggingConfigPath := filepath.Join(t.TempDir(), "logging.yaml")
+		require.NoError(t, os.WriteFile(loggingConfigPath, []byte("output: carrier-pigeon\n"), 0600))
+
+		srv := NewStandaloneCollectorService(col, nil, loggingConfigPath)
+		err := srv.Reload(context.Background())
+		require.ErrorContains(t, err, "invalid logging config")
+	})
+
+	t.Run("Invalid collector config", func(t *testing.T) {
+		col := mocks.NewMockCollector(t)
+		col.On("SetConfigPaths", []string{"config.yaml"}).Return().Twice()
+		col.On("ValidateConfigFiles", mock.Anything).Return(errors.New("unknown receivers type"))
+
+		srv := NewStandaloneCollectorService(col, []string{"config.yaml"}, "")
+		err := srv.Reload(context.Background())
+		require.EqualError(t, err, "invalid collector config: unknown receivers type")
+	})
+
+	t.Run("Restart fails, restarted with the last good config", func(t *testing.T) {
+		col := mocks.NewMockCollector(t)
+		colStatus := make(chan *collector.Status, 1)
+		previousOpts := []zap.Option{zap.Development()}
+
+		configPath := filepath.Join(t.TempDir(), "config.yaml")
+		require.NoError(t, os.WriteFile(configPath, []byte("good"), 0640))
+
+		var running int32
+		col.On("Run", mock.Anything).Return(nil).Run(func(mock.Arguments) {
+			atomic.StoreInt32(&running, 1)
+		})
+		col.On("Status").Return((<-chan *collector.Status)(colStatus))
+		col.On("Stop", mock.Anything).Return(nil)
+		col.On("Running").Return(func() bool {
+			return atomic.LoadInt32(&running) == 1
+		})
+		col.On("ValidateConfigFiles", mock.Anything).Return(nil)
+		col.On("GetLoggingOpts").Return(previousOpts)
+		col.On("SetLoggingOpts", mock.Anything).Return().Once()
+		col.On("SetLoggingOpts", previousOpts).Return().Once()
+		col.On("SetConfigPaths", []string{configPath}).Return().Once()
+
+		// The collector reports the failure like a real one does
+		col.On("Restart", mock.Anything).Return(errors.New("address already in use")).Run(func(mock.Arguments) {
+			atomic.StoreInt32(&running, 0)
+			colStatus <- &collector.Status{Running: false, Err: errors.New("address already in use")}
+		}).Once()
+
+		// Restarted from a copy of the last good config
+		var restoredPaths []string
+		col.On("SetConfigPaths", mock.Anything).Return().Run(func(args mock.Arguments) {
+			restoredPaths = args.Get(0).([]string)
+		}).Once()
+		col.On("Restart", mock.Anything).Return(nil).Run(func(mock.Arguments) {
+			require.Len(t, restoredPaths, 1)
+			require.NotEqual(t, configPath, restoredPaths[0])
+
+			data, err := os.ReadFile(restoredPaths[0])
+			require.NoError(t, err)
+			require.Equal(t, []byte("good"), data)
+			atomic.StoreInt32(&running, 1)
+		}).Once()
+
+		srv := NewStandaloneCollectorService(col, []string{configPath}, "")
+		require.NoError(t, srv.Start(context.Background()))
+
+		require.NoError(t, os.WriteFile(configPath, []byte("bad"), 0640))
+		err := srv.Reload(context.Background())
+		require.EqualError(t, err, "failed to restart collector, restarted it with its previous config: address already in use")
+
+		select {
+		case err := <-srv.Error():
+			t.Fatalf("recovered reload was mistaken for the collector stopping: %s", err)
+		case <-time.After(200 * time.Millisecond):
+		}
+
+		// The operator's config is left as it is
+		data, err := os.ReadFile(configPath)
+		require.NoError(t, err)
+		require.Equal(t, []byte("bad"), data)
+
+		info, err := os.Stat(configPath)
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0640), info.Mode().Perm())
+
+		// The copy is removed once the service stops
+		require.NoError(t, srv.Stop(context.Background()))
+		require.NoFileExists(t, restoredPaths[0])
+	})
+
+	t.Run("Restart fails twice", func(t *testing.T) {
+		col := mocks.NewMockCollector(t)
+		previousOpts := []zap.Option{zap.Development()}
+
+		col.On("SetConfigPaths", mock.Anything).Return()
+		col.On("ValidateConfigFiles", mock.Anything).Return(nil)
+		col.On("GetLoggingOpts").Return(previousOpts)
+		col.On("SetLoggingOpts", mock.Anything).Return().Once()
+		col.On("SetLoggingOpts", previousOpts).Return().Once()
+		col.On("Restart", mock.Anything).Return(errors.New("address already in use")).Once()
+		col.On("Restart", mock.Anything).Return(errors.New("permission denied")).Once()
+		col.On("Running").Return(false)
+
+		srv := NewStandaloneCollectorService(col, nil, "")
+		err := srv.Reload(context.Background())
+		require.EqualError(t, err, "failed to restart collector: address already in use, and failed to restart it with its previous config: permission denied")
+
+		// The collector is left stopped so the service shuts down
+		require.Equal(t, err, <-srv.Error())
+	})
+}
+
+func TestStandaloneCollectorServiceRestartCollector(t *testing.T) {
+	t.Run("Restart isn't mistaken for the collector stopping", func(t *testing.T) {
+		col := mocks.NewMockCollector(t)
+		colStatus := make(chan *collector.Status, 1)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		col.On("Run", ctx).Return(nil)
+		col.On("Status").Return((<-chan *collector.Status)(colStatus))
+		col.On("Stop", mock.Anything).Return(nil)
+		col.On("Running").Return(true)
+
+		// The collector stops while it restarts
+		restarted := make(chan struct{})
+		col.On("Restart", mock.Anything).Return(nil).Run(func(mock.Arguments) {
+			colStatus <- &collector.Status{Running: false}
+			<-restarted
+		})
+
+		srv := NewStandaloneCollectorService(col, nil, "")
+		require.NoError(t, srv.Start(ctx))
+		defer srv.Stop(context.Background())
+
+		done := make(chan error)
+		go func() {
+			done <- srv.RestartCollector(context.Background())
+		}()
+
+		time.Sleep(100 * time.Millisecond)
+		close(restarted)
+		require.NoError(t, <-done)
+
+		select {
+		case err := <-srv.Error():
+			t.Fatalf("restart was mistaken for the collector stopping: %s", err)
+		case <-time.After(200 * time.Millisecond):
+		}
+	})
+
+	t.Run("Restart fails", func(t *testing.T) {
+		col := mocks.NewMockCollector(t)
+		col.On("Restart", mock.Anything).Return(errors.New("address already in use"))
+		col.On("Running").Return(false)
+
+		srv := NewStandaloneCollectorService(col, nil, "")
+		err := srv.RestartCollector(context.Background())
+		require.EqualError(t, err, "failed to restart collector: address already in use")
+
+		// The collector is left stopped so the service shuts down
+		require.Equal(t, err, <-srv.Error())
+	})
+
+	t.Run("Reports the last status", func(t *testing.T) {
+		status := &collector.Status{Running: true}
+		col := mocks.NewMockCollector(t)
+		col.On("LastStatus").Return(status)
+
+		srv := NewStandaloneCollectorService(col, nil, "")
+		require.Equal(t, status, srv.CollectorStatus())
+	})
+}
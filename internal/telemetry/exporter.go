@@ -0,0 +1,58 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package telemetry
+
+import (
+	"strings"
+
+	"go.opencensus.io/metric/metricdata"
+	"go.opencensus.io/metric/metricproducer"
+)
+
+// sendFailedMetric is contained in the names of the collector's metrics counting items exporters failed to send
+const sendFailedMetric = "send_failed_"
+
+// SendFailures returns the number of spans, metric points, and log records exporters have failed to send since the process started
+func SendFailures() int64 {
+	var total int64
+	for _, producer := range metricproducer.GlobalManager().GetAll() {
+		total += sendFailures(producer.Read())
+	}
+	return total
+}
+
+// sendFailures sums the latest value of the send failure metrics
+func sendFailures(metrics []*metricdata.Metric) int64 {
+	var total int64
+	for _, metric := range metrics {
+		if metric == nil || !strings.Contains(metric.Descriptor.Name, sendFailedMetric) {
+			continue
+		}
+
+		for _, ts := range metric.TimeSeries {
+			if len(ts.Points) == 0 {
+				continue
+			}
+
+			switch value := ts.Points[len(ts.Points)-1].Value.(type) {
+			case int64:
+				total += value
+			case float64:
+				total += int64(value)
+			}
+		}
+	}
+	return total
+}
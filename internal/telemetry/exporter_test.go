@@ -0,0 +1,73 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package telemetry
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opencensus.io/metric/metricdata"
+)
+
+func TestSendFailures(t *testing.T) {
+	now := time.Now()
+
+	metric := func(name string, points ...metricdata.Point) *metricdata.Metric {
+		return &metricdata.Metric{
+			Descriptor: metricdata.Descriptor{
+				Name: name,
+				Type: metricdata.TypeCumulativeInt64,
+			},
+			TimeSeries: []*metricdata.TimeSeries{{Points: points}},
+		}
+	}
+
+	testCases := []struct {
+		desc     string
+		metrics  []*metricdata.Metric
+		expected int64
+	}{
+		{
+			desc:     "No metrics",
+			expected: 0,
+		},
+		{
+			desc: "Send failures are summed",
+			metrics: []*metricdata.Metric{
+				metric("exporter/send_failed_spans", metricdata.NewInt64Point(now, 3)),
+				metric("exporter/send_failed_metric_points", metricdata.NewInt64Point(now, 4)),
+				metric("exporter/send_failed_log_records", metricdata.NewFloat64Point(now, 5)),
+			},
+			expected: 12,
+		},
+		{
+			desc: "Other metrics are ignored",
+			metrics: []*metricdata.Metric{
+				nil,
+				metric("exporter/sent_spans", metricdata.NewInt64Point(now, 100)),
+				metric("exporter/send_failed_spans"),
+				metric("exporter/send_failed_spans", metricdata.NewInt64Point(now, 1), metricdata.NewInt64Point(now, 2)),
+			},
+			expected: 2,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			require.Equal(t, tc.expected, sendFailures(tc.metrics))
+		})
+	}
+}
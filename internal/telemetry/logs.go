@@ -0,0 +1,215 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	// DefaultLogsInterval is the default interval buffered logs are flushed on
+	DefaultLogsInterval = 10 * time.Second
+
+	// maxBufferedLogs is the number of log entries buffered before new entries are dropped
+	maxBufferedLogs = 1000
+)
+
+// LogsCore is a zapcore.Core that buffers entries and periodically sends them to a destination.
+// Failures to send are not logged since doing so would feed back into the core.
+type LogsCore struct {
+	zapcore.LevelEnabler
+	state  *logsState
+	fields []zapcore.Field
+}
+
+// logsState is the state shared by a LogsCore and the cores derived from it with With
+type logsState struct {
+	sender   *sender
+	resource map[string]string
+	interval time.Duration
+
+	mux    sync.Mutex
+	buffer plog.LogRecordSlice
+
+	doneChan chan struct{}
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+}
+
+// NewLogsCore creates a LogsCore that sends entries at or above the level to the destination in the settings
+func NewLogsCore(level zapcore.LevelEnabler, settings Settings, resource map[string]string, interval time.Duration) *LogsCore {
+	return &LogsCore{
+		LevelEnabler: level,
+		state: &logsState{
+			sender:   newSender(settings),
+			resource: resource,
+			interval: interval,
+			buffer:   plog.NewLogRecordSlice(),
+			doneChan: make(chan struct{}),
+		},
+	}
+}
+
+// Start begins periodically flushing buffered entries
+func (l *LogsCore) Start() {
+	l.state.wg.Add(1)
+	go l.state.flushLoop()
+}
+
+// Stop stops the flush loop and flushes any remaining entries
+func (l *LogsCore) Stop() {
+	l.state.stopOnce.Do(func() {
+		close(l.state.doneChan)
+		l.state.wg.Wait()
+
+		ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		defer cancel()
+		_ = l.state.flush(ctx)
+		l.state.sender.close()
+	})
+}
+
+// With adds structured context to the core
+func (l *LogsCore) With(fields []zapcore.Field) zapcore.Core {
+	combined := make([]zapcore.Field, 0, len(l.fields)+len(fields))
+	combined = append(combined, l.fields...)
+	combined = append(combined, fields...)
+
+	return &LogsCore{
+		LevelEnabler: l.LevelEnabler,
+		state:        l.state,
+		fields:       combined,
+	}
+}
+
+// Check adds the core to the checked entry if the level is enabled
+func (l *LogsCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if l.Enabled(entry.Level) {
+		return checked.AddCore(entry, l)
+	}
+	return checked
+}
+
+// Write buffers the entry to be sent on the next flush
+func (l *LogsCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, field := range l.fields {
+		field.AddTo(enc)
+	}
+	for _, field := range fields {
+		field.AddTo(enc)
+	}
+
+	l.state.mux.Lock()
+	defer l.state.mux.Unlock()
+
+	if l.state.buffer.Len() >= maxBufferedLogs {
+		return nil
+	}
+
+	record := l.state.buffer.AppendEmpty()
+	record.SetTimestamp(pcommon.NewTimestampFromTime(entry.Time))
+	record.SetObservedTimestamp(pcommon.NewTimestampFromTime(time.Now()))
+	record.SetSeverityNumber(severityNumber(entry.Level))
+	record.SetSeverityText(entry.Level.CapitalString())
+	record.Body().SetStringVal(entry.Message)
+
+	attributes := record.Attributes()
+	if entry.LoggerName != "" {
+		attributes.UpsertString("logger", entry.LoggerName)
+	}
+	if entry.Caller.Defined {
+		attributes.UpsertString("caller", entry.Caller.TrimmedPath())
+	}
+	for key, value := range enc.Fields {
+		attributes.UpsertString(key, fmt.Sprint(value))
+	}
+
+	return nil
+}
+
+// Sync is a no-op. Entries are sent on the flush interval.
+func (l *LogsCore) Sync() error {
+	return nil
+}
+
+// flushLoop flushes buffered entries on an interval until the core is stopped
+func (s *logsState) flushLoop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.doneChan:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+			_ = s.flush(ctx)
+			cancel()
+		}
+	}
+}
+
+// flush sends all buffered entries to the destination
+func (s *logsState) flush(ctx context.Context) error {
+	s.mux.Lock()
+	if s.buffer.Len() == 0 {
+		s.mux.Unlock()
+		return nil
+	}
+
+	ld := plog.NewLogs()
+	rl := ld.ResourceLogs().AppendEmpty()
+	setAttributes(rl.Resource().Attributes(), s.resource)
+	sl := rl.ScopeLogs().AppendEmpty()
+	sl.Scope().SetName(scopeName)
+	s.buffer.MoveAndAppendTo(sl.LogRecords())
+	s.mux.Unlock()
+
+	body, err := plogotlp.NewRequestFromLogs(ld).MarshalProto()
+	if err != nil {
+		return fmt.Errorf("failed to marshal logs: %w", err)
+	}
+
+	return s.sender.send(ctx, body)
+}
+
+// severityNumber maps a zap level to an OpenTelemetry severity
+func severityNumber(level zapcore.Level) plog.SeverityNumber {
+	switch level {
+	case zapcore.DebugLevel:
+		return plog.SeverityNumberDEBUG
+	case zapcore.InfoLevel:
+		return plog.SeverityNumberINFO
+	case zapcore.WarnLevel:
+		return plog.SeverityNumberWARN
+	case zapcore.ErrorLevel:
+		return plog.SeverityNumberERROR
+	case zapcore.DPanicLevel, zapcore.PanicLevel, zapcore.FatalLevel:
+		return plog.SeverityNumberFATAL
+	default:
+		return plog.SeverityNumberUNDEFINED
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package telemetry
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestLogsCore(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		testFunc func(*testing.T)
+	}{
+		{
+			desc: "Stop flushes buffered entries",
+			testFunc: func(t *testing.T) {
+				receiver := newTestReceiver(t, http.StatusOK)
+				resource := map[string]string{"service.name": "com.observiq.collector"}
+				core := NewLogsCore(zapcore.InfoLevel, Settings{Endpoint: receiver.URL}, resource, time.Hour)
+				core.Start()
+
+				logger := zap.New(core).Named("opamp").With(zap.String("component", "test"))
+				logger.Debug("filtered")
+				logger.Warn("sent", zap.Int("count", 2))
+
+				core.Stop()
+				// Stopping twice is safe
+				core.Stop()
+
+				bodies, _ := receiver.requests()
+				require.Len(t, bodies, 1)
+
+				req := plogotlp.NewRequest()
+				require.NoError(t, req.UnmarshalProto(bodies[0]))
+				rl := req.Logs().ResourceLogs().At(0)
+
+				serviceName, ok := rl.Resource().Attributes().Get("service.name")
+				require.True(t, ok)
+				require.Equal(t, "com.observiq.collector", serviceName.StringVal())
+
+				records := rl.ScopeLogs().At(0).LogRecords()
+				require.Equal(t, 1, records.Len())
+
+				record := records.At(0)
+				require.Equal(t, "sent", record.Body().StringVal())
+				require.Equal(t, plog.SeverityNumberWARN, record.SeverityNumber())
+				require.Equal(t, map[string]interface{}{
+					"logger":    "opamp",
+					"component": "test",
+					"count":     "2",
+				}, record.Attributes().AsRaw())
+			},
+		},
+		{
+			desc: "Flushes on interval",
+			testFunc: func(t *testing.T) {
+				receiver := newTestReceiver(t, http.StatusOK)
+				core := NewLogsCore(zapcore.InfoLevel, Settings{Endpoint: receiver.URL}, nil, 10*time.Millisecond)
+				core.Start()
+				defer core.Stop()
+
+				zap.New(core).Info("sent")
+
+				select {
+				case <-receiver.received:
+				case <-time.After(5 * time.Second):
+					t.Fatal("timed out waiting for logs to be flushed")
+				}
+			},
+		},
+		{
+			desc: "Buffer is bounded",
+			testFunc: func(t *testing.T) {
+				receiver := newTestReceiver(t, http.StatusOK)
+				core := NewLogsCore(zapcore.InfoLevel, Settings{Endpoint: receiver.URL}, nil, time.Hour)
+
+				logger := zap.New(core)
+				for i := 0; i < maxBufferedLogs+10; i++ {
+					logger.Info("entry")
+				}
+
+				core.Stop()
+
+				bodies, _ := receiver.requests()
+				require.Len(t, bodies, 1)
+
+				req := plogotlp.NewRequest()
+				require.NoError(t, req.UnmarshalProto(bodies[0]))
+				require.Equal(t, maxBufferedLogs, req.Logs().LogRecordCount())
+			},
+		},
+		{
+			desc: "Failed send does not return error from Stop",
+			testFunc: func(t *testing.T) {
+				receiver := newTestReceiver(t, http.StatusInternalServerError)
+				core := NewLogsCore(zapcore.InfoLevel, Settings{Endpoint: receiver.URL}, nil, time.Hour)
+				core.Start()
+
+				zap.New(core).Info("dropped")
+				core.Stop()
+
+				bodies, _ := receiver.requests()
+				require.Len(t, bodies, 1)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, tc.testFunc)
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opencensus.io/metric/metricdata"
+	"go.opencensus.io/metric/metricexport"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+	"go.uber.org/zap"
+)
+
+// DefaultMetricsInterval is the default interval the collector's own metrics are reported on
+const DefaultMetricsInterval = time.Minute
+
+// MetricsReporter periodically reads the collector's internal metrics and sends them to a destination
+type MetricsReporter struct {
+	logger   *zap.Logger
+	sender   *sender
+	resource map[string]string
+	reader   *metricexport.IntervalReader
+}
+
+// NewMetricsReporter creates a MetricsReporter that sends metrics described by the resource to the destination in the settings
+func NewMetricsReporter(logger *zap.Logger, settings Settings, resource map[string]string, interval time.Duration) (*MetricsReporter, error) {
+	m := &MetricsReporter{
+		logger:   logger,
+		sender:   newSender(settings),
+		resource: resource,
+	}
+
+	reader, err := metricexport.NewIntervalReader(metricexport.NewReader(), m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create metrics reader: %w", err)
+	}
+	reader.ReportingInterval = interval
+	m.reader = reader
+
+	return m, nil
+}
+
+// Start begins reporting metrics
+func (m *MetricsReporter) Start() error {
+	return m.reader.Start()
+}
+
+// Stop stops reporting metrics. Metrics are flushed one last time before returning.
+func (m *MetricsReporter) Stop() {
+	m.reader.Stop()
+	m.sender.close()
+}
+
+// ExportMetrics sends the metrics to the destination. It satisfies the metricexport.Exporter interface.
+func (m *MetricsReporter) ExportMetrics(ctx context.Context, metrics []*metricdata.Metric) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+
+	body, err := pmetricotlp.NewRequestFromMetrics(m.toPdata(metrics)).MarshalProto()
+	if err != nil {
+		return fmt.Errorf("failed to marshal metrics: %w", err)
+	}
+
+	if err := m.sender.send(ctx, body); err != nil {
+		m.logger.Warn("Failed to send own metrics", zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// toPdata converts OpenCensus metrics into pdata metrics
+func (m *MetricsReporter) toPdata(metrics []*metricdata.Metric) pmetric.Metrics {
+	md := pmetric.NewMetrics()
+	rm := md.ResourceMetrics().AppendEmpty()
+	setAttributes(rm.Resource().Attributes(), m.resource)
+
+	sm := rm.ScopeMetrics().AppendEmpty()
+	sm.Scope().SetName(scopeName)
+
+	for _, metric := range metrics {
+		if metric == nil {
+			continue
+		}
+		convertMetric(metric, sm.Metrics())
+	}
+
+	return md
+}
+
+// convertMetric converts an OpenCensus metric and appends it to the slice. Summaries are not supported and are skipped.
+func convertMetric(metric *metricdata.Metric, dest pmetric.MetricSlice) {
+	descriptor := metric.Descriptor
+
+	var appendPoint func(ts *metricdata.TimeSeries, point metricdata.Point)
+
+	pm := pmetric.NewMetric()
+	switch descriptor.Type {
+	case metricdata.TypeGaugeInt64, metricdata.TypeGaugeFloat64:
+		pm.SetDataType(pmetric.MetricDataTypeGauge)
+		dps := pm.Gauge().DataPoints()
+		appendPoint = func(ts *metricdata.TimeSeries, point metricdata.Point) {
+			setNumberPoint(dps.AppendEmpty(), descriptor, ts, point)
+		}
+	case metricdata.TypeCumulativeInt64, metricdata.TypeCumulativeFloat64:
+		pm.SetDataType(pmetric.MetricDataTypeSum)
+		pm.Sum().SetIsMonotonic(true)
+		pm.Sum().SetAggregationTemporality(pmetric.MetricAggregationTemporalityCumulative)
+		dps := pm.Sum().DataPoints()
+		appendPoint = func(ts *metricdata.TimeSeries, point metricdata.Point) {
+			setNumberPoint(dps.AppendEmpty(), descriptor, ts, point)
+		}
+	case metricdata.TypeGaugeDistribution, metricdata.TypeCumulativeDistribution:
+		pm.SetDataType(pmetric.MetricDataTypeHistogram)
+		pm.Histogram().SetAggregationTemporality(pmetric.MetricAggregationTemporalityCumulative)
+		dps := pm.Histogram().DataPoints()
+		appendPoint = func(ts *metricdata.TimeSeries, point metricdata.Point) {
+			setHistogramPoint(dps.AppendEmpty(), descriptor, ts, point)
+		}
+	default:
+		return
+	}
+
+	pm.SetName(descriptor.Name)
+	pm.SetDescription(descriptor.Description)
+	pm.SetUnit(string(descriptor.Unit))
+
+	for _, ts := range metric.TimeSeries {
+		for _, point := range ts.Points {
+			appendPoint(ts, point)
+		}
+	}
+
+	pm.MoveTo(dest.AppendEmpty())
+}
+
+// setNumberPoint sets the values of the number data point from the OpenCensus point
+func setNumberPoint(dp pmetric.NumberDataPoint, descriptor metricdata.Descriptor, ts *metricdata.TimeSeries, point metricdata.Point) {
+	setPointCommon(dp.Attributes(), descriptor, ts)
+	dp.SetStartTimestamp(pcommon.NewTimestampFromTime(ts.StartTime))
+	dp.SetTimestamp(pcommon.NewTimestampFromTime(point.Time))
+
+	switch value := point.Value.(type) {
+	case int64:
+		dp.SetIntVal(value)
+	case float64:
+		dp.SetDoubleVal(value)
+	}
+}
+
+// setHistogramPoint sets the values of the histogram data point from the OpenCensus distribution point
+func setHistogramPoint(dp pmetric.HistogramDataPoint, descriptor metricdata.Descriptor, ts *metricdata.TimeSeries, point metricdata.Point) {
+	setPointCommon(dp.Attributes(), descriptor, ts)
+	dp.SetStartTimestamp(pcommon.NewTimestampFromTime(ts.StartTime))
+	dp.SetTimestamp(pcommon.NewTimestampFromTime(point.Time))
+
+	distribution, ok := point.Value.(*metricdata.Distribution)
+	if !ok || distribution == nil {
+		return
+	}
+
+	dp.SetCount(uint64(distribution.Count))
+	dp.SetSum(distribution.Sum)
+
+	bucketCounts := make([]uint64, 0, len(distribution.Buckets))
+	for _, bucket := range distribution.Buckets {
+		bucketCounts = append(bucketCounts, uint64(bucket.Count))
+	}
+	dp.SetBucketCounts(pcommon.NewImmutableUInt64Slice(bucketCounts))
+
+	if distribution.BucketOptions != nil {
+		dp.SetExplicitBounds(pcommon.NewImmutableFloat64Slice(distribution.BucketOptions.Bounds))
+	}
+}
+
+// setPointCommon sets the attributes of a data point from the OpenCensus labels
+func setPointCommon(attributes pcommon.Map, descriptor metricdata.Descriptor, ts *metricdata.TimeSeries) {
+	for i, labelValue := range ts.LabelValues {
+		if !labelValue.Present || i >= len(descriptor.LabelKeys) {
+			continue
+		}
+		attributes.UpsertString(descriptor.LabelKeys[i].Key, labelValue.Value)
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package telemetry
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opencensus.io/metric/metricdata"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+	"go.uber.org/zap"
+)
+
+func TestMetricsReporterExportMetrics(t *testing.T) {
+	now := time.Now()
+	resource := map[string]string{"service.name": "com.observiq.collector"}
+
+	testMetrics := []*metricdata.Metric{
+		{
+			Descriptor: metricdata.Descriptor{
+				Name:      "otelcol_exporter_sent_spans",
+				Unit:      metricdata.UnitDimensionless,
+				Type:      metricdata.TypeCumulativeInt64,
+				LabelKeys: []metricdata.LabelKey{{Key: "exporter"}},
+			},
+			TimeSeries: []*metricdata.TimeSeries{
+				{
+					LabelValues: []metricdata.LabelValue{metricdata.NewLabelValue("otlp")},
+					Points:      []metricdata.Point{metricdata.NewInt64Point(now, 10)},
+					StartTime:   now.Add(-time.Minute),
+				},
+			},
+		},
+		{
+			Descriptor: metricdata.Descriptor{
+				Name: "otelcol_process_memory_rss",
+				Unit: metricdata.UnitBytes,
+				Type: metricdata.TypeGaugeFloat64,
+			},
+			TimeSeries: []*metricdata.TimeSeries{
+				{Points: []metricdata.Point{metricdata.NewFloat64Point(now, 1024.5)}},
+			},
+		},
+		{
+			Descriptor: metricdata.Descriptor{
+				Name: "otelcol_processor_batch_batch_send_size",
+				Type: metricdata.TypeCumulativeDistribution,
+			},
+			TimeSeries: []*metricdata.TimeSeries{
+				{
+					Points: []metricdata.Point{metricdata.NewDistributionPoint(now, &metricdata.Distribution{
+						Count:         3,
+						Sum:           30,
+						BucketOptions: &metricdata.BucketOptions{Bounds: []float64{10}},
+						Buckets:       []metricdata.Bucket{{Count: 1}, {Count: 2}},
+					})},
+				},
+			},
+		},
+		{
+			Descriptor: metricdata.Descriptor{
+				Name: "unsupported_summary",
+				Type: metricdata.TypeSummary,
+			},
+		},
+	}
+
+	receiver := newTestReceiver(t, http.StatusOK)
+	reporter, err := NewMetricsReporter(zap.NewNop(), Settings{Endpoint: receiver.URL}, resource, time.Hour)
+	require.NoError(t, err)
+	defer reporter.sender.close()
+
+	require.NoError(t, reporter.ExportMetrics(context.Background(), testMetrics))
+
+	bodies, _ := receiver.requests()
+	require.Len(t, bodies, 1)
+
+	req := pmetricotlp.NewRequest()
+	require.NoError(t, req.UnmarshalProto(bodies[0]))
+	md := req.Metrics()
+
+	require.Equal(t, 1, md.ResourceMetrics().Len())
+	rm := md.ResourceMetrics().At(0)
+	serviceName, ok := rm.Resource().Attributes().Get("service.name")
+	require.True(t, ok)
+	require.Equal(t, "com.observiq.collector", serviceName.StringVal())
+
+	metrics := rm.ScopeMetrics().At(0).Metrics()
+	require.Equal(t, 3, metrics.Len())
+
+	sum := metrics.At(0)
+	require.Equal(t, "otelcol_exporter_sent_spans", sum.Name())
+	require.Equal(t, pmetric.MetricDataTypeSum, sum.DataType())
+	require.True(t, sum.Sum().IsMonotonic())
+	require.Equal(t, int64(10), sum.Sum().DataPoints().At(0).IntVal())
+	exporter, ok := sum.Sum().DataPoints().At(0).Attributes().Get("exporter")
+	require.True(t, ok)
+	require.Equal(t, "otlp", exporter.StringVal())
+
+	gauge := metrics.At(1)
+	require.Equal(t, pmetric.MetricDataTypeGauge, gauge.DataType())
+	require.Equal(t, "By", gauge.Unit())
+	require.Equal(t, 1024.5, gauge.Gauge().DataPoints().At(0).DoubleVal())
+
+	histogram := metrics.At(2)
+	require.Equal(t, pmetric.MetricDataTypeHistogram, histogram.DataType())
+	dp := histogram.Histogram().DataPoints().At(0)
+	require.Equal(t, uint64(3), dp.Count())
+	require.Equal(t, 30.0, dp.Sum())
+	require.Equal(t, []float64{10}, dp.ExplicitBounds().AsRaw())
+	require.Equal(t, []uint64{1, 2}, dp.BucketCounts().AsRaw())
+}
+
+func TestMetricsReporterExportMetricsError(t *testing.T) {
+	receiver := newTestReceiver(t, http.StatusInternalServerError)
+	reporter, err := NewMetricsReporter(zap.NewNop(), Settings{Endpoint: receiver.URL}, nil, time.Hour)
+	require.NoError(t, err)
+	defer reporter.sender.close()
+
+	require.NoError(t, reporter.ExportMetrics(context.Background(), nil))
+
+	err = reporter.ExportMetrics(context.Background(), []*metricdata.Metric{
+		{
+			Descriptor: metricdata.Descriptor{Name: "gauge", Type: metricdata.TypeGaugeInt64},
+			TimeSeries: []*metricdata.TimeSeries{
+				{Points: []metricdata.Point{metricdata.NewInt64Point(time.Now(), 1)}},
+			},
+		},
+	})
+	require.Error(t, err)
+}
@@ -0,0 +1,27 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package telemetry
+
+import "go.opentelemetry.io/collector/pdata/pcommon"
+
+// scopeName is the instrumentation scope of all telemetry sent by this package
+const scopeName = "github.com/observiq/observiq-otel-collector/internal/telemetry"
+
+// setAttributes upserts each of the values into the attribute map
+func setAttributes(attributes pcommon.Map, values map[string]string) {
+	for key, value := range values {
+		attributes.UpsertString(key, value)
+	}
+}
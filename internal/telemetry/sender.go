@@ -0,0 +1,94 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package telemetry sends the collector's own telemetry to destinations supplied at runtime
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// sendTimeout is the timeout for a single request to a destination
+const sendTimeout = 10 * time.Second
+
+// Settings describe an OTLP/HTTP destination for the collector's own telemetry
+type Settings struct {
+	// Endpoint is the full URL, including path, of an OTLP/HTTP receiver
+	Endpoint string
+
+	// Headers are added to every request sent to the endpoint
+	Headers map[string]string
+
+	// TLS is used for https endpoints. May be nil.
+	TLS *tls.Config
+}
+
+// sender posts protobuf encoded OTLP requests to a destination
+type sender struct {
+	settings Settings
+	client   *http.Client
+}
+
+// newSender creates a sender for the settings
+func newSender(settings Settings) *sender {
+	return &sender{
+		settings: settings,
+		client: &http.Client{
+			Timeout: sendTimeout,
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: settings.TLS,
+			},
+		},
+	}
+}
+
+// send posts the body to the endpoint
+func (s *sender) send(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.settings.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	for key, value := range s.settings.Headers {
+		req.Header.Set(key, value)
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("destination responded with status %s", resp.Status)
+	}
+
+	return nil
+}
+
+// close releases idle connections held by the sender
+func (s *sender) close() {
+	s.client.CloseIdleConnections()
+}
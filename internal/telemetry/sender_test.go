@@ -0,0 +1,117 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package telemetry
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testReceiver records requests sent to an httptest server
+type testReceiver struct {
+	*httptest.Server
+	mux      sync.Mutex
+	bodies   [][]byte
+	headers  []http.Header
+	status   int
+	received chan struct{}
+}
+
+func newTestReceiver(t *testing.T, status int) *testReceiver {
+	r := &testReceiver{
+		status:   status,
+		received: make(chan struct{}, 100),
+	}
+
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, err := io.ReadAll(req.Body)
+		require.NoError(t, err)
+
+		r.mux.Lock()
+		r.bodies = append(r.bodies, body)
+		r.headers = append(r.headers, req.Header.Clone())
+		r.mux.Unlock()
+
+		w.WriteHeader(r.status)
+		r.received <- struct{}{}
+	}))
+	t.Cleanup(r.Close)
+
+	return r
+}
+
+func (r *testReceiver) requests() ([][]byte, []http.Header) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return r.bodies, r.headers
+}
+
+func TestSenderSend(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		testFunc func(*testing.T)
+	}{
+		{
+			desc: "Successful send",
+			testFunc: func(t *testing.T) {
+				receiver := newTestReceiver(t, http.StatusOK)
+				s := newSender(Settings{
+					Endpoint: receiver.URL + "/v1/metrics",
+					Headers:  map[string]string{"Authorization": "Bearer token"},
+				})
+				defer s.close()
+
+				require.NoError(t, s.send(context.Background(), []byte("payload")))
+
+				bodies, headers := receiver.requests()
+				require.Len(t, bodies, 1)
+				require.Equal(t, []byte("payload"), bodies[0])
+				require.Equal(t, "Bearer token", headers[0].Get("Authorization"))
+				require.Equal(t, "application/x-protobuf", headers[0].Get("Content-Type"))
+			},
+		},
+		{
+			desc: "Error status",
+			testFunc: func(t *testing.T) {
+				receiver := newTestReceiver(t, http.StatusUnauthorized)
+				s := newSender(Settings{Endpoint: receiver.URL})
+				defer s.close()
+
+				err := s.send(context.Background(), []byte("payload"))
+				require.ErrorContains(t, err, "401")
+			},
+		},
+		{
+			desc: "Invalid endpoint",
+			testFunc: func(t *testing.T) {
+				s := newSender(Settings{Endpoint: "http://\x7f"})
+				defer s.close()
+
+				err := s.send(context.Background(), []byte("payload"))
+				require.ErrorContains(t, err, "failed to create request")
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, tc.testFunc)
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opamp
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	ios "github.com/observiq/observiq-otel-collector/internal/os"
+	"gopkg.in/yaml.v3"
+)
+
+// AgentIDStrategy determines how an agent ID is generated when one isn't configured
+type AgentIDStrategy string
+
+const (
+	// AgentIDStrategyRandom generates a random ID. It's stable as long as the manager config it's written to persists.
+	AgentIDStrategyRandom AgentIDStrategy = "random"
+
+	// AgentIDStrategyMachineID derives the ID from the host's machine ID
+	AgentIDStrategyMachineID AgentIDStrategy = "machine-id"
+
+	// AgentIDStrategyKubernetesPod derives the ID from the namespace and name of the pod
+	AgentIDStrategyKubernetesPod AgentIDStrategy = "kubernetes-pod"
+
+	// AgentIDStrategyKubernetesStatefulSet derives the ID from the namespace, StatefulSet, and ordinal of the pod
+	AgentIDStrategyKubernetesStatefulSet AgentIDStrategy = "kubernetes-statefulset"
+
+	// AgentIDStrategyHostAttributes derives the ID from a hash of chosen host attributes
+	AgentIDStrategyHostAttributes AgentIDStrategy = "host-attributes"
+)
+
+// DefaultAgentIDAttributes are the host attributes used by the host-attributes strategy if none are chosen
+var DefaultAgentIDAttributes = []string{"host.name", "host.mac_address"}
+
+// ErrUnknownAgentIDStrategy is returned for an agent ID strategy that doesn't exist
+var ErrUnknownAgentIDStrategy = errors.New("unknown agent ID strategy")
+
+// agentIDNamespace is the namespace of derived agent IDs.
+// Hashing inputs within it keeps identifiers like the machine ID from being exposed.
+var agentIDNamespace = uuid.NewSHA1(uuid.NameSpaceURL, []byte("https://observiq.com/observiq-otel-collector/agent-id"))
+
+// statefulSetPodRegex matches the name of a StatefulSet pod, which is the StatefulSet name followed by the ordinal
+var statefulSetPodRegex = regexp.MustCompile(`^(.+)-(\d+)$`)
+
+// agentIDSource provides the host values agent IDs are derived from. It is replaced in tests.
+type agentIDSource struct {
+	hostname   func() (string, error)
+	macAddress func() string
+	machineID  func() (string, error)
+	details    func() ios.HostDetails
+}
+
+// defaultAgentIDSource reads values from the host
+var defaultAgentIDSource = agentIDSource{
+	hostname:   ios.Hostname,
+	macAddress: ios.MACAddress,
+	machineID:  ios.MachineID,
+	details:    ios.Details,
+}
+
+// NewAgentID generates an agent ID using the strategy.
+// Derived strategies return an error rather than an ID likely to collide with another agent's.
+func NewAgentID(strategy AgentIDStrategy, attributes []string) (string, error) {
+	return newAgentID(defaultAgentIDSource, strategy, attributes)
+}
+
+// EnsureAgentID generates an agent ID for a config without one using its strategy.
+// Random IDs are written back to configPath so the ID persists across restarts.
+// Derived IDs are generated the same each time, so they're only kept in the config and configPath may be read-only.
+func EnsureAgentID(configPath string, cfg *Config) error {
+	return ensureAgentID(defaultAgentIDSource, configPath, cfg)
+}
+
+// ensureAgentID generates an agent ID for a config without one using the source's values
+func ensureAgentID(source agentIDSource, configPath string, cfg *Config) error {
+	if cfg.AgentID != "" {
+		return nil
+	}
+
+	agentID, err := newAgentID(source, cfg.AgentIDStrategy, cfg.AgentIDAttributes)
+	if err != nil {
+		return fmt.Errorf("failed to generate agent ID: %w", err)
+	}
+	cfg.AgentID = agentID
+
+	if cfg.AgentIDStrategy != AgentIDStrategyRandom && cfg.AgentIDStrategy != "" {
+		return nil
+	}
+
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+
+	return WriteFileAtomic(configPath, data, 0600)
+}
+
+// newAgentID generates an agent ID using the strategy from the source's values
+func newAgentID(source agentIDSource, strategy AgentIDStrategy, attributes []string) (string, error) {
+	var name string
+	switch strategy {
+	case AgentIDStrategyRandom, "":
+		return uuid.New().String(), nil
+	case AgentIDStrategyMachineID:
+		machineID, err := source.machineID()
+		if err != nil {
+			return "", fmt.Errorf("failed to read machine ID: %w", err)
+		}
+		name = machineID
+	case AgentIDStrategyKubernetesPod:
+		details := source.details()
+		if details.KubernetesNamespace == "" || details.KubernetesPodName == "" {
+			return "", errors.New("not running in a Kubernetes pod")
+		}
+		name = details.KubernetesNamespace + "/" + details.KubernetesPodName
+	case AgentIDStrategyKubernetesStatefulSet:
+		details := source.details()
+		if details.KubernetesNamespace == "" || details.KubernetesPodName == "" {
+			return "", errors.New("not running in a Kubernetes pod")
+		}
+		matches := statefulSetPodRegex.FindStringSubmatch(details.KubernetesPodName)
+		if matches == nil {
+			return "", fmt.Errorf("pod %s is not part of a StatefulSet", details.KubernetesPodName)
+		}
+		name = fmt.Sprintf("%s/%s/%s", details.KubernetesNamespace, matches[1], matches[2])
+	case AgentIDStrategyHostAttributes:
+		attributesName, err := hostAttributesName(source, attributes)
+		if err != nil {
+			return "", err
+		}
+		name = attributesName
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnknownAgentIDStrategy, strategy)
+	}
+
+	// The strategy is part of the name so different strategies never derive the same ID
+	return uuid.NewSHA1(agentIDNamespace, []byte(string(strategy)+":"+name)).String(), nil
+}
+
+// hostAttributesName joins the values of the attributes in a stable order.
+// Every attribute must have a value, otherwise hosts missing it are more likely to collide.
+func hostAttributesName(source agentIDSource, attributes []string) (string, error) {
+	if len(attributes) == 0 {
+		attributes = DefaultAgentIDAttributes
+	}
+
+	details := source.details()
+
+	values := make([]string, 0, len(attributes))
+	for _, attribute := range attributes {
+		var value string
+		switch attribute {
+		case "host.name":
+			hostname, err := source.hostname()
+			if err == nil {
+				value = hostname
+			}
+		case "host.mac_address":
+			value = source.macAddress()
+		case "host.machine_id":
+			machineID, err := source.machineID()
+			if err == nil {
+				value = machineID
+			}
+		case "host.ip":
+			value = strings.Join(details.IPAddresses, ",")
+		case "container.id":
+			value = details.ContainerID
+		case "k8s.pod.name":
+			value = details.KubernetesPodName
+		case "k8s.namespace.name":
+			value = details.KubernetesNamespace
+		case "k8s.node.name":
+			value = details.KubernetesNodeName
+		case "cloud.provider":
+			value = details.CloudProvider
+		case "cloud.region":
+			value = details.CloudRegion
+		default:
+			return "", fmt.Errorf("unsupported agent ID attribute: %s", attribute)
+		}
+
+		if value == "" || value == "unknown" {
+			return "", fmt.Errorf("agent ID attribute %s has no value", attribute)
+		}
+		values = append(values, attribute+"="+value)
+	}
+
+	sort.Strings(values)
+	return strings.Join(values, ";"), nil
+}
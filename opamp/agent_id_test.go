@@ -0,0 +1,221 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opamp
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	ios "github.com/observiq/observiq-otel-collector/internal/os"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAgentID(t *testing.T) {
+	// source returns an agent ID source with the given host values
+	source := func(hostname, machineID string, details ios.HostDetails) agentIDSource {
+		return agentIDSource{
+			hostname: func() (string, error) {
+				return hostname, nil
+			},
+			macAddress: func() string {
+				return "68-C7-B4-EB-A8-D2"
+			},
+			machineID: func() (string, error) {
+				if machineID == "" {
+					return "", ios.ErrInvalidMachineID
+				}
+				return machineID, nil
+			},
+			details: func() ios.HostDetails {
+				return details
+			},
+		}
+	}
+
+	podDetails := ios.HostDetails{
+		KubernetesNamespace: "observiq",
+		KubernetesPodName:   "collector-0",
+	}
+
+	testCases := []struct {
+		desc     string
+		testFunc func(*testing.T)
+	}{
+		{
+			desc: "Random IDs differ",
+			testFunc: func(t *testing.T) {
+				src := source("host", "", ios.HostDetails{})
+
+				first, err := newAgentID(src, AgentIDStrategyRandom, nil)
+				require.NoError(t, err)
+				second, err := newAgentID(src, "", nil)
+				require.NoError(t, err)
+				assert.NotEqual(t, first, second)
+			},
+		},
+		{
+			desc: "Derived IDs are stable UUIDs",
+			testFunc: func(t *testing.T) {
+				strategies := []AgentIDStrategy{
+					AgentIDStrategyMachineID,
+					AgentIDStrategyKubernetesPod,
+					AgentIDStrategyKubernetesStatefulSet,
+					AgentIDStrategyHostAttributes,
+				}
+
+				ids := make(map[string]struct{})
+				for _, strategy := range strategies {
+					first, err := newAgentID(source("host", "0123456789abcdef", podDetails), strategy, nil)
+					require.NoError(t, err)
+					second, err := newAgentID(source("host", "0123456789abcdef", podDetails), strategy, nil)
+					require.NoError(t, err)
+					assert.Equal(t, first, second)
+
+					_, err = uuid.Parse(first)
+					require.NoError(t, err)
+					ids[first] = struct{}{}
+				}
+
+				// Strategies never derive the same ID
+				assert.Len(t, ids, len(strategies))
+			},
+		},
+		{
+			desc: "Machine ID",
+			testFunc: func(t *testing.T) {
+				first, err := newAgentID(source("host", "0123456789abcdef", ios.HostDetails{}), AgentIDStrategyMachineID, nil)
+				require.NoError(t, err)
+				second, err := newAgentID(source("host", "fedcba9876543210", ios.HostDetails{}), AgentIDStrategyMachineID, nil)
+				require.NoError(t, err)
+				assert.NotEqual(t, first, second)
+
+				_, err = newAgentID(source("host", "", ios.HostDetails{}), AgentIDStrategyMachineID, nil)
+				require.ErrorIs(t, err, ios.ErrInvalidMachineID)
+			},
+		},
+		{
+			desc: "Kubernetes outside of a pod",
+			testFunc: func(t *testing.T) {
+				_, err := newAgentID(source("host", "", ios.HostDetails{}), AgentIDStrategyKubernetesPod, nil)
+				require.ErrorContains(t, err, "not running in a Kubernetes pod")
+
+				_, err = newAgentID(source("host", "", ios.HostDetails{}), AgentIDStrategyKubernetesStatefulSet, nil)
+				require.ErrorContains(t, err, "not running in a Kubernetes pod")
+			},
+		},
+		{
+			desc: "StatefulSet ordinal",
+			testFunc: func(t *testing.T) {
+				first, err := newAgentID(source("host", "", podDetails), AgentIDStrategyKubernetesStatefulSet, nil)
+				require.NoError(t, err)
+
+				otherPod := podDetails
+				otherPod.KubernetesPodName = "collector-1"
+				second, err := newAgentID(source("host", "", otherPod), AgentIDStrategyKubernetesStatefulSet, nil)
+				require.NoError(t, err)
+				assert.NotEqual(t, first, second)
+
+				deploymentPod := podDetails
+				deploymentPod.KubernetesPodName = "collector-7d4b9c8f6d-x2x9k"
+				_, err = newAgentID(source("host", "", deploymentPod), AgentIDStrategyKubernetesStatefulSet, nil)
+				require.ErrorContains(t, err, "is not part of a StatefulSet")
+			},
+		},
+		{
+			desc: "Host attributes",
+			testFunc: func(t *testing.T) {
+				details := ios.HostDetails{
+					KubernetesNodeName: "node-1",
+					CloudProvider:      "aws",
+				}
+
+				first, err := newAgentID(source("host", "", details), AgentIDStrategyHostAttributes, []string{"k8s.node.name", "host.name"})
+				require.NoError(t, err)
+
+				// Order doesn't matter
+				second, err := newAgentID(source("host", "", details), AgentIDStrategyHostAttributes, []string{"host.name", "k8s.node.name"})
+				require.NoError(t, err)
+				assert.Equal(t, first, second)
+
+				third, err := newAgentID(source("other-host", "", details), AgentIDStrategyHostAttributes, []string{"host.name", "k8s.node.name"})
+				require.NoError(t, err)
+				assert.NotEqual(t, first, third)
+
+				_, err = newAgentID(source("host", "", details), AgentIDStrategyHostAttributes, []string{"host.machine_id"})
+				require.ErrorContains(t, err, "agent ID attribute host.machine_id has no value")
+
+				_, err = newAgentID(source("host", "", details), AgentIDStrategyHostAttributes, []string{"host.serial"})
+				require.ErrorContains(t, err, "unsupported agent ID attribute: host.serial")
+			},
+		},
+		{
+			desc: "Unknown strategy",
+			testFunc: func(t *testing.T) {
+				_, err := newAgentID(source("host", "", ios.HostDetails{}), "serial-number", nil)
+				require.True(t, errors.Is(err, ErrUnknownAgentIDStrategy))
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, tc.testFunc)
+	}
+}
+
+func TestEnsureAgentID(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "manager.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte("endpoint: ws://localhost:1234\n"), 0600))
+
+	cfg, err := ParseConfig(configPath)
+	require.NoError(t, err)
+	require.Empty(t, cfg.AgentID)
+
+	require.NoError(t, EnsureAgentID(configPath, cfg))
+	require.NotEmpty(t, cfg.AgentID)
+
+	// The generated ID is persisted and reused
+	persistedCfg, err := ParseConfig(configPath)
+	require.NoError(t, err)
+	require.Equal(t, cfg.AgentID, persistedCfg.AgentID)
+
+	agentID := cfg.AgentID
+	require.NoError(t, EnsureAgentID(configPath, persistedCfg))
+	require.Equal(t, agentID, persistedCfg.AgentID)
+}
+
+func TestEnsureAgentIDDerived(t *testing.T) {
+	source := agentIDSource{
+		machineID: func() (string, error) {
+			return "5c1b7a9e2f3d4e8a9b0c1d2e3f4a5b6c", nil
+		},
+	}
+
+	// The config is read-only, such as one mounted from a ConfigMap
+	configPath := filepath.Join(t.TempDir(), "missing", "manager.yaml")
+	cfg := &Config{Endpoint: "ws://localhost:1234", AgentIDStrategy: AgentIDStrategyMachineID}
+
+	require.NoError(t, ensureAgentID(source, configPath, cfg))
+	require.NotEmpty(t, cfg.AgentID)
+	require.NoFileExists(t, configPath)
+
+	// The same ID is derived on the next start
+	nextCfg := &Config{Endpoint: "ws://localhost:1234", AgentIDStrategy: AgentIDStrategyMachineID}
+	require.NoError(t, ensureAgentID(source, configPath, nextCfg))
+	require.Equal(t, cfg.AgentID, nextCfg.AgentID)
+}
@@ -0,0 +1,197 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opamp
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// AuditResult is the outcome of a remote config recorded in the audit log
+type AuditResult string
+
+const (
+	// AuditResultApplied is a remote config that changed configs
+	AuditResultApplied AuditResult = "applied"
+
+	// AuditResultUnchanged is a remote config that matched the current configs
+	AuditResultUnchanged AuditResult = "unchanged"
+
+	// AuditResultFailed is a remote config that failed to apply
+	AuditResultFailed AuditResult = "failed"
+
+	// AuditResultRolledBack is a remote config that was rolled back after failing probation
+	AuditResultRolledBack AuditResult = "rolled_back"
+
+	// AuditResultSuperseded is a remote config skipped in favor of a newer one
+	AuditResultSuperseded AuditResult = "superseded"
+)
+
+// AuditConfig configures the audit log of remote config changes.
+// The retention settings match those of the collector's log file.
+type AuditConfig struct {
+	// Filename is the file entries are appended to
+	Filename string `yaml:"filename"`
+
+	// MaxSize is the size in megabytes the file reaches before it's rotated. Defaults to 100.
+	MaxSize int `yaml:"maxsize,omitempty"`
+
+	// MaxAge is the number of days rotated files are kept. Zero keeps them regardless of age.
+	MaxAge int `yaml:"maxage,omitempty"`
+
+	// MaxBackups is the number of rotated files kept. Zero keeps all of them.
+	MaxBackups int `yaml:"maxbackups,omitempty"`
+
+	// Compress rotated files with gzip
+	Compress bool `yaml:"compress,omitempty"`
+}
+
+// AuditEntry records a remote config received from the server and what it changed
+type AuditEntry struct {
+	Time             time.Time   `json:"time"`
+	AgentID          string      `json:"agent_id"`
+	Endpoint         string      `json:"endpoint"`
+	RemoteConfigHash string      `json:"remote_config_hash"`
+	Result           AuditResult `json:"result"`
+	Error            string      `json:"error,omitempty"`
+
+	// RollbackRequest is the body of a rollback request included in the remote config
+	RollbackRequest string `json:"rollback_request,omitempty"`
+
+	Configs []AuditConfigChange `json:"configs,omitempty"`
+	Steps   []AuditStep         `json:"steps,omitempty"`
+}
+
+// AuditConfigChange records the change to a single config.
+// Diffs are of the redacted configs so they never contain secrets.
+type AuditConfigChange struct {
+	Name    string `json:"name"`
+	OldHash string `json:"old_hash,omitempty"`
+	NewHash string `json:"new_hash,omitempty"`
+	Diff    string `json:"diff,omitempty"`
+
+	// Ignored is set for configs in the remote config the agent doesn't manage
+	Ignored bool `json:"ignored,omitempty"`
+}
+
+// AuditStep records the timing and outcome of a step in applying a remote config
+type AuditStep struct {
+	Name       string    `json:"name"`
+	Start      time.Time `json:"start"`
+	DurationMS int64     `json:"duration_ms"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// AddStep records a step that started at the time and just finished
+func (e *AuditEntry) AddStep(name string, start time.Time, err error) {
+	step := AuditStep{
+		Name:       name,
+		Start:      start,
+		DurationMS: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		step.Error = err.Error()
+	}
+
+	e.Steps = append(e.Steps, step)
+}
+
+// ConfigDiff returns a unified diff of the contents of a config
+func ConfigDiff(configName string, oldContents, newContents []byte) (string, error) {
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        splitLines(oldContents),
+		B:        splitLines(newContents),
+		FromFile: "a/" + configName,
+		ToFile:   "b/" + configName,
+		Context:  3,
+	})
+}
+
+// splitLines splits contents into lines that keep their line endings
+func splitLines(contents []byte) []string {
+	lines := strings.SplitAfter(string(contents), "\n")
+
+	// Contents ending in a newline don't have a trailing empty line
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// AuditLog appends entries to a file as JSON lines, rotating the file by size
+type AuditLog struct {
+	mux    sync.Mutex
+	writer *lumberjack.Logger
+}
+
+// NewAuditLog creates an audit log that writes to the configured file
+func NewAuditLog(cfg AuditConfig) (*AuditLog, error) {
+	filename := filepath.Clean(os.ExpandEnv(cfg.Filename))
+
+	// Create the file up front so it, and the files rotated from it, are only readable by the owner
+	if err := os.MkdirAll(filepath.Dir(filename), 0750); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+
+	return &AuditLog{
+		writer: &lumberjack.Logger{
+			Filename:   filename,
+			MaxSize:    cfg.MaxSize,
+			MaxAge:     cfg.MaxAge,
+			MaxBackups: cfg.MaxBackups,
+			Compress:   cfg.Compress,
+		},
+	}, nil
+}
+
+// Write appends the entry to the log
+func (a *AuditLog) Write(entry *AuditEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit entry: %w", err)
+	}
+
+	a.mux.Lock()
+	defer a.mux.Unlock()
+
+	// A single write so an entry is never split across files
+	if _, err := a.writer.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit entry: %w", err)
+	}
+	return nil
+}
+
+// Close closes the log file
+func (a *AuditLog) Close() error {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+
+	return a.writer.Close()
+}
@@ -0,0 +1,87 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opamp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditLog(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "audit", "audit.log")
+
+	auditLog, err := NewAuditLog(AuditConfig{Filename: filename})
+	require.NoError(t, err)
+
+	first := &AuditEntry{
+		RemoteConfigHash: "abc",
+		Result:           AuditResultApplied,
+		Configs: []AuditConfigChange{
+			{Name: "collector.yaml", OldHash: "01", NewHash: "02", Diff: "-a\n+b\n"},
+		},
+	}
+	first.AddStep("apply", time.Now(), nil)
+
+	second := &AuditEntry{
+		RemoteConfigHash: "def",
+		Result:           AuditResultFailed,
+	}
+	second.AddStep("apply", time.Now(), errors.New("oops"))
+
+	require.NoError(t, auditLog.Write(first))
+	require.NoError(t, auditLog.Write(second))
+	require.NoError(t, auditLog.Close())
+
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(filename)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+
+	file, err := os.Open(filename)
+	require.NoError(t, err)
+	defer file.Close()
+
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry AuditEntry
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		entries = append(entries, entry)
+	}
+	require.NoError(t, scanner.Err())
+
+	require.Len(t, entries, 2)
+	assert.Equal(t, AuditResultApplied, entries[0].Result)
+	assert.Equal(t, first.Configs, entries[0].Configs)
+	assert.Equal(t, "apply", entries[0].Steps[0].Name)
+	assert.Equal(t, AuditResultFailed, entries[1].Result)
+	assert.Equal(t, "oops", entries[1].Steps[0].Error)
+}
+
+func TestConfigDiff(t *testing.T) {
+	diff, err := ConfigDiff("collector.yaml", []byte("a: 1\nb: 2\n"), []byte("a: 1\nb: 3\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "--- a/collector.yaml\n+++ b/collector.yaml\n@@ -1,2 +1,2 @@\n a: 1\n-b: 2\n+b: 3\n", diff)
+}
@@ -24,4 +24,13 @@ type Client interface {
 
 	// Disconnect disconnects from the server
 	Disconnect(ctx context.Context) error
+
+	// ConnectionStatus returns the current status of the connection to the server
+	ConnectionStatus() ConnectionStatus
+
+	// RestartCollector restarts the collector once any remote config being applied is done
+	RestartCollector(ctx context.Context) error
+
+	// Error returns a channel that receives an error when the collector or connection to the server fails and can't recover
+	Error() <-chan error
 }
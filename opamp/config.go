@@ -22,6 +22,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -53,9 +55,107 @@ type Config struct {
 	AgentID   string     `yaml:"agent_id"`
 	TLS       *TLSConfig `yaml:"tls_config,omitempty"`
 
+	// AgentIDStrategy is how the agent ID was, or will be, generated if it isn't set
+	AgentIDStrategy AgentIDStrategy `yaml:"agent_id_strategy,omitempty"`
+
+	// AgentIDAttributes are the host attributes hashed by the host-attributes strategy
+	AgentIDAttributes []string `yaml:"agent_id_attributes,omitempty"`
+
+	// Headers are additional HTTP headers sent when connecting to the server
+	Headers map[string]string `yaml:"headers,omitempty"`
+
+	// Redaction configures additional values masked in configs reported to the server
+	Redaction *RedactionConfig `yaml:"redaction,omitempty"`
+
+	// Probation configures how long remote configs are watched for problems before they're confirmed
+	Probation *ProbationConfig `yaml:"probation,omitempty"`
+
+	// FileSets are the directories of supporting files the server may write
+	FileSets []FileSet `yaml:"file_sets,omitempty"`
+
+	// Audit configures the log of remote configs received from the server
+	Audit *AuditConfig `yaml:"audit,omitempty"`
+
+	// Reconnect configures how long the collector waits between attempts to connect to the server
+	Reconnect *ReconnectConfig `yaml:"reconnect,omitempty"`
+
+	// FallbackEndpoints are connected to in order when the endpoint can't be reached
+	FallbackEndpoints []EndpointConfig `yaml:"fallback_endpoints,omitempty"`
+
+	// Failover configures when the collector switches between the endpoint and fallback endpoints
+	Failover *FailoverConfig `yaml:"failover,omitempty"`
+
+	// Enrollment configures requesting a client certificate from the server
+	Enrollment *EnrollmentConfig `yaml:"enrollment,omitempty"`
+
+	// Diagnostics configures the diagnostics the server may request
+	Diagnostics *DiagnosticsConfig `yaml:"diagnostics,omitempty"`
+
+	// FailurePolicy configures what happens when the collector or OpAMP client can't recover
+	FailurePolicy *FailurePolicy `yaml:"failure_policy,omitempty"`
+
 	// Updatable fields
-	Labels    *string `yaml:"labels,omitempty"`
-	AgentName *string `yaml:"agent_name,omitempty"`
+	Labels     *string           `yaml:"labels,omitempty"`
+	AgentName  *string           `yaml:"agent_name,omitempty"`
+	Attributes *AttributesConfig `yaml:"attributes,omitempty"`
+}
+
+// AttributesConfig are additional attributes reported in the agent description.
+// Values set locally may reference environment variables, which are expanded when the config is loaded.
+type AttributesConfig struct {
+	// Identifying attributes distinguish the agent from others
+	Identifying map[string]string `yaml:"identifying,omitempty"`
+
+	// NonIdentifying attributes describe the agent, such as the datacenter it runs in
+	NonIdentifying map[string]string `yaml:"non_identifying,omitempty"`
+}
+
+// Validate checks that every attribute has a key
+func (a *AttributesConfig) Validate() error {
+	if a == nil {
+		return nil
+	}
+
+	for _, attributes := range []map[string]string{a.Identifying, a.NonIdentifying} {
+		for key := range attributes {
+			if strings.TrimSpace(key) == "" {
+				return errors.New("attribute keys must not be empty")
+			}
+		}
+	}
+	return nil
+}
+
+// Copy creates a deep copy of the attributes
+func (a AttributesConfig) Copy() *AttributesConfig {
+	return &AttributesConfig{
+		Identifying:    copyStringMap(a.Identifying),
+		NonIdentifying: copyStringMap(a.NonIdentifying),
+	}
+}
+
+// Expand returns a copy of the attributes with environment variables in their values expanded
+func (a *AttributesConfig) Expand() *AttributesConfig {
+	if a == nil {
+		return nil
+	}
+
+	expanded := a.Copy()
+	for _, attributes := range []map[string]string{expanded.Identifying, expanded.NonIdentifying} {
+		for key, value := range attributes {
+			attributes[key] = os.ExpandEnv(value)
+		}
+	}
+	return expanded
+}
+
+func cmpAttributes(a1, a2 *AttributesConfig) bool {
+	switch {
+	case a1 == nil || a2 == nil:
+		return a1 == a2
+	default:
+		return cmpStringMap(a1.Identifying, a2.Identifying) && cmpStringMap(a1.NonIdentifying, a2.NonIdentifying)
+	}
 }
 
 // TLSConfig represents the TLS config to connect to OpAmp server
@@ -66,6 +166,53 @@ type TLSConfig struct {
 	CAFile             *string `yaml:"ca_file"`
 }
 
+// validate checks the files exist when using secure TLS
+func (t *TLSConfig) validate() error {
+	if t == nil || t.InsecureSkipVerify {
+		return nil
+	}
+
+	// If CA file is specified
+	if t.CAFile != nil {
+		// Validate CA file exists on disk
+		if _, err := os.Stat(*t.CAFile); errors.Is(err, os.ErrNotExist) {
+			return errors.New(errInvalidCAFile)
+		}
+	}
+
+	switch {
+	case t.CertFile == nil && t.KeyFile == nil: // Not using mTLS
+		// Nothing to do. This case exists to make it easier to check all happy permutations for Key and Cert files
+	case t.CertFile != nil && t.KeyFile != nil: // Validate both files exist
+		if _, err := os.Stat(*t.KeyFile); errors.Is(err, os.ErrNotExist) {
+			return errors.New(errInvalidKeyFile)
+		}
+
+		if _, err := os.Stat(*t.CertFile); errors.Is(err, os.ErrNotExist) {
+			return errors.New(errInvalidCertFile)
+		}
+	default: // Case with only one file is specified
+		return errors.New(errMissingTLSFiles)
+	}
+
+	return nil
+}
+
+// ProbationConfig configures the probation window after a remote config is applied.
+// The config is rolled back if the collector becomes unhealthy during the window.
+type ProbationConfig struct {
+	// Duration is how long the collector must stay healthy. Zero disables probation.
+	Duration time.Duration `yaml:"duration"`
+
+	// MaxSendFailures is the number of spans, metric points, and log records exporters may fail to send during the window
+	MaxSendFailures int64 `yaml:"max_send_failures,omitempty"`
+}
+
+// Enabled returns true if remote configs should be put on probation
+func (p *ProbationConfig) Enabled() bool {
+	return p != nil && p.Duration > 0
+}
+
 // ToTLS converts the config to a tls.Config
 func (c Config) ToTLS() (*tls.Config, error) {
 	if c.TLS == nil {
@@ -122,31 +269,42 @@ func ParseConfig(configLocation string) (*Config, error) {
 		return nil, fmt.Errorf("%s: %w", errPrefixParse, err)
 	}
 
-	// Using Secure TLS check files
-	if config.TLS != nil && config.TLS.InsecureSkipVerify == false {
-		// If CA file is specified
-		if config.TLS.CAFile != nil {
-			// Validate CA file exists on disk
-			if _, err := os.Stat(*config.TLS.CAFile); errors.Is(err, os.ErrNotExist) {
-				return nil, errors.New(errInvalidCAFile)
-			}
-		}
+	if err := config.TLS.validate(); err != nil {
+		return nil, err
+	}
 
-		switch {
-		case config.TLS.CertFile == nil && config.TLS.KeyFile == nil: // Not using mTLS
-			// Nothing to do. This case exists to make it easier to check all happy permutations for Key and Cert files
-		case config.TLS.CertFile != nil && config.TLS.KeyFile != nil: // Validate both files exist
-			if _, err := os.Stat(*config.TLS.KeyFile); errors.Is(err, os.ErrNotExist) {
-				return nil, errors.New(errInvalidKeyFile)
-			}
+	if err := validateFallbackEndpoints(config.FallbackEndpoints); err != nil {
+		return nil, fmt.Errorf("%s: %w", errPrefixParse, err)
+	}
 
-			if _, err := os.Stat(*config.TLS.CertFile); errors.Is(err, os.ErrNotExist) {
-				return nil, errors.New(errInvalidCertFile)
-			}
-		default: // Case with only one file is specified
-			return nil, errors.New(errMissingTLSFiles)
-		}
+	if err := config.Failover.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", errPrefixParse, err)
 	}
+
+	if err := validateFileSets(config.FileSets); err != nil {
+		return nil, fmt.Errorf("%s: %w", errPrefixParse, err)
+	}
+
+	if err := config.Attributes.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", errPrefixParse, err)
+	}
+
+	if err := config.Reconnect.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", errPrefixParse, err)
+	}
+
+	if err := config.Enrollment.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", errPrefixParse, err)
+	}
+
+	if err := config.Diagnostics.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", errPrefixParse, err)
+	}
+
+	if err := config.FailurePolicy.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", errPrefixParse, err)
+	}
+
 	return &config, nil
 }
 
@@ -154,8 +312,9 @@ func ParseConfig(configLocation string) (*Config, error) {
 func (c Config) Copy() *Config {
 
 	cfgCopy := &Config{
-		Endpoint: c.Endpoint,
-		AgentID:  c.AgentID,
+		Endpoint:        c.Endpoint,
+		AgentID:         c.AgentID,
+		AgentIDStrategy: c.AgentIDStrategy,
 	}
 
 	if c.SecretKey != nil {
@@ -173,6 +332,59 @@ func (c Config) Copy() *Config {
 	if c.TLS != nil {
 		cfgCopy.TLS = c.TLS.copy()
 	}
+	if c.AgentIDAttributes != nil {
+		cfgCopy.AgentIDAttributes = append([]string{}, c.AgentIDAttributes...)
+	}
+	if c.Headers != nil {
+		cfgCopy.Headers = copyStringMap(c.Headers)
+	}
+	if c.Attributes != nil {
+		cfgCopy.Attributes = c.Attributes.Copy()
+	}
+	if c.Redaction != nil {
+		cfgCopy.Redaction = c.Redaction.copy()
+	}
+	if c.Probation != nil {
+		probationCopy := *c.Probation
+		cfgCopy.Probation = &probationCopy
+	}
+	if c.Audit != nil {
+		auditCopy := *c.Audit
+		cfgCopy.Audit = &auditCopy
+	}
+	if c.Reconnect != nil {
+		cfgCopy.Reconnect = c.Reconnect.copy()
+	}
+	if c.FallbackEndpoints != nil {
+		cfgCopy.FallbackEndpoints = make([]EndpointConfig, 0, len(c.FallbackEndpoints))
+		for _, endpoint := range c.FallbackEndpoints {
+			cfgCopy.FallbackEndpoints = append(cfgCopy.FallbackEndpoints, endpoint.copy())
+		}
+	}
+	if c.Failover != nil {
+		failoverCopy := *c.Failover
+		cfgCopy.Failover = &failoverCopy
+	}
+
+	if c.Enrollment != nil {
+		enrollmentCopy := *c.Enrollment
+		cfgCopy.Enrollment = &enrollmentCopy
+	}
+	if c.Diagnostics != nil {
+		diagnosticsCopy := *c.Diagnostics
+		cfgCopy.Diagnostics = &diagnosticsCopy
+	}
+	if c.FailurePolicy != nil {
+		failurePolicyCopy := *c.FailurePolicy
+		cfgCopy.FailurePolicy = &failurePolicyCopy
+	}
+	if c.FileSets != nil {
+		cfgCopy.FileSets = make([]FileSet, 0, len(c.FileSets))
+		for _, fileSet := range c.FileSets {
+			fileSet.Patterns = append([]string{}, fileSet.Patterns...)
+			cfgCopy.FileSets = append(cfgCopy.FileSets, fileSet)
+		}
+	}
 
 	return cfgCopy
 }
@@ -213,9 +425,38 @@ func (c Config) CmpUpdatableFields(o Config) (equal bool) {
 		return false
 	}
 
+	if !cmpAttributes(c.Attributes, o.Attributes) {
+		return false
+	}
+
 	return cmpStringPtr(c.Labels, o.Labels)
 }
 
+func cmpStringMap(m1, m2 map[string]string) bool {
+	if len(m1) != len(m2) {
+		return false
+	}
+
+	for k, v1 := range m1 {
+		if v2, ok := m2[k]; !ok || v1 != v2 {
+			return false
+		}
+	}
+	return true
+}
+
+func copyStringMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+
+	mapCopy := make(map[string]string, len(m))
+	for k, v := range m {
+		mapCopy[k] = v
+	}
+	return mapCopy
+}
+
 func cmpStringPtr(p1, p2 *string) bool {
 	switch {
 	case p1 == nil && p2 == nil:
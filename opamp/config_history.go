@@ -0,0 +1,241 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opamp
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultHistorySize is the number of versions kept for each managed config
+const DefaultHistorySize = 10
+
+const (
+	// historyDirName is the name of the directory, next to the configs, histories are stored in
+	historyDirName = "history"
+
+	// historyIndexName is the name of the file in a history directory describing the stored versions
+	historyIndexName = "index.yaml"
+)
+
+// ErrVersionNotFound is returned when a requested version is not in a config's history
+var ErrVersionNotFound = errors.New("version not found in config history")
+
+// ConfigOrigin describes where a version of a config came from
+type ConfigOrigin string
+
+const (
+	// OriginLocal is a version found on disk, such as a local edit made while the collector was stopped
+	OriginLocal ConfigOrigin = "local"
+
+	// OriginRemote is a version pushed by the OpAMP server
+	OriginRemote ConfigOrigin = "remote"
+
+	// OriginRollback is a version restored from history
+	OriginRollback ConfigOrigin = "rollback"
+)
+
+// HistoryEntry describes a stored version of a config
+type HistoryEntry struct {
+	Version   int          `yaml:"version"`
+	Hash      string       `yaml:"hash"`
+	Timestamp time.Time    `yaml:"timestamp"`
+	Origin    ConfigOrigin `yaml:"origin"`
+}
+
+// historyIndex is the on disk index of a config history
+type historyIndex struct {
+	NextVersion int            `yaml:"next_version"`
+	Entries     []HistoryEntry `yaml:"entries"`
+}
+
+// ConfigHistory is a bounded on disk history of versions of a single config
+type ConfigHistory struct {
+	dir       string
+	extension string
+	size      int
+	mux       sync.Mutex
+}
+
+// HistoryDir returns the directory the history for the config at configPath is stored in
+func HistoryDir(configPath string) string {
+	return filepath.Join(filepath.Dir(configPath), historyDirName, filepath.Base(configPath))
+}
+
+// NewConfigHistory creates a history for the config at configPath that keeps at most size versions
+func NewConfigHistory(configPath string, size int) *ConfigHistory {
+	return &ConfigHistory{
+		dir:       HistoryDir(configPath),
+		extension: filepath.Ext(configPath),
+		size:      size,
+	}
+}
+
+// Record stores the contents as a new version unless they match the latest version.
+// The latest entry is returned in either case.
+func (h *ConfigHistory) Record(contents []byte, origin ConfigOrigin) (HistoryEntry, error) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	index, err := h.readIndex()
+	if err != nil {
+		return HistoryEntry{}, err
+	}
+
+	hash := hex.EncodeToString(ComputeHash(contents))
+	if len(index.Entries) > 0 {
+		latest := index.Entries[len(index.Entries)-1]
+		if latest.Hash == hash {
+			return latest, nil
+		}
+	}
+
+	if err := os.MkdirAll(h.dir, 0750); err != nil {
+		return HistoryEntry{}, fmt.Errorf("failed to create history directory: %w", err)
+	}
+
+	entry := HistoryEntry{
+		Version:   index.NextVersion,
+		Hash:      hash,
+		Timestamp: time.Now().UTC(),
+		Origin:    origin,
+	}
+
+	if err := WriteFileAtomic(h.versionPath(entry.Version), contents, 0600); err != nil {
+		return HistoryEntry{}, fmt.Errorf("failed to store version %d: %w", entry.Version, err)
+	}
+
+	index.NextVersion++
+	index.Entries = append(index.Entries, entry)
+
+	// Prune the oldest versions beyond the size limit
+	var pruned []HistoryEntry
+	if len(index.Entries) > h.size {
+		pruned = index.Entries[:len(index.Entries)-h.size]
+		index.Entries = index.Entries[len(index.Entries)-h.size:]
+	}
+
+	if err := h.writeIndex(index); err != nil {
+		return HistoryEntry{}, err
+	}
+
+	// Pruned versions are no longer referenced by the index so failing to remove them is harmless
+	for _, prunedEntry := range pruned {
+		_ = os.Remove(h.versionPath(prunedEntry.Version))
+	}
+
+	return entry, nil
+}
+
+// Entries returns the stored versions from oldest to newest
+func (h *ConfigHistory) Entries() ([]HistoryEntry, error) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	index, err := h.readIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	return index.Entries, nil
+}
+
+// Get returns the entry and contents of the version.
+// ErrVersionNotFound is returned if the version is not stored.
+func (h *ConfigHistory) Get(version int) (HistoryEntry, []byte, error) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	index, err := h.readIndex()
+	if err != nil {
+		return HistoryEntry{}, nil, err
+	}
+
+	for _, entry := range index.Entries {
+		if entry.Version != version {
+			continue
+		}
+
+		contents, err := os.ReadFile(h.versionPath(version))
+		if err != nil {
+			return HistoryEntry{}, nil, fmt.Errorf("failed to read version %d: %w", version, err)
+		}
+
+		// Guard against the stored file being edited
+		if hex.EncodeToString(ComputeHash(contents)) != entry.Hash {
+			return HistoryEntry{}, nil, fmt.Errorf("version %d does not match its recorded hash", version)
+		}
+
+		return entry, contents, nil
+	}
+
+	return HistoryEntry{}, nil, ErrVersionNotFound
+}
+
+// Latest returns the newest entry and whether there is one
+func (h *ConfigHistory) Latest() (HistoryEntry, bool, error) {
+	entries, err := h.Entries()
+	if err != nil || len(entries) == 0 {
+		return HistoryEntry{}, false, err
+	}
+
+	return entries[len(entries)-1], true, nil
+}
+
+// versionPath returns the path the contents of the version are stored at
+func (h *ConfigHistory) versionPath(version int) string {
+	return filepath.Join(h.dir, fmt.Sprintf("%d%s", version, h.extension))
+}
+
+// readIndex reads the index. A missing index is an empty history.
+func (h *ConfigHistory) readIndex() (*historyIndex, error) {
+	index := &historyIndex{NextVersion: 1}
+
+	data, err := os.ReadFile(filepath.Join(h.dir, historyIndexName))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return index, nil
+	case err != nil:
+		return nil, fmt.Errorf("failed to read history index: %w", err)
+	}
+
+	if err := yaml.NewDecoder(bytes.NewReader(data)).Decode(index); err != nil {
+		return nil, fmt.Errorf("failed to parse history index: %w", err)
+	}
+
+	return index, nil
+}
+
+// writeIndex atomically writes the index
+func (h *ConfigHistory) writeIndex(index *historyIndex) error {
+	data, err := yaml.Marshal(index)
+	if err != nil {
+		return fmt.Errorf("failed to marshal history index: %w", err)
+	}
+
+	if err := WriteFileAtomic(filepath.Join(h.dir, historyIndexName), data, 0600); err != nil {
+		return fmt.Errorf("failed to write history index: %w", err)
+	}
+
+	return nil
+}
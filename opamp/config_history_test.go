@@ -0,0 +1,161 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opamp
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigHistory(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		testFunc func(*testing.T)
+	}{
+		{
+			desc: "Empty history",
+			testFunc: func(t *testing.T) {
+				history := NewConfigHistory(filepath.Join(t.TempDir(), "collector.yaml"), DefaultHistorySize)
+
+				entries, err := history.Entries()
+				require.NoError(t, err)
+				assert.Empty(t, entries)
+
+				_, ok, err := history.Latest()
+				require.NoError(t, err)
+				assert.False(t, ok)
+
+				_, _, err = history.Get(1)
+				assert.ErrorIs(t, err, ErrVersionNotFound)
+			},
+		},
+		{
+			desc: "Record and get versions",
+			testFunc: func(t *testing.T) {
+				configPath := filepath.Join(t.TempDir(), "collector.yaml")
+				history := NewConfigHistory(configPath, DefaultHistorySize)
+
+				first, err := history.Record([]byte("first"), OriginLocal)
+				require.NoError(t, err)
+				assert.Equal(t, 1, first.Version)
+				assert.Equal(t, OriginLocal, first.Origin)
+				assert.Equal(t, hex.EncodeToString(ComputeHash([]byte("first"))), first.Hash)
+
+				second, err := history.Record([]byte("second"), OriginRemote)
+				require.NoError(t, err)
+				assert.Equal(t, 2, second.Version)
+
+				entry, contents, err := history.Get(1)
+				require.NoError(t, err)
+				assert.Equal(t, first.Hash, entry.Hash)
+				assert.Equal(t, []byte("first"), contents)
+
+				latest, ok, err := history.Latest()
+				require.NoError(t, err)
+				assert.True(t, ok)
+				assert.Equal(t, 2, latest.Version)
+				assert.Equal(t, OriginRemote, latest.Origin)
+
+				assert.FileExists(t, filepath.Join(HistoryDir(configPath), "1.yaml"))
+			},
+		},
+		{
+			desc: "Same contents as latest are not recorded again",
+			testFunc: func(t *testing.T) {
+				history := NewConfigHistory(filepath.Join(t.TempDir(), "collector.yaml"), DefaultHistorySize)
+
+				_, err := history.Record([]byte("contents"), OriginLocal)
+				require.NoError(t, err)
+				entry, err := history.Record([]byte("contents"), OriginRemote)
+				require.NoError(t, err)
+				assert.Equal(t, 1, entry.Version)
+				assert.Equal(t, OriginLocal, entry.Origin)
+
+				// Returning to an older version is a new version
+				_, err = history.Record([]byte("other"), OriginRemote)
+				require.NoError(t, err)
+				entry, err = history.Record([]byte("contents"), OriginRollback)
+				require.NoError(t, err)
+				assert.Equal(t, 3, entry.Version)
+			},
+		},
+		{
+			desc: "Oldest versions are pruned",
+			testFunc: func(t *testing.T) {
+				configPath := filepath.Join(t.TempDir(), "collector.yaml")
+				history := NewConfigHistory(configPath, 3)
+
+				for i := 1; i <= 5; i++ {
+					_, err := history.Record([]byte(fmt.Sprintf("version %d", i)), OriginRemote)
+					require.NoError(t, err)
+				}
+
+				entries, err := history.Entries()
+				require.NoError(t, err)
+				require.Len(t, entries, 3)
+				assert.Equal(t, 3, entries[0].Version)
+				assert.Equal(t, 5, entries[2].Version)
+
+				_, _, err = history.Get(2)
+				assert.ErrorIs(t, err, ErrVersionNotFound)
+				assert.NoFileExists(t, filepath.Join(HistoryDir(configPath), "2.yaml"))
+
+				// Version numbers continue after pruning
+				entry, err := history.Record([]byte("version 6"), OriginRemote)
+				require.NoError(t, err)
+				assert.Equal(t, 6, entry.Version)
+			},
+		},
+		{
+			desc: "Modified stored version",
+			testFunc: func(t *testing.T) {
+				configPath := filepath.Join(t.TempDir(), "collector.yaml")
+				history := NewConfigHistory(configPath, DefaultHistorySize)
+
+				_, err := history.Record([]byte("contents"), OriginLocal)
+				require.NoError(t, err)
+
+				err = os.WriteFile(filepath.Join(HistoryDir(configPath), "1.yaml"), []byte("tampered"), 0600)
+				require.NoError(t, err)
+
+				_, _, err = history.Get(1)
+				assert.ErrorContains(t, err, "does not match its recorded hash")
+			},
+		},
+		{
+			desc: "Corrupt index",
+			testFunc: func(t *testing.T) {
+				configPath := filepath.Join(t.TempDir(), "collector.yaml")
+				require.NoError(t, os.MkdirAll(HistoryDir(configPath), 0750))
+				err := os.WriteFile(filepath.Join(HistoryDir(configPath), historyIndexName), []byte("entries: {"), 0600)
+				require.NoError(t, err)
+
+				history := NewConfigHistory(configPath, DefaultHistorySize)
+				_, err = history.Entries()
+				assert.ErrorContains(t, err, "failed to parse history index")
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, tc.testFunc)
+	}
+}
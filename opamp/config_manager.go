@@ -15,6 +15,7 @@
 package opamp
 
 import (
+	"context"
 	"path/filepath"
 
 	"github.com/open-telemetry/opamp-go/protobufs"
@@ -26,19 +27,45 @@ const (
 
 	// JSONContentType content type for .json file
 	JSONContentType = "text/json"
+
+	// PEMContentType content type for .pem, .crt, or .cer file
+	PEMContentType = "application/x-pem-file"
+
+	// CSVContentType content type for .csv file
+	CSVContentType = "text/csv"
+
+	// TextContentType content type for .txt file
+	TextContentType = "text/plain"
 )
 
+// FileValidateFunc returns an error if the contents of a file in a file set should not be written
+type FileValidateFunc func(filePath string, contents []byte) error
+
+// FileChangeFunc is called after files in a file set are written with the paths of the changed files.
+// A cancelled context should abort the change.
+type FileChangeFunc func(ctx context.Context, filePaths []string) error
+
 // ConfigManager handles remote configuration of local configs
 type ConfigManager interface {
 	// AddConfig adds a config to be tracked by the config manager with it's corresponding validator function.
 	AddConfig(configName string, reloader *ManagedConfig)
 
+	// AddFileSet registers a set of files the server may write and tracks the files already in it.
+	// validate and onChange may be nil.
+	AddFileSet(fileSet FileSet, validate FileValidateFunc, onChange FileChangeFunc) error
+
+	// GetConfig returns the tracked managed config with the given name if it exists.
+	GetConfig(configName string) (*ManagedConfig, bool)
+
 	// ComposeEffectiveConfig reads in all config files and calculates the effective config
 	ComposeEffectiveConfig() (*protobufs.EffectiveConfig, error)
 
 	// ApplyConfigChanges compares the remoteConfig to the existing and applies changes.
 	// Calculates new effective config
-	ApplyConfigChanges(remoteConfig *protobufs.AgentRemoteConfig) (changed bool, err error)
+	ApplyConfigChanges(ctx context.Context, remoteConfig *protobufs.AgentRemoteConfig) (changed bool, err error)
+
+	// RollbackConfig reloads the config with the contents of a version from its history
+	RollbackConfig(ctx context.Context, configName string, version int) (changed bool, err error)
 }
 
 // DetermineContentType looks at the file extension for the given filepath and returns the content type
@@ -50,6 +77,12 @@ func DetermineContentType(filePath string) string {
 		return JSONContentType
 	case ".yml", ".yaml":
 		return YAMLContentType
+	case ".pem", ".crt", ".cer":
+		return PEMContentType
+	case ".csv":
+		return CSVContentType
+	case ".txt":
+		return TextContentType
 	default:
 		return ""
 	}
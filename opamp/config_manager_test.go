@@ -41,6 +41,21 @@ func TestDetermineContentType(t *testing.T) {
 			filePath: "path/to/my.yaml",
 			expected: YAMLContentType,
 		},
+		{
+			desc:     "PEM",
+			filePath: "path/to/ca.crt",
+			expected: PEMContentType,
+		},
+		{
+			desc:     "CSV",
+			filePath: "path/to/lookup.csv",
+			expected: CSVContentType,
+		},
+		{
+			desc:     "Text",
+			filePath: "path/to/notes.txt",
+			expected: TextContentType,
+		},
 		{
 			desc:     "Unknown",
 			filePath: "path/to/my.unicorn",
@@ -21,6 +21,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -294,6 +295,448 @@ agent_id: 8321f735-a52c-4f49-aca9-66f9266c5fe5
 				assert.Equal(t, expectedConfig, cfg)
 			},
 		},
+		{
+			desc: "Successful Parse with Probation",
+			testFunc: func(t *testing.T) {
+				configContents := `
+endpoint: localhost:1234
+agent_id: 8321f735-a52c-4f49-aca9-66f9266c5fe5
+probation:
+  duration: 5m
+  max_send_failures: 10
+`
+
+				tmpDir := t.TempDir()
+				configPath := filepath.Join(tmpDir, "manager.yml")
+
+				err := os.WriteFile(configPath, []byte(configContents), os.ModePerm)
+				require.NoError(t, err)
+
+				expectedConfig := &Config{
+					Endpoint: "localhost:1234",
+					AgentID:  "8321f735-a52c-4f49-aca9-66f9266c5fe5",
+					Probation: &ProbationConfig{
+						Duration:        5 * time.Minute,
+						MaxSendFailures: 10,
+					},
+				}
+
+				cfg, err := ParseConfig(configPath)
+				assert.NoError(t, err)
+				assert.Equal(t, expectedConfig, cfg)
+				assert.True(t, cfg.Probation.Enabled())
+			},
+		},
+		{
+			desc: "Successful Parse with Reconnect",
+			testFunc: func(t *testing.T) {
+				configContents := `
+endpoint: localhost:1234
+agent_id: 8321f735-a52c-4f49-aca9-66f9266c5fe5
+reconnect:
+  initial_interval: 2s
+  max_interval: 10m
+  multiplier: 2
+  jitter: 0
+`
+
+				tmpDir := t.TempDir()
+				configPath := filepath.Join(tmpDir, "manager.yml")
+
+				err := os.WriteFile(configPath, []byte(configContents), os.ModePerm)
+				require.NoError(t, err)
+
+				jitter := 0.0
+				expectedConfig := &Config{
+					Endpoint: "localhost:1234",
+					AgentID:  "8321f735-a52c-4f49-aca9-66f9266c5fe5",
+					Reconnect: &ReconnectConfig{
+						InitialInterval: 2 * time.Second,
+						MaxInterval:     10 * time.Minute,
+						Multiplier:      2,
+						Jitter:          &jitter,
+					},
+				}
+
+				cfg, err := ParseConfig(configPath)
+				assert.NoError(t, err)
+				assert.Equal(t, expectedConfig, cfg)
+			},
+		},
+		{
+			desc: "Successful Parse with Fallback Endpoints",
+			testFunc: func(t *testing.T) {
+				configContents := `
+endpoint: ws://primary.localnet/v1/opamp
+agent_id: 8321f735-a52c-4f49-aca9-66f9266c5fe5
+fallback_endpoints:
+  - endpoint: ws://secondary.localnet/v1/opamp
+  - endpoint: wss://tertiary.localnet/v1/opamp
+    tls_config:
+      insecure_skip_verify: true
+failover:
+  max_failures: 5
+  failback_interval: 10m
+`
+
+				tmpDir := t.TempDir()
+				configPath := filepath.Join(tmpDir, "manager.yml")
+
+				err := os.WriteFile(configPath, []byte(configContents), os.ModePerm)
+				require.NoError(t, err)
+
+				expectedConfig := &Config{
+					Endpoint: "ws://primary.localnet/v1/opamp",
+					AgentID:  "8321f735-a52c-4f49-aca9-66f9266c5fe5",
+					FallbackEndpoints: []EndpointConfig{
+						{Endpoint: "ws://secondary.localnet/v1/opamp"},
+						{Endpoint: "wss://tertiary.localnet/v1/opamp", TLS: &TLSConfig{InsecureSkipVerify: true}},
+					},
+					Failover: &FailoverConfig{
+						MaxFailures:      5,
+						FailbackInterval: 10 * time.Minute,
+					},
+				}
+
+				cfg, err := ParseConfig(configPath)
+				assert.NoError(t, err)
+				assert.Equal(t, expectedConfig, cfg)
+			},
+		},
+		{
+			desc: "Invalid Fallback Endpoint",
+			testFunc: func(t *testing.T) {
+				configContents := `
+endpoint: ws://primary.localnet/v1/opamp
+agent_id: 8321f735-a52c-4f49-aca9-66f9266c5fe5
+fallback_endpoints:
+  - tls_config:
+      insecure_skip_verify: true
+`
+
+				tmpDir := t.TempDir()
+				configPath := filepath.Join(tmpDir, "manager.yml")
+
+				err := os.WriteFile(configPath, []byte(configContents), os.ModePerm)
+				require.NoError(t, err)
+
+				cfg, err := ParseConfig(configPath)
+				assert.ErrorContains(t, err, "fallback endpoint 0 has no endpoint")
+				assert.Nil(t, cfg)
+			},
+		},
+		{
+			desc: "Successful Parse with Enrollment",
+			testFunc: func(t *testing.T) {
+				configContents := `
+endpoint: wss://localhost:1234/v1/opamp
+agent_id: 8321f735-a52c-4f49-aca9-66f9266c5fe5
+enrollment:
+  enabled: true
+  renew_before: 72h
+`
+
+				tmpDir := t.TempDir()
+				configPath := filepath.Join(tmpDir, "manager.yml")
+
+				err := os.WriteFile(configPath, []byte(configContents), os.ModePerm)
+				require.NoError(t, err)
+
+				expectedConfig := &Config{
+					Endpoint: "wss://localhost:1234/v1/opamp",
+					AgentID:  "8321f735-a52c-4f49-aca9-66f9266c5fe5",
+					Enrollment: &EnrollmentConfig{
+						Enabled:     true,
+						RenewBefore: 72 * time.Hour,
+					},
+				}
+
+				cfg, err := ParseConfig(configPath)
+				assert.NoError(t, err)
+				assert.Equal(t, expectedConfig, cfg)
+			},
+		},
+		{
+			desc: "Invalid Enrollment",
+			testFunc: func(t *testing.T) {
+				configContents := `
+endpoint: wss://localhost:1234/v1/opamp
+agent_id: 8321f735-a52c-4f49-aca9-66f9266c5fe5
+enrollment:
+  enabled: true
+  renew_before: -1h
+`
+
+				tmpDir := t.TempDir()
+				configPath := filepath.Join(tmpDir, "manager.yml")
+
+				err := os.WriteFile(configPath, []byte(configContents), os.ModePerm)
+				require.NoError(t, err)
+
+				cfg, err := ParseConfig(configPath)
+				assert.ErrorContains(t, err, "enrollment renew_before must not be negative")
+				assert.Nil(t, cfg)
+			},
+		},
+		{
+			desc: "Successful Parse with Diagnostics",
+			testFunc: func(t *testing.T) {
+				configContents := `
+endpoint: wss://localhost:1234/v1/opamp
+agent_id: 8321f735-a52c-4f49-aca9-66f9266c5fe5
+diagnostics:
+  enabled: true
+  max_log_lines: 100
+  max_profile_duration: 10s
+  max_size: 4096
+`
+
+				tmpDir := t.TempDir()
+				configPath := filepath.Join(tmpDir, "manager.yml")
+
+				err := os.WriteFile(configPath, []byte(configContents), os.ModePerm)
+				require.NoError(t, err)
+
+				expectedConfig := &Config{
+					Endpoint: "wss://localhost:1234/v1/opamp",
+					AgentID:  "8321f735-a52c-4f49-aca9-66f9266c5fe5",
+					Diagnostics: &DiagnosticsConfig{
+						Enabled:            true,
+						MaxLogLines:        100,
+						MaxProfileDuration: 10 * time.Second,
+						MaxSize:            4096,
+					},
+				}
+
+				cfg, err := ParseConfig(configPath)
+				assert.NoError(t, err)
+				assert.Equal(t, expectedConfig, cfg)
+			},
+		},
+		{
+			desc: "Invalid Diagnostics",
+			testFunc: func(t *testing.T) {
+				configContents := `
+endpoint: wss://localhost:1234/v1/opamp
+agent_id: 8321f735-a52c-4f49-aca9-66f9266c5fe5
+diagnostics:
+  enabled: true
+  max_size: -1
+`
+
+				tmpDir := t.TempDir()
+				configPath := filepath.Join(tmpDir, "manager.yml")
+
+				err := os.WriteFile(configPath, []byte(configContents), os.ModePerm)
+				require.NoError(t, err)
+
+				cfg, err := ParseConfig(configPath)
+				assert.ErrorContains(t, err, "diagnostics max_size must not be negative")
+				assert.Nil(t, cfg)
+			},
+		},
+		{
+			desc: "Successful Parse with Failure Policy",
+			testFunc: func(t *testing.T) {
+				configContents := `
+endpoint: wss://localhost:1234/v1/opamp
+agent_id: 8321f735-a52c-4f49-aca9-66f9266c5fe5
+failure_policy:
+  action: retry
+  retry_interval: 1m
+  max_retries: 5
+`
+
+				tmpDir := t.TempDir()
+				configPath := filepath.Join(tmpDir, "manager.yml")
+
+				err := os.WriteFile(configPath, []byte(configContents), os.ModePerm)
+				require.NoError(t, err)
+
+				expectedConfig := &Config{
+					Endpoint: "wss://localhost:1234/v1/opamp",
+					AgentID:  "8321f735-a52c-4f49-aca9-66f9266c5fe5",
+					FailurePolicy: &FailurePolicy{
+						Action:        FailureActionRetry,
+						RetryInterval: time.Minute,
+						MaxRetries:    5,
+					},
+				}
+
+				cfg, err := ParseConfig(configPath)
+				assert.NoError(t, err)
+				assert.Equal(t, expectedConfig, cfg)
+			},
+		},
+		{
+			desc: "Invalid Failure Policy",
+			testFunc: func(t *testing.T) {
+				configContents := `
+endpoint: wss://localhost:1234/v1/opamp
+agent_id: 8321f735-a52c-4f49-aca9-66f9266c5fe5
+failure_policy:
+  action: ignore
+`
+
+				tmpDir := t.TempDir()
+				configPath := filepath.Join(tmpDir, "manager.yml")
+
+				err := os.WriteFile(configPath, []byte(configContents), os.ModePerm)
+				require.NoError(t, err)
+
+				cfg, err := ParseConfig(configPath)
+				assert.ErrorContains(t, err, `failure_policy has unknown action "ignore"`)
+				assert.Nil(t, cfg)
+			},
+		},
+		{
+			desc: "Invalid Reconnect",
+			testFunc: func(t *testing.T) {
+				configContents := `
+endpoint: localhost:1234
+agent_id: 8321f735-a52c-4f49-aca9-66f9266c5fe5
+reconnect:
+  multiplier: 0.5
+`
+
+				tmpDir := t.TempDir()
+				configPath := filepath.Join(tmpDir, "manager.yml")
+
+				err := os.WriteFile(configPath, []byte(configContents), os.ModePerm)
+				require.NoError(t, err)
+
+				cfg, err := ParseConfig(configPath)
+				assert.ErrorContains(t, err, "reconnect multiplier must be at least 1")
+				assert.Nil(t, cfg)
+			},
+		},
+		{
+			desc: "Successful Parse with File Sets",
+			testFunc: func(t *testing.T) {
+				configContents := `
+endpoint: localhost:1234
+agent_id: 8321f735-a52c-4f49-aca9-66f9266c5fe5
+file_sets:
+  - name: plugins
+    root: ./plugins
+    patterns: ["*.yaml"]
+    max_file_size: 65536
+    on_change: restart_collector
+`
+
+				tmpDir := t.TempDir()
+				configPath := filepath.Join(tmpDir, "manager.yml")
+
+				err := os.WriteFile(configPath, []byte(configContents), os.ModePerm)
+				require.NoError(t, err)
+
+				expectedConfig := &Config{
+					Endpoint: "localhost:1234",
+					AgentID:  "8321f735-a52c-4f49-aca9-66f9266c5fe5",
+					FileSets: []FileSet{
+						{
+							Name:        "plugins",
+							Root:        "./plugins",
+							Patterns:    []string{"*.yaml"},
+							MaxFileSize: 65536,
+							OnChange:    OnChangeRestartCollector,
+						},
+					},
+				}
+
+				cfg, err := ParseConfig(configPath)
+				assert.NoError(t, err)
+				assert.Equal(t, expectedConfig, cfg)
+			},
+		},
+		{
+			desc: "Duplicate File Set Names",
+			testFunc: func(t *testing.T) {
+				configContents := `
+endpoint: localhost:1234
+agent_id: 8321f735-a52c-4f49-aca9-66f9266c5fe5
+file_sets:
+  - name: plugins
+    root: ./plugins
+    patterns: ["*.yaml"]
+  - name: plugins
+    root: ./other
+    patterns: ["*.yaml"]
+`
+
+				tmpDir := t.TempDir()
+				configPath := filepath.Join(tmpDir, "manager.yml")
+
+				err := os.WriteFile(configPath, []byte(configContents), os.ModePerm)
+				require.NoError(t, err)
+
+				cfg, err := ParseConfig(configPath)
+				assert.ErrorContains(t, err, "duplicate file set name plugins")
+				assert.Nil(t, cfg)
+			},
+		},
+		{
+			desc: "Successful Parse with Attributes",
+			testFunc: func(t *testing.T) {
+				configContents := `
+endpoint: localhost:1234
+agent_id: 8321f735-a52c-4f49-aca9-66f9266c5fe5
+attributes:
+  identifying:
+    cluster: prod-east
+  non_identifying:
+    datacenter: $DATACENTER
+    cost_center: "1234"
+`
+
+				tmpDir := t.TempDir()
+				configPath := filepath.Join(tmpDir, "manager.yml")
+
+				err := os.WriteFile(configPath, []byte(configContents), os.ModePerm)
+				require.NoError(t, err)
+
+				expectedConfig := &Config{
+					Endpoint: "localhost:1234",
+					AgentID:  "8321f735-a52c-4f49-aca9-66f9266c5fe5",
+					Attributes: &AttributesConfig{
+						Identifying: map[string]string{
+							"cluster": "prod-east",
+						},
+						NonIdentifying: map[string]string{
+							// Environment variables are expanded when reported, not when parsed
+							"datacenter":  "$DATACENTER",
+							"cost_center": "1234",
+						},
+					},
+				}
+
+				cfg, err := ParseConfig(configPath)
+				assert.NoError(t, err)
+				assert.Equal(t, expectedConfig, cfg)
+			},
+		},
+		{
+			desc: "Empty Attribute Key",
+			testFunc: func(t *testing.T) {
+				configContents := `
+endpoint: localhost:1234
+agent_id: 8321f735-a52c-4f49-aca9-66f9266c5fe5
+attributes:
+  non_identifying:
+    "": value
+`
+
+				tmpDir := t.TempDir()
+				configPath := filepath.Join(tmpDir, "manager.yml")
+
+				err := os.WriteFile(configPath, []byte(configContents), os.ModePerm)
+				require.NoError(t, err)
+
+				cfg, err := ParseConfig(configPath)
+				assert.ErrorContains(t, err, "attribute keys must not be empty")
+				assert.Nil(t, cfg)
+			},
+		},
 		{
 			desc: "Successful Full Parse with TLS Insecure Skip Verify",
 			testFunc: func(t *testing.T) {
@@ -789,6 +1232,57 @@ func TestCmpUpdatableFields(t *testing.T) {
 			},
 			expect: false,
 		},
+		{
+			desc: "Attributes match",
+			baseCfg: Config{
+				Endpoint: "ws://localhost:1234",
+				AgentID:  "20ce90b8-506c-4a3b-8134-21aa8d526e03",
+				Attributes: &AttributesConfig{
+					NonIdentifying: map[string]string{"datacenter": "east"},
+				},
+			},
+			compare: Config{
+				Endpoint: "ws://localhost:1234",
+				AgentID:  "20ce90b8-506c-4a3b-8134-21aa8d526e03",
+				Attributes: &AttributesConfig{
+					NonIdentifying: map[string]string{"datacenter": "east"},
+				},
+			},
+			expect: true,
+		},
+		{
+			desc: "Attributes don't match",
+			baseCfg: Config{
+				Endpoint: "ws://localhost:1234",
+				AgentID:  "20ce90b8-506c-4a3b-8134-21aa8d526e03",
+				Attributes: &AttributesConfig{
+					NonIdentifying: map[string]string{"datacenter": "east"},
+				},
+			},
+			compare: Config{
+				Endpoint: "ws://localhost:1234",
+				AgentID:  "20ce90b8-506c-4a3b-8134-21aa8d526e03",
+				Attributes: &AttributesConfig{
+					NonIdentifying: map[string]string{"datacenter": "west"},
+				},
+			},
+			expect: false,
+		},
+		{
+			desc: "Attributes present in base not in other",
+			baseCfg: Config{
+				Endpoint: "ws://localhost:1234",
+				AgentID:  "20ce90b8-506c-4a3b-8134-21aa8d526e03",
+				Attributes: &AttributesConfig{
+					Identifying: map[string]string{"cluster": "prod"},
+				},
+			},
+			compare: Config{
+				Endpoint: "ws://localhost:1234",
+				AgentID:  "20ce90b8-506c-4a3b-8134-21aa8d526e03",
+			},
+			expect: false,
+		},
 	}
 
 	for _, tc := range testCase {
@@ -835,6 +1329,7 @@ func TestConfigCopy(t *testing.T) {
 	keyFileContents := "My Key File"
 	certFileContents := "My Cert File"
 	caFileContents := "My CA File"
+	jitter := 0.25
 
 	tlscfg := TLSConfig{
 		InsecureSkipVerify: false,
@@ -843,14 +1338,94 @@ func TestConfigCopy(t *testing.T) {
 		CAFile:             &caFileContents,
 	}
 	cfg := Config{
-		Endpoint:  "ws://localhost:1234",
-		SecretKey: &secretKeyContents,
-		AgentID:   "20ce90b8-506c-4a3b-8134-21aa8d526e03",
-		Labels:    &labelsContents,
-		AgentName: &agentNameContents,
-		TLS:       &tlscfg,
+		Endpoint:          "ws://localhost:1234",
+		SecretKey:         &secretKeyContents,
+		AgentID:           "20ce90b8-506c-4a3b-8134-21aa8d526e03",
+		Labels:            &labelsContents,
+		AgentName:         &agentNameContents,
+		TLS:               &tlscfg,
+		AgentIDStrategy:   AgentIDStrategyHostAttributes,
+		AgentIDAttributes: []string{"host.name"},
+		Attributes: &AttributesConfig{
+			Identifying:    map[string]string{"cluster": "prod-east"},
+			NonIdentifying: map[string]string{"datacenter": "east"},
+		},
+		Headers: map[string]string{
+			"X-Tenant": "my-tenant",
+		},
+		Redaction: &RedactionConfig{
+			KeyPatterns:   []string{"^dsn$"},
+			ValuePatterns: []string{"^sk_live_"},
+		},
+		Probation: &ProbationConfig{
+			Duration:        5 * time.Minute,
+			MaxSendFailures: 10,
+		},
+		FileSets: []FileSet{
+			{
+				Name:     "plugins",
+				Root:     "./plugins",
+				Patterns: []string{"*.yaml"},
+				OnChange: OnChangeRestartCollector,
+			},
+		},
+		Audit: &AuditConfig{
+			Filename:   "audit.log",
+			MaxSize:    10,
+			MaxBackups: 5,
+		},
+		Reconnect: &ReconnectConfig{
+			InitialInterval: time.Second,
+			MaxInterval:     time.Minute,
+			Multiplier:      2,
+			Jitter:          &jitter,
+		},
+		FallbackEndpoints: []EndpointConfig{
+			{Endpoint: "ws://secondary:1234"},
+			{Endpoint: "wss://tertiary:1234", TLS: &TLSConfig{CAFile: &caFileContents}},
+		},
+		Failover: &FailoverConfig{
+			MaxFailures:      5,
+			FailbackInterval: time.Minute,
+		},
+		Enrollment: &EnrollmentConfig{
+			Enabled:     true,
+			RenewBefore: time.Hour,
+		},
+		Diagnostics: &DiagnosticsConfig{
+			Enabled:            true,
+			MaxLogLines:        100,
+			MaxProfileDuration: 10 * time.Second,
+			MaxSize:            4096,
+		},
+		FailurePolicy: &FailurePolicy{
+			Action:        FailureActionRetry,
+			RetryInterval: time.Minute,
+			MaxRetries:    5,
+		},
 	}
 
 	copyCfg := cfg.Copy()
 	require.Equal(t, cfg, *copyCfg)
 }
+
+func TestAttributesConfigExpand(t *testing.T) {
+	t.Setenv("CONFIG_TEST_DATACENTER", "us-east-1")
+
+	var nilAttributes *AttributesConfig
+	require.Nil(t, nilAttributes.Expand())
+
+	attributes := &AttributesConfig{
+		Identifying:    map[string]string{"cluster": "prod"},
+		NonIdentifying: map[string]string{"datacenter": "${CONFIG_TEST_DATACENTER}"},
+	}
+
+	expanded := attributes.Expand()
+	require.Equal(t, &AttributesConfig{
+		Identifying:    map[string]string{"cluster": "prod"},
+		NonIdentifying: map[string]string{"datacenter": "us-east-1"},
+	}, expanded)
+
+	// The original is unchanged
+	require.Equal(t, "${CONFIG_TEST_DATACENTER}", attributes.NonIdentifying["datacenter"])
+}
@@ -0,0 +1,179 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opamp
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+// ConnectionState is the state of the connection to the OpAMP server
+type ConnectionState string
+
+const (
+	// ConnectionStateDisconnected is the state before connecting and after disconnecting
+	ConnectionStateDisconnected ConnectionState = "disconnected"
+
+	// ConnectionStateConnecting is the state while an attempt to connect is in progress
+	ConnectionStateConnecting ConnectionState = "connecting"
+
+	// ConnectionStateConnected is the state once the server accepts the connection
+	ConnectionStateConnected ConnectionState = "connected"
+
+	// ConnectionStateBackoff is the state while waiting to retry after the server couldn't be reached
+	ConnectionStateBackoff ConnectionState = "backoff"
+
+	// ConnectionStateAuthFailed is the state while waiting to retry after the server rejected the secret key
+	ConnectionStateAuthFailed ConnectionState = "auth-failed"
+)
+
+// ConnectionStates are all the states of the connection to the OpAMP server
+var ConnectionStates = []ConnectionState{
+	ConnectionStateDisconnected,
+	ConnectionStateConnecting,
+	ConnectionStateConnected,
+	ConnectionStateBackoff,
+	ConnectionStateAuthFailed,
+}
+
+// ConnectionStatus describes the connection to the OpAMP server
+type ConnectionStatus struct {
+	// State is the current state of the connection
+	State ConnectionState
+
+	// Endpoint is the server being connected to
+	Endpoint string
+
+	// Since is when the connection entered its current state
+	Since time.Time
+
+	// Attempts is the number of consecutive failed attempts to connect
+	Attempts int
+
+	// LastError is the error from the last failed attempt to connect
+	LastError string
+
+	// NextAttempt is when the next attempt to connect is made while backing off
+	NextAttempt time.Time
+
+	// Endpoints is the health of each endpoint in the order they're connected to
+	Endpoints []EndpointHealth
+}
+
+// EndpointHealth tracks the attempts to connect to an endpoint
+type EndpointHealth struct {
+	// Endpoint is the endpoint of the server
+	Endpoint string
+
+	// ConsecutiveFailures is the number of failed attempts since the endpoint was last connected to
+	ConsecutiveFailures int
+
+	// LastError is the error from the last failed attempt
+	LastError string
+
+	// LastFailure is when the last attempt failed
+	LastFailure time.Time
+
+	// LastConnected is when the endpoint was last connected to
+	LastConnected time.Time
+}
+
+// Default reconnect settings
+const (
+	DefaultReconnectInitialInterval = time.Second
+	DefaultReconnectMaxInterval     = 5 * time.Minute
+	DefaultReconnectMultiplier      = 1.5
+	DefaultReconnectJitter          = 0.5
+)
+
+// ReconnectConfig configures the exponential backoff between attempts to connect to the server.
+// Unset fields use the defaults.
+type ReconnectConfig struct {
+	// InitialInterval is how long to wait after the first failed attempt
+	InitialInterval time.Duration `yaml:"initial_interval,omitempty"`
+
+	// MaxInterval is the longest to wait between attempts. It's also how long to wait after the server rejects the secret key.
+	MaxInterval time.Duration `yaml:"max_interval,omitempty"`
+
+	// Multiplier is how much the interval grows after each failed attempt
+	Multiplier float64 `yaml:"multiplier,omitempty"`
+
+	// Jitter is the fraction of the interval it's randomized by, between 0 and 1
+	Jitter *float64 `yaml:"jitter,omitempty"`
+}
+
+// Validate checks the intervals, multiplier, and jitter are in range
+func (r *ReconnectConfig) Validate() error {
+	if r == nil {
+		return nil
+	}
+
+	switch {
+	case r.InitialInterval < 0 || r.MaxInterval < 0:
+		return errors.New("reconnect intervals must not be negative")
+	case r.MaxInterval > 0 && r.MaxInterval < r.InitialInterval:
+		return errors.New("reconnect max_interval must not be less than initial_interval")
+	case r.Multiplier != 0 && r.Multiplier < 1:
+		return errors.New("reconnect multiplier must be at least 1")
+	case r.Jitter != nil && (*r.Jitter < 0 || *r.Jitter > 1):
+		return errors.New("reconnect jitter must be between 0 and 1")
+	}
+	return nil
+}
+
+// GetMaxInterval returns the max interval if set else returns the default
+func (r *ReconnectConfig) GetMaxInterval() time.Duration {
+	if r == nil || r.MaxInterval == 0 {
+		return DefaultReconnectMaxInterval
+	}
+	return r.MaxInterval
+}
+
+// NewBackOff creates a backoff that never stops retrying. A nil config uses the defaults.
+func (r *ReconnectConfig) NewBackOff() backoff.BackOff {
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = DefaultReconnectInitialInterval
+	b.MaxInterval = r.GetMaxInterval()
+	b.Multiplier = DefaultReconnectMultiplier
+	b.RandomizationFactor = DefaultReconnectJitter
+	b.MaxElapsedTime = 0
+
+	if r != nil {
+		if r.InitialInterval > 0 {
+			b.InitialInterval = r.InitialInterval
+		}
+		if r.Multiplier > 0 {
+			b.Multiplier = r.Multiplier
+		}
+		if r.Jitter != nil {
+			b.RandomizationFactor = *r.Jitter
+		}
+	}
+
+	// The initial interval is only applied on reset
+	b.Reset()
+	return b
+}
+
+func (r ReconnectConfig) copy() *ReconnectConfig {
+	reconnectCopy := r
+	if r.Jitter != nil {
+		jitter := *r.Jitter
+		reconnectCopy.Jitter = &jitter
+	}
+	return &reconnectCopy
+}
@@ -0,0 +1,160 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opamp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReconnectConfigValidate(t *testing.T) {
+	negativeJitter := -0.1
+	largeJitter := 1.5
+	validJitter := 0.0
+
+	testCases := []struct {
+		desc        string
+		cfg         *ReconnectConfig
+		expectedErr string
+	}{
+		{
+			desc: "Nil config",
+		},
+		{
+			desc: "Valid config",
+			cfg: &ReconnectConfig{
+				InitialInterval: time.Second,
+				MaxInterval:     time.Minute,
+				Multiplier:      2,
+				Jitter:          &validJitter,
+			},
+		},
+		{
+			desc:        "Negative interval",
+			cfg:         &ReconnectConfig{InitialInterval: -time.Second},
+			expectedErr: "reconnect intervals must not be negative",
+		},
+		{
+			desc:        "Max interval less than initial interval",
+			cfg:         &ReconnectConfig{InitialInterval: time.Minute, MaxInterval: time.Second},
+			expectedErr: "reconnect max_interval must not be less than initial_interval",
+		},
+		{
+			desc:        "Multiplier less than one",
+			cfg:         &ReconnectConfig{Multiplier: 0.5},
+			expectedErr: "reconnect multiplier must be at least 1",
+		},
+		{
+			desc:        "Negative jitter",
+			cfg:         &ReconnectConfig{Jitter: &negativeJitter},
+			expectedErr: "reconnect jitter must be between 0 and 1",
+		},
+		{
+			desc:        "Jitter greater than one",
+			cfg:         &ReconnectConfig{Jitter: &largeJitter},
+			expectedErr: "reconnect jitter must be between 0 and 1",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			err := tc.cfg.Validate()
+			if tc.expectedErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tc.expectedErr)
+		})
+	}
+}
+
+func TestReconnectConfigNewBackOff(t *testing.T) {
+	jitter := 0.25
+
+	testCases := []struct {
+		desc     string
+		cfg      *ReconnectConfig
+		expected backoff.ExponentialBackOff
+	}{
+		{
+			desc: "Nil config uses defaults",
+			expected: backoff.ExponentialBackOff{
+				InitialInterval:     DefaultReconnectInitialInterval,
+				MaxInterval:         DefaultReconnectMaxInterval,
+				Multiplier:          DefaultReconnectMultiplier,
+				RandomizationFactor: DefaultReconnectJitter,
+			},
+		},
+		{
+			desc: "Unset fields use defaults",
+			cfg:  &ReconnectConfig{MaxInterval: time.Minute},
+			expected: backoff.ExponentialBackOff{
+				InitialInterval:     DefaultReconnectInitialInterval,
+				MaxInterval:         time.Minute,
+				Multiplier:          DefaultReconnectMultiplier,
+				RandomizationFactor: DefaultReconnectJitter,
+			},
+		},
+		{
+			desc: "All fields set",
+			cfg: &ReconnectConfig{
+				InitialInterval: 2 * time.Second,
+				MaxInterval:     time.Minute,
+				Multiplier:      3,
+				Jitter:          &jitter,
+			},
+			expected: backoff.ExponentialBackOff{
+				InitialInterval:     2 * time.Second,
+				MaxInterval:         time.Minute,
+				Multiplier:          3,
+				RandomizationFactor: 0.25,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			b, ok := tc.cfg.NewBackOff().(*backoff.ExponentialBackOff)
+			require.True(t, ok)
+
+			assert.Equal(t, tc.expected.InitialInterval, b.InitialInterval)
+			assert.Equal(t, tc.expected.MaxInterval, b.MaxInterval)
+			assert.Equal(t, tc.expected.Multiplier, b.Multiplier)
+			assert.Equal(t, tc.expected.RandomizationFactor, b.RandomizationFactor)
+
+			// Retries never stop
+			assert.Equal(t, time.Duration(0), b.MaxElapsedTime)
+		})
+	}
+}
+
+func TestReconnectConfigNewBackOffIntervals(t *testing.T) {
+	jitter := 0.0
+	cfg := &ReconnectConfig{
+		InitialInterval: time.Second,
+		MaxInterval:     5 * time.Second,
+		Multiplier:      2,
+		Jitter:          &jitter,
+	}
+
+	b := cfg.NewBackOff()
+	for _, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		assert.Equal(t, expected, b.NextBackOff())
+	}
+}
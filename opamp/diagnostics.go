@@ -0,0 +1,92 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opamp
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	// defaultMaxLogLines is the default number of collector log lines returned in diagnostics
+	defaultMaxLogLines = 500
+
+	// defaultMaxProfileDuration is the default longest CPU profile the server may request
+	defaultMaxProfileDuration = 30 * time.Second
+
+	// defaultMaxDiagnosticsSize is the default largest size in bytes of reported diagnostics
+	defaultMaxDiagnosticsSize = 1 << 20
+)
+
+// DiagnosticsConfig configures the diagnostics the server may request from the collector
+type DiagnosticsConfig struct {
+	// Enabled allows the server to request diagnostics
+	Enabled bool `yaml:"enabled"`
+
+	// MaxLogLines is the most lines from the end of the collector log returned. Defaults to 500.
+	MaxLogLines int `yaml:"max_log_lines,omitempty"`
+
+	// MaxProfileDuration is the longest CPU profile the server may request. Defaults to 30s.
+	MaxProfileDuration time.Duration `yaml:"max_profile_duration,omitempty"`
+
+	// MaxSize is the largest size in bytes of the reported diagnostics. Defaults to 1MiB.
+	MaxSize int `yaml:"max_size,omitempty"`
+}
+
+// Validate checks none of the limits are negative
+func (d *DiagnosticsConfig) Validate() error {
+	if d == nil {
+		return nil
+	}
+
+	switch {
+	case d.MaxLogLines < 0:
+		return errors.New("diagnostics max_log_lines must not be negative")
+	case d.MaxProfileDuration < 0:
+		return errors.New("diagnostics max_profile_duration must not be negative")
+	case d.MaxSize < 0:
+		return errors.New("diagnostics max_size must not be negative")
+	}
+	return nil
+}
+
+// IsEnabled returns true if diagnostics are configured and enabled
+func (d *DiagnosticsConfig) IsEnabled() bool {
+	return d != nil && d.Enabled
+}
+
+// GetMaxLogLines returns the most log lines returned or the default if unset
+func (d *DiagnosticsConfig) GetMaxLogLines() int {
+	if d == nil || d.MaxLogLines == 0 {
+		return defaultMaxLogLines
+	}
+	return d.MaxLogLines
+}
+
+// GetMaxProfileDuration returns the longest CPU profile allowed or the default if unset
+func (d *DiagnosticsConfig) GetMaxProfileDuration() time.Duration {
+	if d == nil || d.MaxProfileDuration == 0 {
+		return defaultMaxProfileDuration
+	}
+	return d.MaxProfileDuration
+}
+
+// GetMaxSize returns the largest size of reported diagnostics or the default if unset
+func (d *DiagnosticsConfig) GetMaxSize() int {
+	if d == nil || d.MaxSize == 0 {
+		return defaultMaxDiagnosticsSize
+	}
+	return d.MaxSize
+}
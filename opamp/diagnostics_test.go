@@ -0,0 +1,89 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opamp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiagnosticsConfig(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		testFunc func(*testing.T)
+	}{
+		{
+			desc: "Nil config",
+			testFunc: func(t *testing.T) {
+				var d *DiagnosticsConfig
+				assert.NoError(t, d.Validate())
+				assert.False(t, d.IsEnabled())
+				assert.Equal(t, defaultMaxLogLines, d.GetMaxLogLines())
+				assert.Equal(t, defaultMaxProfileDuration, d.GetMaxProfileDuration())
+				assert.Equal(t, defaultMaxDiagnosticsSize, d.GetMaxSize())
+			},
+		},
+		{
+			desc: "Disabled",
+			testFunc: func(t *testing.T) {
+				d := &DiagnosticsConfig{MaxLogLines: 10}
+				assert.False(t, d.IsEnabled())
+			},
+		},
+		{
+			desc: "Limits set",
+			testFunc: func(t *testing.T) {
+				d := &DiagnosticsConfig{
+					Enabled:            true,
+					MaxLogLines:        10,
+					MaxProfileDuration: time.Second,
+					MaxSize:            1024,
+				}
+				assert.NoError(t, d.Validate())
+				assert.True(t, d.IsEnabled())
+				assert.Equal(t, 10, d.GetMaxLogLines())
+				assert.Equal(t, time.Second, d.GetMaxProfileDuration())
+				assert.Equal(t, 1024, d.GetMaxSize())
+			},
+		},
+		{
+			desc: "Negative max log lines",
+			testFunc: func(t *testing.T) {
+				d := &DiagnosticsConfig{MaxLogLines: -1}
+				assert.EqualError(t, d.Validate(), "diagnostics max_log_lines must not be negative")
+			},
+		},
+		{
+			desc: "Negative max profile duration",
+			testFunc: func(t *testing.T) {
+				d := &DiagnosticsConfig{MaxProfileDuration: -time.Second}
+				assert.EqualError(t, d.Validate(), "diagnostics max_profile_duration must not be negative")
+			},
+		},
+		{
+			desc: "Negative max size",
+			testFunc: func(t *testing.T) {
+				d := &DiagnosticsConfig{MaxSize: -1}
+				assert.EqualError(t, d.Validate(), "diagnostics max_size must not be negative")
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, tc.testFunc)
+	}
+}
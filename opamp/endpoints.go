@@ -0,0 +1,124 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opamp
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Default failover settings
+const (
+	DefaultFailoverMaxFailures      = 3
+	DefaultFailoverFailbackInterval = 5 * time.Minute
+)
+
+// EndpointConfig is an endpoint of the server and the TLS settings used to connect to it
+type EndpointConfig struct {
+	Endpoint string `yaml:"endpoint"`
+
+	// TLS is used instead of the config's TLS settings if set
+	TLS *TLSConfig `yaml:"tls_config,omitempty"`
+}
+
+func (e EndpointConfig) copy() EndpointConfig {
+	endpointCopy := EndpointConfig{
+		Endpoint: e.Endpoint,
+	}
+	if e.TLS != nil {
+		endpointCopy.TLS = e.TLS.copy()
+	}
+	return endpointCopy
+}
+
+// validateFallbackEndpoints checks each fallback endpoint is set and its TLS files exist
+func validateFallbackEndpoints(endpoints []EndpointConfig) error {
+	for i, endpoint := range endpoints {
+		if endpoint.Endpoint == "" {
+			return fmt.Errorf("fallback endpoint %d has no endpoint", i)
+		}
+		if err := endpoint.TLS.validate(); err != nil {
+			return fmt.Errorf("fallback endpoint %s: %w", endpoint.Endpoint, err)
+		}
+	}
+	return nil
+}
+
+// FailoverConfig configures when the collector switches between endpoints
+type FailoverConfig struct {
+	// MaxFailures is the number of consecutive failed attempts to connect to an endpoint before trying the next one
+	MaxFailures int `yaml:"max_failures,omitempty"`
+
+	// FailbackInterval is how often the collector checks if an earlier endpoint has recovered while connected to a later one
+	FailbackInterval time.Duration `yaml:"failback_interval,omitempty"`
+}
+
+// Validate checks the max failures and failback interval aren't negative
+func (f *FailoverConfig) Validate() error {
+	if f == nil {
+		return nil
+	}
+
+	switch {
+	case f.MaxFailures < 0:
+		return errors.New("failover max_failures must not be negative")
+	case f.FailbackInterval < 0:
+		return errors.New("failover failback_interval must not be negative")
+	}
+	return nil
+}
+
+// GetMaxFailures returns the max failures if set else returns the default
+func (f *FailoverConfig) GetMaxFailures() int {
+	if f == nil || f.MaxFailures == 0 {
+		return DefaultFailoverMaxFailures
+	}
+	return f.MaxFailures
+}
+
+// GetFailbackInterval returns the failback interval if set else returns the default
+func (f *FailoverConfig) GetFailbackInterval() time.Duration {
+	if f == nil || f.FailbackInterval == 0 {
+		return DefaultFailoverFailbackInterval
+	}
+	return f.FailbackInterval
+}
+
+// GetEndpoints returns the endpoint followed by the fallback endpoints in the order they're connected to.
+// Fallback endpoints without TLS settings use the config's.
+func (c Config) GetEndpoints() []EndpointConfig {
+	endpoints := make([]EndpointConfig, 0, len(c.FallbackEndpoints)+1)
+	endpoints = append(endpoints, EndpointConfig{Endpoint: c.Endpoint, TLS: c.TLS})
+
+	for _, fallback := range c.FallbackEndpoints {
+		if fallback.TLS == nil {
+			fallback.TLS = c.TLS
+		}
+		endpoints = append(endpoints, fallback)
+	}
+	return endpoints
+}
+
+// WithEndpoint returns a copy of the config that connects to the endpoint
+func (c Config) WithEndpoint(endpoint EndpointConfig) *Config {
+	cfgCopy := c.Copy()
+	cfgCopy.Endpoint = endpoint.Endpoint
+	cfgCopy.TLS = nil
+	if endpoint.TLS != nil {
+		cfgCopy.TLS = endpoint.TLS.copy()
+	}
+	return cfgCopy
+}
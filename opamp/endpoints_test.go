@@ -0,0 +1,125 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opamp
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigGetEndpoints(t *testing.T) {
+	caFile := "ca.crt"
+	fallbackCAFile := "fallback-ca.crt"
+
+	cfg := Config{
+		Endpoint: "wss://primary.localnet/v1/opamp",
+		TLS:      &TLSConfig{CAFile: &caFile},
+		FallbackEndpoints: []EndpointConfig{
+			{Endpoint: "wss://secondary.localnet/v1/opamp"},
+			{Endpoint: "wss://tertiary.localnet/v1/opamp", TLS: &TLSConfig{CAFile: &fallbackCAFile}},
+		},
+	}
+
+	expected := []EndpointConfig{
+		{Endpoint: "wss://primary.localnet/v1/opamp", TLS: &TLSConfig{CAFile: &caFile}},
+		{Endpoint: "wss://secondary.localnet/v1/opamp", TLS: &TLSConfig{CAFile: &caFile}},
+		{Endpoint: "wss://tertiary.localnet/v1/opamp", TLS: &TLSConfig{CAFile: &fallbackCAFile}},
+	}
+	assert.Equal(t, expected, cfg.GetEndpoints())
+
+	// Fallback endpoints aren't modified
+	assert.Nil(t, cfg.FallbackEndpoints[0].TLS)
+
+	// No fallback endpoints
+	assert.Equal(t, []EndpointConfig{{Endpoint: "ws://localhost:1234"}}, Config{Endpoint: "ws://localhost:1234"}.GetEndpoints())
+}
+
+func TestConfigWithEndpoint(t *testing.T) {
+	caFile := "ca.crt"
+	secretKey := "b92222ee-a1fc-4bb1-98db-26de3448541b"
+
+	cfg := Config{
+		Endpoint:  "wss://primary.localnet/v1/opamp",
+		SecretKey: &secretKey,
+		TLS:       &TLSConfig{CAFile: &caFile},
+	}
+
+	withEndpoint := cfg.WithEndpoint(EndpointConfig{Endpoint: "ws://secondary.localnet/v1/opamp"})
+	assert.Equal(t, "ws://secondary.localnet/v1/opamp", withEndpoint.Endpoint)
+	assert.Nil(t, withEndpoint.TLS)
+	assert.Equal(t, secretKey, withEndpoint.GetSecretKey())
+
+	// The original config isn't modified
+	assert.Equal(t, "wss://primary.localnet/v1/opamp", cfg.Endpoint)
+	assert.NotNil(t, cfg.TLS)
+}
+
+func TestValidateFallbackEndpoints(t *testing.T) {
+	missingFile := filepath.Join(t.TempDir(), "missing.crt")
+
+	testCases := []struct {
+		desc        string
+		endpoints   []EndpointConfig
+		expectedErr string
+	}{
+		{
+			desc: "No fallback endpoints",
+		},
+		{
+			desc:      "Valid fallback endpoints",
+			endpoints: []EndpointConfig{{Endpoint: "ws://secondary.localnet/v1/opamp"}},
+		},
+		{
+			desc:        "Missing endpoint",
+			endpoints:   []EndpointConfig{{Endpoint: "ws://secondary.localnet/v1/opamp"}, {}},
+			expectedErr: "fallback endpoint 1 has no endpoint",
+		},
+		{
+			desc:        "Missing TLS file",
+			endpoints:   []EndpointConfig{{Endpoint: "wss://secondary.localnet/v1/opamp", TLS: &TLSConfig{CAFile: &missingFile}}},
+			expectedErr: "fallback endpoint wss://secondary.localnet/v1/opamp: " + errInvalidCAFile,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			err := validateFallbackEndpoints(tc.endpoints)
+			if tc.expectedErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tc.expectedErr)
+		})
+	}
+}
+
+func TestFailoverConfig(t *testing.T) {
+	var nilCfg *FailoverConfig
+	require.NoError(t, nilCfg.Validate())
+	assert.Equal(t, DefaultFailoverMaxFailures, nilCfg.GetMaxFailures())
+	assert.Equal(t, DefaultFailoverFailbackInterval, nilCfg.GetFailbackInterval())
+
+	cfg := &FailoverConfig{MaxFailures: 5, FailbackInterval: time.Minute}
+	require.NoError(t, cfg.Validate())
+	assert.Equal(t, 5, cfg.GetMaxFailures())
+	assert.Equal(t, time.Minute, cfg.GetFailbackInterval())
+
+	assert.EqualError(t, (&FailoverConfig{MaxFailures: -1}).Validate(), "failover max_failures must not be negative")
+	assert.EqualError(t, (&FailoverConfig{FailbackInterval: -time.Second}).Validate(), "failover failback_interval must not be negative")
+}
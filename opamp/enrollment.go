@@ -0,0 +1,57 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opamp
+
+import (
+	"crypto/x509"
+	"errors"
+	"time"
+)
+
+// EnrollmentConfig configures requesting a client certificate from the server
+type EnrollmentConfig struct {
+	// Enabled requests a client certificate when there isn't one or it's about to expire
+	Enabled bool `yaml:"enabled"`
+
+	// RenewBefore is how long before the certificate expires a new one is requested.
+	// Defaults to a third of the certificate's lifetime.
+	RenewBefore time.Duration `yaml:"renew_before,omitempty"`
+}
+
+// Validate checks the renew before duration isn't negative
+func (e *EnrollmentConfig) Validate() error {
+	if e == nil {
+		return nil
+	}
+
+	if e.RenewBefore < 0 {
+		return errors.New("enrollment renew_before must not be negative")
+	}
+	return nil
+}
+
+// IsEnabled returns true if enrollment is configured and enabled
+func (e *EnrollmentConfig) IsEnabled() bool {
+	return e != nil && e.Enabled
+}
+
+// RenewalTime returns when a new certificate should be requested to replace the certificate
+func (e *EnrollmentConfig) RenewalTime(cert *x509.Certificate) time.Time {
+	renewBefore := cert.NotAfter.Sub(cert.NotBefore) / 3
+	if e != nil && e.RenewBefore > 0 {
+		renewBefore = e.RenewBefore
+	}
+	return cert.NotAfter.Add(-renewBefore)
+}
@@ -0,0 +1,73 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opamp
+
+import (
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnrollmentConfig(t *testing.T) {
+	notBefore := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	cert := &x509.Certificate{
+		NotBefore: notBefore,
+		NotAfter:  notBefore.Add(90 * 24 * time.Hour),
+	}
+
+	testCases := []struct {
+		desc     string
+		testFunc func(*testing.T)
+	}{
+		{
+			desc: "Nil config",
+			testFunc: func(t *testing.T) {
+				var e *EnrollmentConfig
+				assert.NoError(t, e.Validate())
+				assert.False(t, e.IsEnabled())
+				assert.Equal(t, notBefore.Add(60*24*time.Hour), e.RenewalTime(cert))
+			},
+		},
+		{
+			desc: "Disabled",
+			testFunc: func(t *testing.T) {
+				e := &EnrollmentConfig{RenewBefore: time.Hour}
+				assert.False(t, e.IsEnabled())
+			},
+		},
+		{
+			desc: "Renew before set",
+			testFunc: func(t *testing.T) {
+				e := &EnrollmentConfig{Enabled: true, RenewBefore: 7 * 24 * time.Hour}
+				assert.NoError(t, e.Validate())
+				assert.True(t, e.IsEnabled())
+				assert.Equal(t, notBefore.Add(83*24*time.Hour), e.RenewalTime(cert))
+			},
+		},
+		{
+			desc: "Negative renew before",
+			testFunc: func(t *testing.T) {
+				e := &EnrollmentConfig{Enabled: true, RenewBefore: -time.Hour}
+				assert.EqualError(t, e.Validate(), "enrollment renew_before must not be negative")
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, tc.testFunc)
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opamp
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Actions taken when the collector or OpAMP client can't recover on its own
+const (
+	// FailureActionExit stops the service with an error so it can be restarted by the service manager
+	FailureActionExit = "exit"
+
+	// FailureActionRetry keeps retrying in place, exiting once the retries are exhausted
+	FailureActionRetry = "retry"
+)
+
+// DefaultFailureRetryInterval is how long to wait between retries if the policy doesn't set it
+const DefaultFailureRetryInterval = 30 * time.Second
+
+// FailurePolicy configures what happens when the collector can't start even after a rollback
+// or the OpAMP client has stopped and won't reconnect
+type FailurePolicy struct {
+	// Action is either FailureActionExit or FailureActionRetry. Defaults to FailureActionExit.
+	Action string `yaml:"action,omitempty"`
+
+	// RetryInterval is how long to wait between retries. Defaults to 30s.
+	RetryInterval time.Duration `yaml:"retry_interval,omitempty"`
+
+	// MaxRetries is the number of failed retries before exiting. Zero retries forever.
+	MaxRetries int `yaml:"max_retries,omitempty"`
+}
+
+// Validate checks the action is known and the retry settings aren't negative
+func (f *FailurePolicy) Validate() error {
+	if f == nil {
+		return nil
+	}
+
+	switch {
+	case f.Action != "" && f.Action != FailureActionExit && f.Action != FailureActionRetry:
+		return fmt.Errorf("failure_policy has unknown action %q", f.Action)
+	case f.RetryInterval < 0:
+		return errors.New("failure_policy retry_interval must not be negative")
+	case f.MaxRetries < 0:
+		return errors.New("failure_policy max_retries must not be negative")
+	}
+	return nil
+}
+
+// ShouldRetry returns true if failures are retried in place instead of exiting
+func (f *FailurePolicy) ShouldRetry() bool {
+	return f != nil && f.Action == FailureActionRetry
+}
+
+// GetRetryInterval returns the interval between retries or the default if unset
+func (f *FailurePolicy) GetRetryInterval() time.Duration {
+	if f == nil || f.RetryInterval == 0 {
+		return DefaultFailureRetryInterval
+	}
+	return f.RetryInterval
+}
@@ -0,0 +1,81 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opamp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFailurePolicy(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		testFunc func(*testing.T)
+	}{
+		{
+			desc: "Nil policy",
+			testFunc: func(t *testing.T) {
+				var f *FailurePolicy
+				assert.NoError(t, f.Validate())
+				assert.False(t, f.ShouldRetry())
+				assert.Equal(t, DefaultFailureRetryInterval, f.GetRetryInterval())
+			},
+		},
+		{
+			desc: "Exit",
+			testFunc: func(t *testing.T) {
+				f := &FailurePolicy{Action: FailureActionExit, RetryInterval: time.Second}
+				assert.NoError(t, f.Validate())
+				assert.False(t, f.ShouldRetry())
+			},
+		},
+		{
+			desc: "Retry",
+			testFunc: func(t *testing.T) {
+				f := &FailurePolicy{Action: FailureActionRetry, RetryInterval: time.Second, MaxRetries: 3}
+				assert.NoError(t, f.Validate())
+				assert.True(t, f.ShouldRetry())
+				assert.Equal(t, time.Second, f.GetRetryInterval())
+			},
+		},
+		{
+			desc: "Unknown action",
+			testFunc: func(t *testing.T) {
+				f := &FailurePolicy{Action: "ignore"}
+				assert.EqualError(t, f.Validate(), `failure_policy has unknown action "ignore"`)
+			},
+		},
+		{
+			desc: "Negative retry interval",
+			testFunc: func(t *testing.T) {
+				f := &FailurePolicy{RetryInterval: -time.Second}
+				assert.EqualError(t, f.Validate(), "failure_policy retry_interval must not be negative")
+			},
+		},
+		{
+			desc: "Negative max retries",
+			testFunc: func(t *testing.T) {
+				f := &FailurePolicy{MaxRetries: -1}
+				assert.EqualError(t, f.Validate(), "failure_policy max_retries must not be negative")
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, tc.testFunc)
+	}
+}
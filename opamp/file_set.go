@@ -0,0 +1,229 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opamp
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultMaxFileSize is the largest file in a file set if it doesn't set a limit
+const DefaultMaxFileSize int64 = 1 << 20
+
+// OnChangeRestartCollector restarts the collector after files in the set change
+const OnChangeRestartCollector = "restart_collector"
+
+var (
+	// ErrInvalidFileName is returned for a file name outside a file set's root or not matching its patterns
+	ErrInvalidFileName = errors.New("invalid file name")
+
+	// ErrFileTooLarge is returned for a file larger than a file set allows
+	ErrFileTooLarge = errors.New("file too large")
+
+	// ErrTooManyFiles is returned when adding a file would exceed a file set's limit
+	ErrTooManyFiles = errors.New("too many files")
+)
+
+// FileSet is a directory of supporting files, such as plugins or CA bundles, the server may write.
+// Files are named "<set name>/<path relative to root>" in remote and effective configs.
+type FileSet struct {
+	// Name prefixes the names of the set's files
+	Name string `yaml:"name"`
+
+	// Root is the directory the set's files are written to
+	Root string `yaml:"root"`
+
+	// Patterns are the glob patterns, matched with path.Match, that paths relative to Root must match
+	Patterns []string `yaml:"patterns"`
+
+	// MaxFileSize is the largest file in bytes. Defaults to DefaultMaxFileSize.
+	MaxFileSize int64 `yaml:"max_file_size,omitempty"`
+
+	// MaxFiles is the most files the set may hold. Zero means no limit.
+	MaxFiles int `yaml:"max_files,omitempty"`
+
+	// ContentType of the set's files. Determined by each file's extension if empty.
+	ContentType string `yaml:"content_type,omitempty"`
+
+	// OnChange is the action taken after a file changes. Either empty or OnChangeRestartCollector.
+	OnChange string `yaml:"on_change,omitempty"`
+}
+
+// Validate returns an error if the file set is not usable
+func (f FileSet) Validate() error {
+	switch {
+	case f.Name == "":
+		return errors.New("file set name must be set")
+	case strings.ContainsAny(f.Name, `/\`):
+		return fmt.Errorf("file set name %q must not contain a path separator", f.Name)
+	case f.Root == "":
+		return fmt.Errorf("file set %s root must be set", f.Name)
+	case len(f.Patterns) == 0:
+		return fmt.Errorf("file set %s must have at least one pattern", f.Name)
+	case f.MaxFileSize < 0:
+		return fmt.Errorf("file set %s max_file_size must not be negative", f.Name)
+	case f.MaxFiles < 0:
+		return fmt.Errorf("file set %s max_files must not be negative", f.Name)
+	case f.OnChange != "" && f.OnChange != OnChangeRestartCollector:
+		return fmt.Errorf("file set %s has unknown on_change %q", f.Name, f.OnChange)
+	}
+
+	for _, pattern := range f.Patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("file set %s has invalid pattern %q: %w", f.Name, pattern, err)
+		}
+	}
+
+	return nil
+}
+
+// validateFileSets validates each file set and checks their names are unique
+func validateFileSets(fileSets []FileSet) error {
+	names := make(map[string]struct{}, len(fileSets))
+	for _, fileSet := range fileSets {
+		if err := fileSet.Validate(); err != nil {
+			return err
+		}
+
+		if _, ok := names[fileSet.Name]; ok {
+			return fmt.Errorf("duplicate file set name %s", fileSet.Name)
+		}
+		names[fileSet.Name] = struct{}{}
+	}
+	return nil
+}
+
+// ConfigName returns the name of a file in the set given its path relative to the root
+func (f FileSet) ConfigName(relPath string) string {
+	return f.Name + "/" + relPath
+}
+
+// RelPath returns the path relative to the root of a file in the set given its config name.
+// False is returned if the config name is not in the set.
+func (f FileSet) RelPath(configName string) (string, bool) {
+	prefix := f.Name + "/"
+	if !strings.HasPrefix(configName, prefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(configName, prefix), true
+}
+
+// Resolve returns the path on disk of a file in the set given its path relative to the root.
+// Paths escaping the root, symlinks, and names not matching a pattern are rejected.
+func (f FileSet) Resolve(relPath string) (string, error) {
+	if relPath == "" || strings.Contains(relPath, `\`) || path.IsAbs(relPath) || path.Clean(relPath) != relPath {
+		return "", fmt.Errorf("%w: %q", ErrInvalidFileName, relPath)
+	}
+	for _, element := range strings.Split(relPath, "/") {
+		if element == ".." {
+			return "", fmt.Errorf("%w: %q", ErrInvalidFileName, relPath)
+		}
+	}
+
+	if !f.matches(relPath) {
+		return "", fmt.Errorf("%w: %q does not match the patterns of file set %s", ErrInvalidFileName, relPath, f.Name)
+	}
+
+	root := filepath.Clean(f.Root)
+	filePath := filepath.Join(root, filepath.FromSlash(relPath))
+
+	// Guard against anything the checks above missed
+	rel, err := filepath.Rel(root, filePath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %q is outside of file set %s", ErrInvalidFileName, relPath, f.Name)
+	}
+
+	// A symlink in the path could point a write outside of the root
+	current := root
+	for _, element := range strings.Split(relPath, "/") {
+		current = filepath.Join(current, element)
+		if info, err := os.Lstat(current); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+			return "", fmt.Errorf("%w: %q contains a symlink", ErrInvalidFileName, relPath)
+		}
+	}
+
+	return filePath, nil
+}
+
+// CheckSize returns an error if the contents are larger than the set allows
+func (f FileSet) CheckSize(contents []byte) error {
+	maxFileSize := f.MaxFileSize
+	if maxFileSize == 0 {
+		maxFileSize = DefaultMaxFileSize
+	}
+
+	if size := int64(len(contents)); size > maxFileSize {
+		return fmt.Errorf("%w: %d bytes exceeds the %d byte limit of file set %s", ErrFileTooLarge, size, maxFileSize, f.Name)
+	}
+	return nil
+}
+
+// DetermineContentType returns the content type of a file in the set
+func (f FileSet) DetermineContentType(filePath string) string {
+	if f.ContentType != "" {
+		return f.ContentType
+	}
+	return DetermineContentType(filePath)
+}
+
+// Files returns the paths relative to the root of the regular files in the set.
+// A missing root has no files.
+func (f FileSet) Files() ([]string, error) {
+	root := filepath.Clean(f.Root)
+
+	var files []string
+	err := filepath.WalkDir(root, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if filePath == root && errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, filePath)
+		if err != nil {
+			return err
+		}
+
+		if relPath := filepath.ToSlash(rel); f.matches(relPath) {
+			files = append(files, relPath)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files of file set %s: %w", f.Name, err)
+	}
+
+	return files, nil
+}
+
+// matches returns true if the relative path matches one of the set's patterns
+func (f FileSet) matches(relPath string) bool {
+	for _, pattern := range f.Patterns {
+		if ok, _ := path.Match(pattern, relPath); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,189 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opamp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileSetValidate(t *testing.T) {
+	valid := FileSet{
+		Name:     "plugins",
+		Root:     "./plugins",
+		Patterns: []string{"*.yaml"},
+	}
+
+	testCases := []struct {
+		desc        string
+		modify      func(f *FileSet)
+		expectedErr string
+	}{
+		{
+			desc:   "Valid",
+			modify: func(*FileSet) {},
+		},
+		{
+			desc:        "Missing name",
+			modify:      func(f *FileSet) { f.Name = "" },
+			expectedErr: "name must be set",
+		},
+		{
+			desc:        "Name with separator",
+			modify:      func(f *FileSet) { f.Name = "a/b" },
+			expectedErr: "must not contain a path separator",
+		},
+		{
+			desc:        "Missing root",
+			modify:      func(f *FileSet) { f.Root = "" },
+			expectedErr: "root must be set",
+		},
+		{
+			desc:        "Missing patterns",
+			modify:      func(f *FileSet) { f.Patterns = nil },
+			expectedErr: "at least one pattern",
+		},
+		{
+			desc:        "Invalid pattern",
+			modify:      func(f *FileSet) { f.Patterns = []string{"["} },
+			expectedErr: "invalid pattern",
+		},
+		{
+			desc:        "Unknown on_change",
+			modify:      func(f *FileSet) { f.OnChange = "reboot" },
+			expectedErr: "unknown on_change",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			fileSet := valid
+			tc.modify(&fileSet)
+
+			err := fileSet.Validate()
+			if tc.expectedErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tc.expectedErr)
+		})
+	}
+}
+
+func TestFileSetResolve(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	require.NoError(t, os.Symlink(outside, filepath.Join(root, "link")))
+
+	fileSet := FileSet{
+		Name:     "plugins",
+		Root:     root,
+		Patterns: []string{"*.yaml", "*/*.yaml"},
+	}
+
+	testCases := []struct {
+		desc     string
+		relPath  string
+		expected string
+	}{
+		{
+			desc:     "File in root",
+			relPath:  "redis.yaml",
+			expected: filepath.Join(root, "redis.yaml"),
+		},
+		{
+			desc:     "File in sub directory",
+			relPath:  "db/postgres.yaml",
+			expected: filepath.Join(root, "db", "postgres.yaml"),
+		},
+		{
+			desc:    "Empty",
+			relPath: "",
+		},
+		{
+			desc:    "Parent directory",
+			relPath: "../manager.yaml",
+		},
+		{
+			desc:    "Parent directory in the middle",
+			relPath: "db/../../manager.yaml",
+		},
+		{
+			desc:    "Absolute path",
+			relPath: "/etc/passwd.yaml",
+		},
+		{
+			desc:    "Backslash",
+			relPath: `..\manager.yaml`,
+		},
+		{
+			desc:    "Not matching a pattern",
+			relPath: "script.sh",
+		},
+		{
+			desc:    "Through a symlink",
+			relPath: "link/redis.yaml",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			actual, err := fileSet.Resolve(tc.relPath)
+			if tc.expected == "" {
+				require.ErrorIs(t, err, ErrInvalidFileName)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestFileSetCheckSize(t *testing.T) {
+	fileSet := FileSet{MaxFileSize: 4}
+	assert.NoError(t, fileSet.CheckSize([]byte("abcd")))
+	assert.ErrorIs(t, fileSet.CheckSize([]byte("abcde")), ErrFileTooLarge)
+
+	fileSet.MaxFileSize = 0
+	assert.NoError(t, fileSet.CheckSize(make([]byte, DefaultMaxFileSize)))
+	assert.ErrorIs(t, fileSet.CheckSize(make([]byte, DefaultMaxFileSize+1)), ErrFileTooLarge)
+}
+
+func TestFileSetFiles(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "db"), 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "redis.yaml"), nil, 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "db", "postgres.yaml"), nil, 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "README.md"), nil, 0600))
+
+	fileSet := FileSet{
+		Name:     "plugins",
+		Root:     root,
+		Patterns: []string{"*.yaml", "*/*.yaml"},
+	}
+
+	files, err := fileSet.Files()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"redis.yaml", "db/postgres.yaml"}, files)
+
+	fileSet.Root = filepath.Join(root, "missing")
+	files, err = fileSet.Files()
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
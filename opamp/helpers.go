@@ -16,6 +16,9 @@ package opamp
 
 import (
 	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
 
 	"github.com/open-telemetry/opamp-go/protobufs"
 )
@@ -30,9 +33,78 @@ func StringKeyValue(key, value string) *protobufs.KeyValue {
 	}
 }
 
+// IntKeyValue converts a string key and int value pair into a protobuf.KeyValue struct
+func IntKeyValue(key string, value int64) *protobufs.KeyValue {
+	return &protobufs.KeyValue{
+		Key: key,
+		Value: &protobufs.AnyValue{
+			Value: &protobufs.AnyValue_IntValue{IntValue: value},
+		},
+	}
+}
+
+// StringArrayKeyValue converts a string key and string slice value pair into a protobuf.KeyValue struct
+func StringArrayKeyValue(key string, values []string) *protobufs.KeyValue {
+	arrayValue := &protobufs.ArrayValue{
+		Values: make([]*protobufs.AnyValue, 0, len(values)),
+	}
+	for _, value := range values {
+		arrayValue.Values = append(arrayValue.Values, &protobufs.AnyValue{
+			Value: &protobufs.AnyValue_StringValue{StringValue: value},
+		})
+	}
+
+	return &protobufs.KeyValue{
+		Key: key,
+		Value: &protobufs.AnyValue{
+			Value: &protobufs.AnyValue_ArrayValue{ArrayValue: arrayValue},
+		},
+	}
+}
+
 // ComputeHash computes a sha256 hash of the passed in data
 func ComputeHash(data []byte) []byte {
 	hash := sha256.New()
 	hash.Write(data)
 	return hash.Sum(nil)
 }
+
+// WriteFileAtomic writes the contents to a temporary file in the same directory, syncs it, then renames it over path.
+// Readers of path see either the old or new contents, never a partial write.
+func WriteFileAtomic(path string, contents []byte, perm os.FileMode) (err error) {
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), fmt.Sprintf(".%s-*.tmp", filepath.Base(path)))
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tmpPath := tmpFile.Name()
+
+	// Clean up the temporary file if anything fails before the rename
+	defer func() {
+		if err != nil {
+			_ = tmpFile.Close()
+			_ = os.Remove(tmpPath)
+		}
+	}()
+
+	if _, err = tmpFile.Write(contents); err != nil {
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+
+	if err = tmpFile.Chmod(perm); err != nil {
+		return fmt.Errorf("failed to set permissions on temporary file: %w", err)
+	}
+
+	if err = tmpFile.Sync(); err != nil {
+		return fmt.Errorf("failed to sync temporary file: %w", err)
+	}
+
+	if err = tmpFile.Close(); err != nil {
+		return fmt.Errorf("failed to close temporary file: %w", err)
+	}
+
+	if err = os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to replace file: %w", err)
+	}
+
+	return nil
+}
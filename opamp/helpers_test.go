@@ -15,6 +15,8 @@
 package opamp
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/open-telemetry/opamp-go/protobufs"
@@ -34,8 +36,78 @@ func TestStringKeyValue(t *testing.T) {
 	require.Equal(t, expected, actual)
 }
 
+func TestIntKeyValue(t *testing.T) {
+	expected := &protobufs.KeyValue{
+		Key: "key",
+		Value: &protobufs.AnyValue{
+			Value: &protobufs.AnyValue_IntValue{IntValue: 8},
+		},
+	}
+
+	actual := IntKeyValue("key", 8)
+	require.Equal(t, expected, actual)
+}
+
+func TestStringArrayKeyValue(t *testing.T) {
+	expected := &protobufs.KeyValue{
+		Key: "key",
+		Value: &protobufs.AnyValue{
+			Value: &protobufs.AnyValue_ArrayValue{
+				ArrayValue: &protobufs.ArrayValue{
+					Values: []*protobufs.AnyValue{
+						{Value: &protobufs.AnyValue_StringValue{StringValue: "a"}},
+						{Value: &protobufs.AnyValue_StringValue{StringValue: "b"}},
+					},
+				},
+			},
+		},
+	}
+
+	actual := StringArrayKeyValue("key", []string{"a", "b"})
+	require.Equal(t, expected, actual)
+}
+
 func TestComputeHash(t *testing.T) {
 	expected := []byte{0xc2, 0xae, 0xcc, 0xc4, 0x2d, 0x2a, 0x57, 0x9c, 0x28, 0x1d, 0xaa, 0xe7, 0xe4, 0x64, 0xa1, 0x4d, 0x74, 0x79, 0x24, 0x15, 0x9e, 0x28, 0x61, 0x7a, 0xd0, 0x18, 0x50, 0xf0, 0xdd, 0x1b, 0xd1, 0x35}
 	actual := ComputeHash([]byte("hellow world"))
 	require.Equal(t, expected, actual)
 }
+
+func TestWriteFileAtomic(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		testFunc func(*testing.T)
+	}{
+		{
+			desc: "Replaces existing file",
+			testFunc: func(t *testing.T) {
+				tmpDir := t.TempDir()
+				path := filepath.Join(tmpDir, "config.yaml")
+				require.NoError(t, os.WriteFile(path, []byte("old"), 0600))
+
+				require.NoError(t, WriteFileAtomic(path, []byte("new"), 0600))
+
+				data, err := os.ReadFile(path)
+				require.NoError(t, err)
+				require.Equal(t, []byte("new"), data)
+
+				// No temporary files are left behind
+				files, err := os.ReadDir(tmpDir)
+				require.NoError(t, err)
+				require.Len(t, files, 1)
+			},
+		},
+		{
+			desc: "Missing directory",
+			testFunc: func(t *testing.T) {
+				path := filepath.Join(t.TempDir(), "missing", "config.yaml")
+				err := WriteFileAtomic(path, []byte("new"), 0600)
+				require.ErrorContains(t, err, "failed to create temporary file")
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, tc.testFunc)
+	}
+}
@@ -15,6 +15,7 @@
 package opamp
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -23,24 +24,31 @@ import (
 // ReloadFunc is a function that handles reloading a config given the new contents
 // Reload function should return true for changed is the in memory or on disk copy of the config
 // was changed in any way. If neither was altered the changed return value should be false.
-type ReloadFunc func([]byte) (changed bool, err error)
+// A cancelled context should abort the reload and restore the original config.
+type ReloadFunc func(ctx context.Context, contents []byte) (changed bool, err error)
 
 // NoopReloadFunc used as a noop reload function if unsure of how to reload
-func NoopReloadFunc([]byte) (bool, error) {
+func NoopReloadFunc(context.Context, []byte) (bool, error) {
 	return false, nil
 }
 
-// NewManagedConfig creates a new Managed config and computes its hash
+// NewManagedConfig creates a new Managed config, computes its hash, and records its current contents in its history
 func NewManagedConfig(configPath string, reload ReloadFunc) (*ManagedConfig, error) {
 	managedConfig := &ManagedConfig{
 		ConfigPath: configPath,
 		Reload:     reload,
+		History:    NewConfigHistory(configPath, DefaultHistorySize),
 	}
 
 	if err := managedConfig.ComputeConfigHash(); err != nil {
 		return nil, fmt.Errorf("failed to compute hash for config %w", err)
 	}
 
+	// Contents that differ from the latest recorded version were changed locally
+	if _, err := managedConfig.RecordHistory(OriginLocal); err != nil {
+		return nil, fmt.Errorf("failed to record config history: %w", err)
+	}
+
 	return managedConfig, nil
 }
 
@@ -52,6 +60,12 @@ type ManagedConfig struct {
 	// Reload will be called when any changes to this config occur.
 	Reload ReloadFunc
 
+	// History holds previous versions of the config. May be nil.
+	History *ConfigHistory
+
+	// ContentType overrides the content type determined from the config path if set
+	ContentType string
+
 	// currentConfigHash is the hash of the config currently being used
 	currentConfigHash []byte
 }
@@ -72,3 +86,18 @@ func (m *ManagedConfig) ComputeConfigHash() error {
 	m.currentConfigHash = ComputeHash(contents)
 	return nil
 }
+
+// RecordHistory records the contents of the config on disk in its history
+func (m *ManagedConfig) RecordHistory(origin ConfigOrigin) (HistoryEntry, error) {
+	if m.History == nil {
+		return HistoryEntry{}, nil
+	}
+
+	cleanPath := filepath.Clean(m.ConfigPath)
+	contents, err := os.ReadFile(cleanPath)
+	if err != nil {
+		return HistoryEntry{}, err
+	}
+
+	return m.History.Record(contents, origin)
+}
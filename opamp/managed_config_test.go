@@ -107,6 +107,63 @@ func TestNewManagedConfig(t *testing.T) {
 				assert.NoError(t, err)
 				assert.Equal(t, expected.ConfigPath, managedConfig.ConfigPath)
 				assert.Equal(t, expected.currentConfigHash, managedConfig.currentConfigHash)
+
+				// The current contents are recorded as the first version
+				entry, ok, err := managedConfig.History.Latest()
+				assert.NoError(t, err)
+				assert.True(t, ok)
+				assert.Equal(t, 1, entry.Version)
+				assert.Equal(t, OriginLocal, entry.Origin)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, tc.testFunc)
+	}
+}
+
+func TestManagedConfigRecordHistory(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		testFunc func(*testing.T)
+	}{
+		{
+			desc: "No history",
+			testFunc: func(t *testing.T) {
+				managedConfig := &ManagedConfig{
+					ConfigPath: "./path.yaml",
+				}
+
+				_, err := managedConfig.RecordHistory(OriginRemote)
+				assert.NoError(t, err)
+			},
+		},
+		{
+			desc: "Records changes on disk",
+			testFunc: func(t *testing.T) {
+				tmpDir := t.TempDir()
+				cfgPath := filepath.Join(tmpDir, "config.yaml")
+				err := os.WriteFile(cfgPath, []byte("hello world"), 0600)
+				require.NoError(t, err)
+
+				managedConfig, err := NewManagedConfig(cfgPath, NoopReloadFunc)
+				require.NoError(t, err)
+
+				err = os.WriteFile(cfgPath, []byte("goodbye world"), 0600)
+				require.NoError(t, err)
+
+				entry, err := managedConfig.RecordHistory(OriginRemote)
+				require.NoError(t, err)
+				assert.Equal(t, 2, entry.Version)
+				assert.Equal(t, OriginRemote, entry.Origin)
+
+				// Recreating the managed config does not record a new version
+				managedConfig, err = NewManagedConfig(cfgPath, NoopReloadFunc)
+				require.NoError(t, err)
+				entries, err := managedConfig.History.Entries()
+				require.NoError(t, err)
+				assert.Len(t, entries, 2)
 			},
 		},
 	}
@@ -5,6 +5,7 @@ package mocks
 import (
 	context "context"
 
+	opamp "github.com/observiq/observiq-otel-collector/opamp"
 	mock "github.com/stretchr/testify/mock"
 
 	testing "testing"
@@ -29,6 +30,20 @@ func (_m *MockClient) Connect(ctx context.Context) error {
 	return r0
 }
 
+// ConnectionStatus provides a mock function with given fields:
+func (_m *MockClient) ConnectionStatus() opamp.ConnectionStatus {
+	ret := _m.Called()
+
+	var r0 opamp.ConnectionStatus
+	if rf, ok := ret.Get(0).(func() opamp.ConnectionStatus); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(opamp.ConnectionStatus)
+	}
+
+	return r0
+}
+
 // Disconnect provides a mock function with given fields: ctx
 func (_m *MockClient) Disconnect(ctx context.Context) error {
 	ret := _m.Called(ctx)
@@ -43,6 +58,36 @@ func (_m *MockClient) Disconnect(ctx context.Context) error {
 	return r0
 }
 
+// Error provides a mock function with given fields:
+func (_m *MockClient) Error() <-chan error {
+	ret := _m.Called()
+
+	var r0 <-chan error
+	if rf, ok := ret.Get(0).(func() <-chan error); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(<-chan error)
+		}
+	}
+
+	return r0
+}
+
+// RestartCollector provides a mock function with given fields: ctx
+func (_m *MockClient) RestartCollector(ctx context.Context) error {
+	ret := _m.Called(ctx)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context) error); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // NewMockClient creates a new instance of MockClient. It also registers the testing.TB interface on the mock and a cleanup function to assert the mocks expectations.
 func NewMockClient(t testing.TB) *MockClient {
 	mock := &MockClient{}
@@ -3,6 +3,8 @@
 package mocks
 
 import (
+	context "context"
+
 	opamp "github.com/observiq/observiq-otel-collector/opamp"
 	protobufs "github.com/open-telemetry/opamp-go/protobufs"
 	mock "github.com/stretchr/testify/mock"
@@ -20,20 +22,34 @@ func (_m *MockConfigManager) AddConfig(configName string, reloader *opamp.Manage
 	_m.Called(configName, reloader)
 }
 
-// ApplyConfigChanges provides a mock function with given fields: remoteConfig
-func (_m *MockConfigManager) ApplyConfigChanges(remoteConfig *protobufs.AgentRemoteConfig) (bool, error) {
-	ret := _m.Called(remoteConfig)
+// AddFileSet provides a mock function with given fields: fileSet, validate, onChange
+func (_m *MockConfigManager) AddFileSet(fileSet opamp.FileSet, validate opamp.FileValidateFunc, onChange opamp.FileChangeFunc) error {
+	ret := _m.Called(fileSet, validate, onChange)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(opamp.FileSet, opamp.FileValidateFunc, opamp.FileChangeFunc) error); ok {
+		r0 = rf(fileSet, validate, onChange)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ApplyConfigChanges provides a mock function with given fields: ctx, remoteConfig
+func (_m *MockConfigManager) ApplyConfigChanges(ctx context.Context, remoteConfig *protobufs.AgentRemoteConfig) (bool, error) {
+	ret := _m.Called(ctx, remoteConfig)
 
 	var r0 bool
-	if rf, ok := ret.Get(0).(func(*protobufs.AgentRemoteConfig) bool); ok {
-		r0 = rf(remoteConfig)
+	if rf, ok := ret.Get(0).(func(context.Context, *protobufs.AgentRemoteConfig) bool); ok {
+		r0 = rf(ctx, remoteConfig)
 	} else {
 		r0 = ret.Get(0).(bool)
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(*protobufs.AgentRemoteConfig) error); ok {
-		r1 = rf(remoteConfig)
+	if rf, ok := ret.Get(1).(func(context.Context, *protobufs.AgentRemoteConfig) error); ok {
+		r1 = rf(ctx, remoteConfig)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -64,6 +80,50 @@ func (_m *MockConfigManager) ComposeEffectiveConfig() (*protobufs.EffectiveConfi
 	return r0, r1
 }
 
+// GetConfig provides a mock function with given fields: configName
+func (_m *MockConfigManager) GetConfig(configName string) (*opamp.ManagedConfig, bool) {
+	ret := _m.Called(configName)
+
+	var r0 *opamp.ManagedConfig
+	if rf, ok := ret.Get(0).(func(string) *opamp.ManagedConfig); ok {
+		r0 = rf(configName)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*opamp.ManagedConfig)
+		}
+	}
+
+	var r1 bool
+	if rf, ok := ret.Get(1).(func(string) bool); ok {
+		r1 = rf(configName)
+	} else {
+		r1 = ret.Get(1).(bool)
+	}
+
+	return r0, r1
+}
+
+// RollbackConfig provides a mock function with given fields: ctx, configName, version
+func (_m *MockConfigManager) RollbackConfig(ctx context.Context, configName string, version int) (bool, error) {
+	ret := _m.Called(ctx, configName, version)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(context.Context, string, int) bool); ok {
+		r0 = rf(ctx, configName, version)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, int) error); ok {
+		r1 = rf(ctx, configName, version)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // NewMockConfigManager creates a new instance of MockConfigManager. It also registers the testing.TB interface on the mock and a cleanup function to assert the mocks expectations.
 func NewMockConfigManager(t testing.TB) *MockConfigManager {
 	mock := &MockConfigManager{}
@@ -16,13 +16,16 @@ package observiq
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 
 	"github.com/observiq/observiq-otel-collector/opamp"
 	"github.com/open-telemetry/opamp-go/protobufs"
 	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
 )
 
 const (
@@ -32,8 +35,17 @@ const (
 	ManagerConfigName = "manager.yaml"
 	// LoggingConfigName is the key of the logging config in OpAmp
 	LoggingConfigName = "logging.yaml"
+	// RollbackConfigName is the key of a remote request to roll a config back to a version in its history.
+	// It is never written to disk.
+	RollbackConfigName = "rollback.yaml"
 )
 
+// rollbackRequest is the contents of a remote rollback request
+type rollbackRequest struct {
+	Config  string `yaml:"config"`
+	Version int    `yaml:"version"`
+}
+
 // acceptableConfigs is a lookup of configs that are able to be written/updated
 var acceptableConfigs = map[string]struct{}{
 	CollectorConfigName: {},
@@ -46,29 +58,69 @@ var _ opamp.ConfigManager = (*AgentConfigManager)(nil)
 
 // AgentConfigManager keeps track of active configs for the agent
 type AgentConfigManager struct {
+	// configMux guards configMap. It is not held while a config is reloading.
+	configMux sync.RWMutex
 	configMap map[string]*opamp.ManagedConfig
+	fileSets  map[string]*managedFileSet
 	logger    *zap.Logger
+	redactor  *opamp.Redactor
 }
 
-// NewAgentConfigManager creates a new AgentConfigManager
+// NewAgentConfigManager creates a new AgentConfigManager that redacts the default sensitive fields from the effective config
 func NewAgentConfigManager(defaultLogger *zap.Logger) *AgentConfigManager {
+	// The default patterns always compile
+	redactor, _ := opamp.NewRedactor("", nil)
+
 	return &AgentConfigManager{
 		configMap: make(map[string]*opamp.ManagedConfig),
+		fileSets:  make(map[string]*managedFileSet),
 		logger:    defaultLogger.Named("config manager"),
+		redactor:  redactor,
 	}
 }
 
+// SetRedactor sets the redactor used to mask sensitive values in the effective config
+func (a *AgentConfigManager) SetRedactor(redactor *opamp.Redactor) {
+	a.redactor = redactor
+}
+
 // AddConfig adds a config to be tracked by the config manager.
 // If the config already is tracked it'll be overwritten with the new managed config
 func (a *AgentConfigManager) AddConfig(configName string, managedConfig *opamp.ManagedConfig) {
+	a.configMux.Lock()
+	defer a.configMux.Unlock()
+
 	a.configMap[configName] = managedConfig
 }
 
-// ComposeEffectiveConfig reads in all config files and calculates the effective config
-func (a *AgentConfigManager) ComposeEffectiveConfig() (*protobufs.EffectiveConfig, error) {
-	contentMap := make(map[string]*protobufs.AgentConfigFile, len(a.configMap))
+// GetConfig returns the tracked managed config with the given name if it exists.
+func (a *AgentConfigManager) GetConfig(configName string) (*opamp.ManagedConfig, bool) {
+	a.configMux.RLock()
+	defer a.configMux.RUnlock()
+
+	managedConfig, ok := a.configMap[configName]
+	return managedConfig, ok
+}
 
+// managedConfigs returns a copy of the tracked configs so they can be read without holding the lock
+func (a *AgentConfigManager) managedConfigs() map[string]*opamp.ManagedConfig {
+	a.configMux.RLock()
+	defer a.configMux.RUnlock()
+
+	configs := make(map[string]*opamp.ManagedConfig, len(a.configMap))
 	for configName, managedConfig := range a.configMap {
+		configs[configName] = managedConfig
+	}
+	return configs
+}
+
+// ComposeEffectiveConfig reads in all config files and calculates the effective config.
+// Files in file sets are reported by their hash rather than their contents.
+func (a *AgentConfigManager) ComposeEffectiveConfig() (*protobufs.EffectiveConfig, error) {
+	configs := a.managedConfigs()
+	contentMap := make(map[string]*protobufs.AgentConfigFile, len(configs))
+
+	for configName, managedConfig := range configs {
 		// Read in config file
 		cleanPath := filepath.Clean(managedConfig.ConfigPath)
 		configContents, err := os.ReadFile(cleanPath)
@@ -76,10 +128,28 @@ func (a *AgentConfigManager) ComposeEffectiveConfig() (*protobufs.EffectiveConfi
 			return nil, fmt.Errorf("error reading config file %s: %w", configName, err)
 		}
 
+		// Files in file sets are reported by hash, the inventory describes the plugins among them
+		if _, _, ok := a.fileSetFor(configName); ok {
+			contentMap[configName] = newFileSetHashFile(configContents)
+			continue
+		}
+
+		contentType := managedConfig.ContentType
+		if contentType == "" {
+			contentType = opamp.DetermineContentType(managedConfig.ConfigPath)
+		}
+
+		// Never send a config that couldn't be redacted
+		redactedContents, err := a.redactor.Redact(configContents, contentType)
+		if err != nil {
+			a.logger.Warn("Omitting config from effective config, failed to redact", zap.String("config", configName), zap.Error(err))
+			redactedContents = nil
+		}
+
 		// Add to contentMap
 		contentMap[configName] = &protobufs.AgentConfigFile{
-			Body:        configContents,
-			ContentType: opamp.DetermineContentType(managedConfig.ConfigPath),
+			Body:        redactedContents,
+			ContentType: contentType,
 		}
 	}
 
@@ -90,8 +160,25 @@ func (a *AgentConfigManager) ComposeEffectiveConfig() (*protobufs.EffectiveConfi
 	}, nil
 }
 
+// checkMasks rejects remote configs that would write a mask from the effective config, such as a server echoing back a reported config.
+// Writing a mask would replace the value it hides.
+func (a *AgentConfigManager) checkMasks(remoteConfigMap map[string]*protobufs.AgentConfigFile) error {
+	for configName, remoteContents := range remoteConfigMap {
+		if _, tracked := a.GetConfig(configName); !tracked {
+			if _, _, inFileSet := a.fileSetFor(configName); !inFileSet {
+				continue
+			}
+		}
+
+		if opamp.ContainsMask(remoteContents.GetBody()) {
+			return fmt.Errorf("rejected config %s: %w", configName, opamp.ErrMaskedValue)
+		}
+	}
+	return nil
+}
+
 // ApplyConfigChanges compares the remoteConfig to the existing and applies changes
-func (a *AgentConfigManager) ApplyConfigChanges(remoteConfig *protobufs.AgentRemoteConfig) (changed bool, returnErr error) {
+func (a *AgentConfigManager) ApplyConfigChanges(ctx context.Context, remoteConfig *protobufs.AgentRemoteConfig) (changed bool, returnErr error) {
 	remoteConfigMap := remoteConfig.GetConfig().GetConfigMap()
 
 	// No remote config Map
@@ -99,28 +186,73 @@ func (a *AgentConfigManager) ApplyConfigChanges(remoteConfig *protobufs.AgentRem
 		return
 	}
 
+	if err := a.checkMasks(remoteConfigMap); err != nil {
+		returnErr = err
+		return
+	}
+
+	// A rollback request takes the place of the pushed contents of the config it names
+	var rollbackConfigName string
+	if rollbackContents, ok := remoteConfigMap[RollbackConfigName]; ok {
+		var request rollbackRequest
+		if err := yaml.Unmarshal(rollbackContents.GetBody(), &request); err != nil {
+			returnErr = fmt.Errorf("failed to parse %s: %w", RollbackConfigName, err)
+			return
+		}
+
+		rollbackChanged, err := a.RollbackConfig(ctx, request.Config, request.Version)
+		if err != nil {
+			returnErr = err
+			return
+		}
+
+		rollbackConfigName = request.Config
+		changed = rollbackChanged
+	}
+
+	// Supporting files are written first so configs referencing them are valid
+	fileChanges, err := a.applyFileSetChanges(ctx, remoteConfigMap)
+	if err != nil {
+		returnErr = err
+		return
+	}
+	changed = changed || len(fileChanges) > 0
+
+	// The files are restored if a config referencing them fails
+	defer func() {
+		if returnErr != nil && len(fileChanges) > 0 {
+			a.logger.Info("Restoring file sets after failed config")
+			a.revertFileSetChanges(fileChanges, notifiedFileSets(fileChanges))
+		}
+	}()
+
 	// loop through all remote configs and compare then with existing configs
 	for configName, remoteContents := range remoteConfigMap {
+		if configName == RollbackConfigName || configName == rollbackConfigName || configName == InventoryConfigName || configName == CSRConfigName ||
+			configName == DiagnosticsRequestConfigName {
+			continue
+		}
+
+		// Applied with the rest of their file set
+		if _, _, ok := a.fileSetFor(configName); ok {
+			continue
+		}
+
 		// For security check the log file we want is acceptable
 		if _, ok := acceptableConfigs[configName]; !ok {
 			a.logger.Warn("Not supported config received skipping", zap.String("config", configName))
 			continue
 		}
 
-		managedConfig, ok := a.configMap[configName]
-		// This check is impossible to hit now but will be a use case we'll have in the future so leaving this tested code in for now.
+		// Configs are only written to the path they're tracked at
+		managedConfig, ok := a.GetConfig(configName)
 		if !ok {
-			// We don't current track this config file we should add it
-			if err := a.trackNewConfig(configName, remoteContents.GetBody()); err != nil {
-				returnErr = err
-				return
-			}
-			changed = true
+			a.logger.Warn("Untracked config received skipping", zap.String("config", configName))
 			continue
 		}
 
 		// Update the config file
-		configChanged, err := a.updateExistingConfig(configName, managedConfig, remoteContents.GetBody())
+		configChanged, err := a.updateExistingConfig(ctx, configName, managedConfig, remoteContents.GetBody())
 		if err != nil {
 			returnErr = err
 			return
@@ -132,7 +264,7 @@ func (a *AgentConfigManager) ApplyConfigChanges(remoteConfig *protobufs.AgentRem
 	return
 }
 
-func (a *AgentConfigManager) updateExistingConfig(configName string, managedConfig *opamp.ManagedConfig, newContents []byte) (changed bool, err error) {
+func (a *AgentConfigManager) updateExistingConfig(ctx context.Context, configName string, managedConfig *opamp.ManagedConfig, newContents []byte) (changed bool, err error) {
 	remoteHash := opamp.ComputeHash(newContents)
 
 	// Nothing to update
@@ -143,7 +275,7 @@ func (a *AgentConfigManager) updateExistingConfig(configName string, managedConf
 	}
 
 	a.logger.Info("Applying changes to config file", zap.String("config", configName))
-	changed, err = managedConfig.Reload(newContents)
+	changed, err = managedConfig.Reload(ctx, newContents)
 	if err != nil {
 		err = fmt.Errorf("failed to reload config: %s: %w", configName, err)
 		return
@@ -156,11 +288,59 @@ func (a *AgentConfigManager) updateExistingConfig(configName string, managedConf
 			err = fmt.Errorf("failed hash compute for config %s: %w", configName, err)
 			return
 		}
+
+		a.recordHistory(configName, managedConfig, opamp.OriginRemote)
 	}
 
 	return
 }
 
+// RollbackConfig reloads the config with the contents of a version from its history
+func (a *AgentConfigManager) RollbackConfig(ctx context.Context, configName string, version int) (changed bool, err error) {
+	managedConfig, ok := a.GetConfig(configName)
+	if !ok {
+		return false, fmt.Errorf("config %s is not managed", configName)
+	}
+
+	if managedConfig.History == nil {
+		return false, fmt.Errorf("config %s does not have a history", configName)
+	}
+
+	_, contents, err := managedConfig.History.Get(version)
+	if err != nil {
+		return false, fmt.Errorf("failed to get version %d of config %s: %w", version, configName, err)
+	}
+
+	// Already running the version
+	if bytes.Equal(managedConfig.GetCurrentConfigHash(), opamp.ComputeHash(contents)) {
+		return false, nil
+	}
+
+	a.logger.Info("Rolling back config", zap.String("config", configName), zap.Int("version", version))
+	changed, err = managedConfig.Reload(ctx, contents)
+	if err != nil {
+		return false, fmt.Errorf("failed to roll back config %s to version %d: %w", configName, version, err)
+	}
+
+	if changed {
+		if err := managedConfig.ComputeConfigHash(); err != nil {
+			return changed, fmt.Errorf("failed hash compute for config %s: %w", configName, err)
+		}
+
+		a.recordHistory(configName, managedConfig, opamp.OriginRollback)
+	}
+
+	return changed, nil
+}
+
+// recordHistory records the config in its history.
+// The config has already been applied so a failure is only logged.
+func (a *AgentConfigManager) recordHistory(configName string, managedConfig *opamp.ManagedConfig, origin opamp.ConfigOrigin) {
+	if _, err := managedConfig.RecordHistory(origin); err != nil {
+		a.logger.Warn("Failed to record config history", zap.String("config", configName), zap.Error(err))
+	}
+}
+
 // verifyDiskContents verifies the contents saved on disk match the in memory hash.
 // If not overwrite them with the passed in contents
 func verifyDiskContents(configPath string, memHash, contents []byte) (changed bool, err error) {
@@ -178,28 +358,9 @@ func verifyDiskContents(configPath string, memHash, contents []byte) (changed bo
 	}
 
 	// Disk file doesn't match memory so overwrite with correct contents
-	if err := os.WriteFile(cleanPath, contents, 0600); err != nil {
+	if err := opamp.WriteFileAtomic(cleanPath, contents, 0600); err != nil {
 		return false, fmt.Errorf("failed to write contents to config file: %w", err)
 	}
 
 	return true, nil
 }
-
-func (a *AgentConfigManager) trackNewConfig(configName string, contents []byte) error {
-	a.logger.Info("Untracked config found", zap.String("config", configName))
-
-	// Write out the file
-	if err := os.WriteFile(configName, contents, 0600); err != nil {
-		return fmt.Errorf("failed to write new config file %s: %w", configName, err)
-	}
-
-	managedConfig, err := opamp.NewManagedConfig(filepath.Join(".", configName), opamp.NoopReloadFunc)
-	if err != nil {
-		return err
-	}
-
-	// Track new config
-	a.AddConfig(configName, managedConfig)
-
-	return nil
-}
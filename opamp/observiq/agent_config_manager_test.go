@@ -15,9 +15,12 @@
 package observiq
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 
 	"github.com/observiq/observiq-otel-collector/opamp"
@@ -30,9 +33,14 @@ import (
 func TestNewAgentConfigManager(t *testing.T) {
 	logger := zap.NewNop()
 
+	redactor, err := opamp.NewRedactor("", nil)
+	require.NoError(t, err)
+
 	expected := &AgentConfigManager{
 		configMap: make(map[string]*opamp.ManagedConfig),
+		fileSets:  make(map[string]*managedFileSet),
 		logger:    logger.Named("config manager"),
+		redactor:  redactor,
 	}
 
 	actual := NewAgentConfigManager(logger)
@@ -53,6 +61,25 @@ func TestAddConfig(t *testing.T) {
 	require.Equal(t, managedConfig, manager.configMap[configName])
 }
 
+func TestGetConfig(t *testing.T) {
+	manager := NewAgentConfigManager(zap.NewNop())
+
+	configName := "config.json"
+	managedConfig := &opamp.ManagedConfig{
+		ConfigPath: "path/to/config.json",
+		Reload:     opamp.NoopReloadFunc,
+	}
+	manager.AddConfig(configName, managedConfig)
+
+	actual, ok := manager.GetConfig(configName)
+	require.True(t, ok)
+	require.Equal(t, managedConfig, actual)
+
+	actual, ok = manager.GetConfig("not_tracked.yaml")
+	require.False(t, ok)
+	require.Nil(t, actual)
+}
+
 func TestComposeEffectiveConfig(t *testing.T) {
 	testCases := []struct {
 		desc     string
@@ -123,6 +150,53 @@ func TestComposeEffectiveConfig(t *testing.T) {
 
 			},
 		},
+		{
+			desc: "Sensitive values are redacted",
+			testFunc: func(t *testing.T) {
+				tmpDir := t.TempDir()
+
+				managerPath := filepath.Join(tmpDir, ManagerConfigName)
+				err := os.WriteFile(managerPath, []byte("endpoint: ws://localhost:3001\nsecret_key: abc123\n"), 0600)
+				assert.NoError(t, err)
+
+				invalidPath := filepath.Join(tmpDir, CollectorConfigName)
+				err = os.WriteFile(invalidPath, []byte("password: [unclosed"), 0600)
+				assert.NoError(t, err)
+
+				redactor, err := opamp.NewRedactor("agent-id", nil)
+				assert.NoError(t, err)
+
+				manager := NewAgentConfigManager(zap.NewNop())
+				manager.SetRedactor(redactor)
+				manager.AddConfig(ManagerConfigName, &opamp.ManagedConfig{
+					ConfigPath: managerPath,
+					Reload:     opamp.NoopReloadFunc,
+				})
+				manager.AddConfig(CollectorConfigName, &opamp.ManagedConfig{
+					ConfigPath: invalidPath,
+					Reload:     opamp.NoopReloadFunc,
+				})
+
+				expected := &protobufs.EffectiveConfig{
+					ConfigMap: &protobufs.AgentConfigMap{
+						ConfigMap: map[string]*protobufs.AgentConfigFile{
+							ManagerConfigName: {
+								Body:        []byte("endpoint: ws://localhost:3001\nsecret_key: " + redactor.Mask([]byte("abc123")) + "\n"),
+								ContentType: opamp.YAMLContentType,
+							},
+							// Configs that can't be redacted are sent without a body
+							CollectorConfigName: {
+								ContentType: opamp.YAMLContentType,
+							},
+						},
+					},
+				}
+
+				effCfg, err := manager.ComposeEffectiveConfig()
+				assert.NoError(t, err)
+				assert.Equal(t, expected, effCfg)
+			},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -130,6 +204,65 @@ func TestComposeEffectiveConfig(t *testing.T) {
 	}
 }
 
+// TestAgentConfigManagerConcurrentAccess verifies configs can be added and read while changes are applied.
+// It is meant to be run with -race.
+func TestAgentConfigManagerConcurrentAccess(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, CollectorConfigName)
+	require.NoError(t, os.WriteFile(configPath, []byte("key: value"), 0600))
+
+	manager := NewAgentConfigManager(zap.NewNop())
+	managedConfig, err := opamp.NewManagedConfig(configPath, func(_ context.Context, data []byte) (bool, error) {
+		return true, os.WriteFile(configPath, data, 0600)
+	})
+	require.NoError(t, err)
+	manager.AddConfig(CollectorConfigName, managedConfig)
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+
+			_, err := manager.ComposeEffectiveConfig()
+			assert.NoError(t, err)
+			_, ok := manager.GetConfig(CollectorConfigName)
+			assert.True(t, ok)
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			manager.AddConfig(fmt.Sprintf("other-%d.yaml", i), managedConfig)
+		}
+	}()
+
+	for i := 0; i < 10; i++ {
+		remoteConfig := &protobufs.AgentRemoteConfig{
+			Config: &protobufs.AgentConfigMap{
+				ConfigMap: map[string]*protobufs.AgentConfigFile{
+					CollectorConfigName: {Body: []byte(fmt.Sprintf("key: value-%d", i))},
+				},
+			},
+		}
+
+		changed, err := manager.ApplyConfigChanges(context.Background(), remoteConfig)
+		require.NoError(t, err)
+		require.True(t, changed)
+	}
+
+	close(done)
+	wg.Wait()
+}
+
 func TestApplyConfigChanges(t *testing.T) {
 	testCases := []struct {
 		desc     string
@@ -164,7 +297,7 @@ func TestApplyConfigChanges(t *testing.T) {
 						},
 					},
 				}
-				changed, err := manager.ApplyConfigChanges(remoteConfig)
+				changed, err := manager.ApplyConfigChanges(context.Background(), remoteConfig)
 				assert.NoError(t, err)
 				assert.False(t, changed)
 
@@ -210,7 +343,7 @@ func TestApplyConfigChanges(t *testing.T) {
 						},
 					},
 				}
-				changed, err := manager.ApplyConfigChanges(remoteConfig)
+				changed, err := manager.ApplyConfigChanges(context.Background(), remoteConfig)
 
 				assert.NoError(t, err)
 				assert.False(t, changed)
@@ -262,7 +395,7 @@ func TestApplyConfigChanges(t *testing.T) {
 					},
 				}
 
-				changed, err := manager.ApplyConfigChanges(remoteConfig)
+				changed, err := manager.ApplyConfigChanges(context.Background(), remoteConfig)
 				assert.NoError(t, err)
 				assert.True(t, changed)
 
@@ -314,7 +447,7 @@ func TestApplyConfigChanges(t *testing.T) {
 						},
 					},
 				}
-				changed, err := manager.ApplyConfigChanges(remoteConfig)
+				changed, err := manager.ApplyConfigChanges(context.Background(), remoteConfig)
 				assert.NoError(t, err)
 				assert.False(t, changed)
 
@@ -324,6 +457,86 @@ func TestApplyConfigChanges(t *testing.T) {
 				assert.Equal(t, expectedEffCfg, effCfg)
 			},
 		},
+		{
+			desc: "Remote config contains reported inventory",
+			testFunc: func(*testing.T) {
+				tmpDir := t.TempDir()
+				configPath := filepath.Join(tmpDir, ManagerConfigName)
+				configContents := []byte(`key: value`)
+
+				err := os.WriteFile(configPath, configContents, 0600)
+				assert.NoError(t, err)
+
+				manager := NewAgentConfigManager(zap.NewNop())
+
+				mangedConfig, err := opamp.NewManagedConfig(configPath, opamp.NoopReloadFunc)
+				assert.NoError(t, err)
+				manager.AddConfig(ManagerConfigName, mangedConfig)
+
+				// Servers may echo back the effective config, including the inventory
+				remoteConfig := &protobufs.AgentRemoteConfig{
+					Config: &protobufs.AgentConfigMap{
+						ConfigMap: map[string]*protobufs.AgentConfigFile{
+							ManagerConfigName: {
+								Body:        configContents,
+								ContentType: opamp.YAMLContentType,
+							},
+							InventoryConfigName: {
+								Body:        []byte(`{"receivers":[]}`),
+								ContentType: opamp.JSONContentType,
+							},
+						},
+					},
+				}
+
+				changed, err := manager.ApplyConfigChanges(context.Background(), remoteConfig)
+				assert.NoError(t, err)
+				assert.False(t, changed)
+
+				_, ok := manager.GetConfig(InventoryConfigName)
+				assert.False(t, ok)
+			},
+		},
+		{
+			desc: "Remote config contains diagnostics request",
+			testFunc: func(*testing.T) {
+				tmpDir := t.TempDir()
+				configPath := filepath.Join(tmpDir, ManagerConfigName)
+				configContents := []byte(`key: value`)
+
+				err := os.WriteFile(configPath, configContents, 0600)
+				assert.NoError(t, err)
+
+				manager := NewAgentConfigManager(zap.NewNop())
+
+				mangedConfig, err := opamp.NewManagedConfig(configPath, opamp.NoopReloadFunc)
+				assert.NoError(t, err)
+				manager.AddConfig(ManagerConfigName, mangedConfig)
+
+				// The request is handled by the client rather than written
+				remoteConfig := &protobufs.AgentRemoteConfig{
+					Config: &protobufs.AgentConfigMap{
+						ConfigMap: map[string]*protobufs.AgentConfigFile{
+							ManagerConfigName: {
+								Body:        configContents,
+								ContentType: opamp.YAMLContentType,
+							},
+							DiagnosticsRequestConfigName: {
+								Body:        []byte("id: one\n"),
+								ContentType: opamp.YAMLContentType,
+							},
+						},
+					},
+				}
+
+				changed, err := manager.ApplyConfigChanges(context.Background(), remoteConfig)
+				assert.NoError(t, err)
+				assert.False(t, changed)
+
+				_, ok := manager.GetConfig(DiagnosticsRequestConfigName)
+				assert.False(t, ok)
+			},
+		},
 		{
 			desc: "Remote config contains untracked known file",
 			testFunc: func(*testing.T) {
@@ -363,27 +576,19 @@ func TestApplyConfigChanges(t *testing.T) {
 								Body:        configContents,
 								ContentType: opamp.YAMLContentType,
 							},
-							LoggingConfigName: {
-								Body:        newFileContents,
-								ContentType: opamp.YAMLContentType,
-							},
 						},
 					},
 				}
-				changed, err := manager.ApplyConfigChanges(remoteConfig)
+				changed, err := manager.ApplyConfigChanges(context.Background(), remoteConfig)
 
 				assert.NoError(t, err)
-				assert.True(t, changed)
-				assert.FileExists(t, filepath.Join(".", LoggingConfigName))
+				assert.False(t, changed)
+				assert.NoFileExists(t, filepath.Join(".", LoggingConfigName))
 
 				// Verify effective config is as expected
 				effCfg, err := manager.ComposeEffectiveConfig()
 				assert.NoError(t, err)
 				assert.Equal(t, expectedEffCfg, effCfg)
-
-				// Cleanup
-				err = os.Remove(filepath.Join(".", LoggingConfigName))
-				assert.NoError(t, err)
 			},
 		},
 		{
@@ -399,7 +604,7 @@ func TestApplyConfigChanges(t *testing.T) {
 				assert.NoError(t, err)
 
 				manager := NewAgentConfigManager(zap.NewNop())
-				mangedConfig, err := opamp.NewManagedConfig(configPath, func(data []byte) (changed bool, err error) {
+				mangedConfig, err := opamp.NewManagedConfig(configPath, func(_ context.Context, data []byte) (changed bool, err error) {
 					err = os.WriteFile(configPath, data, 0600)
 					assert.NoError(t, err)
 					return true, err
@@ -428,7 +633,7 @@ func TestApplyConfigChanges(t *testing.T) {
 						},
 					},
 				}
-				changed, err := manager.ApplyConfigChanges(remoteConfig)
+				changed, err := manager.ApplyConfigChanges(context.Background(), remoteConfig)
 				assert.NoError(t, err)
 				assert.True(t, changed)
 
@@ -453,7 +658,7 @@ func TestApplyConfigChanges(t *testing.T) {
 				assert.NoError(t, err)
 
 				manager := NewAgentConfigManager(zap.NewNop())
-				mangedConfig, err := opamp.NewManagedConfig(configPath, func(data []byte) (changed bool, err error) {
+				mangedConfig, err := opamp.NewManagedConfig(configPath, func(_ context.Context, data []byte) (changed bool, err error) {
 					return false, expectedError
 				})
 				assert.NoError(t, err)
@@ -480,7 +685,7 @@ func TestApplyConfigChanges(t *testing.T) {
 						},
 					},
 				}
-				changed, err := manager.ApplyConfigChanges(remoteConfig)
+				changed, err := manager.ApplyConfigChanges(context.Background(), remoteConfig)
 				assert.ErrorIs(t, err, expectedError)
 				assert.False(t, changed)
 
@@ -490,6 +695,216 @@ func TestApplyConfigChanges(t *testing.T) {
 				assert.Equal(t, expectedEffCfg, effCfg)
 			},
 		},
+		{
+			desc: "Remote config echoing a masked value is rejected",
+			testFunc: func(t *testing.T) {
+				tmpDir := t.TempDir()
+				configPath := filepath.Join(tmpDir, CollectorConfigName)
+				configContents := []byte("exporters:\n  otlp:\n    headers:\n      api_key: abc123\n")
+				require.NoError(t, os.WriteFile(configPath, configContents, 0600))
+
+				redactor, err := opamp.NewRedactor("key", nil)
+				require.NoError(t, err)
+
+				var reloaded bool
+				manager := NewAgentConfigManager(zap.NewNop())
+				manager.SetRedactor(redactor)
+				managedConfig, err := opamp.NewManagedConfig(configPath, func(context.Context, []byte) (bool, error) {
+					reloaded = true
+					return true, nil
+				})
+				require.NoError(t, err)
+				manager.AddConfig(CollectorConfigName, managedConfig)
+
+				effCfg, err := manager.ComposeEffectiveConfig()
+				require.NoError(t, err)
+				reported := effCfg.GetConfigMap().GetConfigMap()[CollectorConfigName].GetBody()
+				require.Contains(t, string(reported), redactor.Mask([]byte("abc123")))
+
+				remoteConfig := &protobufs.AgentRemoteConfig{
+					Config: &protobufs.AgentConfigMap{
+						ConfigMap: map[string]*protobufs.AgentConfigFile{
+							CollectorConfigName: {Body: append(reported, []byte("# changed\n")...)},
+						},
+					},
+				}
+				changed, err := manager.ApplyConfigChanges(context.Background(), remoteConfig)
+				require.ErrorIs(t, err, opamp.ErrMaskedValue)
+				require.ErrorContains(t, err, "rejected config collector.yaml")
+				assert.False(t, changed)
+				assert.False(t, reloaded)
+
+				data, err := os.ReadFile(configPath)
+				require.NoError(t, err)
+				assert.Equal(t, configContents, data)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, tc.testFunc)
+	}
+}
+
+func TestRollbackConfig(t *testing.T) {
+	// setupManager creates a manager tracking a logging config with two versions in its history
+	setupManager := func(t *testing.T, reload func(configPath string) opamp.ReloadFunc) (*AgentConfigManager, *opamp.ManagedConfig, string) {
+		configPath := filepath.Join(t.TempDir(), LoggingConfigName)
+		require.NoError(t, os.WriteFile(configPath, []byte("version: 1"), 0600))
+
+		managedConfig, err := opamp.NewManagedConfig(configPath, reload(configPath))
+		require.NoError(t, err)
+
+		require.NoError(t, os.WriteFile(configPath, []byte("version: 2"), 0600))
+		require.NoError(t, managedConfig.ComputeConfigHash())
+		_, err = managedConfig.RecordHistory(opamp.OriginRemote)
+		require.NoError(t, err)
+
+		manager := NewAgentConfigManager(zap.NewNop())
+		manager.AddConfig(LoggingConfigName, managedConfig)
+
+		return manager, managedConfig, configPath
+	}
+
+	writeReload := func(configPath string) opamp.ReloadFunc {
+		return func(_ context.Context, data []byte) (bool, error) {
+			return true, os.WriteFile(configPath, data, 0600)
+		}
+	}
+
+	noopReload := func(string) opamp.ReloadFunc {
+		return opamp.NoopReloadFunc
+	}
+
+	testCases := []struct {
+		desc     string
+		testFunc func(*testing.T)
+	}{
+		{
+			desc: "Config not managed",
+			testFunc: func(t *testing.T) {
+				manager := NewAgentConfigManager(zap.NewNop())
+				changed, err := manager.RollbackConfig(context.Background(), CollectorConfigName, 1)
+				assert.ErrorContains(t, err, "not managed")
+				assert.False(t, changed)
+			},
+		},
+		{
+			desc: "Version not found",
+			testFunc: func(t *testing.T) {
+				manager, _, _ := setupManager(t, noopReload)
+				changed, err := manager.RollbackConfig(context.Background(), LoggingConfigName, 10)
+				assert.ErrorIs(t, err, opamp.ErrVersionNotFound)
+				assert.False(t, changed)
+			},
+		},
+		{
+			desc: "Already on version",
+			testFunc: func(t *testing.T) {
+				manager, _, _ := setupManager(t, func(string) opamp.ReloadFunc {
+					return func(context.Context, []byte) (bool, error) {
+						t.Fatal("reload should not be called")
+						return false, nil
+					}
+				})
+				changed, err := manager.RollbackConfig(context.Background(), LoggingConfigName, 2)
+				assert.NoError(t, err)
+				assert.False(t, changed)
+			},
+		},
+		{
+			desc: "Reload fails",
+			testFunc: func(t *testing.T) {
+				expectedErr := errors.New("oops")
+				manager, _, _ := setupManager(t, func(string) opamp.ReloadFunc {
+					return func(context.Context, []byte) (bool, error) {
+						return false, expectedErr
+					}
+				})
+				changed, err := manager.RollbackConfig(context.Background(), LoggingConfigName, 1)
+				assert.ErrorIs(t, err, expectedErr)
+				assert.False(t, changed)
+			},
+		},
+		{
+			desc: "Successful rollback",
+			testFunc: func(t *testing.T) {
+				manager, managedConfig, configPath := setupManager(t, writeReload)
+
+				changed, err := manager.RollbackConfig(context.Background(), LoggingConfigName, 1)
+				assert.NoError(t, err)
+				assert.True(t, changed)
+
+				data, err := os.ReadFile(configPath)
+				assert.NoError(t, err)
+				assert.Equal(t, []byte("version: 1"), data)
+				assert.Equal(t, opamp.ComputeHash([]byte("version: 1")), managedConfig.GetCurrentConfigHash())
+
+				latest, _, err := managedConfig.History.Latest()
+				assert.NoError(t, err)
+				assert.Equal(t, 3, latest.Version)
+				assert.Equal(t, opamp.OriginRollback, latest.Origin)
+			},
+		},
+		{
+			desc: "Remote rollback request replaces pushed contents",
+			testFunc: func(t *testing.T) {
+				manager, _, configPath := setupManager(t, writeReload)
+
+				remoteConfig := &protobufs.AgentRemoteConfig{
+					Config: &protobufs.AgentConfigMap{
+						ConfigMap: map[string]*protobufs.AgentConfigFile{
+							LoggingConfigName: {
+								Body:        []byte("version: 2"),
+								ContentType: opamp.YAMLContentType,
+							},
+							RollbackConfigName: {
+								Body:        []byte("config: logging.yaml\nversion: 1"),
+								ContentType: opamp.YAMLContentType,
+							},
+						},
+					},
+				}
+
+				changed, err := manager.ApplyConfigChanges(context.Background(), remoteConfig)
+				assert.NoError(t, err)
+				assert.True(t, changed)
+
+				data, err := os.ReadFile(configPath)
+				assert.NoError(t, err)
+				assert.Equal(t, []byte("version: 1"), data)
+
+				// The rollback request is never tracked
+				_, ok := manager.GetConfig(RollbackConfigName)
+				assert.False(t, ok)
+
+				// Receiving the same request again is a no-op
+				changed, err = manager.ApplyConfigChanges(context.Background(), remoteConfig)
+				assert.NoError(t, err)
+				assert.False(t, changed)
+			},
+		},
+		{
+			desc: "Invalid remote rollback request",
+			testFunc: func(t *testing.T) {
+				manager, _, _ := setupManager(t, noopReload)
+
+				remoteConfig := &protobufs.AgentRemoteConfig{
+					Config: &protobufs.AgentConfigMap{
+						ConfigMap: map[string]*protobufs.AgentConfigFile{
+							RollbackConfigName: {
+								Body:        []byte("config: [logging.yaml"),
+								ContentType: opamp.YAMLContentType,
+							},
+						},
+					},
+				}
+
+				changed, err := manager.ApplyConfigChanges(context.Background(), remoteConfig)
+				assert.ErrorContains(t, err, "failed to parse rollback.yaml")
+				assert.False(t, changed)
+			},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -0,0 +1,122 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package observiq
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/observiq/observiq-otel-collector/opamp"
+	"github.com/open-telemetry/opamp-go/protobufs"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// onAgentIdentificationHandler adopts the agent ID assigned by the server.
+// The server assigns a new ID when the agent's ID collides with another agent's.
+// Adopting the ID waits for any remote config being applied, so it's done on the apply queue instead of blocking messages from the server.
+func (c *Client) onAgentIdentificationHandler(agentIdentification *protobufs.AgentIdentification) {
+	newAgentID := agentIdentification.GetNewInstanceUid()
+	if newAgentID == "" {
+		return
+	}
+
+	c.applyQueue.enqueueTask(func(context.Context) {
+		if err := c.adoptAgentID(newAgentID); err != nil {
+			c.getLogger().Error("Failed to update agent ID", zap.Error(err))
+		}
+	})
+}
+
+// adoptAgentID persists the agent ID to the manager config and identity and uses it for future connections.
+// The OpAMP client has already switched to the new ID.
+func (c *Client) adoptAgentID(newAgentID string) error {
+	c.applyMux.Lock()
+	defer c.applyMux.Unlock()
+
+	currentConfig := c.getCurrentConfig()
+	if newAgentID == currentConfig.AgentID {
+		return nil
+	}
+
+	c.getLogger().Warn("Server reported the agent ID collides with another agent, switching to the assigned ID",
+		zap.String("agent_id", currentConfig.AgentID),
+		zap.String("new_agent_id", newAgentID),
+		zap.String("agent_id_strategy", string(currentConfig.AgentIDStrategy)),
+	)
+
+	updatedConfig := currentConfig.Copy()
+	updatedConfig.AgentID = newAgentID
+	updatedIdent := c.getIdent().Copy()
+	updatedIdent.agentID = newAgentID
+
+	rollbackFunc, cleanupFunc, err := prepRollback(c.managerConfigPath)
+	if err != nil {
+		return fmt.Errorf("failed to prep for rollback: %w", err)
+	}
+
+	defer func() {
+		// Cleanup rollback
+		if err := cleanupFunc(); err != nil {
+			c.getLogger().Warn("Failed to cleanup rollback file", zap.Error(err))
+		}
+	}()
+
+	newContents, err := yaml.Marshal(updatedConfig)
+	if err != nil {
+		return fmt.Errorf("failed to reformat manager config: %w", err)
+	}
+
+	if err := updateConfigFile(ManagerConfigName, c.managerConfigPath, newContents); err != nil {
+		if rollbackErr := rollbackFunc(); rollbackErr != nil {
+			c.getLogger().Error("Rollback failed for manager config", zap.Error(rollbackErr))
+		}
+		return err
+	}
+	c.recomputeManagerConfigHash()
+
+	c.setCurrentConfig(*updatedConfig, updatedIdent)
+	c.setSettingsAgentID(newAgentID)
+
+	if managedConfig, ok := c.configManager.GetConfig(ManagerConfigName); ok {
+		if _, err := managedConfig.RecordHistory(opamp.OriginRemote); err != nil {
+			c.getLogger().Warn("Failed to record manager config history", zap.Error(err))
+		}
+	}
+
+	if err := c.setAgentDescription(updatedIdent); err != nil {
+		return fmt.Errorf("failed to set agent description: %w", err)
+	}
+
+	return nil
+}
+
+// setSettingsAgentID sets the agent ID the OpAMP client is started with when it reconnects, fails over, or fails back
+func (c *Client) setSettingsAgentID(agentID string) {
+	c.opampMux.Lock()
+	defer c.opampMux.Unlock()
+
+	// The header may be shared with the stopped clients' settings so it's copied
+	header := c.opampSettings.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	// Set without canonicalizing the key so it replaces the header set by startSettings
+	header["Agent-ID"] = []string{agentID}
+
+	c.opampSettings.Header = header
+	c.opampSettings.InstanceUid = agentID
+}
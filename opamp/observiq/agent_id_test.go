@@ -0,0 +1,136 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package observiq
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/observiq/observiq-otel-collector/opamp"
+	"github.com/observiq/observiq-otel-collector/opamp/mocks"
+	"github.com/open-telemetry/opamp-go/client/types"
+	"github.com/open-telemetry/opamp-go/protobufs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestClient_onAgentIdentificationHandler(t *testing.T) {
+	currConfig := opamp.Config{
+		Endpoint:        "ws://localhost:1234",
+		AgentID:         "d4691426-b0bb-41f7-84a8-320a9ec0ea2e",
+		AgentIDStrategy: opamp.AgentIDStrategyMachineID,
+	}
+	newAgentID := "0c2bd5d6-6b1f-4a3c-9e3e-3f1f0b6b1d2a"
+
+	testCases := []struct {
+		desc     string
+		testFunc func(*testing.T)
+	}{
+		{
+			desc: "Assigned ID is persisted and reported",
+			testFunc: func(t *testing.T) {
+				managerFilePath, managedConfig := writeManagerConfig(t, currConfig)
+
+				mockOpAmpClient := mocks.NewMockOpAMPClient(t)
+				mockOpAmpClient.On("SetAgentDescription", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+					desc := args.Get(0).(*protobufs.AgentDescription)
+					assert.Equal(t, "service.instance.id", desc.IdentifyingAttributes[0].GetKey())
+					assert.Equal(t, newAgentID, desc.IdentifyingAttributes[0].GetValue().GetStringValue())
+				})
+
+				c := newSwitchTestClient(t, mockOpAmpClient, currConfig, managerFilePath, managedConfig)
+				c.applyQueue = newApplyQueue(c.applyRemoteConfig)
+				c.applyQueue.start()
+				defer c.applyQueue.stop()
+
+				settings, err := c.startSettings(currConfig)
+				require.NoError(t, err)
+				c.opampSettings = settings
+
+				// The ID is adopted once the config being applied is done, without blocking the handler
+				c.applyMux.Lock()
+				c.onMessageFuncHandler(context.Background(), &types.MessageData{
+					AgentIdentification: &protobufs.AgentIdentification{NewInstanceUid: newAgentID},
+				})
+				assert.Equal(t, currConfig.AgentID, c.getCurrentConfig().AgentID)
+				c.applyMux.Unlock()
+
+				require.Eventually(t, func() bool {
+					return c.getIdent().agentID == newAgentID
+				}, 5*time.Second, 10*time.Millisecond)
+				c.applyQueue.stop()
+
+				assert.Equal(t, newAgentID, c.getCurrentConfig().AgentID)
+
+				// Reconnecting uses the new ID
+				c.opampMux.Lock()
+				assert.Equal(t, newAgentID, c.opampSettings.InstanceUid)
+				assert.Equal(t, []string{newAgentID}, c.opampSettings.Header["Agent-ID"])
+				assert.Len(t, c.opampSettings.Header, len(settings.Header))
+				c.opampMux.Unlock()
+				assert.Equal(t, []string{currConfig.AgentID}, settings.Header["Agent-ID"])
+
+				data, err := os.ReadFile(managerFilePath)
+				require.NoError(t, err)
+				var persisted opamp.Config
+				require.NoError(t, yaml.Unmarshal(data, &persisted))
+				assert.Equal(t, newAgentID, persisted.AgentID)
+				assert.Equal(t, opamp.AgentIDStrategyMachineID, persisted.AgentIDStrategy)
+
+				// The manager config change is tracked
+				assert.Equal(t, opamp.ComputeHash(data), managedConfig.GetCurrentConfigHash())
+			},
+		},
+		{
+			desc: "Same ID is ignored",
+			testFunc: func(t *testing.T) {
+				managerFilePath, managedConfig := writeManagerConfig(t, currConfig)
+				mockOpAmpClient := mocks.NewMockOpAMPClient(t)
+
+				c := newSwitchTestClient(t, mockOpAmpClient, currConfig, managerFilePath, managedConfig)
+
+				err := c.adoptAgentID(currConfig.AgentID)
+				require.NoError(t, err)
+				assert.Equal(t, currConfig, c.getCurrentConfig())
+			},
+		},
+		{
+			desc: "Agent description fails",
+			testFunc: func(t *testing.T) {
+				managerFilePath, managedConfig := writeManagerConfig(t, currConfig)
+
+				mockOpAmpClient := mocks.NewMockOpAMPClient(t)
+				mockOpAmpClient.On("SetAgentDescription", mock.Anything).Return(errors.New("oops"))
+
+				c := newSwitchTestClient(t, mockOpAmpClient, currConfig, managerFilePath, managedConfig)
+
+				err := c.adoptAgentID(newAgentID)
+				require.ErrorContains(t, err, "failed to set agent description")
+
+				// The OpAMP client already uses the new ID so it's kept
+				assert.Equal(t, newAgentID, c.getCurrentConfig().AgentID)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, tc.testFunc)
+	}
+}
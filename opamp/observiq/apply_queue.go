@@ -0,0 +1,209 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package observiq
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/open-telemetry/opamp-go/protobufs"
+)
+
+// errApplySuperseded is returned when a newer remote config is pushed while one is applying
+var errApplySuperseded = errors.New("apply superseded by a newer config")
+
+// applyFunc applies a remote config. The context is cancelled when the queue is stopped or a newer config is pushed.
+type applyFunc func(ctx context.Context, remoteConfig *protobufs.AgentRemoteConfig)
+
+// supersededKey is the context key of the channel closed when an apply is superseded by a newer config
+type supersededKey struct{}
+
+// applySuperseded returns true if the apply's context was cancelled by a newer config rather than the queue stopping
+func applySuperseded(ctx context.Context) bool {
+	superseded, ok := ctx.Value(supersededKey{}).(chan struct{})
+	if !ok {
+		return false
+	}
+
+	select {
+	case <-superseded:
+		return true
+	default:
+		return false
+	}
+}
+
+// applyTask is work that changes the configs, run on the apply queue so it doesn't block the caller
+type applyTask func(ctx context.Context)
+
+// applyQueue applies remote configs one at a time on a single worker.
+// A remote config that arrives while another is applying cancels the apply in progress and replaces any config
+// still waiting to be applied, so superseded pushes are never applied.
+// Tasks are never superseded and run in order before the waiting config.
+type applyQueue struct {
+	apply applyFunc
+
+	mux         sync.Mutex
+	pending     *protobufs.AgentRemoteConfig
+	tasks       []applyTask
+	cancelApply context.CancelFunc
+	stopped     bool
+
+	// supersedeApply cancels the config apply in progress, marking it superseded. Nil unless a config is applying.
+	supersedeApply func()
+
+	wakeChan chan struct{}
+	doneChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// newApplyQueue creates an applyQueue that applies remote configs with the apply func
+func newApplyQueue(apply applyFunc) *applyQueue {
+	return &applyQueue{
+		apply:    apply,
+		wakeChan: make(chan struct{}, 1),
+		doneChan: make(chan struct{}),
+	}
+}
+
+// start starts the worker
+func (q *applyQueue) start() {
+	q.wg.Add(1)
+	go q.run()
+}
+
+// enqueue queues the remote config to be applied, replacing any config still waiting and cancelling the config apply in progress.
+// Returns the config that was replaced or nil if none was waiting.
+func (q *applyQueue) enqueue(remoteConfig *protobufs.AgentRemoteConfig) (superseded *protobufs.AgentRemoteConfig) {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	if q.stopped {
+		return nil
+	}
+
+	superseded = q.pending
+	q.pending = remoteConfig
+
+	if q.supersedeApply != nil {
+		q.supersedeApply()
+	}
+
+	// The worker only needs to be woken once for any number of pending configs
+	select {
+	case q.wakeChan <- struct{}{}:
+	default:
+	}
+
+	return superseded
+}
+
+// enqueueTask queues the task to run after the apply in progress, if any
+func (q *applyQueue) enqueueTask(task applyTask) {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	if q.stopped {
+		return
+	}
+
+	q.tasks = append(q.tasks, task)
+
+	select {
+	case q.wakeChan <- struct{}{}:
+	default:
+	}
+}
+
+// stop discards the waiting config and tasks, cancels the apply in progress, and waits for the worker to exit
+func (q *applyQueue) stop() {
+	q.mux.Lock()
+	if q.stopped {
+		q.mux.Unlock()
+		return
+	}
+	q.stopped = true
+	q.pending = nil
+	q.tasks = nil
+	if q.cancelApply != nil {
+		q.cancelApply()
+	}
+	close(q.doneChan)
+	q.mux.Unlock()
+
+	q.wg.Wait()
+}
+
+// run applies pending configs until the queue is stopped
+func (q *applyQueue) run() {
+	defer q.wg.Done()
+
+	for {
+		select {
+		case <-q.doneChan:
+			return
+		case <-q.wakeChan:
+			q.applyPending()
+		}
+	}
+}
+
+// applyPending runs the waiting tasks then applies the waiting config if there is one
+func (q *applyQueue) applyPending() {
+	q.mux.Lock()
+	remoteConfig := q.pending
+	tasks := q.tasks
+	q.pending = nil
+	q.tasks = nil
+	if (remoteConfig == nil && len(tasks) == 0) || q.stopped {
+		q.mux.Unlock()
+		return
+	}
+
+	supersededChan := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), supersededKey{}, supersededChan))
+	q.cancelApply = cancel
+	q.mux.Unlock()
+
+	defer func() {
+		q.mux.Lock()
+		q.cancelApply = nil
+		q.supersedeApply = nil
+		q.mux.Unlock()
+		cancel()
+	}()
+
+	// Tasks aren't superseded so only the config apply is cancelled by a newer config
+	for _, task := range tasks {
+		task(ctx)
+	}
+
+	if remoteConfig == nil {
+		return
+	}
+
+	q.mux.Lock()
+	var once sync.Once
+	q.supersedeApply = func() {
+		once.Do(func() {
+			close(supersededChan)
+			cancel()
+		})
+	}
+	q.mux.Unlock()
+
+	q.apply(ctx, remoteConfig)
+}
@@ -0,0 +1,266 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package observiq
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/open-telemetry/opamp-go/protobufs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyQueue(t *testing.T) {
+	remoteConfig := func(hash string) *protobufs.AgentRemoteConfig {
+		return &protobufs.AgentRemoteConfig{ConfigHash: []byte(hash)}
+	}
+
+	testCases := []struct {
+		desc     string
+		testFunc func(*testing.T)
+	}{
+		{
+			desc: "Superseded configs are skipped",
+			testFunc: func(t *testing.T) {
+				started := make(chan struct{})
+				release := make(chan struct{})
+
+				var mux sync.Mutex
+				var applied []string
+				done := make(chan struct{})
+
+				queue := newApplyQueue(func(_ context.Context, rc *protobufs.AgentRemoteConfig) {
+					hash := string(rc.GetConfigHash())
+					if hash == "1" {
+						close(started)
+						<-release
+					}
+
+					mux.Lock()
+					applied = append(applied, hash)
+					mux.Unlock()
+
+					if hash == "4" {
+						close(done)
+					}
+				})
+				queue.start()
+				defer queue.stop()
+
+				require.Nil(t, queue.enqueue(remoteConfig("1")))
+				<-started
+
+				// Received while 1 is applying
+				require.Nil(t, queue.enqueue(remoteConfig("2")))
+				require.Equal(t, remoteConfig("2"), queue.enqueue(remoteConfig("3")))
+				require.Equal(t, remoteConfig("3"), queue.enqueue(remoteConfig("4")))
+				close(release)
+
+				select {
+				case <-done:
+				case <-time.After(5 * time.Second):
+					t.Fatal("timed out waiting for apply")
+				}
+
+				mux.Lock()
+				defer mux.Unlock()
+				require.Equal(t, []string{"1", "4"}, applied)
+			},
+		},
+		{
+			desc: "Tasks run in order before the waiting config and aren't superseded",
+			testFunc: func(t *testing.T) {
+				started := make(chan struct{})
+				release := make(chan struct{})
+
+				var mux sync.Mutex
+				var ran []string
+				done := make(chan struct{})
+				record := func(name string) {
+					mux.Lock()
+					ran = append(ran, name)
+					mux.Unlock()
+				}
+
+				queue := newApplyQueue(func(_ context.Context, rc *protobufs.AgentRemoteConfig) {
+					hash := string(rc.GetConfigHash())
+					if hash == "1" {
+						close(started)
+						<-release
+					}
+
+					record(hash)
+					if hash == "3" {
+						close(done)
+					}
+				})
+				queue.start()
+				defer queue.stop()
+
+				queue.enqueue(remoteConfig("1"))
+				<-started
+
+				// Received while 1 is applying
+				queue.enqueue(remoteConfig("2"))
+				queue.enqueueTask(func(context.Context) { record("task a") })
+				queue.enqueue(remoteConfig("3"))
+				queue.enqueueTask(func(context.Context) { record("task b") })
+				close(release)
+
+				select {
+				case <-done:
+				case <-time.After(5 * time.Second):
+					t.Fatal("timed out waiting for apply")
+				}
+
+				mux.Lock()
+				defer mux.Unlock()
+				require.Equal(t, []string{"1", "task a", "task b", "3"}, ran)
+			},
+		},
+		{
+			desc: "A newer config cancels the apply in progress",
+			testFunc: func(t *testing.T) {
+				started := make(chan struct{})
+				cancelled := make(chan bool, 1)
+				applied := make(chan string, 1)
+
+				queue := newApplyQueue(func(ctx context.Context, remoteConfig *protobufs.AgentRemoteConfig) {
+					if string(remoteConfig.GetConfigHash()) != "1" {
+						applied <- string(remoteConfig.GetConfigHash())
+						return
+					}
+
+					close(started)
+					<-ctx.Done()
+					cancelled <- applySuperseded(ctx)
+				})
+				queue.start()
+				defer queue.stop()
+
+				queue.enqueue(remoteConfig("1"))
+				<-started
+				require.Nil(t, queue.enqueue(remoteConfig("2")))
+
+				select {
+				case superseded := <-cancelled:
+					require.True(t, superseded)
+				case <-time.After(5 * time.Second):
+					t.Fatal("timed out waiting for cancel")
+				}
+
+				select {
+				case hash := <-applied:
+					require.Equal(t, "2", hash)
+				case <-time.After(5 * time.Second):
+					t.Fatal("timed out waiting for the newer config")
+				}
+			},
+		},
+		{
+			desc: "Stop cancels the apply in progress and discards pending configs",
+			testFunc: func(t *testing.T) {
+				started := make(chan struct{})
+
+				var mux sync.Mutex
+				var applied []string
+
+				// The apply outlasts being superseded so the newer config is still pending when the queue stops
+				var queue *applyQueue
+				queue = newApplyQueue(func(ctx context.Context, rc *protobufs.AgentRemoteConfig) {
+					mux.Lock()
+					applied = append(applied, string(rc.GetConfigHash()))
+					mux.Unlock()
+
+					close(started)
+					<-ctx.Done()
+					<-queue.doneChan
+				})
+				queue.start()
+
+				queue.enqueue(remoteConfig("1"))
+				<-started
+				queue.enqueue(remoteConfig("2"))
+
+				queue.stop()
+				require.Nil(t, queue.enqueue(remoteConfig("3")))
+
+				// Stopping again does nothing
+				queue.stop()
+
+				mux.Lock()
+				defer mux.Unlock()
+				require.Equal(t, []string{"1"}, applied)
+			},
+		},
+		{
+			desc: "Concurrent enqueues apply one at a time",
+			testFunc: func(t *testing.T) {
+				var mux sync.Mutex
+				var running, maxRunning, applies int
+
+				queue := newApplyQueue(func(_ context.Context, _ *protobufs.AgentRemoteConfig) {
+					mux.Lock()
+					running++
+					applies++
+					if running > maxRunning {
+						maxRunning = running
+					}
+					mux.Unlock()
+
+					time.Sleep(time.Millisecond)
+
+					mux.Lock()
+					running--
+					mux.Unlock()
+				})
+				queue.start()
+
+				var wg sync.WaitGroup
+				for i := 0; i < 10; i++ {
+					wg.Add(1)
+					go func(i int) {
+						defer wg.Done()
+						for j := 0; j < 20; j++ {
+							queue.enqueue(remoteConfig(fmt.Sprintf("%d-%d", i, j)))
+						}
+					}(i)
+				}
+				wg.Wait()
+
+				// Wait for the last config to be picked up before stopping
+				assert.Eventually(t, func() bool {
+					queue.mux.Lock()
+					defer queue.mux.Unlock()
+					return queue.pending == nil
+				}, 5*time.Second, time.Millisecond)
+				queue.stop()
+
+				mux.Lock()
+				defer mux.Unlock()
+				require.Equal(t, 1, maxRunning)
+				require.GreaterOrEqual(t, applies, 1)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, tc.testFunc)
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package observiq
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/observiq/observiq-otel-collector/opamp"
+	"github.com/open-telemetry/opamp-go/protobufs"
+	"go.uber.org/zap"
+)
+
+// configState is the hash and redacted contents of a managed config
+type configState struct {
+	hash     []byte
+	contents []byte
+}
+
+// configSnapshot is the state of each managed config at a point in time
+type configSnapshot map[string]configState
+
+// newAuditEntry starts the audit entry of a remote config
+func (c *Client) newAuditEntry(remoteConfig *protobufs.AgentRemoteConfig) *opamp.AuditEntry {
+	currentConfig := c.getCurrentConfig()
+
+	entry := &opamp.AuditEntry{
+		Time:             time.Now(),
+		AgentID:          currentConfig.AgentID,
+		Endpoint:         currentConfig.Endpoint,
+		RemoteConfigHash: hex.EncodeToString(remoteConfig.GetConfigHash()),
+	}
+
+	if rollbackContents, ok := remoteConfig.GetConfig().GetConfigMap()[RollbackConfigName]; ok {
+		entry.RollbackRequest = string(rollbackContents.GetBody())
+	}
+
+	return entry
+}
+
+// snapshotConfigs returns the current state of the managed configs.
+// Nothing is snapshotted if the audit log is disabled.
+func (c *Client) snapshotConfigs() configSnapshot {
+	if c.auditLog == nil {
+		return nil
+	}
+
+	// The effective config is already redacted
+	effectiveConfig, err := c.configManager.ComposeEffectiveConfig()
+	if err != nil {
+		c.getLogger().Warn("Failed to snapshot configs for the audit log", zap.Error(err))
+		return nil
+	}
+
+	snapshot := make(configSnapshot)
+	for configName, configFile := range effectiveConfig.GetConfigMap().GetConfigMap() {
+		state := configState{
+			contents: configFile.GetBody(),
+		}
+		if managedConfig, ok := c.configManager.GetConfig(configName); ok {
+			state.hash = managedConfig.GetCurrentConfigHash()
+		}
+		snapshot[configName] = state
+	}
+
+	return snapshot
+}
+
+// writeAudit completes the audit entry and appends it to the audit log if enabled
+func (c *Client) writeAudit(entry *opamp.AuditEntry, remoteConfig *protobufs.AgentRemoteConfig, before configSnapshot, changed bool, applyErr error) {
+	if c.auditLog == nil {
+		return
+	}
+
+	switch {
+	case errors.Is(applyErr, errApplySuperseded):
+		entry.Result = opamp.AuditResultSuperseded
+	case errors.Is(applyErr, errProbationFailed):
+		entry.Result = opamp.AuditResultRolledBack
+	case applyErr != nil:
+		entry.Result = opamp.AuditResultFailed
+	case changed:
+		entry.Result = opamp.AuditResultApplied
+	default:
+		entry.Result = opamp.AuditResultUnchanged
+	}
+	if applyErr != nil {
+		entry.Error = applyErr.Error()
+	}
+
+	entry.Configs = c.auditConfigChanges(remoteConfig, before, c.snapshotConfigs())
+
+	if err := c.auditLog.Write(entry); err != nil {
+		c.getLogger().Error("Failed to write audit log", zap.Error(err))
+	}
+}
+
+// auditSuperseded records a remote config skipped in favor of a newer one
+func (c *Client) auditSuperseded(remoteConfig *protobufs.AgentRemoteConfig) {
+	if c.auditLog == nil {
+		return
+	}
+
+	entry := c.newAuditEntry(remoteConfig)
+	entry.Result = opamp.AuditResultSuperseded
+
+	if err := c.auditLog.Write(entry); err != nil {
+		c.getLogger().Error("Failed to write audit log", zap.Error(err))
+	}
+}
+
+// auditConfigChanges compares the configs before and after a remote config was applied.
+// Every config named by the remote config is included along with any other config that changed, such as one rolled back.
+func (c *Client) auditConfigChanges(remoteConfig *protobufs.AgentRemoteConfig, before, after configSnapshot) []opamp.AuditConfigChange {
+	names := make(map[string]struct{})
+	for configName := range remoteConfig.GetConfig().GetConfigMap() {
+		if configName != RollbackConfigName {
+			names[configName] = struct{}{}
+		}
+	}
+	for configName, state := range after {
+		if !bytes.Equal(before[configName].hash, state.hash) {
+			names[configName] = struct{}{}
+		}
+	}
+
+	sortedNames := make([]string, 0, len(names))
+	for configName := range names {
+		sortedNames = append(sortedNames, configName)
+	}
+	sort.Strings(sortedNames)
+
+	changes := make([]opamp.AuditConfigChange, 0, len(sortedNames))
+	for _, configName := range sortedNames {
+		oldState, oldOK := before[configName]
+		newState, newOK := after[configName]
+
+		change := opamp.AuditConfigChange{
+			Name:    configName,
+			OldHash: hex.EncodeToString(oldState.hash),
+			NewHash: hex.EncodeToString(newState.hash),
+			Ignored: !oldOK && !newOK,
+		}
+
+		if !bytes.Equal(oldState.contents, newState.contents) {
+			diff, err := opamp.ConfigDiff(configName, oldState.contents, newState.contents)
+			if err != nil {
+				c.getLogger().Warn("Failed to diff config for the audit log", zap.String("config", configName), zap.Error(err))
+			}
+			change.Diff = diff
+		}
+
+		changes = append(changes, change)
+	}
+
+	return changes
+}
@@ -0,0 +1,163 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package observiq
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	colmocks "github.com/observiq/observiq-otel-collector/collector/mocks"
+	"github.com/observiq/observiq-otel-collector/opamp"
+	"github.com/observiq/observiq-otel-collector/opamp/mocks"
+	"github.com/open-telemetry/opamp-go/protobufs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestClient_onRemoteConfigHandlerAudit(t *testing.T) {
+	currContents := []byte("exporters:\n  otlp:\n    password: hunter1\n")
+	newContents := []byte("exporters:\n  otlp:\n    password: hunter2\n")
+
+	remoteConfig := &protobufs.AgentRemoteConfig{
+		Config: &protobufs.AgentConfigMap{
+			ConfigMap: map[string]*protobufs.AgentConfigFile{
+				CollectorConfigName: {Body: newContents},
+				"other.yaml":        {Body: []byte("other: value")},
+			},
+		},
+		ConfigHash: []byte("hash"),
+	}
+
+	// setupClient creates a client managing a collector config with an audit log
+	setupClient := func(t *testing.T, mockCollector *colmocks.MockCollector) (*Client, string) {
+		tmpDir := t.TempDir()
+		collectorFilePath := filepath.Join(tmpDir, CollectorConfigName)
+		require.NoError(t, os.WriteFile(collectorFilePath, currContents, 0600))
+
+		auditFilePath := filepath.Join(tmpDir, "audit.log")
+		auditLog, err := opamp.NewAuditLog(opamp.AuditConfig{Filename: auditFilePath})
+		require.NoError(t, err)
+		t.Cleanup(func() { auditLog.Close() })
+
+		mockOpAmpClient := mocks.NewMockOpAMPClient(t)
+		mockOpAmpClient.On("SetRemoteConfigStatus", mock.Anything).Return(nil)
+		mockOpAmpClient.On("UpdateEffectiveConfig", mock.Anything).Return(nil).Maybe()
+
+		c := &Client{
+			opampClient:   mockOpAmpClient,
+			logger:        zap.NewNop(),
+			configManager: NewAgentConfigManager(zap.NewNop()),
+			collector:     mockCollector,
+			auditLog:      auditLog,
+			currentConfig: opamp.Config{
+				Endpoint: "ws://localhost:3001",
+				AgentID:  "agent",
+			},
+		}
+
+		managedConfig, err := opamp.NewManagedConfig(collectorFilePath, collectorReload(c, collectorFilePath))
+		require.NoError(t, err)
+		c.configManager.AddConfig(CollectorConfigName, managedConfig)
+
+		return c, auditFilePath
+	}
+
+	readEntries := func(t *testing.T, auditFilePath string) []opamp.AuditEntry {
+		data, err := os.ReadFile(auditFilePath)
+		require.NoError(t, err)
+
+		var entries []opamp.AuditEntry
+		for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+			var entry opamp.AuditEntry
+			require.NoError(t, json.Unmarshal([]byte(line), &entry))
+			entries = append(entries, entry)
+		}
+		return entries
+	}
+
+	testCases := []struct {
+		desc     string
+		testFunc func(*testing.T)
+	}{
+		{
+			desc: "Applied config is recorded with a redacted diff",
+			testFunc: func(t *testing.T) {
+				mockCollector := colmocks.NewMockCollector(t)
+				mockCollector.On("ValidateConfig", mock.Anything, newContents).Return(nil)
+				mockCollector.On("Restart", mock.Anything).Return(nil)
+
+				c, auditFilePath := setupClient(t, mockCollector)
+
+				require.NoError(t, c.onRemoteConfigHandler(context.Background(), remoteConfig))
+
+				entries := readEntries(t, auditFilePath)
+				require.Len(t, entries, 1)
+
+				entry := entries[0]
+				assert.Equal(t, opamp.AuditResultApplied, entry.Result)
+				assert.Equal(t, "agent", entry.AgentID)
+				assert.Equal(t, "ws://localhost:3001", entry.Endpoint)
+				assert.Equal(t, hex.EncodeToString([]byte("hash")), entry.RemoteConfigHash)
+				require.Len(t, entry.Steps, 1)
+				assert.Equal(t, "apply", entry.Steps[0].Name)
+
+				require.Len(t, entry.Configs, 2)
+				collectorChange := entry.Configs[0]
+				assert.Equal(t, CollectorConfigName, collectorChange.Name)
+				assert.Equal(t, hex.EncodeToString(opamp.ComputeHash(currContents)), collectorChange.OldHash)
+				assert.Equal(t, hex.EncodeToString(opamp.ComputeHash(newContents)), collectorChange.NewHash)
+				assert.Contains(t, collectorChange.Diff, "+    password: REDACTED:")
+				assert.NotContains(t, collectorChange.Diff, "hunter")
+
+				assert.Equal(t, opamp.AuditConfigChange{Name: "other.yaml", Ignored: true}, entry.Configs[1])
+			},
+		},
+		{
+			desc: "Failed config is recorded",
+			testFunc: func(t *testing.T) {
+				mockCollector := colmocks.NewMockCollector(t)
+				mockCollector.On("ValidateConfig", mock.Anything, newContents).Return(errors.New("unknown exporter"))
+
+				c, auditFilePath := setupClient(t, mockCollector)
+
+				require.NoError(t, c.onRemoteConfigHandler(context.Background(), remoteConfig))
+
+				entries := readEntries(t, auditFilePath)
+				require.Len(t, entries, 1)
+
+				entry := entries[0]
+				assert.Equal(t, opamp.AuditResultFailed, entry.Result)
+				assert.Contains(t, entry.Error, "unknown exporter")
+				assert.Contains(t, entry.Steps[0].Error, "unknown exporter")
+
+				collectorChange := entry.Configs[0]
+				assert.Equal(t, collectorChange.OldHash, collectorChange.NewHash)
+				assert.Empty(t, collectorChange.Diff)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, tc.testFunc)
+	}
+}
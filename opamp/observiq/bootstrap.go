@@ -0,0 +1,142 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package observiq
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/observiq/observiq-otel-collector/opamp"
+	"github.com/open-telemetry/opamp-go/protobufs"
+	"go.uber.org/zap"
+)
+
+// configStatusAttribute is the agent description attribute reporting whether the server has configured the collector
+const configStatusAttribute = "opamp.config.status"
+
+// Values of the config status attribute
+const (
+	configStatusAwaiting   = "awaiting-configuration"
+	configStatusConfigured = "configured"
+)
+
+// bootstrapCollectorConfig is written when there's no collector config so the collector can run until the server sends one.
+// Its pipeline receives and exports nothing.
+var bootstrapCollectorConfig = []byte(`receivers:
+  nop:
+exporters:
+  nop:
+service:
+  pipelines:
+    metrics:
+      receivers: [nop]
+      exporters: [nop]
+`)
+
+// bootstrapLoggingConfig is written when there's no logging config. It matches the logging used when the file doesn't exist.
+var bootstrapLoggingConfig = []byte(`output: stdout
+level: info
+`)
+
+// ensureConfigFile writes the contents to the path if there's no file there yet.
+// Returns true if the file was written.
+func ensureConfigFile(configPath string, contents []byte) (bool, error) {
+	cleanPath := filepath.Clean(configPath)
+
+	_, err := os.Stat(cleanPath)
+	switch {
+	case err == nil:
+		return false, nil
+	case !errors.Is(err, os.ErrNotExist):
+		return false, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cleanPath), 0750); err != nil {
+		return false, fmt.Errorf("failed to create directory for %s: %w", configPath, err)
+	}
+
+	if err := opamp.WriteFileAtomic(cleanPath, contents, 0600); err != nil {
+		return false, fmt.Errorf("failed to write %s: %w", configPath, err)
+	}
+	return true, nil
+}
+
+// ensureBootstrapConfigs writes the bootstrap collector and logging configs if they don't exist
+// so a new agent can start with only a manager config
+func (c *Client) ensureBootstrapConfigs(args *NewClientArgs) error {
+	created, err := ensureConfigFile(args.CollectorConfigPath, bootstrapCollectorConfig)
+	if err != nil {
+		return fmt.Errorf("failed to create collector config: %w", err)
+	}
+	if created {
+		c.getLogger().Info("Created collector config with an empty pipeline", zap.String("path", args.CollectorConfigPath))
+	}
+
+	created, err = ensureConfigFile(args.LoggerConfigPath, bootstrapLoggingConfig)
+	if err != nil {
+		return fmt.Errorf("failed to create logging config: %w", err)
+	}
+	if created {
+		c.getLogger().Info("Created default logging config", zap.String("path", args.LoggerConfigPath))
+	}
+
+	return nil
+}
+
+// awaitingConfiguration returns true while the collector is running the bootstrap config
+func (c *Client) awaitingConfiguration() bool {
+	if c.configManager == nil {
+		return false
+	}
+
+	managedConfig, ok := c.configManager.GetConfig(CollectorConfigName)
+	if !ok {
+		return false
+	}
+
+	return isBootstrapCollectorConfig(managedConfig.ConfigPath)
+}
+
+// isBootstrapCollectorConfig returns true if the collector config at the path is the bootstrap config
+func isBootstrapCollectorConfig(configPath string) bool {
+	contents, err := os.ReadFile(filepath.Clean(configPath))
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(contents, bootstrapCollectorConfig)
+}
+
+// describe creates the agent description reported to the server, including whether it's awaiting configuration
+func (c *Client) describe(ident *identity, endpoint string) *protobufs.AgentDescription {
+	desc := agentDescription(ident, endpoint)
+
+	status := configStatusConfigured
+	if c.awaitingConfiguration() {
+		status = configStatusAwaiting
+	}
+
+	attributes := make([]*protobufs.KeyValue, 0, len(desc.NonIdentifyingAttributes)+1)
+	for _, attribute := range desc.NonIdentifyingAttributes {
+		if attribute.GetKey() != configStatusAttribute {
+			attributes = append(attributes, attribute)
+		}
+	}
+	desc.NonIdentifyingAttributes = append(attributes, opamp.StringKeyValue(configStatusAttribute, status))
+
+	return desc
+}
@@ -0,0 +1,157 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package observiq
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/observiq/observiq-otel-collector/collector"
+	colmocks "github.com/observiq/observiq-otel-collector/collector/mocks"
+	"github.com/observiq/observiq-otel-collector/opamp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+func TestEnsureConfigFile(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		testFunc func(*testing.T)
+	}{
+		{
+			desc: "Missing file is written",
+			testFunc: func(t *testing.T) {
+				configPath := filepath.Join(t.TempDir(), "config", CollectorConfigName)
+
+				created, err := ensureConfigFile(configPath, bootstrapCollectorConfig)
+				require.NoError(t, err)
+				assert.True(t, created)
+
+				contents, err := os.ReadFile(configPath)
+				require.NoError(t, err)
+				assert.Equal(t, bootstrapCollectorConfig, contents)
+			},
+		},
+		{
+			desc: "Existing file is kept",
+			testFunc: func(t *testing.T) {
+				configPath := filepath.Join(t.TempDir(), CollectorConfigName)
+				require.NoError(t, os.WriteFile(configPath, []byte("receivers:"), 0600))
+
+				created, err := ensureConfigFile(configPath, bootstrapCollectorConfig)
+				require.NoError(t, err)
+				assert.False(t, created)
+
+				contents, err := os.ReadFile(configPath)
+				require.NoError(t, err)
+				assert.Equal(t, []byte("receivers:"), contents)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, tc.testFunc)
+	}
+}
+
+func TestBootstrapCollectorConfigIsValid(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), CollectorConfigName)
+	col := collector.New([]string{configPath}, "0.0.0", nil)
+	assert.NoError(t, col.ValidateConfig(context.Background(), bootstrapCollectorConfig))
+}
+
+func TestNewClientWithoutConfigs(t *testing.T) {
+	dir := t.TempDir()
+	cfg := opamp.Config{
+		Endpoint: "ws://localhost:1234",
+		AgentID:  "d4691426-b0bb-41f7-84a8-320a9ec0ea2e",
+	}
+
+	managerContents, err := yaml.Marshal(cfg)
+	require.NoError(t, err)
+	managerConfigPath := filepath.Join(dir, ManagerConfigName)
+	require.NoError(t, os.WriteFile(managerConfigPath, managerContents, 0600))
+
+	args := &NewClientArgs{
+		DefaultLogger:       zap.NewNop(),
+		Config:              cfg,
+		Collector:           colmocks.NewMockCollector(t),
+		ManagerConfigPath:   managerConfigPath,
+		CollectorConfigPath: filepath.Join(dir, CollectorConfigName),
+		LoggerConfigPath:    filepath.Join(dir, LoggingConfigName),
+	}
+
+	opampClient, err := NewClient(args)
+	require.NoError(t, err)
+	c := opampClient.(*Client)
+
+	collectorContents, err := os.ReadFile(args.CollectorConfigPath)
+	require.NoError(t, err)
+	assert.Equal(t, bootstrapCollectorConfig, collectorContents)
+
+	loggingContents, err := os.ReadFile(args.LoggerConfigPath)
+	require.NoError(t, err)
+	assert.Equal(t, bootstrapLoggingConfig, loggingContents)
+
+	assert.True(t, c.awaitingConfiguration())
+	desc := c.describe(c.getIdent(), cfg.Endpoint)
+	assert.Equal(t, configStatusAwaiting, findAttribute(desc.GetNonIdentifyingAttributes(), configStatusAttribute))
+	assert.Equal(t, cfg.Endpoint, findAttribute(desc.GetNonIdentifyingAttributes(), endpointAttribute))
+}
+
+func TestClient_describe(t *testing.T) {
+	collectorConfigPath := filepath.Join(t.TempDir(), CollectorConfigName)
+	require.NoError(t, os.WriteFile(collectorConfigPath, bootstrapCollectorConfig, 0600))
+
+	c := newBootstrapTestClient(t, collectorConfigPath)
+
+	desc := c.describe(c.getIdent(), "ws://localhost:1234")
+	assert.Equal(t, configStatusAwaiting, findAttribute(desc.GetNonIdentifyingAttributes(), configStatusAttribute))
+
+	require.NoError(t, os.WriteFile(collectorConfigPath, []byte("receivers:"), 0600))
+	desc = c.describe(c.getIdent(), "ws://localhost:1234")
+	assert.Equal(t, configStatusConfigured, findAttribute(desc.GetNonIdentifyingAttributes(), configStatusAttribute))
+
+	// A user defined attribute with the same key is replaced
+	c.ident.attributes = &opamp.AttributesConfig{NonIdentifying: map[string]string{configStatusAttribute: "custom"}}
+	desc = c.describe(c.getIdent(), "ws://localhost:1234")
+
+	var statuses []string
+	for _, attribute := range desc.GetNonIdentifyingAttributes() {
+		if attribute.GetKey() == configStatusAttribute {
+			statuses = append(statuses, attribute.GetValue().GetStringValue())
+		}
+	}
+	assert.Equal(t, []string{configStatusConfigured}, statuses)
+}
+
+// newBootstrapTestClient creates a client managing the collector config at the path
+func newBootstrapTestClient(t *testing.T, collectorConfigPath string) *Client {
+	managedConfig, err := opamp.NewManagedConfig(collectorConfigPath, opamp.NoopReloadFunc)
+	require.NoError(t, err)
+
+	configManager := NewAgentConfigManager(zap.NewNop())
+	configManager.AddConfig(CollectorConfigName, managedConfig)
+
+	return &Client{
+		logger:        zap.NewNop(),
+		ident:         newIdentity(zap.NewNop(), opamp.Config{AgentID: "d4691426-b0bb-41f7-84a8-320a9ec0ea2e"}),
+		configManager: configManager,
+	}
+}
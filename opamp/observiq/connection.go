@@ -0,0 +1,589 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package observiq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/observiq/observiq-otel-collector/opamp"
+	"github.com/open-telemetry/opamp-go/client"
+	"github.com/open-telemetry/opamp-go/client/types"
+	"github.com/open-telemetry/opamp-go/protobufs"
+	"go.opencensus.io/metric"
+	"go.opencensus.io/metric/metricdata"
+	"go.uber.org/zap"
+)
+
+// endpointAttribute is the agent description attribute reporting the endpoint the agent is connected to
+const endpointAttribute = "opamp.endpoint"
+
+// failureReasons are the labels connection failures are counted by for each state a failure leads to
+var failureReasons = map[opamp.ConnectionState]string{
+	opamp.ConnectionStateBackoff:    "network",
+	opamp.ConnectionStateAuthFailed: "auth",
+}
+
+// ConnectionStatus returns the current status of the connection to the server
+func (c *Client) ConnectionStatus() opamp.ConnectionStatus {
+	endpoints := c.getCurrentConfig().GetEndpoints()
+
+	c.connMux.Lock()
+	defer c.connMux.Unlock()
+
+	status := c.connStatus
+	if status.State == "" {
+		status.State = opamp.ConnectionStateDisconnected
+	}
+
+	status.Endpoints = make([]opamp.EndpointHealth, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		health := opamp.EndpointHealth{Endpoint: endpoint.Endpoint}
+		if tracked, ok := c.endpointHealth[endpoint.Endpoint]; ok {
+			health = *tracked
+		}
+		status.Endpoints = append(status.Endpoints, health)
+	}
+	return status
+}
+
+// activeEndpoint returns the endpoint the agent is connected or connecting to
+func (c *Client) activeEndpoint() string {
+	c.connMux.Lock()
+	endpoint := c.connStatus.Endpoint
+	c.connMux.Unlock()
+
+	if endpoint == "" {
+		return c.getCurrentConfig().Endpoint
+	}
+	return endpoint
+}
+
+// agentDescription describes the agent with the identity, along with the endpoint it's connected to.
+// The endpoint replaces a user defined attribute with the same key.
+func agentDescription(ident *identity, endpoint string) *protobufs.AgentDescription {
+	desc := ident.ToAgentDescription()
+
+	attributes := make([]*protobufs.KeyValue, 0, len(desc.NonIdentifyingAttributes)+1)
+	for _, attribute := range desc.NonIdentifyingAttributes {
+		if attribute.GetKey() != endpointAttribute {
+			attributes = append(attributes, attribute)
+		}
+	}
+	desc.NonIdentifyingAttributes = append(attributes, opamp.StringKeyValue(endpointAttribute, endpoint))
+
+	return desc
+}
+
+// endpointHealthFor returns the tracked health of the endpoint, tracking it if it isn't yet.
+// connMux must be held.
+func (c *Client) endpointHealthFor(endpoint string) *opamp.EndpointHealth {
+	if c.endpointHealth == nil {
+		c.endpointHealth = make(map[string]*opamp.EndpointHealth)
+	}
+
+	health, ok := c.endpointHealth[endpoint]
+	if !ok {
+		health = &opamp.EndpointHealth{Endpoint: endpoint}
+		c.endpointHealth[endpoint] = health
+	}
+	return health
+}
+
+// setConnectionStatus replaces the connection status, keeping when the state was entered if it's unchanged.
+// connMux must be held.
+func (c *Client) setConnectionStatus(status opamp.ConnectionStatus) {
+	if status.State == c.connStatus.State {
+		status.Since = c.connStatus.Since
+	} else {
+		status.Since = time.Now()
+		c.recordStatusTransition(status)
+	}
+	c.connStatus = status
+}
+
+// startOpAMPClient starts the OpAMP client, tracking its connection so it's reconnected with backoff if it fails.
+// opampMux must be held.
+func (c *Client) startOpAMPClient(ctx context.Context, opampClient client.OpAMPClient, settings types.StartSettings) error {
+	c.connMux.Lock()
+	c.opampGen++
+	gen := c.opampGen
+	c.reconnecting = false
+	c.setConnectionStatus(opamp.ConnectionStatus{
+		State:     opamp.ConnectionStateConnecting,
+		Endpoint:  settings.OpAMPServerURL,
+		Attempts:  c.connStatus.Attempts,
+		LastError: c.connStatus.LastError,
+	})
+	c.connMux.Unlock()
+
+	callbacks, _ := settings.Callbacks.(types.CallbacksStruct)
+	tracked := callbacks
+	tracked.OnConnectFunc = func() {
+		c.onTrackedConnect(gen)
+		if callbacks.OnConnectFunc != nil {
+			callbacks.OnConnectFunc()
+		}
+	}
+	tracked.OnConnectFailedFunc = func(err error) {
+		if callbacks.OnConnectFailedFunc != nil {
+			callbacks.OnConnectFailedFunc(err)
+		}
+		c.onTrackedConnectFailed(gen, err)
+	}
+
+	trackedSettings := settings
+	trackedSettings.Callbacks = tracked
+	if err := opampClient.Start(ctx, trackedSettings); err != nil {
+		c.connMux.Lock()
+		c.setConnectionStatus(opamp.ConnectionStatus{
+			State:     opamp.ConnectionStateDisconnected,
+			Endpoint:  settings.OpAMPServerURL,
+			LastError: err.Error(),
+		})
+		c.connMux.Unlock()
+		return err
+	}
+
+	c.opampClient = opampClient
+	c.opampSettings = settings
+	c.opampStopped = false
+	return nil
+}
+
+// startNewOpAMPClient stops the current OpAMP client and starts a new one with the settings.
+// opampMux must be held.
+func (c *Client) startNewOpAMPClient(settings types.StartSettings) error {
+	if c.disconnected {
+		return errClientDisconnected
+	}
+
+	// An OpAMP client can only be stopped once
+	if !c.opampStopped {
+		stopCtx, cancel := context.WithTimeout(context.Background(), connectionSettingsTimeout)
+		defer cancel()
+		if err := c.opampClient.Stop(stopCtx); err != nil {
+			c.getLogger().Warn("Failed to stop OpAMP client", zap.Error(err))
+		}
+		c.opampStopped = true
+	}
+
+	newClient, err := newOpAMPClient(c.getLogger(), settings.OpAMPServerURL)
+	if err != nil {
+		return err
+	}
+
+	// Carry over what was last set on the stopped client so it isn't lost if it was set while the clients were swapped
+	ident := c.describedIdent
+	if ident == nil {
+		ident = c.getIdent()
+	}
+	if err := newClient.SetAgentDescription(c.describe(ident, settings.OpAMPServerURL)); err != nil {
+		return fmt.Errorf("failed to set agent description: %w", err)
+	}
+
+	if c.remoteConfigStatus != nil {
+		if err := newClient.SetRemoteConfigStatus(c.remoteConfigStatus); err != nil {
+			return fmt.Errorf("failed to set remote config status: %w", err)
+		}
+	}
+
+	if err := c.startOpAMPClient(context.Background(), newClient, settings); err != nil {
+		return fmt.Errorf("failed to start OpAMP client: %w", err)
+	}
+	return nil
+}
+
+// getOpAMPClient returns the current OpAMP client, which is replaced when it reconnects, fails over, or fails back
+func (c *Client) getOpAMPClient() client.OpAMPClient {
+	c.opampMux.Lock()
+	defer c.opampMux.Unlock()
+	return c.opampClient
+}
+
+// setAgentDescription describes the agent with the identity to the current OpAMP client.
+// The identity is kept so an OpAMP client started to replace this one is described the same way.
+func (c *Client) setAgentDescription(ident *identity) error {
+	c.opampMux.Lock()
+	c.describedIdent = ident
+	opampClient := c.opampClient
+	c.opampMux.Unlock()
+
+	return opampClient.SetAgentDescription(c.describe(ident, c.activeEndpoint()))
+}
+
+// setRemoteConfigStatus sets the remote config status on the current OpAMP client.
+// The status is kept so an OpAMP client started to replace this one also reports it.
+func (c *Client) setRemoteConfigStatus(status *protobufs.RemoteConfigStatus) error {
+	c.opampMux.Lock()
+	c.remoteConfigStatus = status
+	opampClient := c.opampClient
+	c.opampMux.Unlock()
+
+	return opampClient.SetRemoteConfigStatus(status)
+}
+
+// onTrackedConnect marks the connection as connected if the OpAMP client is the current one.
+// If it's connected to a fallback endpoint it starts checking for an earlier endpoint to fail back to.
+func (c *Client) onTrackedConnect(gen uint64) {
+	endpoints := c.getCurrentConfig().GetEndpoints()
+
+	c.connMux.Lock()
+	defer c.connMux.Unlock()
+
+	if gen != c.opampGen {
+		return
+	}
+
+	if c.connStatus.Attempts > 0 {
+		c.getLogger().Info("Reconnected to server", zap.Int("failed_attempts", c.connStatus.Attempts), zap.String("endpoint", c.connStatus.Endpoint))
+	}
+
+	health := c.endpointHealthFor(c.connStatus.Endpoint)
+	health.ConsecutiveFailures = 0
+	health.LastConnected = time.Now()
+
+	c.reconnectBackOff = nil
+	c.setConnectionStatus(opamp.ConnectionStatus{
+		State:    opamp.ConnectionStateConnected,
+		Endpoint: c.connStatus.Endpoint,
+	})
+
+	if endpointIndex(endpoints, c.connStatus.Endpoint) > 0 {
+		go c.failback(gen)
+	}
+}
+
+// onTrackedConnectFailed starts reconnecting if the OpAMP client is the current one.
+// The OpAMP client retries on its own fixed schedule, so it's replaced with one started after the configured backoff.
+func (c *Client) onTrackedConnectFailed(gen uint64, err error) {
+	// Attempts are canceled when the client is stopped
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+
+	c.connMux.Lock()
+	if gen != c.opampGen || c.reconnecting {
+		c.connMux.Unlock()
+		return
+	}
+	c.reconnecting = true
+	c.connMux.Unlock()
+
+	// The OpAMP client can't be stopped from within one of its callbacks so reconnect in the background
+	go c.reconnect(gen, err)
+}
+
+// reconnect stops the failed OpAMP client and starts new ones after backing off until one starts.
+// It gives up if the client is disconnected or a different OpAMP client is started in the meantime.
+func (c *Client) reconnect(gen uint64, connectErr error) {
+	c.opampMux.Lock()
+	if c.disconnected || !c.isCurrentOpAMPClient(gen) {
+		c.opampMux.Unlock()
+		return
+	}
+
+	settings := c.opampSettings
+	if !c.opampStopped {
+		stopCtx, cancel := context.WithTimeout(context.Background(), connectionSettingsTimeout)
+		if err := c.opampClient.Stop(stopCtx); err != nil {
+			c.getLogger().Warn("Failed to stop OpAMP client", zap.Error(err))
+		}
+		cancel()
+		c.opampStopped = true
+	}
+	c.opampMux.Unlock()
+
+	for {
+		state := connectFailureState(settings, connectErr)
+		delay := c.recordConnectFailure(state, connectErr)
+
+		// Fail over once the endpoint has failed too many times in a row
+		if next, ok := c.nextEndpoint(settings.OpAMPServerURL); ok {
+			nextSettings, err := c.endpointSettings(settings, next)
+			if err != nil {
+				c.getLogger().Error("Failed to create settings for fallback endpoint", zap.String("endpoint", next.Endpoint), zap.Error(err))
+			} else {
+				c.getLogger().Warn("Failing over to next endpoint", zap.String("from", settings.OpAMPServerURL), zap.String("to", next.Endpoint))
+				settings = nextSettings
+			}
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-c.reconnectDone:
+			timer.Stop()
+			return
+		}
+
+		c.opampMux.Lock()
+		if c.disconnected || !c.isCurrentOpAMPClient(gen) {
+			c.opampMux.Unlock()
+			return
+		}
+		err := c.startNewOpAMPClient(settings)
+		if err != nil {
+			// Keep trying as the client that failed to start
+			gen = c.currentOpAMPClientGen()
+		}
+		c.opampMux.Unlock()
+
+		if err == nil {
+			return
+		}
+		c.getLogger().Error("Failed to restart OpAMP client", zap.Error(err))
+		connectErr = err
+	}
+}
+
+// isCurrentOpAMPClient returns true if no OpAMP client has been started since the one with the generation
+func (c *Client) isCurrentOpAMPClient(gen uint64) bool {
+	return gen == c.currentOpAMPClientGen()
+}
+
+// currentOpAMPClientGen returns the generation of the last OpAMP client started
+func (c *Client) currentOpAMPClientGen() uint64 {
+	c.connMux.Lock()
+	defer c.connMux.Unlock()
+	return c.opampGen
+}
+
+// recordConnectFailure updates the connection status after a failed attempt and returns how long to wait before the next one.
+// Retrying won't help until the secret key is changed so auth failures always wait the max interval.
+func (c *Client) recordConnectFailure(state opamp.ConnectionState, err error) time.Duration {
+	reconnectCfg := c.getCurrentConfig().Reconnect
+
+	c.connMux.Lock()
+	defer c.connMux.Unlock()
+
+	if c.reconnectBackOff == nil {
+		c.reconnectBackOff = reconnectCfg.NewBackOff()
+	}
+
+	delay := c.reconnectBackOff.NextBackOff()
+	if state == opamp.ConnectionStateAuthFailed {
+		delay = reconnectCfg.GetMaxInterval()
+	}
+
+	if state == opamp.ConnectionStateAuthFailed && c.connStatus.State != opamp.ConnectionStateAuthFailed {
+		c.getLogger().Error("Server rejected the secret key, check the secret_key in the manager config", zap.String("endpoint", c.connStatus.Endpoint))
+	}
+	c.getLogger().Info("Retrying connection to server", zap.Duration("delay", delay), zap.String("state", string(state)))
+
+	if c.connFailures == nil {
+		c.connFailures = make(map[opamp.ConnectionState]int64)
+	}
+	c.connFailures[state]++
+
+	health := c.endpointHealthFor(c.connStatus.Endpoint)
+	health.ConsecutiveFailures++
+	health.LastError = err.Error()
+	health.LastFailure = time.Now()
+	c.setConnectionStatus(opamp.ConnectionStatus{
+		State:       state,
+		Endpoint:    c.connStatus.Endpoint,
+		Attempts:    c.connStatus.Attempts + 1,
+		LastError:   err.Error(),
+		NextAttempt: time.Now().Add(delay),
+	})
+
+	return delay
+}
+
+// nextEndpoint returns the endpoint to fail over to if the endpoint has failed the max number of times in a row.
+// Endpoints that aren't configured, such as one offered by the server being tested, never fail over.
+func (c *Client) nextEndpoint(endpoint string) (opamp.EndpointConfig, bool) {
+	cfg := c.getCurrentConfig()
+	endpoints := cfg.GetEndpoints()
+
+	i := endpointIndex(endpoints, endpoint)
+	if i < 0 || len(endpoints) < 2 {
+		return opamp.EndpointConfig{}, false
+	}
+
+	c.connMux.Lock()
+	failures := c.endpointHealthFor(endpoint).ConsecutiveFailures
+	c.connMux.Unlock()
+
+	if failures < cfg.Failover.GetMaxFailures() {
+		return opamp.EndpointConfig{}, false
+	}
+	return endpoints[(i+1)%len(endpoints)], true
+}
+
+// endpointSettings creates settings to connect to the endpoint with the current config, keeping the callbacks of the settings
+func (c *Client) endpointSettings(settings types.StartSettings, endpoint opamp.EndpointConfig) (types.StartSettings, error) {
+	endpointSettings, err := c.startSettings(*c.getCurrentConfig().WithEndpoint(endpoint))
+	if err != nil {
+		return types.StartSettings{}, err
+	}
+
+	endpointSettings.Callbacks = settings.Callbacks
+	return endpointSettings, nil
+}
+
+// failback periodically checks whether an endpoint earlier than the one connected to can be reached and switches to it.
+// It stops once a different OpAMP client is started or the client disconnects.
+func (c *Client) failback(gen uint64) {
+	ticker := time.NewTicker(c.getCurrentConfig().Failover.GetFailbackInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-c.reconnectDone:
+			return
+		}
+
+		if !c.isCurrentOpAMPClient(gen) {
+			return
+		}
+
+		endpoints := c.getCurrentConfig().GetEndpoints()
+		active := c.activeEndpoint()
+		i := endpointIndex(endpoints, active)
+		if i <= 0 {
+			return
+		}
+
+		for _, preferred := range endpoints[:i] {
+			if c.tryFailback(gen, active, preferred) {
+				return
+			}
+		}
+	}
+}
+
+// tryFailback switches to the preferred endpoint if it can be reached. It returns true if failback should stop.
+func (c *Client) tryFailback(gen uint64, active string, preferred opamp.EndpointConfig) bool {
+	probeSettings, err := c.startSettings(*c.getCurrentConfig().WithEndpoint(preferred))
+	if err != nil {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), connectionSettingsTimeout)
+	defer cancel()
+	if _, err := dialServer(ctx, probeSettings); err != nil {
+		return false
+	}
+
+	c.opampMux.Lock()
+	defer c.opampMux.Unlock()
+
+	if c.disconnected || !c.isCurrentOpAMPClient(gen) {
+		return true
+	}
+
+	settings, err := c.endpointSettings(c.opampSettings, preferred)
+	if err != nil {
+		return false
+	}
+
+	c.getLogger().Info("Failing back to recovered endpoint", zap.String("from", active), zap.String("to", preferred.Endpoint))
+	if err := c.startNewOpAMPClient(settings); err != nil {
+		c.getLogger().Error("Failed to fail back to endpoint", zap.String("endpoint", preferred.Endpoint), zap.Error(err))
+
+		// The client connected to the active endpoint has already been stopped so start another
+		if err := c.startNewOpAMPClient(c.opampSettings); err != nil {
+			c.getLogger().Error("Failed to restart OpAMP client", zap.String("endpoint", active), zap.Error(err))
+		}
+	}
+	return true
+}
+
+// endpointIndex returns the index of the endpoint or -1 if it isn't one of the endpoints
+func endpointIndex(endpoints []opamp.EndpointConfig, endpoint string) int {
+	for i, e := range endpoints {
+		if e.Endpoint == endpoint {
+			return i
+		}
+	}
+	return -1
+}
+
+// connectionFailures returns the number of failed attempts to connect that led to the state
+func (c *Client) connectionFailures(state opamp.ConnectionState) int64 {
+	c.connMux.Lock()
+	defer c.connMux.Unlock()
+	return c.connFailures[state]
+}
+
+// connectFailureState returns whether a failed attempt to connect was rejected for its credentials or couldn't reach the server.
+// The OpAMP client doesn't report the response to a failed handshake so the server is asked again for it.
+func connectFailureState(settings types.StartSettings, err error) opamp.ConnectionState {
+	if !errors.Is(err, websocket.ErrBadHandshake) {
+		return opamp.ConnectionStateBackoff
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), connectionSettingsTimeout)
+	defer cancel()
+
+	switch statusCode, _ := dialServer(ctx, settings); statusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return opamp.ConnectionStateAuthFailed
+	default:
+		return opamp.ConnectionStateBackoff
+	}
+}
+
+// newConnectionMetrics creates the metrics describing the connection to the server.
+// They're reported with the collector's own metrics.
+func (c *Client) newConnectionMetrics() (*metric.Registry, error) {
+	registry := metric.NewRegistry()
+
+	stateGauge, err := registry.AddInt64DerivedGauge("opamp/connection_state",
+		metric.WithDescription("Whether the connection to the OpAMP server is in the state"),
+		metric.WithLabelKeys("state"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create connection state metric: %w", err)
+	}
+
+	for _, state := range opamp.ConnectionStates {
+		state := state
+		inState := func() int64 {
+			if c.ConnectionStatus().State == state {
+				return 1
+			}
+			return 0
+		}
+		if err := stateGauge.UpsertEntry(inState, metricdata.NewLabelValue(string(state))); err != nil {
+			return nil, fmt.Errorf("failed to create connection state metric: %w", err)
+		}
+	}
+
+	failures, err := registry.AddInt64DerivedCumulative("opamp/connection_failures",
+		metric.WithDescription("Failed attempts to connect to the OpAMP server"),
+		metric.WithLabelKeys("reason"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create connection failures metric: %w", err)
+	}
+
+	for state, reason := range failureReasons {
+		state := state
+		count := func() int64 { return c.connectionFailures(state) }
+		if err := failures.UpsertEntry(count, metricdata.NewLabelValue(reason)); err != nil {
+			return nil, fmt.Errorf("failed to create connection failures metric: %w", err)
+		}
+	}
+
+	return registry, nil
+}
@@ -0,0 +1,403 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package observiq
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/observiq/observiq-otel-collector/opamp"
+	"github.com/open-telemetry/opamp-go/client/types"
+	"github.com/open-telemetry/opamp-go/protobufs"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// secretKeyAuthPrefix is the prefix of the Authorization header value containing the secret key
+const secretKeyAuthPrefix = "Secret-Key "
+
+var (
+	// connectionSettingsTimeout is how long new connection settings have to connect before being reverted
+	connectionSettingsTimeout = 30 * time.Second
+
+	// errUnsupportedAuthorization is returned when the offered Authorization header is not a secret key
+	errUnsupportedAuthorization = errors.New("only Secret-Key authorization is supported")
+
+	// errClientDisconnected is returned when connection settings are switched after disconnecting
+	errClientDisconnected = errors.New("client is disconnected")
+)
+
+// onOpampConnectionSettingsHandler is called when the server offers new OpAMP connection settings.
+// The offer is converted into a new config and tested. Returning an error rejects the offer.
+func (c *Client) onOpampConnectionSettingsHandler(ctx context.Context, settings *protobufs.OpAMPConnectionSettings) error {
+	c.getLogger().Info("Received OpAMP connection settings offer")
+
+	newConfig, err := c.configFromConnectionSettings(settings)
+	if err != nil {
+		c.getLogger().Error("Rejecting invalid OpAMP connection settings", zap.Error(err))
+		return err
+	}
+
+	if err := c.testConnectionSettings(ctx, *newConfig); err != nil {
+		c.getLogger().Error("Rejecting OpAMP connection settings that failed to connect", zap.Error(err))
+		c.removeUnusedCertFiles(*newConfig)
+		return err
+	}
+
+	c.connSettingsMux.Lock()
+	c.pendingConnSettings = newConfig
+	c.connSettingsMux.Unlock()
+
+	return nil
+}
+
+// onOpampConnectionSettingsAcceptedHandler is called once an offer has been accepted.
+// The new settings are persisted and the OpAMP client reconnects using them.
+func (c *Client) onOpampConnectionSettingsAcceptedHandler(_ *protobufs.OpAMPConnectionSettings) {
+	c.connSettingsMux.Lock()
+	newConfig := c.pendingConnSettings
+	c.pendingConnSettings = nil
+	c.connSettingsMux.Unlock()
+
+	if newConfig == nil {
+		c.getLogger().Warn("Connection settings accepted without a tested offer, ignoring")
+		return
+	}
+
+	// The OpAMP client can't be stopped from within one of its callbacks so switch in the background
+	go func() {
+		if err := c.switchConnectionSettings(*newConfig); err != nil {
+			c.getLogger().Error("Failed to switch OpAMP connection settings", zap.Error(err))
+		}
+	}()
+}
+
+// configFromConnectionSettings creates a new config by applying the offered settings to the current config
+func (c *Client) configFromConnectionSettings(settings *protobufs.OpAMPConnectionSettings) (*opamp.Config, error) {
+	currentConfig := c.getCurrentConfig()
+	newConfig := currentConfig.Copy()
+
+	if endpoint := settings.GetDestinationEndpoint(); endpoint != "" {
+		if err := validateEndpoint(endpoint); err != nil {
+			return nil, fmt.Errorf("invalid endpoint %s: %w", endpoint, err)
+		}
+		newConfig.Endpoint = endpoint
+	}
+
+	// Offered headers replace the current headers rather than adding to them
+	if settings.GetHeaders() != nil {
+		newConfig.Headers = nil
+	}
+
+	for _, header := range settings.GetHeaders().GetHeaders() {
+		// The secret key is sent in the Authorization header so store it as the secret key
+		if strings.EqualFold(header.GetKey(), "Authorization") {
+			if !strings.HasPrefix(header.GetValue(), secretKeyAuthPrefix) {
+				return nil, errUnsupportedAuthorization
+			}
+
+			secretKey := strings.TrimPrefix(header.GetValue(), secretKeyAuthPrefix)
+			newConfig.SecretKey = &secretKey
+			continue
+		}
+
+		if newConfig.Headers == nil {
+			newConfig.Headers = make(map[string]string)
+		}
+		newConfig.Headers[header.GetKey()] = header.GetValue()
+	}
+
+	if certificate := settings.GetCertificate(); certificate != nil {
+		if err := c.applyCertificate(newConfig, certificate); err != nil {
+			return nil, fmt.Errorf("invalid certificate: %w", err)
+		}
+	}
+
+	return newConfig, nil
+}
+
+// applyCertificate validates the offered certificate, writes it next to the manager config, and points the TLS config at it
+func (c *Client) applyCertificate(cfg *opamp.Config, certificate *protobufs.TLSCertificate) error {
+	publicKey, privateKey, caPublicKey := certificate.GetPublicKey(), certificate.GetPrivateKey(), certificate.GetCaPublicKey()
+
+	// A certificate signed for a pending enrollment is offered without the private key
+	if len(publicKey) > 0 && len(privateKey) == 0 {
+		privateKey = c.enrollmentKeyFor(publicKey)
+	}
+
+	// Validate everything before writing any files
+	hasKeyPair := len(publicKey) > 0 || len(privateKey) > 0
+	if hasKeyPair {
+		if _, err := tls.X509KeyPair(publicKey, privateKey); err != nil {
+			return fmt.Errorf("failed to parse key pair: %w", err)
+		}
+	}
+
+	if len(caPublicKey) > 0 {
+		if ok := x509.NewCertPool().AppendCertsFromPEM(caPublicKey); !ok {
+			return errors.New("failed to parse CA certificate")
+		}
+	}
+
+	if cfg.TLS == nil {
+		cfg.TLS = &opamp.TLSConfig{}
+	}
+
+	if hasKeyPair {
+		certFile, err := c.writeCertFile(publicKey, "crt")
+		if err != nil {
+			return err
+		}
+
+		keyFile, err := c.writeCertFile(privateKey, "key")
+		if err != nil {
+			return err
+		}
+
+		cfg.TLS.CertFile = &certFile
+		cfg.TLS.KeyFile = &keyFile
+	}
+
+	if len(caPublicKey) > 0 {
+		caFile, err := c.writeCertFile(caPublicKey, "ca.crt")
+		if err != nil {
+			return err
+		}
+
+		cfg.TLS.CAFile = &caFile
+	}
+
+	return nil
+}
+
+// writeCertFile writes the contents to a file in the manager config directory named after the hash of its contents.
+// Naming the file by its hash ensures files used by the current config are never overwritten.
+func (c *Client) writeCertFile(contents []byte, extension string) (string, error) {
+	fileName := fmt.Sprintf("opamp-%x.%s", opamp.ComputeHash(contents)[:8], extension)
+	filePath := filepath.Join(filepath.Dir(c.managerConfigPath), fileName)
+
+	if err := opamp.WriteFileAtomic(filePath, contents, 0600); err != nil {
+		return "", fmt.Errorf("failed to write certificate file %s: %w", fileName, err)
+	}
+
+	return filePath, nil
+}
+
+// removeUnusedCertFiles removes certificate files referenced by the config that aren't in use by the current config
+func (c *Client) removeUnusedCertFiles(cfg opamp.Config) {
+	if cfg.TLS == nil {
+		return
+	}
+
+	inUse := make(map[string]struct{})
+	if currentConfig := c.getCurrentConfig(); currentConfig.TLS != nil {
+		for _, file := range []*string{currentConfig.TLS.CertFile, currentConfig.TLS.KeyFile, currentConfig.TLS.CAFile} {
+			if file != nil {
+				inUse[*file] = struct{}{}
+			}
+		}
+	}
+
+	for _, file := range []*string{cfg.TLS.CertFile, cfg.TLS.KeyFile, cfg.TLS.CAFile} {
+		if file == nil {
+			continue
+		}
+
+		if _, ok := inUse[*file]; ok {
+			continue
+		}
+
+		if err := os.Remove(*file); err != nil && !errors.Is(err, os.ErrNotExist) {
+			c.getLogger().Warn("Failed to remove unused certificate file", zap.String("file", *file), zap.Error(err))
+		}
+	}
+}
+
+// testConnectionSettings verifies the server can be reached with the new config by opening and closing a websocket connection
+func (c *Client) testConnectionSettings(ctx context.Context, cfg opamp.Config) error {
+	settings, err := c.startSettings(cfg)
+	if err != nil {
+		return err
+	}
+
+	if _, err := dialServer(ctx, settings); err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", cfg.Endpoint, err)
+	}
+	return nil
+}
+
+// dialServer opens and closes a websocket connection to the server the same way the OpAMP client would.
+// The status code of the server's response is returned even if the handshake fails.
+func dialServer(ctx context.Context, settings types.StartSettings) (int, error) {
+	serverURL, err := url.Parse(settings.OpAMPServerURL)
+	if err != nil {
+		return 0, err
+	}
+
+	// Match the OpAMP client which always uses a secure websocket when TLS is configured
+	if settings.TLSConfig != nil {
+		serverURL.Scheme = "wss"
+	}
+
+	dialer := websocket.Dialer{
+		TLSClientConfig:  settings.TLSConfig,
+		HandshakeTimeout: connectionSettingsTimeout,
+	}
+
+	var statusCode int
+	conn, resp, err := dialer.DialContext(ctx, serverURL.String(), settings.Header)
+	if resp != nil {
+		statusCode = resp.StatusCode
+		if resp.Body != nil {
+			_ = resp.Body.Close()
+		}
+	}
+	if err != nil {
+		return statusCode, err
+	}
+
+	return statusCode, conn.Close()
+}
+
+// switchConnectionSettings persists the new config to the manager config and reconnects using it.
+// If the client is unable to connect with the new config the original config is restored.
+func (c *Client) switchConnectionSettings(newConfig opamp.Config) error {
+	c.applyMux.Lock()
+	defer c.applyMux.Unlock()
+
+	rollbackFunc, cleanupFunc, err := prepRollback(c.managerConfigPath)
+	if err != nil {
+		return fmt.Errorf("failed to prep for rollback: %w", err)
+	}
+
+	defer func() {
+		// Cleanup rollback
+		if err := cleanupFunc(); err != nil {
+			c.getLogger().Warn("Failed to cleanup rollback file", zap.Error(err))
+		}
+	}()
+
+	newContents, err := yaml.Marshal(newConfig)
+	if err != nil {
+		return fmt.Errorf("failed to reformat manager config: %w", err)
+	}
+
+	if err := updateConfigFile(ManagerConfigName, c.managerConfigPath, newContents); err != nil {
+		if rollbackErr := rollbackFunc(); rollbackErr != nil {
+			c.getLogger().Error("Rollback failed for manager config", zap.Error(rollbackErr))
+		}
+		return err
+	}
+	c.recomputeManagerConfigHash()
+
+	if err := c.restartOpAMPClient(newConfig, true); err != nil {
+		c.getLogger().Error("Failed to connect with new connection settings, reverting", zap.Error(err))
+
+		if rollbackErr := rollbackFunc(); rollbackErr != nil {
+			c.getLogger().Error("Rollback failed for manager config", zap.Error(rollbackErr))
+		}
+		c.recomputeManagerConfigHash()
+
+		// Reconnect with the original config
+		if restartErr := c.restartOpAMPClient(c.getCurrentConfig(), false); restartErr != nil {
+			c.getLogger().Error("Failed to reconnect with original connection settings", zap.Error(restartErr))
+		}
+
+		c.removeUnusedCertFiles(newConfig)
+		return fmt.Errorf("failed to connect with new connection settings: %w", err)
+	}
+
+	c.setCurrentConfig(newConfig, nil)
+	c.getLogger().Info("Switched to new OpAMP connection settings", zap.String("endpoint", newConfig.Endpoint))
+
+	// Stop requesting a certificate once an enrolled one is in use
+	c.checkEnrollment()
+
+	if managedConfig, ok := c.configManager.GetConfig(ManagerConfigName); ok {
+		if _, err := managedConfig.RecordHistory(opamp.OriginRemote); err != nil {
+			c.getLogger().Warn("Failed to record manager config history", zap.Error(err))
+		}
+	}
+
+	c.opampMux.Lock()
+	defer c.opampMux.Unlock()
+	if err := c.opampClient.UpdateEffectiveConfig(context.Background()); err != nil {
+		return fmt.Errorf("failed to update effective config: %w", err)
+	}
+
+	return nil
+}
+
+// recomputeManagerConfigHash updates the managed manager config after the file was changed outside of a reload
+func (c *Client) recomputeManagerConfigHash() {
+	managedConfig, ok := c.configManager.GetConfig(ManagerConfigName)
+	if !ok {
+		return
+	}
+
+	if err := managedConfig.ComputeConfigHash(); err != nil {
+		c.getLogger().Error("Failed to compute hash for manager config", zap.Error(err))
+	}
+}
+
+// restartOpAMPClient stops the current OpAMP client and starts a new one with the given config.
+// If waitForConnect is true this blocks until the new client connects or the connection settings timeout expires.
+func (c *Client) restartOpAMPClient(cfg opamp.Config, waitForConnect bool) error {
+	settings, err := c.startSettings(cfg)
+	if err != nil {
+		return err
+	}
+
+	// Wrap the connect callback so we know when the new client has connected
+	connected := make(chan struct{})
+	var connectedOnce sync.Once
+	callbacks, _ := settings.Callbacks.(types.CallbacksStruct)
+	callbacks.OnConnectFunc = func() {
+		c.onConnectHandler()
+		connectedOnce.Do(func() { close(connected) })
+	}
+	settings.Callbacks = callbacks
+
+	c.opampMux.Lock()
+	err = c.startNewOpAMPClient(settings)
+	c.opampMux.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if !waitForConnect {
+		return nil
+	}
+
+	timer := time.NewTimer(connectionSettingsTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-connected:
+		return nil
+	case <-timer.C:
+		return fmt.Errorf("timed out connecting to %s", cfg.Endpoint)
+	}
+}
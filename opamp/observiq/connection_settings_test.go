@@ -0,0 +1,485 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package observiq
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/observiq/observiq-otel-collector/opamp"
+	"github.com/observiq/observiq-otel-collector/opamp/mocks"
+	"github.com/open-telemetry/opamp-go/client"
+	"github.com/open-telemetry/opamp-go/client/types"
+	"github.com/open-telemetry/opamp-go/protobufs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+func TestClient_configFromConnectionSettings(t *testing.T) {
+	secretKey := "136bdd08-2074-40b7-ac1c-6706ac24c4f2"
+	currConfig := opamp.Config{
+		Endpoint:  "ws://localhost:1234",
+		AgentID:   "d4691426-b0bb-41f7-84a8-320a9ec0ea2e",
+		SecretKey: &secretKey,
+	}
+
+	certContents, err := os.ReadFile(filepath.Join("..", "testdata", "test.crt"))
+	require.NoError(t, err)
+	keyContents, err := os.ReadFile(filepath.Join("..", "testdata", "test.key"))
+	require.NoError(t, err)
+	caContents, err := os.ReadFile(filepath.Join("..", "testdata", "test-ca.crt"))
+	require.NoError(t, err)
+
+	testCases := []struct {
+		desc     string
+		testFunc func(*testing.T)
+	}{
+		{
+			desc: "New endpoint",
+			testFunc: func(t *testing.T) {
+				c := &Client{currentConfig: currConfig}
+
+				newConfig, err := c.configFromConnectionSettings(&protobufs.OpAMPConnectionSettings{
+					DestinationEndpoint: "wss://new.localnet:443/v1/opamp",
+				})
+				require.NoError(t, err)
+				assert.Equal(t, "wss://new.localnet:443/v1/opamp", newConfig.Endpoint)
+				assert.Equal(t, currConfig.AgentID, newConfig.AgentID)
+				assert.Equal(t, currConfig.SecretKey, newConfig.SecretKey)
+
+				// Current config is untouched
+				assert.Equal(t, "ws://localhost:1234", c.currentConfig.Endpoint)
+			},
+		},
+		{
+			desc: "Unsupported endpoint scheme",
+			testFunc: func(t *testing.T) {
+				c := &Client{currentConfig: currConfig}
+
+				newConfig, err := c.configFromConnectionSettings(&protobufs.OpAMPConnectionSettings{
+					DestinationEndpoint: "http://new.localnet:80",
+				})
+				assert.ErrorIs(t, err, ErrUnsupportedURL)
+				assert.Nil(t, newConfig)
+			},
+		},
+		{
+			desc: "Secret key and additional headers",
+			testFunc: func(t *testing.T) {
+				c := &Client{currentConfig: currConfig}
+
+				newConfig, err := c.configFromConnectionSettings(&protobufs.OpAMPConnectionSettings{
+					Headers: &protobufs.Headers{
+						Headers: []*protobufs.Header{
+							{Key: "Authorization", Value: "Secret-Key new-secret"},
+							{Key: "X-Tenant", Value: "my-tenant"},
+						},
+					},
+				})
+				require.NoError(t, err)
+				assert.Equal(t, "new-secret", newConfig.GetSecretKey())
+				assert.Equal(t, map[string]string{"X-Tenant": "my-tenant"}, newConfig.Headers)
+			},
+		},
+		{
+			desc: "Offered headers replace current headers",
+			testFunc: func(t *testing.T) {
+				cfg := currConfig
+				cfg.Headers = map[string]string{"X-Tenant": "old-tenant", "X-Removed": "removed"}
+				c := &Client{currentConfig: cfg}
+
+				newConfig, err := c.configFromConnectionSettings(&protobufs.OpAMPConnectionSettings{
+					Headers: &protobufs.Headers{
+						Headers: []*protobufs.Header{
+							{Key: "X-Tenant", Value: "my-tenant"},
+						},
+					},
+				})
+				require.NoError(t, err)
+				assert.Equal(t, map[string]string{"X-Tenant": "my-tenant"}, newConfig.Headers)
+
+				// An offer without headers keeps the current headers
+				newConfig, err = c.configFromConnectionSettings(&protobufs.OpAMPConnectionSettings{
+					DestinationEndpoint: "wss://new.localnet:443/v1/opamp",
+				})
+				require.NoError(t, err)
+				assert.Equal(t, cfg.Headers, newConfig.Headers)
+			},
+		},
+		{
+			desc: "Unsupported authorization",
+			testFunc: func(t *testing.T) {
+				c := &Client{currentConfig: currConfig}
+
+				newConfig, err := c.configFromConnectionSettings(&protobufs.OpAMPConnectionSettings{
+					Headers: &protobufs.Headers{
+						Headers: []*protobufs.Header{
+							{Key: "Authorization", Value: "Bearer token"},
+						},
+					},
+				})
+				assert.ErrorIs(t, err, errUnsupportedAuthorization)
+				assert.Nil(t, newConfig)
+			},
+		},
+		{
+			desc: "Certificates written next to manager config",
+			testFunc: func(t *testing.T) {
+				tmpDir := t.TempDir()
+				c := &Client{
+					currentConfig:     currConfig,
+					managerConfigPath: filepath.Join(tmpDir, ManagerConfigName),
+				}
+
+				newConfig, err := c.configFromConnectionSettings(&protobufs.OpAMPConnectionSettings{
+					Certificate: &protobufs.TLSCertificate{
+						PublicKey:   certContents,
+						PrivateKey:  keyContents,
+						CaPublicKey: caContents,
+					},
+				})
+				require.NoError(t, err)
+				require.NotNil(t, newConfig.TLS)
+
+				for file, expected := range map[*string][]byte{
+					newConfig.TLS.CertFile: certContents,
+					newConfig.TLS.KeyFile:  keyContents,
+					newConfig.TLS.CAFile:   caContents,
+				} {
+					require.NotNil(t, file)
+					assert.Equal(t, tmpDir, filepath.Dir(*file))
+
+					data, err := os.ReadFile(*file)
+					require.NoError(t, err)
+					assert.Equal(t, expected, data)
+				}
+
+				// Files are usable by the config
+				_, err = newConfig.ToTLS()
+				assert.NoError(t, err)
+			},
+		},
+		{
+			desc: "Invalid key pair",
+			testFunc: func(t *testing.T) {
+				tmpDir := t.TempDir()
+				c := &Client{
+					currentConfig:     currConfig,
+					managerConfigPath: filepath.Join(tmpDir, ManagerConfigName),
+				}
+
+				newConfig, err := c.configFromConnectionSettings(&protobufs.OpAMPConnectionSettings{
+					Certificate: &protobufs.TLSCertificate{
+						PublicKey: certContents,
+					},
+				})
+				assert.ErrorContains(t, err, "failed to parse key pair")
+				assert.Nil(t, newConfig)
+
+				// Nothing should have been written
+				entries, err := os.ReadDir(tmpDir)
+				require.NoError(t, err)
+				assert.Len(t, entries, 0)
+			},
+		},
+		{
+			desc: "Invalid CA",
+			testFunc: func(t *testing.T) {
+				c := &Client{currentConfig: currConfig}
+
+				newConfig, err := c.configFromConnectionSettings(&protobufs.OpAMPConnectionSettings{
+					Certificate: &protobufs.TLSCertificate{
+						CaPublicKey: []byte("not a cert"),
+					},
+				})
+				assert.ErrorContains(t, err, "failed to parse CA certificate")
+				assert.Nil(t, newConfig)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, tc.testFunc)
+	}
+}
+
+func TestClient_onOpampConnectionSettingsHandler(t *testing.T) {
+	secretKey := "136bdd08-2074-40b7-ac1c-6706ac24c4f2"
+	server := newTestWebsocketServer(t, "new-secret")
+
+	testCases := []struct {
+		desc     string
+		testFunc func(*testing.T)
+	}{
+		{
+			desc: "Offer connects successfully",
+			testFunc: func(t *testing.T) {
+				c := &Client{
+					logger: zap.NewNop(),
+					ident:  &identity{agentID: "d4691426-b0bb-41f7-84a8-320a9ec0ea2e"},
+					currentConfig: opamp.Config{
+						Endpoint:  "ws://localhost:1234",
+						SecretKey: &secretKey,
+					},
+				}
+
+				err := c.onOpampConnectionSettingsHandler(context.Background(), &protobufs.OpAMPConnectionSettings{
+					DestinationEndpoint: server,
+					Headers: &protobufs.Headers{
+						Headers: []*protobufs.Header{
+							{Key: "Authorization", Value: "Secret-Key new-secret"},
+						},
+					},
+				})
+				require.NoError(t, err)
+				require.NotNil(t, c.pendingConnSettings)
+				assert.Equal(t, server, c.pendingConnSettings.Endpoint)
+				assert.Equal(t, "new-secret", c.pendingConnSettings.GetSecretKey())
+			},
+		},
+		{
+			desc: "Offer fails to connect",
+			testFunc: func(t *testing.T) {
+				c := &Client{
+					logger: zap.NewNop(),
+					ident:  &identity{agentID: "d4691426-b0bb-41f7-84a8-320a9ec0ea2e"},
+					currentConfig: opamp.Config{
+						Endpoint:  "ws://localhost:1234",
+						SecretKey: &secretKey,
+					},
+				}
+
+				// Server rejects the current secret key
+				err := c.onOpampConnectionSettingsHandler(context.Background(), &protobufs.OpAMPConnectionSettings{
+					DestinationEndpoint: server,
+				})
+				assert.ErrorContains(t, err, "failed to connect")
+				assert.Nil(t, c.pendingConnSettings)
+			},
+		},
+		{
+			desc: "Invalid offer",
+			testFunc: func(t *testing.T) {
+				c := &Client{
+					logger: zap.NewNop(),
+					currentConfig: opamp.Config{
+						Endpoint: "ws://localhost:1234",
+					},
+				}
+
+				err := c.onOpampConnectionSettingsHandler(context.Background(), &protobufs.OpAMPConnectionSettings{
+					DestinationEndpoint: "ftp://localhost:1234",
+				})
+				assert.ErrorIs(t, err, ErrUnsupportedURL)
+				assert.Nil(t, c.pendingConnSettings)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, tc.testFunc)
+	}
+}
+
+func TestClient_switchConnectionSettings(t *testing.T) {
+	// Shorten the timeout so failures don't take long
+	originalTimeout := connectionSettingsTimeout
+	connectionSettingsTimeout = 100 * time.Millisecond
+	t.Cleanup(func() { connectionSettingsTimeout = originalTimeout })
+
+	currConfig := opamp.Config{
+		Endpoint: "ws://localhost:1234",
+		AgentID:  "d4691426-b0bb-41f7-84a8-320a9ec0ea2e",
+	}
+
+	testCases := []struct {
+		desc     string
+		testFunc func(*testing.T)
+	}{
+		{
+			desc: "New settings connect",
+			testFunc: func(t *testing.T) {
+				managerFilePath, managedConfig := writeManagerConfig(t, currConfig)
+
+				oldClient := mocks.NewMockOpAMPClient(t)
+				oldClient.On("Stop", mock.Anything).Return(nil)
+
+				newClient := mocks.NewMockOpAMPClient(t)
+				newClient.On("SetAgentDescription", mock.Anything).Return(nil)
+				newClient.On("UpdateEffectiveConfig", mock.Anything).Return(nil)
+				newClient.On("Start", mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+					settings := args.Get(1).(types.StartSettings)
+					assert.Equal(t, "ws://new.localnet:1234", settings.OpAMPServerURL)
+					settings.Callbacks.OnConnect()
+				})
+				setNewOpAMPClient(t, newClient)
+
+				c := newSwitchTestClient(t, oldClient, currConfig, managerFilePath, managedConfig)
+
+				newConfig := currConfig.Copy()
+				newConfig.Endpoint = "ws://new.localnet:1234"
+
+				err := c.switchConnectionSettings(*newConfig)
+				require.NoError(t, err)
+
+				assert.Equal(t, *newConfig, c.currentConfig)
+				assert.Equal(t, newClient, c.opampClient)
+
+				// New settings persisted and tracked
+				data, err := os.ReadFile(managerFilePath)
+				require.NoError(t, err)
+				var persisted opamp.Config
+				require.NoError(t, yaml.Unmarshal(data, &persisted))
+				assert.Equal(t, "ws://new.localnet:1234", persisted.Endpoint)
+				assert.Equal(t, opamp.ComputeHash(data), managedConfig.GetCurrentConfigHash())
+			},
+		},
+		{
+			desc: "New settings fail to connect, rollback",
+			testFunc: func(t *testing.T) {
+				managerFilePath, managedConfig := writeManagerConfig(t, currConfig)
+				origContents, err := os.ReadFile(managerFilePath)
+				require.NoError(t, err)
+
+				oldClient := mocks.NewMockOpAMPClient(t)
+				oldClient.On("Stop", mock.Anything).Return(nil)
+
+				// New client never connects, then the rollback client is started
+				newClient := mocks.NewMockOpAMPClient(t)
+				newClient.On("SetAgentDescription", mock.Anything).Return(nil)
+				newClient.On("Stop", mock.Anything).Return(nil)
+				newClient.On("Start", mock.Anything, mock.Anything).Return(nil).Once()
+
+				rollbackClient := mocks.NewMockOpAMPClient(t)
+				rollbackClient.On("SetAgentDescription", mock.Anything).Return(nil)
+				rollbackClient.On("Start", mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+					settings := args.Get(1).(types.StartSettings)
+					assert.Equal(t, currConfig.Endpoint, settings.OpAMPServerURL)
+				})
+				setNewOpAMPClient(t, newClient, rollbackClient)
+
+				c := newSwitchTestClient(t, oldClient, currConfig, managerFilePath, managedConfig)
+
+				newConfig := currConfig.Copy()
+				newConfig.Endpoint = "ws://new.localnet:1234"
+
+				err = c.switchConnectionSettings(*newConfig)
+				assert.ErrorContains(t, err, "failed to connect with new connection settings")
+
+				assert.Equal(t, currConfig, c.currentConfig)
+				assert.Equal(t, rollbackClient, c.opampClient)
+
+				// Manager config rolled back
+				data, err := os.ReadFile(managerFilePath)
+				require.NoError(t, err)
+				assert.Equal(t, origContents, data)
+				assert.Equal(t, opamp.ComputeHash(origContents), managedConfig.GetCurrentConfigHash())
+			},
+		},
+		{
+			desc: "Client disconnected",
+			testFunc: func(t *testing.T) {
+				managerFilePath, managedConfig := writeManagerConfig(t, currConfig)
+
+				oldClient := mocks.NewMockOpAMPClient(t)
+				c := newSwitchTestClient(t, oldClient, currConfig, managerFilePath, managedConfig)
+				c.disconnected = true
+
+				newConfig := currConfig.Copy()
+				newConfig.Endpoint = "ws://new.localnet:1234"
+
+				err := c.switchConnectionSettings(*newConfig)
+				assert.ErrorIs(t, err, errClientDisconnected)
+				assert.Equal(t, currConfig, c.currentConfig)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, tc.testFunc)
+	}
+}
+
+// newTestWebsocketServer starts a websocket server that only accepts connections with the secret key
+func newTestWebsocketServer(t *testing.T, secretKey string) string {
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != secretKeyAuthPrefix+secretKey {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		_ = conn.Close()
+	}))
+	t.Cleanup(server.Close)
+
+	return strings.Replace(server.URL, "http://", "ws://", 1)
+}
+
+// writeManagerConfig writes the config to a manager config in a temp directory and returns a managed config for it
+func writeManagerConfig(t *testing.T, cfg opamp.Config) (string, *opamp.ManagedConfig) {
+	managerFilePath := filepath.Join(t.TempDir(), ManagerConfigName)
+
+	contents, err := yaml.Marshal(cfg)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(managerFilePath, contents, 0600))
+
+	managedConfig, err := opamp.NewManagedConfig(managerFilePath, opamp.NoopReloadFunc)
+	require.NoError(t, err)
+
+	return managerFilePath, managedConfig
+}
+
+// newSwitchTestClient creates a client that tracks the managed manager config
+func newSwitchTestClient(t *testing.T, opampClient client.OpAMPClient, cfg opamp.Config, managerFilePath string, managedConfig *opamp.ManagedConfig) *Client {
+	configManager := NewAgentConfigManager(zap.NewNop())
+	configManager.AddConfig(ManagerConfigName, managedConfig)
+
+	return &Client{
+		opampClient:       opampClient,
+		logger:            zap.NewNop(),
+		ident:             newIdentity(zap.NewNop(), cfg),
+		configManager:     configManager,
+		currentConfig:     cfg,
+		managerConfigPath: managerFilePath,
+	}
+}
+
+// setNewOpAMPClient replaces the OpAMP client constructor to return the clients in order
+func setNewOpAMPClient(t *testing.T, clients ...client.OpAMPClient) {
+	original := newOpAMPClient
+	t.Cleanup(func() { newOpAMPClient = original })
+
+	newOpAMPClient = func(*zap.Logger, string) (client.OpAMPClient, error) {
+		require.NotEmpty(t, clients)
+		next := clients[0]
+		clients = clients[1:]
+		return next, nil
+	}
+}
@@ -0,0 +1,587 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package observiq
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/observiq/observiq-otel-collector/opamp"
+	"github.com/observiq/observiq-otel-collector/opamp/mocks"
+	"github.com/open-telemetry/opamp-go/client/types"
+	"github.com/open-telemetry/opamp-go/protobufs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestClient_reconnect(t *testing.T) {
+	jitter := 0.0
+	currConfig := opamp.Config{
+		Endpoint: "ws://localhost:1234",
+		AgentID:  "d4691426-b0bb-41f7-84a8-320a9ec0ea2e",
+		Reconnect: &opamp.ReconnectConfig{
+			InitialInterval: 10 * time.Millisecond,
+			MaxInterval:     20 * time.Millisecond,
+			Jitter:          &jitter,
+		},
+	}
+
+	// startTracked starts the client and returns the callbacks it was started with
+	startTracked := func(t *testing.T, c *Client) types.Callbacks {
+		var callbacks types.Callbacks
+		mockOpAmpClient := c.opampClient.(*mocks.MockOpAMPClient)
+		mockOpAmpClient.On("Start", mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+			callbacks = args.Get(1).(types.StartSettings).Callbacks
+		}).Once()
+
+		settings, err := c.startSettings(c.getCurrentConfig())
+		require.NoError(t, err)
+
+		c.opampMux.Lock()
+		err = c.startOpAMPClient(context.Background(), c.opampClient, settings)
+		c.opampMux.Unlock()
+		require.NoError(t, err)
+
+		assert.Equal(t, opamp.ConnectionStateConnecting, c.ConnectionStatus().State)
+		return callbacks
+	}
+
+	testCases := []struct {
+		desc     string
+		testFunc func(*testing.T)
+	}{
+		{
+			desc: "Failed client is replaced after backing off",
+			testFunc: func(t *testing.T) {
+				oldClient := mocks.NewMockOpAMPClient(t)
+				oldClient.On("Stop", mock.Anything).Return(nil).Once()
+
+				var newCallbacks types.Callbacks
+				started := make(chan struct{})
+				newClient := mocks.NewMockOpAMPClient(t)
+				newClient.On("SetAgentDescription", mock.Anything).Return(nil)
+				newClient.On("Start", mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+					settings := args.Get(1).(types.StartSettings)
+					assert.Equal(t, currConfig.Endpoint, settings.OpAMPServerURL)
+					newCallbacks = settings.Callbacks
+					close(started)
+				})
+				setNewOpAMPClient(t, newClient)
+
+				c := newReconnectTestClient(oldClient, currConfig)
+				callbacks := startTracked(t, c)
+
+				callbacks.OnConnectFailed(errors.New("connection refused"))
+
+				select {
+				case <-started:
+				case <-time.After(5 * time.Second):
+					t.Fatal("new client was never started")
+				}
+
+				c.opampMux.Lock()
+				assert.Equal(t, newClient, c.opampClient)
+				c.opampMux.Unlock()
+
+				status := c.ConnectionStatus()
+				assert.Equal(t, opamp.ConnectionStateConnecting, status.State)
+				assert.Equal(t, 1, status.Attempts)
+				assert.Equal(t, "connection refused", status.LastError)
+				assert.Equal(t, int64(1), c.connectionFailures(opamp.ConnectionStateBackoff))
+
+				// The old client's callbacks no longer affect the status
+				callbacks.OnConnect()
+				assert.Equal(t, opamp.ConnectionStateConnecting, c.ConnectionStatus().State)
+
+				newCallbacks.OnConnect()
+				status = c.ConnectionStatus()
+				assert.Equal(t, opamp.ConnectionStateConnected, status.State)
+				assert.Equal(t, 0, status.Attempts)
+				assert.Empty(t, status.LastError)
+			},
+		},
+		{
+			desc: "Canceled attempts are ignored",
+			testFunc: func(t *testing.T) {
+				oldClient := mocks.NewMockOpAMPClient(t)
+				c := newReconnectTestClient(oldClient, currConfig)
+				callbacks := startTracked(t, c)
+
+				callbacks.OnConnectFailed(context.Canceled)
+				assert.Equal(t, opamp.ConnectionStateConnecting, c.ConnectionStatus().State)
+			},
+		},
+		{
+			desc: "Disconnect stops reconnecting",
+			testFunc: func(t *testing.T) {
+				blockingConfig := currConfig.Copy()
+				blockingConfig.Reconnect = &opamp.ReconnectConfig{InitialInterval: time.Hour, MaxInterval: time.Hour}
+
+				oldClient := mocks.NewMockOpAMPClient(t)
+				oldClient.On("Stop", mock.Anything).Return(nil).Once()
+
+				c := newReconnectTestClient(oldClient, *blockingConfig)
+				callbacks := startTracked(t, c)
+
+				callbacks.OnConnectFailed(errors.New("connection refused"))
+				require.Eventually(t, func() bool {
+					return c.ConnectionStatus().State == opamp.ConnectionStateBackoff
+				}, 5*time.Second, 10*time.Millisecond)
+
+				c.opampMux.Lock()
+				close(c.reconnectDone)
+				c.disconnected = true
+				c.opampMux.Unlock()
+
+				// No new client is created
+				setNewOpAMPClient(t)
+				c.reconnect(c.currentOpAMPClientGen(), errors.New("connection refused"))
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, tc.testFunc)
+	}
+}
+
+func TestClient_recordConnectFailure(t *testing.T) {
+	jitter := 0.0
+	cfg := opamp.Config{
+		Reconnect: &opamp.ReconnectConfig{
+			InitialInterval: time.Second,
+			MaxInterval:     4 * time.Second,
+			Multiplier:      2,
+			Jitter:          &jitter,
+		},
+	}
+	c := newReconnectTestClient(nil, cfg)
+
+	// Network failures back off up to the max interval
+	for _, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		delay := c.recordConnectFailure(opamp.ConnectionStateBackoff, errors.New("connection refused"))
+		assert.Equal(t, expected, delay)
+	}
+
+	// Auth failures always wait the max interval
+	delay := c.recordConnectFailure(opamp.ConnectionStateAuthFailed, websocket.ErrBadHandshake)
+	assert.Equal(t, 4*time.Second, delay)
+
+	status := c.ConnectionStatus()
+	assert.Equal(t, opamp.ConnectionStateAuthFailed, status.State)
+	assert.Equal(t, 5, status.Attempts)
+	assert.Equal(t, websocket.ErrBadHandshake.Error(), status.LastError)
+	assert.WithinDuration(t, time.Now().Add(4*time.Second), status.NextAttempt, time.Second)
+	assert.Equal(t, int64(4), c.connectionFailures(opamp.ConnectionStateBackoff))
+	assert.Equal(t, int64(1), c.connectionFailures(opamp.ConnectionStateAuthFailed))
+
+	// Connecting resets the backoff
+	c.onTrackedConnect(c.currentOpAMPClientGen())
+	delay = c.recordConnectFailure(opamp.ConnectionStateBackoff, errors.New("connection refused"))
+	assert.Equal(t, time.Second, delay)
+}
+
+func TestConnectFailureState(t *testing.T) {
+	secretKey := "b92222ee-a1fc-4bb1-98db-26de3448541b"
+	endpoint := newTestWebsocketServer(t, secretKey)
+
+	testCases := []struct {
+		desc     string
+		header   http.Header
+		err      error
+		expected opamp.ConnectionState
+	}{
+		{
+			desc:     "Network error",
+			err:      errors.New("dial tcp: connection refused"),
+			expected: opamp.ConnectionStateBackoff,
+		},
+		{
+			desc:     "Secret key rejected",
+			header:   http.Header{"Authorization": []string{secretKeyAuthPrefix + "wrong"}},
+			err:      websocket.ErrBadHandshake,
+			expected: opamp.ConnectionStateAuthFailed,
+		},
+		{
+			desc:     "Handshake failed for another reason",
+			header:   http.Header{"Authorization": []string{secretKeyAuthPrefix + secretKey}},
+			err:      websocket.ErrBadHandshake,
+			expected: opamp.ConnectionStateBackoff,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			settings := types.StartSettings{
+				OpAMPServerURL: endpoint,
+				Header:         tc.header,
+			}
+			assert.Equal(t, tc.expected, connectFailureState(settings, tc.err))
+		})
+	}
+}
+
+func TestClient_newConnectionMetrics(t *testing.T) {
+	c := newReconnectTestClient(nil, opamp.Config{})
+	c.recordConnectFailure(opamp.ConnectionStateAuthFailed, websocket.ErrBadHandshake)
+
+	registry, err := c.newConnectionMetrics()
+	require.NoError(t, err)
+
+	values := make(map[string]int64)
+	for _, metric := range registry.Read() {
+		for _, ts := range metric.TimeSeries {
+			require.Len(t, ts.LabelValues, 1)
+			require.Len(t, ts.Points, 1)
+			values[metric.Descriptor.Name+"/"+ts.LabelValues[0].Value] = ts.Points[0].Value.(int64)
+		}
+	}
+
+	assert.Equal(t, map[string]int64{
+		"opamp/connection_state/disconnected": 0,
+		"opamp/connection_state/connecting":   0,
+		"opamp/connection_state/connected":    0,
+		"opamp/connection_state/backoff":      0,
+		"opamp/connection_state/auth-failed":  1,
+		"opamp/connection_failures/network":   0,
+		"opamp/connection_failures/auth":      1,
+	}, values)
+}
+
+func TestClient_reconnectDuringApply(t *testing.T) {
+	jitter := 0.0
+	currConfig := opamp.Config{
+		Endpoint: "ws://localhost:1234",
+		AgentID:  "d4691426-b0bb-41f7-84a8-320a9ec0ea2e",
+		Reconnect: &opamp.ReconnectConfig{
+			InitialInterval: time.Millisecond,
+			MaxInterval:     time.Millisecond,
+			Jitter:          &jitter,
+		},
+	}
+
+	// startTracked starts the client and returns the callbacks it was started with
+	startTracked := func(t *testing.T, c *Client, opampClient *mocks.MockOpAMPClient) types.Callbacks {
+		var callbacks types.Callbacks
+		opampClient.On("Start", mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+			callbacks = args.Get(1).(types.StartSettings).Callbacks
+		}).Once()
+
+		settings, err := c.startSettings(c.getCurrentConfig())
+		require.NoError(t, err)
+
+		c.opampMux.Lock()
+		err = c.startOpAMPClient(context.Background(), opampClient, settings)
+		c.opampMux.Unlock()
+		require.NoError(t, err)
+		return callbacks
+	}
+
+	// newStartedClient returns a client that closes started when it's started
+	newStartedClient := func(t *testing.T, started chan struct{}) *mocks.MockOpAMPClient {
+		newClient := mocks.NewMockOpAMPClient(t)
+		newClient.On("SetAgentDescription", mock.Anything).Return(nil)
+		newClient.On("Start", mock.Anything, mock.Anything).Return(nil).Run(func(mock.Arguments) {
+			close(started)
+		})
+		return newClient
+	}
+
+	waitForStart := func(t *testing.T, started chan struct{}) {
+		select {
+		case <-started:
+		case <-time.After(5 * time.Second):
+			t.Fatal("new client was never started")
+		}
+	}
+
+	testCases := []struct {
+		desc     string
+		testFunc func(*testing.T)
+	}{
+		{
+			desc: "Status of an apply finished after reconnecting goes to the new client",
+			testFunc: func(t *testing.T) {
+				remoteConfig := &protobufs.AgentRemoteConfig{ConfigHash: []byte("hash")}
+
+				applying := make(chan struct{})
+				release := make(chan struct{})
+				mockManager := mocks.NewMockConfigManager(t)
+				mockManager.On("ApplyConfigChanges", mock.Anything, remoteConfig).Return(true, nil).Run(func(mock.Arguments) {
+					close(applying)
+					<-release
+				})
+				mockManager.On("GetConfig", CollectorConfigName).Return(nil, false)
+
+				oldClient := mocks.NewMockOpAMPClient(t)
+				oldClient.On("Stop", mock.Anything).Return(nil).Once()
+
+				started := make(chan struct{})
+				newClient := newStartedClient(t, started)
+				newClient.On("SetRemoteConfigStatus", mock.MatchedBy(func(status *protobufs.RemoteConfigStatus) bool {
+					return status.GetStatus() == protobufs.RemoteConfigStatus_APPLIED
+				})).Return(nil).Once()
+				newClient.On("UpdateEffectiveConfig", mock.Anything).Return(nil).Once()
+				setNewOpAMPClient(t, newClient)
+
+				c := newReconnectTestClient(oldClient, currConfig)
+				c.configManager = mockManager
+				callbacks := startTracked(t, c, oldClient)
+
+				applyErr := make(chan error, 1)
+				go func() { applyErr <- c.onRemoteConfigHandler(context.Background(), remoteConfig) }()
+				<-applying
+
+				callbacks.OnConnectFailed(errors.New("connection refused"))
+				waitForStart(t, started)
+
+				close(release)
+				require.NoError(t, <-applyErr)
+				assert.Equal(t, newClient, c.getOpAMPClient())
+			},
+		},
+		{
+			desc: "Status set before reconnecting is carried over to the new client",
+			testFunc: func(t *testing.T) {
+				status := &protobufs.RemoteConfigStatus{
+					LastRemoteConfigHash: []byte("hash"),
+					Status:               protobufs.RemoteConfigStatus_APPLYING,
+				}
+
+				oldClient := mocks.NewMockOpAMPClient(t)
+				oldClient.On("SetRemoteConfigStatus", status).Return(nil).Once()
+				oldClient.On("Stop", mock.Anything).Return(nil).Once()
+
+				started := make(chan struct{})
+				newClient := newStartedClient(t, started)
+				newClient.On("SetRemoteConfigStatus", status).Return(nil).Once()
+				setNewOpAMPClient(t, newClient)
+
+				c := newReconnectTestClient(oldClient, currConfig)
+				callbacks := startTracked(t, c, oldClient)
+
+				require.NoError(t, c.setRemoteConfigStatus(status))
+				callbacks.OnConnectFailed(errors.New("connection refused"))
+				waitForStart(t, started)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, tc.testFunc)
+	}
+}
+
+// newReconnectTestClient creates a client with the OpAMP client and config
+func newReconnectTestClient(opampClient *mocks.MockOpAMPClient, cfg opamp.Config) *Client {
+	c := &Client{
+		logger:        zap.NewNop(),
+		ident:         newIdentity(zap.NewNop(), cfg),
+		currentConfig: cfg,
+		reconnectDone: make(chan struct{}),
+	}
+	if opampClient != nil {
+		c.opampClient = opampClient
+	}
+	return c
+}
+
+func TestClient_failover(t *testing.T) {
+	jitter := 0.0
+	currConfig := opamp.Config{
+		Endpoint: "ws://primary.localnet:1234",
+		AgentID:  "d4691426-b0bb-41f7-84a8-320a9ec0ea2e",
+		FallbackEndpoints: []opamp.EndpointConfig{
+			{Endpoint: "ws://secondary.localnet:1234"},
+			{Endpoint: "ws://tertiary.localnet:1234"},
+		},
+		Failover: &opamp.FailoverConfig{MaxFailures: 2},
+		Reconnect: &opamp.ReconnectConfig{
+			InitialInterval: time.Millisecond,
+			MaxInterval:     time.Millisecond,
+			Jitter:          &jitter,
+		},
+	}
+
+	t.Run("Next endpoint after max failures", func(t *testing.T) {
+		c := newReconnectTestClient(nil, currConfig)
+		c.connStatus.Endpoint = "ws://tertiary.localnet:1234"
+
+		_, ok := c.nextEndpoint("ws://tertiary.localnet:1234")
+		assert.False(t, ok)
+
+		c.recordConnectFailure(opamp.ConnectionStateBackoff, errors.New("connection refused"))
+		_, ok = c.nextEndpoint("ws://tertiary.localnet:1234")
+		assert.False(t, ok)
+
+		c.recordConnectFailure(opamp.ConnectionStateBackoff, errors.New("connection refused"))
+		next, ok := c.nextEndpoint("ws://tertiary.localnet:1234")
+		require.True(t, ok)
+
+		// Wraps around to the first endpoint
+		assert.Equal(t, currConfig.Endpoint, next.Endpoint)
+
+		// Endpoints that aren't configured never fail over
+		_, ok = c.nextEndpoint("ws://offered.localnet:1234")
+		assert.False(t, ok)
+
+		status := c.ConnectionStatus()
+		require.Len(t, status.Endpoints, 3)
+		assert.Equal(t, currConfig.Endpoint, status.Endpoints[0].Endpoint)
+		assert.Equal(t, 0, status.Endpoints[0].ConsecutiveFailures)
+		assert.Equal(t, "ws://tertiary.localnet:1234", status.Endpoints[2].Endpoint)
+		assert.Equal(t, 2, status.Endpoints[2].ConsecutiveFailures)
+		assert.Equal(t, "connection refused", status.Endpoints[2].LastError)
+	})
+
+	t.Run("Fails over to next endpoint", func(t *testing.T) {
+		var endpoints []string
+		started := make(chan types.Callbacks, 3)
+		newClient := func() *mocks.MockOpAMPClient {
+			mockClient := mocks.NewMockOpAMPClient(t)
+			mockClient.On("SetAgentDescription", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+				desc := args.Get(0).(*protobufs.AgentDescription)
+				endpoints = append(endpoints, findAttribute(desc.GetNonIdentifyingAttributes(), endpointAttribute))
+			})
+			mockClient.On("Start", mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+				settings := args.Get(1).(types.StartSettings)
+				started <- settings.Callbacks
+			})
+			mockClient.On("Stop", mock.Anything).Return(nil).Maybe()
+			return mockClient
+		}
+		setNewOpAMPClient(t, newClient(), newClient(), newClient())
+
+		oldClient := mocks.NewMockOpAMPClient(t)
+		oldClient.On("Stop", mock.Anything).Return(nil)
+		c := newReconnectTestClient(oldClient, currConfig)
+
+		settings, err := c.startSettings(currConfig)
+		require.NoError(t, err)
+
+		c.opampMux.Lock()
+		require.NoError(t, c.startNewOpAMPClient(settings))
+		c.opampMux.Unlock()
+
+		waitStarted := func() types.Callbacks {
+			select {
+			case callbacks := <-started:
+				return callbacks
+			case <-time.After(5 * time.Second):
+				t.Fatal("client was never started")
+				return nil
+			}
+		}
+
+		// Two failures on the primary fail over to the secondary
+		callbacks := waitStarted()
+		callbacks.OnConnectFailed(errors.New("connection refused"))
+		callbacks = waitStarted()
+		callbacks.OnConnectFailed(errors.New("connection refused"))
+		callbacks = waitStarted()
+
+		assert.Equal(t, "ws://secondary.localnet:1234", c.activeEndpoint())
+		assert.Equal(t, []string{currConfig.Endpoint, currConfig.Endpoint, "ws://secondary.localnet:1234"}, endpoints)
+
+		callbacks.OnConnect()
+		status := c.ConnectionStatus()
+		assert.Equal(t, opamp.ConnectionStateConnected, status.State)
+		assert.Equal(t, "ws://secondary.localnet:1234", status.Endpoint)
+		assert.Equal(t, 2, status.Endpoints[0].ConsecutiveFailures)
+		assert.False(t, status.Endpoints[1].LastConnected.IsZero())
+
+		// Stop checking for failback
+		c.opampMux.Lock()
+		close(c.reconnectDone)
+		c.disconnected = true
+		c.opampMux.Unlock()
+	})
+}
+
+func TestClient_failback(t *testing.T) {
+	secretKey := "b92222ee-a1fc-4bb1-98db-26de3448541b"
+	primary := newTestWebsocketServer(t, secretKey)
+
+	currConfig := opamp.Config{
+		Endpoint:          primary,
+		SecretKey:         &secretKey,
+		AgentID:           "d4691426-b0bb-41f7-84a8-320a9ec0ea2e",
+		FallbackEndpoints: []opamp.EndpointConfig{{Endpoint: "ws://secondary.localnet:1234"}},
+		Failover:          &opamp.FailoverConfig{FailbackInterval: 10 * time.Millisecond},
+	}
+
+	fallbackClient := mocks.NewMockOpAMPClient(t)
+	fallbackClient.On("Stop", mock.Anything).Return(nil)
+
+	started := make(chan string, 1)
+	primaryClient := mocks.NewMockOpAMPClient(t)
+	primaryClient.On("SetAgentDescription", mock.Anything).Return(nil)
+	primaryClient.On("Start", mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		started <- args.Get(1).(types.StartSettings).OpAMPServerURL
+	})
+	setNewOpAMPClient(t, primaryClient)
+
+	c := newReconnectTestClient(fallbackClient, currConfig)
+	t.Cleanup(func() { close(c.reconnectDone) })
+
+	var callbacks types.Callbacks
+	fallbackClient.On("Start", mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		callbacks = args.Get(1).(types.StartSettings).Callbacks
+	}).Once()
+
+	settings, err := c.startSettings(*currConfig.WithEndpoint(currConfig.FallbackEndpoints[0]))
+	require.NoError(t, err)
+
+	c.opampMux.Lock()
+	require.NoError(t, c.startOpAMPClient(context.Background(), fallbackClient, settings))
+	c.opampMux.Unlock()
+
+	// Connecting to the fallback starts checking the primary
+	callbacks.OnConnect()
+
+	select {
+	case endpoint := <-started:
+		assert.Equal(t, primary, endpoint)
+	case <-time.After(5 * time.Second):
+		t.Fatal("never failed back to the primary endpoint")
+	}
+
+	assert.Equal(t, primary, c.activeEndpoint())
+}
+
+func TestAgentDescription(t *testing.T) {
+	ident := newIdentity(zap.NewNop(), opamp.Config{
+		AgentID: "d4691426-b0bb-41f7-84a8-320a9ec0ea2e",
+		Attributes: &opamp.AttributesConfig{
+			NonIdentifying: map[string]string{endpointAttribute: "ws://user.localnet:1234"},
+		},
+	})
+
+	desc := agentDescription(ident, "ws://secondary.localnet:1234")
+
+	var endpoints []string
+	for _, attribute := range desc.NonIdentifyingAttributes {
+		if attribute.GetKey() == endpointAttribute {
+			endpoints = append(endpoints, attribute.GetValue().GetStringValue())
+		}
+	}
+	assert.Equal(t, []string{"ws://secondary.localnet:1234"}, endpoints)
+}
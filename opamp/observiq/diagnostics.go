@@ -0,0 +1,386 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package observiq
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime/pprof"
+	"strings"
+	"time"
+
+	"github.com/observiq/observiq-otel-collector/internal/logging"
+	"github.com/observiq/observiq-otel-collector/opamp"
+	"github.com/open-telemetry/opamp-go/protobufs"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// DiagnosticsRequestConfigName is the name of the remote config the server requests diagnostics with
+	DiagnosticsRequestConfigName = "diagnostics.request"
+
+	// DiagnosticsConfigName is the name of the diagnostics reported in the effective config
+	DiagnosticsConfigName = "diagnostics.json"
+)
+
+// Profile types the server may request
+const (
+	profileCPU  = "cpu"
+	profileHeap = "heap"
+)
+
+// logFileOutput is the logging config output that writes the collector log to a file
+const logFileOutput = "file"
+
+// maxStatusTransitions is the number of connection status transitions kept for diagnostics
+const maxStatusTransitions = 20
+
+// errDiagnosticsDisabled is reported when the server requests diagnostics without them being enabled
+var errDiagnosticsDisabled = errors.New("diagnostics are not enabled in the manager config")
+
+// diagnosticsRequest is the body of the diagnostics request config.
+// Diagnostics are collected once for each ID, so the request can stay in the remote config.
+type diagnosticsRequest struct {
+	ID              string        `yaml:"id"`
+	LogLines        int           `yaml:"log_lines,omitempty"`
+	Profile         string        `yaml:"profile,omitempty"`
+	ProfileDuration time.Duration `yaml:"profile_duration,omitempty"`
+}
+
+// diagnostics are the results of a diagnostics request
+type diagnostics struct {
+	RequestID         string             `json:"request_id"`
+	CollectedAt       time.Time          `json:"collected_at"`
+	ConfigHashes      map[string]string  `json:"config_hashes,omitempty"`
+	StatusTransitions []statusTransition `json:"status_transitions,omitempty"`
+	LogLines          []string           `json:"log_lines,omitempty"`
+	Profile           *profile           `json:"profile,omitempty"`
+	Truncated         bool               `json:"truncated,omitempty"`
+	Errors            []string           `json:"errors,omitempty"`
+}
+
+// profile is a pprof profile of the collector
+type profile struct {
+	Type     string `json:"type"`
+	Duration string `json:"duration,omitempty"`
+	Data     []byte `json:"data"`
+}
+
+// statusTransition is a change in the state of the connection to the server
+type statusTransition struct {
+	Time     time.Time             `json:"time"`
+	State    opamp.ConnectionState `json:"state"`
+	Endpoint string                `json:"endpoint,omitempty"`
+	Error    string                `json:"error,omitempty"`
+}
+
+// recordStatusTransition keeps the most recent connection status transitions.
+// connMux must be held.
+func (c *Client) recordStatusTransition(status opamp.ConnectionStatus) {
+	c.statusTransitions = append(c.statusTransitions, statusTransition{
+		Time:     status.Since,
+		State:    status.State,
+		Endpoint: status.Endpoint,
+		Error:    status.LastError,
+	})
+
+	if len(c.statusTransitions) > maxStatusTransitions {
+		c.statusTransitions = append([]statusTransition{}, c.statusTransitions[len(c.statusTransitions)-maxStatusTransitions:]...)
+	}
+}
+
+// handleDiagnosticsRequest collects diagnostics in the background if the remote config requests them.
+// A remote config without a request discards diagnostics that haven't been reported yet.
+func (c *Client) handleDiagnosticsRequest(remoteConfig *protobufs.AgentRemoteConfig) {
+	requestFile, ok := remoteConfig.GetConfig().GetConfigMap()[DiagnosticsRequestConfigName]
+	if !ok {
+		c.diagMux.Lock()
+		c.diagRequestID, c.diagReport = "", nil
+		c.diagMux.Unlock()
+		return
+	}
+
+	var request diagnosticsRequest
+	if err := yaml.Unmarshal(requestFile.GetBody(), &request); err != nil {
+		c.getLogger().Error("Failed to parse diagnostics request", zap.Error(err))
+		return
+	}
+
+	c.diagMux.Lock()
+	defer c.diagMux.Unlock()
+	if c.diagRunning || request.ID == c.diagRequestID {
+		return
+	}
+	c.diagRequestID = request.ID
+	c.diagRunning = true
+
+	go func() {
+		report := c.collectDiagnostics(request, c.getCurrentConfig().Diagnostics, c.reconnectDone)
+
+		// The request may have been removed while collecting
+		c.diagMux.Lock()
+		current := c.diagRequestID == request.ID
+		if current {
+			c.diagReport = report
+		}
+		c.diagRunning = false
+		c.diagMux.Unlock()
+
+		if current {
+			c.reportEffectiveConfig("diagnostics")
+		}
+	}()
+}
+
+// collectDiagnostics collects the requested diagnostics and marshals them within the configured size limit.
+// done cancels a CPU profile in progress.
+func (c *Client) collectDiagnostics(request diagnosticsRequest, cfg *opamp.DiagnosticsConfig, done <-chan struct{}) []byte {
+	result := &diagnostics{
+		RequestID:   request.ID,
+		CollectedAt: time.Now(),
+	}
+
+	if !cfg.IsEnabled() {
+		c.getLogger().Warn("Ignoring diagnostics request", zap.Error(errDiagnosticsDisabled))
+		result.Errors = append(result.Errors, errDiagnosticsDisabled.Error())
+		return marshalDiagnostics(result, cfg.GetMaxSize())
+	}
+
+	c.getLogger().Info("Collecting diagnostics", zap.String("request_id", request.ID))
+
+	result.ConfigHashes = c.configHashes()
+
+	c.connMux.Lock()
+	result.StatusTransitions = append([]statusTransition{}, c.statusTransitions...)
+	c.connMux.Unlock()
+
+	if request.LogLines > 0 {
+		lines, err := c.tailCollectorLog(request.LogLines, cfg)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("failed to read collector log: %s", err))
+		}
+		result.LogLines = lines
+	}
+
+	if request.Profile != "" {
+		prof, err := collectProfile(request.Profile, request.ProfileDuration, cfg.GetMaxProfileDuration(), done)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("failed to collect profile: %s", err))
+		}
+		result.Profile = prof
+	}
+
+	return marshalDiagnostics(result, cfg.GetMaxSize())
+}
+
+// configHashes returns the hashes of the managed configs
+func (c *Client) configHashes() map[string]string {
+	hashes := make(map[string]string)
+	for _, configName := range []string{ManagerConfigName, CollectorConfigName, LoggingConfigName} {
+		if managedConfig, ok := c.configManager.GetConfig(configName); ok {
+			hashes[configName] = hex.EncodeToString(managedConfig.GetCurrentConfigHash())
+		}
+	}
+	return hashes
+}
+
+// tailCollectorLog returns up to the requested number of lines from the end of the log file configured in the logging config.
+// Lines with sensitive values are redacted the same way configs reported to the server are.
+func (c *Client) tailCollectorLog(requested int, cfg *opamp.DiagnosticsConfig) ([]string, error) {
+	managedConfig, ok := c.configManager.GetConfig(LoggingConfigName)
+	if !ok {
+		return nil, errors.New("logging config is not managed")
+	}
+
+	loggerConfig, err := logging.NewLoggerConfig(managedConfig.ConfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read logging config: %w", err)
+	}
+
+	if loggerConfig.Output != logFileOutput || loggerConfig.File == nil || loggerConfig.File.Filename == "" {
+		return nil, errors.New("collector logs are not written to a file")
+	}
+
+	maxLines := cfg.GetMaxLogLines()
+	if requested > maxLines {
+		requested = maxLines
+	}
+
+	lines, err := tailFile(loggerConfig.File.Filename, requested, int64(cfg.GetMaxSize()))
+	if err != nil {
+		return nil, err
+	}
+
+	redactor, err := opamp.NewRedactor(c.redactionKey, c.getCurrentConfig().Redaction)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create redactor: %w", err)
+	}
+
+	for i, line := range lines {
+		lines[i] = redactLogLine(redactor, line)
+	}
+	return lines, nil
+}
+
+// tailFile returns up to the last n lines of the file, reading at most maxBytes from its end
+func tailFile(path string, n int, maxBytes int64) ([]string, error) {
+	file, err := os.Open(path) // #nosec G304 - path is the log file from the logging config
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	offset := info.Size() - maxBytes
+	if offset < 0 {
+		offset = 0
+	}
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+
+	// A read starting partway through the file begins partway through a line
+	if offset > 0 {
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			data = data[i+1:]
+		}
+	}
+
+	text := strings.TrimRight(string(data), "\n")
+	if text == "" {
+		return nil, nil
+	}
+
+	lines := strings.Split(text, "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines, nil
+}
+
+// redactLogLine masks sensitive values in a JSON log line. Lines that aren't JSON are masked as a whole if they contain a sensitive value.
+func redactLogLine(redactor *opamp.Redactor, line string) string {
+	contentType := opamp.TextContentType
+	if json.Valid([]byte(line)) {
+		contentType = opamp.JSONContentType
+	}
+
+	redacted, err := redactor.Redact([]byte(line), contentType)
+	if err != nil {
+		return redactor.Mask([]byte(line))
+	}
+	return string(redacted)
+}
+
+// collectProfile collects a pprof profile of the requested type.
+// CPU profiles run for the requested duration capped at maxDuration, or until done is closed.
+func collectProfile(profileType string, duration, maxDuration time.Duration, done <-chan struct{}) (*profile, error) {
+	var buf bytes.Buffer
+
+	switch profileType {
+	case profileHeap:
+		if err := pprof.Lookup("heap").WriteTo(&buf, 0); err != nil {
+			return nil, err
+		}
+		return &profile{Type: profileType, Data: buf.Bytes()}, nil
+	case profileCPU:
+		if duration <= 0 || duration > maxDuration {
+			duration = maxDuration
+		}
+
+		if err := pprof.StartCPUProfile(&buf); err != nil {
+			return nil, err
+		}
+
+		timer := time.NewTimer(duration)
+		select {
+		case <-timer.C:
+		case <-done:
+			timer.Stop()
+			pprof.StopCPUProfile()
+			return nil, errors.New("cancelled by shutdown")
+		}
+		pprof.StopCPUProfile()
+
+		return &profile{Type: profileType, Duration: duration.String(), Data: buf.Bytes()}, nil
+	default:
+		return nil, fmt.Errorf("unknown profile type %q", profileType)
+	}
+}
+
+// marshalDiagnostics marshals the diagnostics, dropping the profile and then the oldest log lines until they fit in maxSize
+func marshalDiagnostics(result *diagnostics, maxSize int) []byte {
+	for {
+		data, err := json.Marshal(result)
+		if err != nil {
+			return []byte(fmt.Sprintf(`{"request_id":%q,"errors":[%q]}`, result.RequestID, err.Error()))
+		}
+
+		switch {
+		case len(data) <= maxSize:
+			return data
+		case result.Profile != nil:
+			result.Profile = nil
+			result.Errors = append(result.Errors, "profile omitted as it exceeds the max size")
+		case len(result.LogLines) > 0:
+			result.LogLines = result.LogLines[len(result.LogLines)/2+len(result.LogLines)%2:]
+		default:
+			return data
+		}
+		result.Truncated = true
+	}
+}
+
+// addDiagnostics adds the collected diagnostics to the effective config.
+// They're only reported once so later effective configs don't carry them.
+func (c *Client) addDiagnostics(effectiveConfig *protobufs.EffectiveConfig) {
+	configMap := effectiveConfig.GetConfigMap()
+	if configMap == nil {
+		return
+	}
+
+	c.diagMux.Lock()
+	report := c.diagReport
+	c.diagReport = nil
+	c.diagMux.Unlock()
+
+	if report == nil {
+		return
+	}
+	if configMap.ConfigMap == nil {
+		configMap.ConfigMap = make(map[string]*protobufs.AgentConfigFile)
+	}
+
+	configMap.ConfigMap[DiagnosticsConfigName] = &protobufs.AgentConfigFile{
+		Body:        report,
+		ContentType: opamp.JSONContentType,
+	}
+}
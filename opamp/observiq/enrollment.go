@@ -0,0 +1,236 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package observiq
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/observiq/observiq-otel-collector/opamp"
+	"github.com/open-telemetry/opamp-go/protobufs"
+	"go.uber.org/zap"
+)
+
+// CSRConfigName is the name of the certificate signing request reported in the effective config while enrolling.
+// The server responds by offering the signed certificate in the connection settings without a private key.
+const CSRConfigName = "enrollment.csr"
+
+// enrollmentKeyFileName is the name of the file the private key of a pending enrollment is kept in next to the manager config
+const enrollmentKeyFileName = "opamp-enrollment.key"
+
+// enrollmentCheckInterval is how often the client certificate is checked for renewal
+var enrollmentCheckInterval = time.Hour
+
+// enrollmentLoop periodically checks whether the client certificate needs to be renewed until done is closed
+func (c *Client) enrollmentLoop(done <-chan struct{}) {
+	ticker := time.NewTicker(enrollmentCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			c.requestCertificate()
+		}
+	}
+}
+
+// requestCertificate checks the enrollment and reports the change to the server if a certificate is now being requested
+func (c *Client) requestCertificate() {
+	if !c.checkEnrollment() {
+		return
+	}
+
+	c.reportEffectiveConfig("certificate signing request")
+}
+
+// checkEnrollment starts an enrollment when the client certificate is missing or due for renewal
+// and completes it once a new certificate is in use.
+// Returns true if the certificate signing request reported in the effective config changed.
+func (c *Client) checkEnrollment() bool {
+	cfg := c.getCurrentConfig()
+	if !cfg.Enrollment.IsEnabled() {
+		return false
+	}
+
+	c.enrollMux.Lock()
+	defer c.enrollMux.Unlock()
+
+	due := certificateDue(cfg, time.Now())
+	switch {
+	case !due && c.enrollCSR != nil:
+		c.enrollKey, c.enrollCSR = nil, nil
+		if err := os.Remove(c.enrollmentKeyPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+			c.getLogger().Warn("Failed to remove enrollment key", zap.Error(err))
+		}
+
+		c.getLogger().Info("Client certificate enrollment complete")
+		return true
+	case due && c.enrollCSR == nil:
+		key, err := c.loadOrCreateEnrollmentKey()
+		if err != nil {
+			c.getLogger().Error("Failed to create enrollment key", zap.Error(err))
+			return false
+		}
+
+		csr, err := newCertificateRequest(key, c.getIdent().agentID)
+		if err != nil {
+			c.getLogger().Error("Failed to create certificate signing request", zap.Error(err))
+			return false
+		}
+
+		c.enrollKey, c.enrollCSR = key, csr
+		c.getLogger().Info("Requesting client certificate")
+		return true
+	}
+
+	return false
+}
+
+// certificateDue returns true if the config has no readable client certificate or it's due to be renewed
+func certificateDue(cfg opamp.Config, now time.Time) bool {
+	if cfg.TLS == nil || cfg.TLS.CertFile == nil {
+		return true
+	}
+
+	contents, err := os.ReadFile(*cfg.TLS.CertFile)
+	if err != nil {
+		return true
+	}
+
+	block, _ := pem.Decode(contents)
+	if block == nil {
+		return true
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return true
+	}
+
+	return !now.Before(cfg.Enrollment.RenewalTime(cert))
+}
+
+// enrollmentKeyPath is the path of the private key of a pending enrollment
+func (c *Client) enrollmentKeyPath() string {
+	return filepath.Join(filepath.Dir(c.managerConfigPath), enrollmentKeyFileName)
+}
+
+// loadOrCreateEnrollmentKey reuses the key of an enrollment pending before a restart so a certificate signed for it can still be used.
+// Otherwise a new key is generated and saved.
+func (c *Client) loadOrCreateEnrollmentKey() (*ecdsa.PrivateKey, error) {
+	keyPath := c.enrollmentKeyPath()
+
+	if contents, err := os.ReadFile(keyPath); err == nil {
+		if block, _ := pem.Decode(contents); block != nil {
+			if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+				return key, nil
+			}
+		}
+		c.getLogger().Warn("Replacing unreadable enrollment key", zap.String("file", keyPath))
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal key: %w", err)
+	}
+
+	if err := opamp.WriteFileAtomic(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		return nil, fmt.Errorf("failed to write key: %w", err)
+	}
+
+	return key, nil
+}
+
+// newCertificateRequest creates a PEM encoded certificate signing request for the agent ID
+func newCertificateRequest(key *ecdsa.PrivateKey, agentID string) ([]byte, error) {
+	template := &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: agentID},
+	}
+
+	der, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}), nil
+}
+
+// enrollmentKeyFor returns the PEM encoded key of the pending enrollment if the certificate was signed for it, otherwise nil
+func (c *Client) enrollmentKeyFor(certPEM []byte) []byte {
+	c.enrollMux.Lock()
+	key := c.enrollKey
+	c.enrollMux.Unlock()
+
+	if key == nil {
+		return nil
+	}
+
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return nil
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil
+	}
+
+	if publicKey, ok := cert.PublicKey.(*ecdsa.PublicKey); !ok || !publicKey.Equal(&key.PublicKey) {
+		c.getLogger().Warn("Offered certificate was not signed for the pending enrollment")
+		return nil
+	}
+
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+}
+
+// addCertificateRequest adds the certificate signing request of a pending enrollment to the effective config
+func (c *Client) addCertificateRequest(effectiveConfig *protobufs.EffectiveConfig) {
+	c.enrollMux.Lock()
+	csr := c.enrollCSR
+	c.enrollMux.Unlock()
+
+	configMap := effectiveConfig.GetConfigMap()
+	if csr == nil || configMap == nil {
+		return
+	}
+	if configMap.ConfigMap == nil {
+		configMap.ConfigMap = make(map[string]*protobufs.AgentConfigFile)
+	}
+
+	configMap.ConfigMap[CSRConfigName] = &protobufs.AgentConfigFile{
+		Body:        csr,
+		ContentType: opamp.PEMContentType,
+	}
+}
@@ -0,0 +1,490 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package observiq
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/observiq/observiq-otel-collector/opamp"
+	"github.com/observiq/observiq-otel-collector/opamp/mocks"
+	"github.com/open-telemetry/opamp-go/client/types"
+	"github.com/open-telemetry/opamp-go/protobufs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+func TestClient_checkEnrollment(t *testing.T) {
+	agentID := "d4691426-b0bb-41f7-84a8-320a9ec0ea2e"
+	currConfig := opamp.Config{
+		Endpoint:   "wss://localhost:1234",
+		AgentID:    agentID,
+		Enrollment: &opamp.EnrollmentConfig{Enabled: true},
+	}
+
+	newEnrollmentTestClient := func(cfg opamp.Config, dir string) *Client {
+		return &Client{
+			logger:            zap.NewNop(),
+			ident:             newIdentity(zap.NewNop(), cfg),
+			currentConfig:     cfg,
+			managerConfigPath: filepath.Join(dir, ManagerConfigName),
+		}
+	}
+
+	testCases := []struct {
+		desc     string
+		testFunc func(*testing.T)
+	}{
+		{
+			desc: "Enrollment disabled",
+			testFunc: func(t *testing.T) {
+				cfg := currConfig.Copy()
+				cfg.Enrollment = nil
+
+				dir := t.TempDir()
+				c := newEnrollmentTestClient(*cfg, dir)
+				assert.False(t, c.checkEnrollment())
+				assert.Nil(t, c.enrollCSR)
+				assert.NoFileExists(t, filepath.Join(dir, enrollmentKeyFileName))
+			},
+		},
+		{
+			desc: "No certificate requests one",
+			testFunc: func(t *testing.T) {
+				dir := t.TempDir()
+				c := newEnrollmentTestClient(currConfig, dir)
+				require.True(t, c.checkEnrollment())
+
+				csr := parseTestCertificateRequest(t, c.enrollCSR)
+				assert.Equal(t, agentID, csr.Subject.CommonName)
+				assert.NoError(t, csr.CheckSignature())
+				assert.FileExists(t, filepath.Join(dir, enrollmentKeyFileName))
+
+				// The request is only created once
+				csrPEM := c.enrollCSR
+				assert.False(t, c.checkEnrollment())
+				assert.Equal(t, csrPEM, c.enrollCSR)
+
+				// The key is reused after a restart
+				restarted := newEnrollmentTestClient(currConfig, dir)
+				require.True(t, restarted.checkEnrollment())
+				assert.Equal(t, csr.PublicKey, parseTestCertificateRequest(t, restarted.enrollCSR).PublicKey)
+			},
+		},
+		{
+			desc: "Certificate due for renewal requests one",
+			testFunc: func(t *testing.T) {
+				ca := newTestCA(t)
+				dir := t.TempDir()
+
+				cfg := currConfig.Copy()
+				cfg.Enrollment.RenewBefore = 2 * time.Hour
+				cfg.TLS = &opamp.TLSConfig{CertFile: writeTestCertificate(t, dir, ca, time.Hour)}
+
+				c := newEnrollmentTestClient(*cfg, dir)
+				assert.True(t, c.checkEnrollment())
+				assert.NotNil(t, c.enrollCSR)
+			},
+		},
+		{
+			desc: "New certificate completes enrollment",
+			testFunc: func(t *testing.T) {
+				ca := newTestCA(t)
+				dir := t.TempDir()
+
+				c := newEnrollmentTestClient(currConfig, dir)
+				require.True(t, c.checkEnrollment())
+
+				cfg := currConfig.Copy()
+				cfg.TLS = &opamp.TLSConfig{CertFile: writeTestCertificate(t, dir, ca, time.Hour)}
+				c.currentConfig = *cfg
+
+				assert.True(t, c.checkEnrollment())
+				assert.Nil(t, c.enrollCSR)
+				assert.Nil(t, c.enrollKey)
+				assert.NoFileExists(t, filepath.Join(dir, enrollmentKeyFileName))
+
+				effectiveConfig := &protobufs.EffectiveConfig{ConfigMap: &protobufs.AgentConfigMap{}}
+				c.addCertificateRequest(effectiveConfig)
+				assert.NotContains(t, effectiveConfig.GetConfigMap().GetConfigMap(), CSRConfigName)
+			},
+		},
+		{
+			desc: "Loop reports renewal",
+			testFunc: func(t *testing.T) {
+				originalInterval := enrollmentCheckInterval
+				enrollmentCheckInterval = 10 * time.Millisecond
+				t.Cleanup(func() { enrollmentCheckInterval = originalInterval })
+
+				updated := make(chan struct{})
+				var updatedOnce sync.Once
+				mockOpAmpClient := mocks.NewMockOpAMPClient(t)
+				mockOpAmpClient.On("UpdateEffectiveConfig", mock.Anything).Return(nil).Run(func(mock.Arguments) {
+					updatedOnce.Do(func() { close(updated) })
+				}).Once()
+
+				c := newEnrollmentTestClient(currConfig, t.TempDir())
+				c.opampClient = mockOpAmpClient
+
+				done := make(chan struct{})
+				defer close(done)
+				go c.enrollmentLoop(done)
+
+				select {
+				case <-updated:
+				case <-time.After(5 * time.Second):
+					t.Fatal("certificate signing request was never reported")
+				}
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, tc.testFunc)
+	}
+}
+
+func TestCertificateDue(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	certFile := writeTestCertificate(t, dir, ca, 3*time.Hour)
+
+	badFile := filepath.Join(dir, "bad.crt")
+	require.NoError(t, os.WriteFile(badFile, []byte("not a cert"), 0600))
+	missingFile := filepath.Join(dir, "missing.crt")
+
+	enrollment := &opamp.EnrollmentConfig{Enabled: true}
+	testCases := []struct {
+		desc     string
+		tls      *opamp.TLSConfig
+		now      time.Time
+		expected bool
+	}{
+		{
+			desc:     "No TLS",
+			now:      time.Now(),
+			expected: true,
+		},
+		{
+			desc:     "Missing certificate",
+			tls:      &opamp.TLSConfig{CertFile: &missingFile},
+			now:      time.Now(),
+			expected: true,
+		},
+		{
+			desc:     "Invalid certificate",
+			tls:      &opamp.TLSConfig{CertFile: &badFile},
+			now:      time.Now(),
+			expected: true,
+		},
+		{
+			desc:     "Valid certificate",
+			tls:      &opamp.TLSConfig{CertFile: certFile},
+			now:      time.Now(),
+			expected: false,
+		},
+		{
+			desc:     "Last third of the certificate's lifetime",
+			tls:      &opamp.TLSConfig{CertFile: certFile},
+			now:      time.Now().Add(2*time.Hour + time.Minute),
+			expected: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			cfg := opamp.Config{TLS: tc.tls, Enrollment: enrollment}
+			assert.Equal(t, tc.expected, certificateDue(cfg, tc.now))
+		})
+	}
+}
+
+func TestClient_enrollment(t *testing.T) {
+	// Shorten the timeout so failures don't take long
+	originalTimeout := connectionSettingsTimeout
+	connectionSettingsTimeout = 5 * time.Second
+	t.Cleanup(func() { connectionSettingsTimeout = originalTimeout })
+
+	secretKey := "b92222ee-a1fc-4bb1-98db-26de3448541b"
+	agentID := "d4691426-b0bb-41f7-84a8-320a9ec0ea2e"
+
+	ca := newTestCA(t)
+	server := newTestEnrollmentServer(t, ca, secretKey)
+
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	require.NoError(t, os.WriteFile(caFile, ca.certPEM, 0600))
+
+	currConfig := opamp.Config{
+		Endpoint:   server.endpoint,
+		SecretKey:  &secretKey,
+		AgentID:    agentID,
+		TLS:        &opamp.TLSConfig{CAFile: &caFile},
+		Enrollment: &opamp.EnrollmentConfig{Enabled: true},
+	}
+	managerFilePath, managedConfig := writeManagerConfig(t, currConfig)
+
+	oldClient := mocks.NewMockOpAMPClient(t)
+	oldClient.On("Stop", mock.Anything).Return(nil)
+
+	newClient := mocks.NewMockOpAMPClient(t)
+	newClient.On("SetAgentDescription", mock.Anything).Return(nil)
+	newClient.On("UpdateEffectiveConfig", mock.Anything).Return(nil)
+	newClient.On("Start", mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		settings := args.Get(1).(types.StartSettings)
+		assert.Len(t, settings.TLSConfig.Certificates, 1)
+		settings.Callbacks.OnConnect()
+	})
+	setNewOpAMPClient(t, newClient)
+
+	c := newSwitchTestClient(t, oldClient, currConfig, managerFilePath, managedConfig)
+
+	// The agent reports a certificate signing request
+	require.True(t, c.checkEnrollment())
+	effectiveConfig, err := c.onGetEffectiveConfigHandler(context.Background())
+	require.NoError(t, err)
+
+	csrFile, ok := effectiveConfig.GetConfigMap().GetConfigMap()[CSRConfigName]
+	require.True(t, ok)
+	assert.Equal(t, opamp.PEMContentType, csrFile.GetContentType())
+
+	// The server signs it and offers the certificate without a private key
+	certPEM := ca.sign(t, parseTestCertificateRequest(t, csrFile.GetBody()), time.Hour)
+	err = c.onOpampConnectionSettingsHandler(context.Background(), &protobufs.OpAMPConnectionSettings{
+		Certificate: &protobufs.TLSCertificate{PublicKey: certPEM},
+	})
+	require.NoError(t, err)
+
+	// The offer was tested using mTLS
+	assert.Equal(t, []string{agentID}, server.clientNames())
+
+	c.connSettingsMux.Lock()
+	newConfig := c.pendingConnSettings
+	c.connSettingsMux.Unlock()
+	require.NotNil(t, newConfig)
+	require.NoError(t, c.switchConnectionSettings(*newConfig))
+
+	// The certificate and key are stored next to the manager config
+	data, err := os.ReadFile(managerFilePath)
+	require.NoError(t, err)
+	var persisted opamp.Config
+	require.NoError(t, yaml.Unmarshal(data, &persisted))
+	require.NotNil(t, persisted.TLS.CertFile)
+	require.NotNil(t, persisted.TLS.KeyFile)
+	assert.Equal(t, filepath.Dir(managerFilePath), filepath.Dir(*persisted.TLS.CertFile))
+	assert.Equal(t, caFile, *persisted.TLS.CAFile)
+
+	certContents, err := os.ReadFile(*persisted.TLS.CertFile)
+	require.NoError(t, err)
+	assert.Equal(t, certPEM, certContents)
+
+	// The enrollment is complete
+	assert.NoFileExists(t, filepath.Join(filepath.Dir(managerFilePath), enrollmentKeyFileName))
+	effectiveConfig, err = c.onGetEffectiveConfigHandler(context.Background())
+	require.NoError(t, err)
+	assert.NotContains(t, effectiveConfig.GetConfigMap().GetConfigMap(), CSRConfigName)
+}
+
+func TestClient_enrollmentKeyFor(t *testing.T) {
+	ca := newTestCA(t)
+
+	c := &Client{
+		logger:            zap.NewNop(),
+		ident:             newIdentity(zap.NewNop(), opamp.Config{AgentID: "d4691426-b0bb-41f7-84a8-320a9ec0ea2e"}),
+		currentConfig:     opamp.Config{Enrollment: &opamp.EnrollmentConfig{Enabled: true}},
+		managerConfigPath: filepath.Join(t.TempDir(), ManagerConfigName),
+	}
+
+	otherCert, err := os.ReadFile(filepath.Join("..", "testdata", "test.crt"))
+	require.NoError(t, err)
+
+	// No enrollment is pending
+	assert.Nil(t, c.enrollmentKeyFor(otherCert))
+
+	require.True(t, c.checkEnrollment())
+	certPEM := ca.sign(t, parseTestCertificateRequest(t, c.enrollCSR), time.Hour)
+
+	keyPEM := c.enrollmentKeyFor(certPEM)
+	require.NotNil(t, keyPEM)
+	_, err = tls.X509KeyPair(certPEM, keyPEM)
+	assert.NoError(t, err)
+
+	// Certificates signed for other keys aren't matched
+	assert.Nil(t, c.enrollmentKeyFor(otherCert))
+	assert.Nil(t, c.enrollmentKeyFor([]byte("not a cert")))
+}
+
+// testCA is a certificate authority that signs certificates in tests
+type testCA struct {
+	cert    *x509.Certificate
+	certPEM []byte
+	key     *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testCA{
+		cert:    cert,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		key:     key,
+	}
+}
+
+// sign creates a PEM encoded certificate for the request valid from now for the lifetime
+func (ca *testCA) sign(t *testing.T, csr *x509.CertificateRequest, lifetime time.Duration) []byte {
+	require.NoError(t, csr.CheckSignature())
+	return ca.issue(t, &x509.Certificate{
+		Subject:     csr.Subject,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, csr.PublicKey, lifetime)
+}
+
+func (ca *testCA) issue(t *testing.T, template *x509.Certificate, publicKey interface{}, lifetime time.Duration) []byte {
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+
+	template.SerialNumber = serial
+	template.NotBefore = time.Now().Add(-time.Minute)
+	template.NotAfter = template.NotBefore.Add(lifetime)
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, publicKey, ca.key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+// writeTestCertificate writes a client certificate valid from now for the lifetime to the directory
+func writeTestCertificate(t *testing.T, dir string, ca *testCA, lifetime time.Duration) *string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	certPEM := ca.issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "client"}}, &key.PublicKey, lifetime+time.Minute)
+	certFile := filepath.Join(dir, "client.crt")
+	require.NoError(t, os.WriteFile(certFile, certPEM, 0600))
+	return &certFile
+}
+
+func parseTestCertificateRequest(t *testing.T, csrPEM []byte) *x509.CertificateRequest {
+	block, _ := pem.Decode(csrPEM)
+	require.NotNil(t, block)
+	require.Equal(t, "CERTIFICATE REQUEST", block.Type)
+
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	require.NoError(t, err)
+	return csr
+}
+
+// testEnrollmentServer is a websocket server using a certificate from the test CA.
+// Client certificates are optional so agents can connect with the secret key to enroll.
+type testEnrollmentServer struct {
+	endpoint string
+
+	mux     sync.Mutex
+	clients []string
+}
+
+func newTestEnrollmentServer(t *testing.T, ca *testCA, secretKey string) *testEnrollmentServer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	certPEM := ca.issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "localhost"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, &key.PublicKey, time.Hour)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	serverCert, err := tls.X509KeyPair(certPEM, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	require.NoError(t, err)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+
+	s := &testEnrollmentServer{}
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != secretKeyAuthPrefix+secretKey {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if len(r.TLS.PeerCertificates) > 0 {
+			s.mux.Lock()
+			s.clients = append(s.clients, r.TLS.PeerCertificates[0].Subject.CommonName)
+			s.mux.Unlock()
+		}
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		_ = conn.Close()
+	}))
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientCAs:    clientCAs,
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		MinVersion:   tls.VersionTLS12,
+	}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	s.endpoint = strings.Replace(server.URL, "https://", "wss://", 1)
+	return s
+}
+
+// clientNames returns the common names of the verified client certificates that have connected
+func (s *testEnrollmentServer) clientNames() []string {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return append([]string(nil), s.clients...)
+}
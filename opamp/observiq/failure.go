@@ -0,0 +1,159 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package observiq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// errCollectorNotRunning is reported when the collector stopped and wasn't restarted, such as when a rollback fails
+	errCollectorNotRunning = errors.New("collector is not running")
+
+	// errOpAMPClientStopped is reported when the OpAMP client stopped and isn't reconnecting
+	errOpAMPClientStopped = errors.New("OpAMP client stopped and is not reconnecting")
+)
+
+// failureCheckInterval is how often the collector and OpAMP client are checked for failures they can't recover from
+var failureCheckInterval = 5 * time.Second
+
+// Error returns a channel that receives an error once the collector or OpAMP client fails
+// and the failure policy gives up on it
+func (c *Client) Error() <-chan error {
+	return c.failures
+}
+
+// monitorFailures checks for failures until done is closed.
+// Failures are reported on the error channel unless the failure policy retries them.
+func (c *Client) monitorFailures(done <-chan struct{}) {
+	retries := 0
+	interval := failureCheckInterval
+	for {
+		timer := time.NewTimer(interval)
+		select {
+		case <-done:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		err := c.checkFailures()
+		if err == nil {
+			if retries > 0 {
+				c.getLogger().Info("Recovered from failure", zap.Int("retries", retries))
+			}
+			retries = 0
+			interval = failureCheckInterval
+			continue
+		}
+
+		// The policy is read each time as it may change with the manager config
+		policy := c.getCurrentConfig().FailurePolicy
+		if !policy.ShouldRetry() || (policy.MaxRetries > 0 && retries >= policy.MaxRetries) {
+			c.getLogger().Error("Unrecoverable failure", zap.Int("retries", retries), zap.Error(err))
+			c.reportFailure(fmt.Errorf("unrecoverable failure in managed mode: %w", err))
+			return
+		}
+
+		retries++
+		c.getLogger().Warn("Retrying after failure", zap.Int("retry", retries), zap.Error(err))
+		c.retryFailures()
+		interval = policy.GetRetryInterval()
+	}
+}
+
+// checkFailures returns an error if the collector isn't running or the OpAMP client has stopped for good.
+// It waits for any apply in progress so collector restarts and connection changes aren't mistaken for failures.
+func (c *Client) checkFailures() error {
+	c.applyMux.Lock()
+	defer c.applyMux.Unlock()
+
+	switch {
+	case !c.collector.Running():
+		return errCollectorNotRunning
+	case c.opampClientStopped():
+		return errOpAMPClientStopped
+	}
+	return nil
+}
+
+// retryFailures restarts the collector if it isn't running and the OpAMP client if it has stopped for good
+func (c *Client) retryFailures() {
+	c.applyMux.Lock()
+	defer c.applyMux.Unlock()
+
+	if !c.collector.Running() {
+		if err := c.collector.Restart(context.Background()); err != nil {
+			c.getLogger().Error("Failed to restart collector", zap.Error(err))
+		}
+	}
+
+	if c.opampClientStopped() {
+		if err := c.restartOpAMPClient(c.getCurrentConfig(), false); err != nil {
+			c.getLogger().Error("Failed to restart OpAMP client", zap.Error(err))
+		}
+	}
+}
+
+// opampClientStopped returns true if the OpAMP client was stopped and no new one is being started.
+// This happens when reconnecting with the original connection settings fails after switching them fails.
+func (c *Client) opampClientStopped() bool {
+	c.opampMux.Lock()
+	defer c.opampMux.Unlock()
+	if c.disconnected || !c.opampStopped {
+		return false
+	}
+
+	c.connMux.Lock()
+	defer c.connMux.Unlock()
+	return !c.reconnecting
+}
+
+// reportFailure sends the error on the error channel without blocking. Only the first error is kept.
+func (c *Client) reportFailure(err error) {
+	select {
+	case c.failures <- err:
+	default:
+	}
+}
+
+// startFailureMonitor starts checking for failures in the background until the client disconnects
+func (c *Client) startFailureMonitor() {
+	if c.failureMonitorDone == nil {
+		return
+	}
+
+	c.failureMonitorWG.Add(1)
+	go func() {
+		defer c.failureMonitorWG.Done()
+		c.monitorFailures(c.failureMonitorDone)
+	}()
+}
+
+// stopFailureMonitor stops monitoring for failures and waits for a retry in progress to finish.
+// It's called before the collector is stopped so the shutdown isn't reported as a failure.
+func (c *Client) stopFailureMonitor() {
+	c.failureMonitorStop.Do(func() {
+		if c.failureMonitorDone != nil {
+			close(c.failureMonitorDone)
+		}
+	})
+	c.failureMonitorWG.Wait()
+}
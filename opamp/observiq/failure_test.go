@@ -0,0 +1,228 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package observiq
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	colmocks "github.com/observiq/observiq-otel-collector/collector/mocks"
+	"github.com/observiq/observiq-otel-collector/opamp"
+	"github.com/observiq/observiq-otel-collector/opamp/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// newFailureTestClient creates a client that checks for failures frequently
+func newFailureTestClient(t *testing.T, col *colmocks.MockCollector, policy *opamp.FailurePolicy) *Client {
+	originalInterval := failureCheckInterval
+	failureCheckInterval = 10 * time.Millisecond
+	t.Cleanup(func() { failureCheckInterval = originalInterval })
+
+	cfg := opamp.Config{
+		Endpoint:      "ws://localhost:1234",
+		AgentID:       "a69dcef0-0261-4f4f-9ac0-a483af42a6ba",
+		FailurePolicy: policy,
+	}
+
+	return &Client{
+		logger:             zap.NewNop(),
+		ident:              newIdentity(zap.NewNop(), cfg),
+		collector:          col,
+		currentConfig:      cfg,
+		reconnectDone:      make(chan struct{}),
+		failures:           make(chan error, 1),
+		failureMonitorDone: make(chan struct{}),
+	}
+}
+
+// waitForFailure waits for an error to be reported by the client
+func waitForFailure(t *testing.T, c *Client) error {
+	select {
+	case err := <-c.Error():
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for failure")
+		return nil
+	}
+}
+
+func TestClientMonitorFailures(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		testFunc func(*testing.T)
+	}{
+		{
+			desc: "Collector not running exits by default",
+			testFunc: func(t *testing.T) {
+				col := colmocks.NewMockCollector(t)
+				col.On("Running").Return(false)
+
+				c := newFailureTestClient(t, col, nil)
+				c.startFailureMonitor()
+				defer c.stopFailureMonitor()
+
+				err := waitForFailure(t, c)
+				assert.ErrorIs(t, err, errCollectorNotRunning)
+				col.AssertNotCalled(t, "Restart", mock.Anything)
+			},
+		},
+		{
+			desc: "Collector restarted by retry",
+			testFunc: func(t *testing.T) {
+				var running int32
+				col := colmocks.NewMockCollector(t)
+				col.On("Running").Return(func() bool { return atomic.LoadInt32(&running) == 1 })
+				restarted := make(chan struct{})
+				col.On("Restart", mock.Anything).Return(nil).Once().Run(func(mock.Arguments) {
+					atomic.StoreInt32(&running, 1)
+					close(restarted)
+				})
+
+				c := newFailureTestClient(t, col, &opamp.FailurePolicy{
+					Action:        opamp.FailureActionRetry,
+					RetryInterval: 10 * time.Millisecond,
+					MaxRetries:    1,
+				})
+				c.startFailureMonitor()
+
+				select {
+				case <-restarted:
+				case <-time.After(5 * time.Second):
+					t.Fatal("timed out waiting for collector restart")
+				}
+
+				// Keep checking after recovering, which would exhaust the retries if it hadn't recovered
+				time.Sleep(50 * time.Millisecond)
+				c.stopFailureMonitor()
+
+				select {
+				case err := <-c.Error():
+					t.Fatalf("unexpected failure: %s", err)
+				default:
+				}
+			},
+		},
+		{
+			desc: "Exits once retries are exhausted",
+			testFunc: func(t *testing.T) {
+				col := colmocks.NewMockCollector(t)
+				col.On("Running").Return(false)
+				col.On("Restart", mock.Anything).Return(errors.New("bad config"))
+
+				c := newFailureTestClient(t, col, &opamp.FailurePolicy{
+					Action:        opamp.FailureActionRetry,
+					RetryInterval: 10 * time.Millisecond,
+					MaxRetries:    2,
+				})
+				c.startFailureMonitor()
+				defer c.stopFailureMonitor()
+
+				err := waitForFailure(t, c)
+				assert.ErrorIs(t, err, errCollectorNotRunning)
+				col.AssertNumberOfCalls(t, "Restart", 2)
+			},
+		},
+		{
+			desc: "OpAMP client stopped",
+			testFunc: func(t *testing.T) {
+				col := colmocks.NewMockCollector(t)
+				col.On("Running").Return(true)
+
+				c := newFailureTestClient(t, col, nil)
+				c.opampStopped = true
+				c.startFailureMonitor()
+				defer c.stopFailureMonitor()
+
+				err := waitForFailure(t, c)
+				assert.ErrorIs(t, err, errOpAMPClientStopped)
+			},
+		},
+		{
+			desc: "OpAMP client restarted by retry",
+			testFunc: func(t *testing.T) {
+				col := colmocks.NewMockCollector(t)
+				col.On("Running").Return(true)
+
+				started := make(chan struct{})
+				newClient := mocks.NewMockOpAMPClient(t)
+				newClient.On("SetAgentDescription", mock.Anything).Return(nil)
+				newClient.On("Start", mock.Anything, mock.Anything).Return(nil).Run(func(mock.Arguments) {
+					close(started)
+				})
+				setNewOpAMPClient(t, newClient)
+
+				c := newFailureTestClient(t, col, &opamp.FailurePolicy{
+					Action:        opamp.FailureActionRetry,
+					RetryInterval: 10 * time.Millisecond,
+				})
+				c.opampClient = mocks.NewMockOpAMPClient(t)
+				c.opampStopped = true
+				c.startFailureMonitor()
+
+				select {
+				case <-started:
+				case <-time.After(5 * time.Second):
+					t.Fatal("timed out waiting for OpAMP client restart")
+				}
+
+				c.stopFailureMonitor()
+				assert.False(t, c.opampClientStopped())
+				require.Equal(t, newClient, c.opampClient)
+			},
+		},
+		{
+			desc: "Reconnecting is not a failure",
+			testFunc: func(t *testing.T) {
+				c := newFailureTestClient(t, nil, nil)
+				c.opampStopped = true
+				c.reconnecting = true
+				assert.False(t, c.opampClientStopped())
+
+				c.disconnected = true
+				c.reconnecting = false
+				assert.False(t, c.opampClientStopped())
+			},
+		},
+		{
+			desc: "Stopping the monitor doesn't report a failure",
+			testFunc: func(t *testing.T) {
+				col := colmocks.NewMockCollector(t)
+				col.On("Running").Return(true).Maybe()
+
+				c := newFailureTestClient(t, col, nil)
+				c.startFailureMonitor()
+				c.stopFailureMonitor()
+
+				// Stopping again does nothing
+				c.stopFailureMonitor()
+
+				select {
+				case err := <-c.Error():
+					t.Fatalf("unexpected failure: %s", err)
+				default:
+				}
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, tc.testFunc)
+	}
+}
@@ -0,0 +1,358 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package observiq
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/observiq/observiq-otel-collector/opamp"
+	"github.com/open-telemetry/opamp-go/protobufs"
+	"go.uber.org/zap"
+)
+
+// managedFileSet is a registered file set and the functions called before and after its files change
+type managedFileSet struct {
+	opamp.FileSet
+	validate opamp.FileValidateFunc
+	onChange opamp.FileChangeFunc
+}
+
+// fileChange records a file written by a remote config so it can be restored
+type fileChange struct {
+	configName string
+	filePath   string
+
+	// previous contents of the file. Only set if the file existed.
+	previous []byte
+	existed  bool
+}
+
+// fileSetHash is reported in the effective config in place of the contents of a file in a file set
+type fileSetHash struct {
+	SHA256 string `json:"sha256"`
+	Size   int    `json:"size"`
+}
+
+// newFileSetHashFile creates the effective config entry for a file in a file set
+func newFileSetHashFile(contents []byte) *protobufs.AgentConfigFile {
+	// Marshaling a struct of a string and int can't fail
+	body, _ := json.Marshal(fileSetHash{
+		SHA256: hex.EncodeToString(opamp.ComputeHash(contents)),
+		Size:   len(contents),
+	})
+
+	return &protobufs.AgentConfigFile{
+		Body:        body,
+		ContentType: opamp.JSONContentType,
+	}
+}
+
+// AddFileSet registers a set of files the server may write and tracks the files already in it.
+// validate and onChange may be nil.
+func (a *AgentConfigManager) AddFileSet(fileSet opamp.FileSet, validate opamp.FileValidateFunc, onChange opamp.FileChangeFunc) error {
+	if err := fileSet.Validate(); err != nil {
+		return err
+	}
+
+	relPaths, err := fileSet.Files()
+	if err != nil {
+		return err
+	}
+
+	configs := make(map[string]*opamp.ManagedConfig, len(relPaths))
+	for _, relPath := range relPaths {
+		filePath, err := fileSet.Resolve(relPath)
+		if err != nil {
+			a.logger.Warn("Not tracking file in file set", zap.String("file_set", fileSet.Name), zap.Error(err))
+			continue
+		}
+
+		managedConfig, err := newFileSetConfig(fileSet, filePath)
+		if err != nil {
+			return fmt.Errorf("failed to track file %s: %w", filePath, err)
+		}
+		configs[fileSet.ConfigName(relPath)] = managedConfig
+	}
+
+	a.configMux.Lock()
+	defer a.configMux.Unlock()
+
+	if _, ok := a.fileSets[fileSet.Name]; ok {
+		return fmt.Errorf("file set %s already added", fileSet.Name)
+	}
+
+	a.fileSets[fileSet.Name] = &managedFileSet{
+		FileSet:  fileSet,
+		validate: validate,
+		onChange: onChange,
+	}
+	for configName, managedConfig := range configs {
+		a.configMap[configName] = managedConfig
+	}
+
+	return nil
+}
+
+// newFileSetConfig creates a managed config for a file in a file set.
+// Files in a file set don't keep a history.
+func newFileSetConfig(fileSet opamp.FileSet, filePath string) (*opamp.ManagedConfig, error) {
+	managedConfig := &opamp.ManagedConfig{
+		ConfigPath:  filePath,
+		ContentType: fileSet.DetermineContentType(filePath),
+		Reload:      fileSetReload(fileSet, filePath),
+	}
+
+	if err := managedConfig.ComputeConfigHash(); err != nil {
+		return nil, err
+	}
+
+	return managedConfig, nil
+}
+
+// fileSetReload writes a file in a file set.
+// The set's change function is called once all of a remote config's files are written.
+func fileSetReload(fileSet opamp.FileSet, filePath string) opamp.ReloadFunc {
+	return func(_ context.Context, contents []byte) (bool, error) {
+		if err := fileSet.CheckSize(contents); err != nil {
+			return false, err
+		}
+
+		if err := os.MkdirAll(filepath.Dir(filePath), 0750); err != nil {
+			return false, fmt.Errorf("failed to create directory for %s: %w", filePath, err)
+		}
+
+		if err := opamp.WriteFileAtomic(filePath, contents, 0600); err != nil {
+			return false, err
+		}
+
+		return true, nil
+	}
+}
+
+// fileSetFor returns the file set a config belongs to and the config's path relative to the set's root
+func (a *AgentConfigManager) fileSetFor(configName string) (*managedFileSet, string, bool) {
+	a.configMux.RLock()
+	defer a.configMux.RUnlock()
+
+	for _, fileSet := range a.fileSets {
+		if relPath, ok := fileSet.RelPath(configName); ok {
+			return fileSet, relPath, true
+		}
+	}
+	return nil, "", false
+}
+
+// fileSetSize returns the number of tracked files in a file set
+func (a *AgentConfigManager) fileSetSize(fileSet *managedFileSet) int {
+	a.configMux.RLock()
+	defer a.configMux.RUnlock()
+
+	var count int
+	for configName := range a.configMap {
+		if _, ok := fileSet.RelPath(configName); ok {
+			count++
+		}
+	}
+	return count
+}
+
+// removeConfig stops tracking a config
+func (a *AgentConfigManager) removeConfig(configName string) {
+	a.configMux.Lock()
+	defer a.configMux.Unlock()
+
+	delete(a.configMap, configName)
+}
+
+// applyFileSetChanges writes the files of the remote config belonging to file sets then calls the change function of each set with changed files.
+// The written files are returned so they can be reverted if a later config fails. If anything fails every written file is restored.
+func (a *AgentConfigManager) applyFileSetChanges(ctx context.Context, remoteConfigMap map[string]*protobufs.AgentConfigFile) (map[*managedFileSet][]fileChange, error) {
+	changes := make(map[*managedFileSet][]fileChange)
+	var fileSets []*managedFileSet
+
+	for configName, remoteContents := range remoteConfigMap {
+		fileSet, relPath, ok := a.fileSetFor(configName)
+		if !ok {
+			continue
+		}
+
+		change, fileChanged, err := a.applyFileSetFile(ctx, fileSet, configName, relPath, remoteContents.GetBody())
+		if err != nil {
+			a.restoreFiles(changes)
+			return nil, err
+		}
+
+		if fileChanged {
+			if _, ok := changes[fileSet]; !ok {
+				fileSets = append(fileSets, fileSet)
+			}
+			changes[fileSet] = append(changes[fileSet], change)
+		}
+	}
+
+	var notified []*managedFileSet
+	for _, fileSet := range fileSets {
+		if fileSet.onChange == nil {
+			continue
+		}
+
+		if err := fileSet.onChange(ctx, changedPaths(changes[fileSet])); err != nil {
+			a.revertFileSetChanges(changes, append(notified, fileSet))
+			return nil, fmt.Errorf("failed to reload file set %s: %w", fileSet.Name, err)
+		}
+		notified = append(notified, fileSet)
+	}
+
+	return changes, nil
+}
+
+// revertFileSetChanges restores the written files and calls the change function of each notified set with them.
+// This must not be cancelled or the restored files could be left unused.
+func (a *AgentConfigManager) revertFileSetChanges(changes map[*managedFileSet][]fileChange, notified []*managedFileSet) {
+	a.restoreFiles(changes)
+
+	for _, fileSet := range notified {
+		if err := fileSet.onChange(context.Background(), changedPaths(changes[fileSet])); err != nil {
+			a.logger.Error("Failed to reload restored file set", zap.String("file_set", fileSet.Name), zap.Error(err))
+		}
+	}
+}
+
+// notifiedFileSets returns the sets with changes whose change function was called
+func notifiedFileSets(changes map[*managedFileSet][]fileChange) []*managedFileSet {
+	var notified []*managedFileSet
+	for fileSet := range changes {
+		if fileSet.onChange != nil {
+			notified = append(notified, fileSet)
+		}
+	}
+	return notified
+}
+
+// applyFileSetFile writes a file in a file set if its contents differ from the remote contents.
+// Files not yet tracked are tracked once written.
+func (a *AgentConfigManager) applyFileSetFile(ctx context.Context, fileSet *managedFileSet, configName, relPath string, contents []byte) (change fileChange, changed bool, err error) {
+	filePath, err := fileSet.Resolve(relPath)
+	if err != nil {
+		return change, false, fmt.Errorf("rejected file %s: %w", configName, err)
+	}
+
+	if err := fileSet.CheckSize(contents); err != nil {
+		return change, false, fmt.Errorf("rejected file %s: %w", configName, err)
+	}
+
+	managedConfig, tracked := a.GetConfig(configName)
+	if !tracked {
+		if fileSet.MaxFiles > 0 && a.fileSetSize(fileSet) >= fileSet.MaxFiles {
+			return change, false, fmt.Errorf("rejected file %s: %w: file set %s is limited to %d files", configName, opamp.ErrTooManyFiles, fileSet.Name, fileSet.MaxFiles)
+		}
+
+		managedConfig = &opamp.ManagedConfig{
+			ConfigPath:  filePath,
+			ContentType: fileSet.DetermineContentType(filePath),
+			Reload:      fileSetReload(fileSet.FileSet, filePath),
+		}
+	}
+
+	change = fileChange{
+		configName: configName,
+		filePath:   filePath,
+	}
+
+	change.previous, err = os.ReadFile(filepath.Clean(filePath))
+	switch {
+	case err == nil:
+		change.existed = true
+	case !errors.Is(err, fs.ErrNotExist):
+		return change, false, fmt.Errorf("failed to read file %s: %w", configName, err)
+	}
+
+	// Disk already matches the remote contents
+	if change.existed && bytes.Equal(change.previous, contents) {
+		if !tracked {
+			if err := managedConfig.ComputeConfigHash(); err != nil {
+				return change, false, fmt.Errorf("failed hash compute for file %s: %w", configName, err)
+			}
+			a.AddConfig(configName, managedConfig)
+		}
+		return change, false, nil
+	}
+
+	if fileSet.validate != nil {
+		if err := fileSet.validate(filePath, contents); err != nil {
+			return change, false, fmt.Errorf("invalid file %s: %w", configName, err)
+		}
+	}
+
+	a.logger.Info("Applying changes to file", zap.String("config", configName))
+	if _, err := managedConfig.Reload(ctx, contents); err != nil {
+		return change, false, fmt.Errorf("failed to write file %s: %w", configName, err)
+	}
+
+	if err := managedConfig.ComputeConfigHash(); err != nil {
+		return change, false, fmt.Errorf("failed hash compute for file %s: %w", configName, err)
+	}
+
+	if !tracked {
+		a.AddConfig(configName, managedConfig)
+	}
+
+	return change, true, nil
+}
+
+// restoreFiles restores the previous contents of written files and removes files that didn't exist
+func (a *AgentConfigManager) restoreFiles(changes map[*managedFileSet][]fileChange) {
+	for _, setChanges := range changes {
+		for _, change := range setChanges {
+			if err := a.restoreFile(change); err != nil {
+				a.logger.Error("Failed to restore file", zap.String("config", change.configName), zap.Error(err))
+			}
+		}
+	}
+}
+
+// restoreFile restores a single written file
+func (a *AgentConfigManager) restoreFile(change fileChange) error {
+	if !change.existed {
+		a.removeConfig(change.configName)
+		return os.Remove(change.filePath)
+	}
+
+	if err := opamp.WriteFileAtomic(change.filePath, change.previous, 0600); err != nil {
+		return err
+	}
+
+	if managedConfig, ok := a.GetConfig(change.configName); ok {
+		return managedConfig.ComputeConfigHash()
+	}
+	return nil
+}
+
+// changedPaths returns the paths of the changed files
+func changedPaths(changes []fileChange) []string {
+	paths := make([]string, 0, len(changes))
+	for _, change := range changes {
+		paths = append(paths, change.filePath)
+	}
+	return paths
+}
@@ -0,0 +1,260 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package observiq
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/observiq/observiq-otel-collector/opamp"
+	"github.com/open-telemetry/opamp-go/protobufs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestAgentConfigManagerFileSets(t *testing.T) {
+	// setupManager creates a manager with a plugins file set holding one existing plugin
+	setupManager := func(t *testing.T, validate opamp.FileValidateFunc, onChange opamp.FileChangeFunc) (*AgentConfigManager, string) {
+		root := filepath.Join(t.TempDir(), "plugins")
+		require.NoError(t, os.MkdirAll(root, 0750))
+		require.NoError(t, os.WriteFile(filepath.Join(root, "redis.yaml"), []byte("version: 1"), 0600))
+
+		manager := NewAgentConfigManager(zap.NewNop())
+		err := manager.AddFileSet(opamp.FileSet{
+			Name:        "plugins",
+			Root:        root,
+			Patterns:    []string{"*.yaml", "*/*.yaml"},
+			MaxFileSize: 64,
+			MaxFiles:    3,
+		}, validate, onChange)
+		require.NoError(t, err)
+
+		return manager, root
+	}
+
+	remoteConfig := func(files map[string]string) *protobufs.AgentRemoteConfig {
+		configMap := make(map[string]*protobufs.AgentConfigFile, len(files))
+		for name, contents := range files {
+			configMap[name] = &protobufs.AgentConfigFile{Body: []byte(contents)}
+		}
+		return &protobufs.AgentRemoteConfig{
+			Config: &protobufs.AgentConfigMap{ConfigMap: configMap},
+		}
+	}
+
+	testCases := []struct {
+		desc     string
+		testFunc func(*testing.T)
+	}{
+		{
+			desc: "Existing files are tracked",
+			testFunc: func(t *testing.T) {
+				manager, root := setupManager(t, nil, nil)
+
+				managedConfig, ok := manager.GetConfig("plugins/redis.yaml")
+				require.True(t, ok)
+				assert.Equal(t, filepath.Join(root, "redis.yaml"), managedConfig.ConfigPath)
+				assert.Nil(t, managedConfig.History)
+
+				effCfg, err := manager.ComposeEffectiveConfig()
+				require.NoError(t, err)
+				// Only the hash of the file is reported
+				expectedHash := hex.EncodeToString(opamp.ComputeHash([]byte("version: 1")))
+				assert.JSONEq(t, `{"sha256": "`+expectedHash+`", "size": 10}`, string(effCfg.GetConfigMap().GetConfigMap()["plugins/redis.yaml"].GetBody()))
+				assert.Equal(t, opamp.JSONContentType, effCfg.GetConfigMap().GetConfigMap()["plugins/redis.yaml"].GetContentType())
+			},
+		},
+		{
+			desc: "Duplicate file set",
+			testFunc: func(t *testing.T) {
+				manager, root := setupManager(t, nil, nil)
+
+				err := manager.AddFileSet(opamp.FileSet{Name: "plugins", Root: root, Patterns: []string{"*"}}, nil, nil)
+				require.ErrorContains(t, err, "already added")
+			},
+		},
+		{
+			desc: "New and changed files are written and reloaded once",
+			testFunc: func(t *testing.T) {
+				var reloads [][]string
+				manager, root := setupManager(t, nil, func(_ context.Context, filePaths []string) error {
+					reloads = append(reloads, filePaths)
+					return nil
+				})
+
+				changed, err := manager.ApplyConfigChanges(context.Background(), remoteConfig(map[string]string{
+					"plugins/redis.yaml":       "version: 2",
+					"plugins/db/postgres.yaml": "version: 1",
+				}))
+				require.NoError(t, err)
+				require.True(t, changed)
+
+				require.Len(t, reloads, 1)
+				assert.ElementsMatch(t, []string{filepath.Join(root, "redis.yaml"), filepath.Join(root, "db", "postgres.yaml")}, reloads[0])
+
+				data, err := os.ReadFile(filepath.Join(root, "db", "postgres.yaml"))
+				require.NoError(t, err)
+				assert.Equal(t, []byte("version: 1"), data)
+
+				_, ok := manager.GetConfig("plugins/db/postgres.yaml")
+				assert.True(t, ok)
+
+				// Nothing is reloaded when the files already match
+				changed, err = manager.ApplyConfigChanges(context.Background(), remoteConfig(map[string]string{
+					"plugins/redis.yaml": "version: 2",
+				}))
+				require.NoError(t, err)
+				assert.False(t, changed)
+				assert.Len(t, reloads, 1)
+			},
+		},
+		{
+			desc: "Path traversal is rejected",
+			testFunc: func(t *testing.T) {
+				manager, root := setupManager(t, nil, nil)
+
+				_, err := manager.ApplyConfigChanges(context.Background(), remoteConfig(map[string]string{
+					"plugins/../manager.yaml": "endpoint: ws://evil",
+				}))
+				require.ErrorIs(t, err, opamp.ErrInvalidFileName)
+				assert.NoFileExists(t, filepath.Join(filepath.Dir(root), "manager.yaml"))
+			},
+		},
+		{
+			desc: "Invalid files are rejected",
+			testFunc: func(t *testing.T) {
+				expectedErr := errors.New("bad plugin")
+				manager, root := setupManager(t, func(string, []byte) error { return expectedErr }, nil)
+
+				_, err := manager.ApplyConfigChanges(context.Background(), remoteConfig(map[string]string{
+					"plugins/redis.yaml": "version: 2",
+				}))
+				require.ErrorIs(t, err, expectedErr)
+
+				data, err := os.ReadFile(filepath.Join(root, "redis.yaml"))
+				require.NoError(t, err)
+				assert.Equal(t, []byte("version: 1"), data)
+			},
+		},
+		{
+			desc: "Files over the size limit are rejected",
+			testFunc: func(t *testing.T) {
+				manager, _ := setupManager(t, nil, nil)
+
+				_, err := manager.ApplyConfigChanges(context.Background(), remoteConfig(map[string]string{
+					"plugins/big.yaml": string(make([]byte, 65)),
+				}))
+				require.ErrorIs(t, err, opamp.ErrFileTooLarge)
+			},
+		},
+		{
+			desc: "Files over the file limit are rejected and written files restored",
+			testFunc: func(t *testing.T) {
+				manager, root := setupManager(t, nil, nil)
+
+				_, err := manager.ApplyConfigChanges(context.Background(), remoteConfig(map[string]string{
+					"plugins/a.yaml": "a: 1",
+					"plugins/b.yaml": "b: 1",
+					"plugins/c.yaml": "c: 1",
+				}))
+				require.ErrorIs(t, err, opamp.ErrTooManyFiles)
+
+				files, err := opamp.FileSet{Root: root, Patterns: []string{"*.yaml"}}.Files()
+				require.NoError(t, err)
+				assert.Equal(t, []string{"redis.yaml"}, files)
+			},
+		},
+		{
+			desc: "Failed reload restores files",
+			testFunc: func(t *testing.T) {
+				expectedErr := errors.New("oops")
+
+				var calls int
+				manager, root := setupManager(t, nil, func(context.Context, []string) error {
+					calls++
+					if calls == 1 {
+						return expectedErr
+					}
+					return nil
+				})
+
+				changed, err := manager.ApplyConfigChanges(context.Background(), remoteConfig(map[string]string{
+					"plugins/redis.yaml": "version: 2",
+					"plugins/new.yaml":   "version: 1",
+				}))
+				require.ErrorIs(t, err, expectedErr)
+				require.False(t, changed)
+
+				// Reloaded again with the restored files
+				assert.Equal(t, 2, calls)
+
+				data, err := os.ReadFile(filepath.Join(root, "redis.yaml"))
+				require.NoError(t, err)
+				assert.Equal(t, []byte("version: 1"), data)
+				assert.NoFileExists(t, filepath.Join(root, "new.yaml"))
+
+				_, ok := manager.GetConfig("plugins/new.yaml")
+				assert.False(t, ok)
+			},
+		},
+		{
+			desc: "Failed config restores files and reloads them",
+			testFunc: func(t *testing.T) {
+				expectedErr := errors.New("oops")
+
+				var reloaded [][]string
+				manager, root := setupManager(t, nil, func(_ context.Context, paths []string) error {
+					reloaded = append(reloaded, paths)
+					return nil
+				})
+
+				collectorPath := filepath.Join(t.TempDir(), CollectorConfigName)
+				require.NoError(t, os.WriteFile(collectorPath, []byte("current: config"), 0600))
+				managedConfig, err := opamp.NewManagedConfig(collectorPath, func(context.Context, []byte) (bool, error) {
+					return false, expectedErr
+				})
+				require.NoError(t, err)
+				manager.AddConfig(CollectorConfigName, managedConfig)
+
+				_, err = manager.ApplyConfigChanges(context.Background(), remoteConfig(map[string]string{
+					"plugins/redis.yaml": "version: 2",
+					CollectorConfigName:  "new: config",
+				}))
+				require.ErrorIs(t, err, expectedErr)
+
+				// Reloaded with the new file then again with the restored file
+				redisPath := filepath.Join(root, "redis.yaml")
+				assert.Equal(t, [][]string{{redisPath}, {redisPath}}, reloaded)
+
+				data, err := os.ReadFile(redisPath)
+				require.NoError(t, err)
+				assert.Equal(t, []byte("version: 1"), data)
+
+				pluginConfig, ok := manager.GetConfig("plugins/redis.yaml")
+				require.True(t, ok)
+				assert.Equal(t, opamp.ComputeHash([]byte("version: 1")), pluginConfig.GetCurrentConfigHash())
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, tc.testFunc)
+	}
+}
@@ -16,6 +16,8 @@ package observiq
 
 import (
 	"runtime"
+	"sort"
+	"time"
 
 	ios "github.com/observiq/observiq-otel-collector/internal/os"
 	"github.com/observiq/observiq-otel-collector/internal/version"
@@ -31,11 +33,13 @@ type identity struct {
 	serviceName string
 	version     string
 	labels      *string
+	attributes  *opamp.AttributesConfig
 	oSArch      string
 	oSDetails   string
 	oSFamily    string
 	hostname    string
 	mac         string
+	host        ios.HostDetails
 }
 
 // newIdentity constructs a new identity for this collector
@@ -57,11 +61,13 @@ func newIdentity(logger *zap.Logger, config opamp.Config) *identity {
 		serviceName: "com.observiq.collector", // Hardcoded defines this type of agent to the server
 		version:     version.Version(),
 		labels:      config.Labels,
+		attributes:  config.Attributes.Expand(),
 		oSArch:      runtime.GOARCH,
 		oSDetails:   name,
 		oSFamily:    runtime.GOOS,
 		hostname:    hostname,
 		mac:         ios.MACAddress(),
+		host:        ios.Details(),
 	}
 }
 
@@ -76,6 +82,7 @@ func (i identity) Copy() *identity {
 		oSFamily:    i.oSFamily,
 		hostname:    i.hostname,
 		mac:         i.mac,
+		host:        i.host.Copy(),
 	}
 
 	if i.agentName != nil {
@@ -88,6 +95,10 @@ func (i identity) Copy() *identity {
 		*identCpy.labels = *i.labels
 	}
 
+	if i.attributes != nil {
+		identCpy.attributes = i.attributes.Copy()
+	}
+
 	return identCpy
 }
 
@@ -116,6 +127,13 @@ func (i *identity) ToAgentDescription() *protobufs.AgentDescription {
 		nonIdentifyingAttributes = append(nonIdentifyingAttributes, opamp.StringKeyValue("service.labels", *i.labels))
 	}
 
+	nonIdentifyingAttributes = append(nonIdentifyingAttributes, hostAttributes(i.host)...)
+
+	if i.attributes != nil {
+		identifyingAttributes = appendUserAttributes(identifyingAttributes, i.attributes.Identifying)
+		nonIdentifyingAttributes = appendUserAttributes(nonIdentifyingAttributes, i.attributes.NonIdentifying)
+	}
+
 	agentDesc := &protobufs.AgentDescription{
 		IdentifyingAttributes:    identifyingAttributes,
 		NonIdentifyingAttributes: nonIdentifyingAttributes,
@@ -123,3 +141,62 @@ func (i *identity) ToAgentDescription() *protobufs.AgentDescription {
 
 	return agentDesc
 }
+
+// hostAttributes converts the host details into attributes, omitting any that are unknown
+func hostAttributes(details ios.HostDetails) []*protobufs.KeyValue {
+	var attributes []*protobufs.KeyValue
+
+	addString := func(key, value string) {
+		if value != "" {
+			attributes = append(attributes, opamp.StringKeyValue(key, value))
+		}
+	}
+	addTime := func(key string, value time.Time) {
+		if !value.IsZero() {
+			attributes = append(attributes, opamp.StringKeyValue(key, value.UTC().Format(time.RFC3339)))
+		}
+	}
+
+	if len(details.IPAddresses) > 0 {
+		attributes = append(attributes, opamp.StringArrayKeyValue("host.ip", details.IPAddresses))
+	}
+	if details.CPUCount > 0 {
+		attributes = append(attributes, opamp.IntKeyValue("host.cpu.count", int64(details.CPUCount)))
+	}
+	if details.TotalMemory > 0 {
+		attributes = append(attributes, opamp.IntKeyValue("host.memory.total", int64(details.TotalMemory)))
+	}
+	addString("os.kernel.version", details.KernelVersion)
+	addTime("host.boot.time", details.BootTime)
+	addTime("process.start.time", details.ProcessStartTime)
+	addString("container.id", details.ContainerID)
+	addString("k8s.pod.name", details.KubernetesPodName)
+	addString("k8s.namespace.name", details.KubernetesNamespace)
+	addString("k8s.node.name", details.KubernetesNodeName)
+	addString("cloud.provider", details.CloudProvider)
+	addString("cloud.region", details.CloudRegion)
+
+	return attributes
+}
+
+// appendUserAttributes appends the user's attributes sorted by key.
+// Attributes with the same key as one the collector reports are skipped.
+func appendUserAttributes(attributes []*protobufs.KeyValue, userAttributes map[string]string) []*protobufs.KeyValue {
+	reported := make(map[string]struct{}, len(attributes))
+	for _, attribute := range attributes {
+		reported[attribute.GetKey()] = struct{}{}
+	}
+
+	keys := make([]string, 0, len(userAttributes))
+	for key := range userAttributes {
+		if _, ok := reported[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		attributes = append(attributes, opamp.StringKeyValue(key, userAttributes[key]))
+	}
+	return attributes
+}
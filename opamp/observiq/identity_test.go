@@ -17,7 +17,9 @@ package observiq
 import (
 	"runtime"
 	"testing"
+	"time"
 
+	ios "github.com/observiq/observiq-otel-collector/internal/os"
 	"github.com/observiq/observiq-otel-collector/internal/version"
 	"github.com/observiq/observiq-otel-collector/opamp"
 	"github.com/open-telemetry/opamp-go/protobufs"
@@ -27,6 +29,7 @@ import (
 )
 
 func Test_newIdentity(t *testing.T) {
+	t.Setenv("IDENTITY_TEST_DATACENTER", "us-east-1")
 	secretKeyContents := "b92222ee-a1fc-4bb1-98db-26de3448541b"
 	labelsContents := "one=foo,two=bar"
 	agentNameContents := "My Agent"
@@ -37,10 +40,17 @@ func Test_newIdentity(t *testing.T) {
 		AgentID:   "8321f735-a52c-4f49-aca9-66f9266c5fe5",
 		Labels:    &labelsContents,
 		AgentName: &agentNameContents,
+		Attributes: &opamp.AttributesConfig{
+			NonIdentifying: map[string]string{"datacenter": "${IDENTITY_TEST_DATACENTER}"},
+		},
 	}
 
 	got := newIdentity(zap.NewNop(), cfg)
 
+	// Environment variables in attributes are expanded when loaded
+	require.Equal(t, map[string]string{"datacenter": "us-east-1"}, got.attributes.NonIdentifying)
+	require.Equal(t, "${IDENTITY_TEST_DATACENTER}", cfg.Attributes.NonIdentifying["datacenter"])
+
 	// Check all fields from config
 	require.Equal(t, cfg.AgentID, got.agentID)
 	require.Equal(t, cfg.AgentName, got.agentName)
@@ -50,6 +60,7 @@ func Test_newIdentity(t *testing.T) {
 	require.NotEmpty(t, got.oSDetails)
 	require.NotEmpty(t, got.hostname)
 	require.NotEmpty(t, got.mac)
+	require.NotZero(t, got.host.CPUCount)
 
 	// Check hardcoded/fields from runtime and other packages
 	require.Equal(t, got.serviceName, "com.observiq.collector")
@@ -127,6 +138,98 @@ func TestToAgentDescription(t *testing.T) {
 				},
 			},
 		},
+		{
+			desc: "With host details",
+			ident: &identity{
+				agentID:     "4322d8d1-f3e0-46db-b68d-b01a4689ef19",
+				serviceName: "com.observiq.collector",
+				version:     "v1.2.3",
+				oSArch:      "amd64",
+				oSDetails:   "os details",
+				oSFamily:    "linux",
+				hostname:    "my-linux-box",
+				mac:         "68-C7-B4-EB-A8-D2",
+				host: ios.HostDetails{
+					IPAddresses:         []string{"10.0.0.5", "2001:db8::10"},
+					CPUCount:            4,
+					TotalMemory:         8 << 30,
+					KernelVersion:       "5.15.0-41-generic",
+					BootTime:            time.Date(2022, 8, 1, 12, 0, 0, 0, time.UTC),
+					ProcessStartTime:    time.Date(2022, 8, 2, 12, 0, 0, 0, time.UTC),
+					ContainerID:         "0123456789abcdef",
+					KubernetesPodName:   "collector-abc",
+					KubernetesNamespace: "observiq",
+					CloudProvider:       "aws",
+				},
+			},
+			expected: &protobufs.AgentDescription{
+				IdentifyingAttributes: []*protobufs.KeyValue{
+					opamp.StringKeyValue("service.instance.id", "4322d8d1-f3e0-46db-b68d-b01a4689ef19"),
+					opamp.StringKeyValue("service.name", "com.observiq.collector"),
+					opamp.StringKeyValue("service.version", "v1.2.3"),
+					opamp.StringKeyValue("service.instance.name", "my-linux-box"),
+				},
+				NonIdentifyingAttributes: []*protobufs.KeyValue{
+					opamp.StringKeyValue("os.arch", "amd64"),
+					opamp.StringKeyValue("os.details", "os details"),
+					opamp.StringKeyValue("os.family", "linux"),
+					opamp.StringKeyValue("host.name", "my-linux-box"),
+					opamp.StringKeyValue("host.mac_address", "68-C7-B4-EB-A8-D2"),
+					opamp.StringArrayKeyValue("host.ip", []string{"10.0.0.5", "2001:db8::10"}),
+					opamp.IntKeyValue("host.cpu.count", 4),
+					opamp.IntKeyValue("host.memory.total", 8<<30),
+					opamp.StringKeyValue("os.kernel.version", "5.15.0-41-generic"),
+					opamp.StringKeyValue("host.boot.time", "2022-08-01T12:00:00Z"),
+					opamp.StringKeyValue("process.start.time", "2022-08-02T12:00:00Z"),
+					opamp.StringKeyValue("container.id", "0123456789abcdef"),
+					opamp.StringKeyValue("k8s.pod.name", "collector-abc"),
+					opamp.StringKeyValue("k8s.namespace.name", "observiq"),
+					opamp.StringKeyValue("cloud.provider", "aws"),
+				},
+			},
+		},
+		{
+			desc: "With user attributes",
+			ident: &identity{
+				agentID:     "4322d8d1-f3e0-46db-b68d-b01a4689ef19",
+				serviceName: "com.observiq.collector",
+				version:     "v1.2.3",
+				oSArch:      "amd64",
+				oSDetails:   "os details",
+				oSFamily:    "linux",
+				hostname:    "my-linux-box",
+				mac:         "68-C7-B4-EB-A8-D2",
+				attributes: &opamp.AttributesConfig{
+					Identifying: map[string]string{
+						"cluster": "prod-east",
+						// Reported attributes can't be overridden
+						"service.name": "other",
+					},
+					NonIdentifying: map[string]string{
+						"oncall":     "platform",
+						"datacenter": "us-east-1",
+					},
+				},
+			},
+			expected: &protobufs.AgentDescription{
+				IdentifyingAttributes: []*protobufs.KeyValue{
+					opamp.StringKeyValue("service.instance.id", "4322d8d1-f3e0-46db-b68d-b01a4689ef19"),
+					opamp.StringKeyValue("service.name", "com.observiq.collector"),
+					opamp.StringKeyValue("service.version", "v1.2.3"),
+					opamp.StringKeyValue("service.instance.name", "my-linux-box"),
+					opamp.StringKeyValue("cluster", "prod-east"),
+				},
+				NonIdentifyingAttributes: []*protobufs.KeyValue{
+					opamp.StringKeyValue("os.arch", "amd64"),
+					opamp.StringKeyValue("os.details", "os details"),
+					opamp.StringKeyValue("os.family", "linux"),
+					opamp.StringKeyValue("host.name", "my-linux-box"),
+					opamp.StringKeyValue("host.mac_address", "68-C7-B4-EB-A8-D2"),
+					opamp.StringKeyValue("datacenter", "us-east-1"),
+					opamp.StringKeyValue("oncall", "platform"),
+				},
+			},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -151,9 +254,22 @@ func Test_identityCopy(t *testing.T) {
 		oSFamily:    "linux",
 		hostname:    "my-linux-box",
 		mac:         "68-C7-B4-EB-A8-D2",
+		host: ios.HostDetails{
+			IPAddresses: []string{"10.0.0.5"},
+			CPUCount:    4,
+		},
+		attributes: &opamp.AttributesConfig{
+			NonIdentifying: map[string]string{"datacenter": "east"},
+		},
 	}
 
 	copyIdent := ident.Copy()
 
 	require.Equal(t, ident, copyIdent)
+
+	copyIdent.host.IPAddresses[0] = "10.0.0.6"
+	require.Equal(t, "10.0.0.5", ident.host.IPAddresses[0])
+
+	copyIdent.attributes.NonIdentifying["datacenter"] = "west"
+	require.Equal(t, "east", ident.attributes.NonIdentifying["datacenter"])
 }
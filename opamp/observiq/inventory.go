@@ -0,0 +1,236 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package observiq
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/observiq/observiq-otel-collector/factories"
+	"github.com/observiq/observiq-otel-collector/opamp"
+	"github.com/observiq/observiq-otel-collector/receiver/pluginreceiver"
+	"github.com/open-telemetry/opamp-go/protobufs"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/config"
+	"go.uber.org/zap"
+)
+
+// InventoryConfigName is the name of the inventory reported in the effective config.
+// Configs the server pushes with this name are ignored.
+const InventoryConfigName = "inventory.json"
+
+// inventory describes the components built into the collector and the plugins available to it
+type inventory struct {
+	Receivers  []componentInfo `json:"receivers"`
+	Processors []componentInfo `json:"processors"`
+	Exporters  []componentInfo `json:"exporters"`
+	Extensions []componentInfo `json:"extensions"`
+	Plugins    []pluginInfo    `json:"plugins"`
+}
+
+// componentInfo describes a component type and the stability of each signal it supports
+type componentInfo struct {
+	Type      string            `json:"type"`
+	Stability map[string]string `json:"stability,omitempty"`
+}
+
+// pluginInfo describes a plugin in the plugins file set.
+// Error is set instead of the plugin's details if it fails to load.
+type pluginInfo struct {
+	Name        string            `json:"name"`
+	Title       string            `json:"title,omitempty"`
+	Version     string            `json:"version,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Parameters  []pluginParameter `json:"parameters,omitempty"`
+	Error       string            `json:"error,omitempty"`
+}
+
+// pluginParameter describes a parameter of a plugin
+type pluginParameter struct {
+	Name      string        `json:"name"`
+	Type      string        `json:"type"`
+	Default   interface{}   `json:"default,omitempty"`
+	Supported []interface{} `json:"supported,omitempty"`
+	Required  bool          `json:"required,omitempty"`
+}
+
+// stabilityDataTypes are the signals the stability of components is reported for
+var stabilityDataTypes = []config.DataType{config.TracesDataType, config.MetricsDataType, config.LogsDataType}
+
+// newInventory collects the components from the factories and the plugins from the file set, if any
+func newInventory(available component.Factories, plugins *opamp.FileSet) inventory {
+	inv := inventory{
+		Receivers:  make([]componentInfo, 0, len(available.Receivers)),
+		Processors: make([]componentInfo, 0, len(available.Processors)),
+		Exporters:  make([]componentInfo, 0, len(available.Exporters)),
+		Extensions: make([]componentInfo, 0, len(available.Extensions)),
+		Plugins:    []pluginInfo{},
+	}
+
+	for _, factory := range available.Receivers {
+		inv.Receivers = append(inv.Receivers, newComponentInfo(factory))
+	}
+	for _, factory := range available.Processors {
+		inv.Processors = append(inv.Processors, newComponentInfo(factory))
+	}
+	for _, factory := range available.Exporters {
+		inv.Exporters = append(inv.Exporters, newComponentInfo(factory))
+	}
+	for _, factory := range available.Extensions {
+		inv.Extensions = append(inv.Extensions, newComponentInfo(factory))
+	}
+
+	for _, components := range [][]componentInfo{inv.Receivers, inv.Processors, inv.Exporters, inv.Extensions} {
+		sort.Slice(components, func(i, j int) bool { return components[i].Type < components[j].Type })
+	}
+
+	if plugins != nil {
+		inv.Plugins = collectPlugins(*plugins)
+	}
+
+	return inv
+}
+
+// newComponentInfo describes the component created by the factory
+func newComponentInfo(factory component.Factory) componentInfo {
+	info := componentInfo{
+		Type: string(factory.Type()),
+	}
+
+	for _, dataType := range stabilityDataTypes {
+		level := factory.StabilityLevel(dataType)
+		if level == component.StabilityLevelUndefined {
+			continue
+		}
+		if info.Stability == nil {
+			info.Stability = make(map[string]string)
+		}
+		info.Stability[string(dataType)] = level.String()
+	}
+
+	return info
+}
+
+// collectPlugins loads every plugin in the file set, sorted by name
+func collectPlugins(plugins opamp.FileSet) []pluginInfo {
+	infos := []pluginInfo{}
+
+	files, err := plugins.Files()
+	if err != nil {
+		return infos
+	}
+
+	for _, rel := range files {
+		info := pluginInfo{
+			Name: plugins.ConfigName(rel),
+		}
+
+		filePath, err := plugins.Resolve(rel)
+		if err == nil {
+			var plugin *pluginreceiver.Plugin
+			plugin, err = pluginreceiver.LoadPlugin(filePath)
+			if err == nil {
+				info.Title = plugin.Title
+				info.Version = plugin.Version
+				info.Description = plugin.Description
+				info.Parameters = newPluginParameters(plugin.Parameters)
+			}
+		}
+		if err != nil {
+			info.Error = err.Error()
+		}
+
+		infos = append(infos, info)
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// newPluginParameters describes the parameters of a plugin
+func newPluginParameters(parameters []pluginreceiver.Parameter) []pluginParameter {
+	infos := make([]pluginParameter, 0, len(parameters))
+	for _, parameter := range parameters {
+		info := pluginParameter{
+			Name:     parameter.Name,
+			Type:     string(parameter.Type),
+			Default:  jsonValue(parameter.Default),
+			Required: parameter.Required,
+		}
+		for _, supported := range parameter.Supported {
+			info.Supported = append(info.Supported, jsonValue(supported))
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// jsonValue converts the maps decoded from plugin YAML, which have interface keys, into maps that can be marshaled to JSON
+func jsonValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			converted[fmt.Sprint(key)] = jsonValue(val)
+		}
+		return converted
+	case []interface{}:
+		converted := make([]interface{}, 0, len(v))
+		for _, val := range v {
+			converted = append(converted, jsonValue(val))
+		}
+		return converted
+	default:
+		return value
+	}
+}
+
+// composeInventory returns the inventory of the collector as JSON
+func (c *Client) composeInventory() ([]byte, error) {
+	available, err := factories.DefaultFactories()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get collector components: %w", err)
+	}
+
+	data, err := json.Marshal(newInventory(available, c.pluginsFileSet))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal inventory: %w", err)
+	}
+	return data, nil
+}
+
+// addInventory adds the inventory to the effective config.
+// It's composed each time the effective config is, so the server sees plugin changes with the configs that caused them.
+func (c *Client) addInventory(effectiveConfig *protobufs.EffectiveConfig) {
+	data, err := c.composeInventory()
+	if err != nil {
+		c.getLogger().Warn("Omitting inventory from effective config", zap.Error(err))
+		return
+	}
+
+	configMap := effectiveConfig.GetConfigMap()
+	if configMap == nil {
+		return
+	}
+	if configMap.ConfigMap == nil {
+		configMap.ConfigMap = make(map[string]*protobufs.AgentConfigFile)
+	}
+
+	configMap.ConfigMap[InventoryConfigName] = &protobufs.AgentConfigFile{
+		Body:        data,
+		ContentType: opamp.JSONContentType,
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package observiq
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/observiq/observiq-otel-collector/factories"
+	"github.com/observiq/observiq-otel-collector/opamp"
+	"github.com/observiq/observiq-otel-collector/opamp/mocks"
+	"github.com/open-telemetry/opamp-go/protobufs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestNewInventory(t *testing.T) {
+	pluginsDir := t.TempDir()
+	redisPlugin := `
+title: Redis
+version: 0.0.1
+description: Log parser for Redis
+template: |
+  receivers:
+    filelog:
+      include: {{ .file_path }}
+parameters:
+  - name: file_path
+    type: "[]string"
+    default: ["/var/log/redis/redis-server.log"]
+  - name: start_at
+    type: string
+    supported: [beginning, end]
+    default: end
+  - name: attributes
+    type: map
+    default:
+      env: prod
+`
+	require.NoError(t, os.WriteFile(filepath.Join(pluginsDir, "redis.yaml"), []byte(redisPlugin), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(pluginsDir, "broken.yaml"), []byte("title: [unclosed"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(pluginsDir, "README.md"), []byte("not a plugin"), 0600))
+
+	available, err := factories.DefaultFactories()
+	require.NoError(t, err)
+
+	plugins := pluginsFileSet(pluginsDir)
+	inv := newInventory(available, &plugins)
+
+	// Components are sorted and include their stability
+	require.Len(t, inv.Receivers, len(available.Receivers))
+	require.Len(t, inv.Processors, len(available.Processors))
+	require.Len(t, inv.Exporters, len(available.Exporters))
+	require.Len(t, inv.Extensions, len(available.Extensions))
+	for i := 1; i < len(inv.Receivers); i++ {
+		assert.Less(t, inv.Receivers[i-1].Type, inv.Receivers[i].Type)
+	}
+
+	var otlp *componentInfo
+	for i, receiver := range inv.Receivers {
+		if receiver.Type == "otlp" {
+			otlp = &inv.Receivers[i]
+		}
+	}
+	require.NotNil(t, otlp)
+	assert.Equal(t, "stable", otlp.Stability["traces"])
+	assert.Contains(t, otlp.Stability, "metrics")
+	assert.Contains(t, otlp.Stability, "logs")
+
+	// Plugins are sorted by name and failures are reported
+	require.Len(t, inv.Plugins, 2)
+	assert.Equal(t, "plugins/broken.yaml", inv.Plugins[0].Name)
+	assert.Contains(t, inv.Plugins[0].Error, "failed to unmarshal plugin")
+
+	redis := inv.Plugins[1]
+	assert.Equal(t, "plugins/redis.yaml", redis.Name)
+	assert.Equal(t, "Redis", redis.Title)
+	assert.Equal(t, "0.0.1", redis.Version)
+	assert.Equal(t, "Log parser for Redis", redis.Description)
+	assert.Empty(t, redis.Error)
+	require.Len(t, redis.Parameters, 3)
+	assert.Equal(t, pluginParameter{Name: "start_at", Type: "string", Default: "end", Supported: []interface{}{"beginning", "end"}}, redis.Parameters[1])
+
+	// Parameters with map defaults can be marshaled
+	data, err := json.Marshal(inv)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"default":{"env":"prod"}`)
+}
+
+func TestNewInventoryWithoutPlugins(t *testing.T) {
+	available, err := factories.DefaultFactories()
+	require.NoError(t, err)
+
+	inv := newInventory(available, nil)
+	assert.Empty(t, inv.Plugins)
+
+	// Plugins are always a list so the server can tell there are none
+	data, err := json.Marshal(inv)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"plugins":[]`)
+}
+
+func TestClient_onGetEffectiveConfigHandlerInventory(t *testing.T) {
+	mockManager := mocks.NewMockConfigManager(t)
+	mockManager.On("ComposeEffectiveConfig").Return(&protobufs.EffectiveConfig{
+		ConfigMap: &protobufs.AgentConfigMap{
+			ConfigMap: map[string]*protobufs.AgentConfigFile{
+				CollectorConfigName: {Body: []byte("receivers:"), ContentType: opamp.YAMLContentType},
+			},
+		},
+	}, nil)
+
+	plugins := pluginsFileSet(t.TempDir())
+	c := &Client{
+		logger:         zap.NewNop(),
+		configManager:  mockManager,
+		pluginsFileSet: &plugins,
+	}
+
+	effectiveConfig, err := c.onGetEffectiveConfigHandler(context.Background())
+	require.NoError(t, err)
+
+	configMap := effectiveConfig.GetConfigMap().GetConfigMap()
+	require.Contains(t, configMap, CollectorConfigName)
+	require.Contains(t, configMap, InventoryConfigName)
+	assert.Equal(t, opamp.JSONContentType, configMap[InventoryConfigName].GetContentType())
+
+	var inv inventory
+	require.NoError(t, json.Unmarshal(configMap[InventoryConfigName].GetBody(), &inv))
+	assert.NotEmpty(t, inv.Receivers)
+	assert.Empty(t, inv.Plugins)
+}
@@ -17,17 +17,26 @@ package observiq
 
 import (
 	"context"
+	"crypto/ecdsa"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/cenkalti/backoff/v4"
 	"github.com/observiq/observiq-otel-collector/collector"
+	"github.com/observiq/observiq-otel-collector/internal/telemetry"
 	"github.com/observiq/observiq-otel-collector/internal/version"
 	"github.com/observiq/observiq-otel-collector/opamp"
 	"github.com/open-telemetry/opamp-go/client"
 	"github.com/open-telemetry/opamp-go/client/types"
 	"github.com/open-telemetry/opamp-go/protobufs"
+	"go.opencensus.io/metric"
+	"go.opencensus.io/metric/metricproducer"
 	"go.uber.org/zap"
 )
 
@@ -42,12 +51,92 @@ var _ opamp.Client = (*Client)(nil)
 // Client represents a client that is connected to Iris via OpAmp
 type Client struct {
 	opampClient   client.OpAMPClient
-	logger        *zap.Logger
-	ident         *identity
 	configManager opamp.ConfigManager
 	collector     collector.Collector
 
+	// stateMux guards the logger, identity, and current config which are replaced by reloads.
+	// They are never modified in place once set.
+	stateMux      sync.RWMutex
+	logger        *zap.Logger
+	ident         *identity
 	currentConfig opamp.Config
+
+	managerConfigPath string
+
+	// redactionKey is the key masks of sensitive values are computed with
+	redactionKey string
+
+	// applyMux serializes changes to the configs and connection settings
+	applyMux   sync.Mutex
+	applyQueue *applyQueue
+
+	// unconfirmedVersions are the config versions from before a remote config superseded while applying or during its probation.
+	// The next remote config is rolled back to them if it fails probation. Guarded by applyMux.
+	unconfirmedVersions map[string]int
+
+	// auditLog records remote configs. Nil if disabled.
+	auditLog *opamp.AuditLog
+
+	// pluginsFileSet is the file set plugins are read from for the inventory. Nil if plugins aren't managed.
+	pluginsFileSet *opamp.FileSet
+
+	// opampMux guards swapping out the OpAMP client when connection settings change or it reconnects
+	opampMux      sync.Mutex
+	opampStopped  bool
+	disconnected  bool
+	opampSettings types.StartSettings
+
+	// describedIdent and remoteConfigStatus are the last set on the OpAMP client, carried over to the next one
+	describedIdent     *identity
+	remoteConfigStatus *protobufs.RemoteConfigStatus
+
+	// reconnectDone is closed on disconnect to stop waiting to reconnect
+	reconnectDone chan struct{}
+
+	// failures receives the failure the client couldn't recover from.
+	// failureMonitorDone is closed on disconnect to stop checking for failures.
+	failures           chan error
+	failureMonitorDone chan struct{}
+	failureMonitorStop sync.Once
+	failureMonitorWG   sync.WaitGroup
+
+	// connMux guards the connection status and reconnect state.
+	// It's acquired from OpAMP client callbacks so opampMux must never be acquired while holding it.
+	connMux          sync.Mutex
+	connStatus       opamp.ConnectionStatus
+	connFailures     map[opamp.ConnectionState]int64
+	endpointHealth   map[string]*opamp.EndpointHealth
+	opampGen         uint64
+	reconnecting     bool
+	reconnectBackOff backoff.BackOff
+	connMetrics      *metric.Registry
+
+	// statusTransitions are the most recent connection status transitions reported in diagnostics
+	statusTransitions []statusTransition
+
+	// enrollMux guards the key and certificate signing request of a pending enrollment
+	enrollMux sync.Mutex
+	enrollKey *ecdsa.PrivateKey
+	enrollCSR []byte
+
+	// diagMux guards the diagnostics reported in the effective config and the request they were collected for
+	diagMux       sync.Mutex
+	diagRequestID string
+	diagRunning   bool
+	diagReport    []byte
+
+	// pendingConnSettings holds the connection settings offered by the server
+	// between the offer being tested and accepted
+	pendingConnSettings *opamp.Config
+	connSettingsMux     sync.Mutex
+
+	// ownTelemetryMux guards the destinations the collector's own telemetry is sent to
+	ownTelemetryMux     sync.Mutex
+	ownTelemetryStopped bool
+	ownMetricsSettings  *protobufs.TelemetryConnectionSettings
+	ownMetrics          *telemetry.MetricsReporter
+	ownLogsSettings     *protobufs.TelemetryConnectionSettings
+	ownLogs             *telemetry.LogsCore
 }
 
 // NewClientArgs arguments passed when creating a new client
@@ -59,6 +148,9 @@ type NewClientArgs struct {
 	ManagerConfigPath   string
 	CollectorConfigPath string
 	LoggerConfigPath    string
+
+	// PluginsDir is the directory the server may write plugins to. Plugins are not managed if empty.
+	PluginsDir string
 }
 
 // NewClient creates a new OpAmp client
@@ -67,18 +159,45 @@ func NewClient(args *NewClientArgs) (opamp.Client, error) {
 
 	configManager := NewAgentConfigManager(args.DefaultLogger)
 
-	observiqClient := &Client{
-		logger:        clientLogger,
-		ident:         newIdentity(clientLogger, args.Config),
-		configManager: configManager,
-		collector:     args.Collector,
-		currentConfig: args.Config,
+	// Masks are keyed with a secret kept next to the manager config so they can't be reversed by the server
+	redactionKey, err := opamp.LoadRedactionKey(filepath.Join(filepath.Dir(args.ManagerConfigPath), opamp.RedactionKeyFileName))
+	if err != nil {
+		return nil, err
 	}
 
-	// Parse URL to determin scheme
-	opampURL, err := url.Parse(args.Config.Endpoint)
+	redactor, err := opamp.NewRedactor(redactionKey, args.Config.Redaction)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to create redactor: %w", err)
+	}
+	configManager.SetRedactor(redactor)
+
+	observiqClient := &Client{
+		logger:             clientLogger,
+		ident:              newIdentity(clientLogger, args.Config),
+		configManager:      configManager,
+		collector:          args.Collector,
+		currentConfig:      args.Config,
+		managerConfigPath:  args.ManagerConfigPath,
+		redactionKey:       redactionKey,
+		reconnectDone:      make(chan struct{}),
+		failures:           make(chan error, 1),
+		failureMonitorDone: make(chan struct{}),
+	}
+	observiqClient.applyQueue = newApplyQueue(observiqClient.applyRemoteConfig)
+
+	if args.Config.Audit != nil {
+		auditLog, err := opamp.NewAuditLog(*args.Config.Audit)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create audit log: %w", err)
+		}
+		observiqClient.auditLog = auditLog
+	}
+
+	// Validate the URL scheme before doing any work
+	for _, endpoint := range args.Config.GetEndpoints() {
+		if err := validateEndpoint(endpoint.Endpoint); err != nil {
+			return nil, err
+		}
 	}
 
 	// Add managed configs
@@ -86,18 +205,90 @@ func NewClient(args *NewClientArgs) (opamp.Client, error) {
 		return nil, err
 	}
 
-	// Create collect client based on URL scheme
+	opampClient, err := newOpAMPClient(clientLogger, args.Config.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	observiqClient.opampClient = opampClient
+
+	connMetrics, err := observiqClient.newConnectionMetrics()
+	if err != nil {
+		return nil, err
+	}
+	observiqClient.connMetrics = connMetrics
+
+	return observiqClient, nil
+}
+
+// newOpAMPClient creates the underlying OpAMP client based on the URL scheme of the endpoint.
+// It is a variable so tests can substitute a mock client.
+var newOpAMPClient = func(logger *zap.Logger, endpoint string) (client.OpAMPClient, error) {
+	if err := validateEndpoint(endpoint); err != nil {
+		return nil, err
+	}
+
+	return client.NewWebSocket(logger.Sugar()), nil
+}
+
+// validateEndpoint verifies the endpoint is a parsable URL with a supported scheme
+func validateEndpoint(endpoint string) error {
+	opampURL, err := url.Parse(endpoint)
+	if err != nil {
+		return err
+	}
+
 	switch opampURL.Scheme {
 	case "ws", "wss":
-		observiqClient.opampClient = client.NewWebSocket(clientLogger.Sugar())
+		return nil
 	default:
-		return nil, ErrUnsupportedURL
+		return ErrUnsupportedURL
 	}
+}
 
-	return observiqClient, nil
+// getLogger returns the client's current logger
+func (c *Client) getLogger() *zap.Logger {
+	c.stateMux.RLock()
+	defer c.stateMux.RUnlock()
+	return c.logger
+}
+
+// setLogger replaces the client's logger
+func (c *Client) setLogger(logger *zap.Logger) {
+	c.stateMux.Lock()
+	defer c.stateMux.Unlock()
+	c.logger = logger
+}
+
+// getIdent returns the client's current identity. It must not be modified.
+func (c *Client) getIdent() *identity {
+	c.stateMux.RLock()
+	defer c.stateMux.RUnlock()
+	return c.ident
+}
+
+// getCurrentConfig returns the client's current config. It must not be modified.
+func (c *Client) getCurrentConfig() opamp.Config {
+	c.stateMux.RLock()
+	defer c.stateMux.RUnlock()
+	return c.currentConfig
+}
+
+// setCurrentConfig replaces the client's current config and, if not nil, its identity
+func (c *Client) setCurrentConfig(cfg opamp.Config, ident *identity) {
+	c.stateMux.Lock()
+	defer c.stateMux.Unlock()
+	c.currentConfig = cfg
+	if ident != nil {
+		c.ident = ident
+	}
 }
 
 func (c *Client) addManagedConfigs(args *NewClientArgs) error {
+	// A new agent may start with only the manager config and wait for the server to configure it
+	if err := c.ensureBootstrapConfigs(args); err != nil {
+		return err
+	}
+
 	// Add configs to config manager
 	managerManagedConfig, err := opamp.NewManagedConfig(args.ManagerConfigPath, managerReload(c, args.ManagerConfigPath))
 	if err != nil {
@@ -117,46 +308,45 @@ func (c *Client) addManagedConfigs(args *NewClientArgs) error {
 	}
 	c.configManager.AddConfig(LoggingConfigName, loggerManagedConfig)
 
+	pluginsConfigured := false
+	for _, fileSet := range args.Config.FileSets {
+		if err := c.configManager.AddFileSet(fileSet, nil, fileSetOnChange(c, fileSet)); err != nil {
+			return fmt.Errorf("failed to add file set %s: %w", fileSet.Name, err)
+		}
+		if fileSet.Name == PluginsFileSetName {
+			fileSet := fileSet
+			c.pluginsFileSet = &fileSet
+			pluginsConfigured = true
+		}
+	}
+
+	// A plugins file set in the manager config replaces the default one
+	if args.PluginsDir != "" && !pluginsConfigured {
+		fileSet := pluginsFileSet(args.PluginsDir)
+		if err := c.configManager.AddFileSet(fileSet, validatePlugin, pluginsOnChange(c, args.CollectorConfigPath)); err != nil {
+			return fmt.Errorf("failed to add plugins: %w", err)
+		}
+		c.pluginsFileSet = &fileSet
+	}
+
 	return nil
 }
 
 // Connect initiates a connection to the OpAmp server
 func (c *Client) Connect(ctx context.Context) error {
 	// Compose and set the agent description
-	if err := c.opampClient.SetAgentDescription(c.ident.ToAgentDescription()); err != nil {
-		c.logger.Error("Error while setting agent description", zap.Error(err))
+	if err := c.setAgentDescription(c.getIdent()); err != nil {
+		c.getLogger().Error("Error while setting agent description", zap.Error(err))
 		return err
 	}
 
-	tlsCfg, err := c.currentConfig.ToTLS()
+	settings, err := c.startSettings(c.getCurrentConfig())
 	if err != nil {
-		return fmt.Errorf("failed creating TLS config: %w", err)
-	}
-
-	settings := types.StartSettings{
-		OpAMPServerURL: c.currentConfig.Endpoint,
-		Header: http.Header{
-			"Authorization":  []string{fmt.Sprintf("Secret-Key %s", c.currentConfig.GetSecretKey())},
-			"User-Agent":     []string{fmt.Sprintf("observiq-otel-collector/%s", version.Version())},
-			"OpAMP-Version":  []string{opamp.Version()},
-			"Agent-ID":       []string{c.ident.agentID},
-			"Agent-Version":  []string{version.Version()},
-			"Agent-Hostname": []string{c.ident.hostname},
-		},
-		TLSConfig:   tlsCfg,
-		InstanceUid: c.ident.agentID,
-		Callbacks: types.CallbacksStruct{
-			OnConnectFunc:          c.onConnectHandler,
-			OnConnectFailedFunc:    c.onConnectFailedHandler,
-			OnErrorFunc:            c.onErrorHandler,
-			OnMessageFunc:          c.onMessageFuncHandler,
-			GetEffectiveConfigFunc: c.onGetEffectiveConfigHandler,
-			// Unimplemented handlers
-			// OnOpampConnectionSettingsFunc
-			// OnOpampConnectionSettingsAcceptedFunc
-			// OnCommandFunc
-			// SaveRemoteConfigStatusFunc
-		},
+		return err
+	}
+
+	if c.awaitingConfiguration() {
+		c.getLogger().Info("Awaiting configuration from server")
 	}
 
 	// Start the embedded collector
@@ -166,63 +356,246 @@ func (c *Client) Connect(ctx context.Context) error {
 		return fmt.Errorf("collector failed to start: %w", err)
 	}
 
-	return c.opampClient.Start(ctx, settings)
+	// Remote configs may be received as soon as the OpAMP client starts
+	c.applyQueue.start()
+
+	if c.connMetrics != nil {
+		metricproducer.GlobalManager().AddProducer(c.connMetrics)
+	}
+
+	// The certificate signing request is reported in the first effective config
+	if c.getCurrentConfig().Enrollment.IsEnabled() {
+		c.checkEnrollment()
+		go c.enrollmentLoop(c.reconnectDone)
+	}
+
+	c.opampMux.Lock()
+	err = c.startOpAMPClient(ctx, c.opampClient, settings)
+	c.opampMux.Unlock()
+	if err != nil {
+		return err
+	}
+
+	c.startFailureMonitor()
+	return nil
+}
+
+// startSettings creates the settings used to start the OpAMP client with the given config
+func (c *Client) startSettings(cfg opamp.Config) (types.StartSettings, error) {
+	tlsCfg, err := cfg.ToTLS()
+	if err != nil {
+		return types.StartSettings{}, fmt.Errorf("failed creating TLS config: %w", err)
+	}
+
+	ident := c.getIdent()
+
+	header := http.Header{
+		"Authorization":  []string{fmt.Sprintf("Secret-Key %s", cfg.GetSecretKey())},
+		"User-Agent":     []string{fmt.Sprintf("observiq-otel-collector/%s", version.Version())},
+		"OpAMP-Version":  []string{opamp.Version()},
+		"Agent-ID":       []string{ident.agentID},
+		"Agent-Version":  []string{version.Version()},
+		"Agent-Hostname": []string{ident.hostname},
+	}
+
+	// Add additional headers without overwriting the ones the server relies on
+	for key, value := range cfg.Headers {
+		if !hasHeader(header, key) {
+			header.Set(key, value)
+		}
+	}
+
+	return types.StartSettings{
+		OpAMPServerURL: cfg.Endpoint,
+		Header:         header,
+		TLSConfig:      tlsCfg,
+		InstanceUid:    ident.agentID,
+		Callbacks: types.CallbacksStruct{
+			OnConnectFunc:                         c.onConnectHandler,
+			OnConnectFailedFunc:                   c.onConnectFailedHandler,
+			OnErrorFunc:                           c.onErrorHandler,
+			OnMessageFunc:                         c.onMessageFuncHandler,
+			GetEffectiveConfigFunc:                c.onGetEffectiveConfigHandler,
+			OnOpampConnectionSettingsFunc:         c.onOpampConnectionSettingsHandler,
+			OnOpampConnectionSettingsAcceptedFunc: c.onOpampConnectionSettingsAcceptedHandler,
+			// Unimplemented handlers
+			// OnCommandFunc
+			// SaveRemoteConfigStatusFunc
+		},
+	}, nil
+}
+
+// hasHeader does a case insensitive check for the key in the header
+func hasHeader(header http.Header, key string) bool {
+	for k := range header {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return false
 }
 
 // Disconnect disconnects from the server
 func (c *Client) Disconnect(ctx context.Context) error {
+	// Cancel any apply in progress before stopping the collector it may be restarting
+	c.applyQueue.stop()
+
+	// Stopping the collector must not be mistaken for a failure
+	c.stopFailureMonitor()
+
 	c.collector.Stop()
+	c.stopOwnTelemetry()
+
+	if c.auditLog != nil {
+		if err := c.auditLog.Close(); err != nil {
+			c.getLogger().Warn("Failed to close audit log", zap.Error(err))
+		}
+	}
+
+	if c.connMetrics != nil {
+		metricproducer.GlobalManager().DeleteProducer(c.connMetrics)
+	}
+
+	c.opampMux.Lock()
+	defer c.opampMux.Unlock()
+
+	if !c.disconnected && c.reconnectDone != nil {
+		close(c.reconnectDone)
+	}
+	c.disconnected = true
+
+	c.connMux.Lock()
+	c.setConnectionStatus(opamp.ConnectionStatus{State: opamp.ConnectionStateDisconnected})
+	c.connMux.Unlock()
+
+	if c.opampStopped {
+		return nil
+	}
 	return c.opampClient.Stop(ctx)
 }
 
+// RestartCollector restarts the collector once any remote config being applied is done
+func (c *Client) RestartCollector(ctx context.Context) error {
+	c.applyMux.Lock()
+	defer c.applyMux.Unlock()
+
+	c.getLogger().Info("Restarting collector")
+	if err := c.collector.Restart(ctx); err != nil {
+		return fmt.Errorf("failed to restart collector: %w", err)
+	}
+	return nil
+}
+
 // client callbacks
 
 func (c *Client) onConnectHandler() {
-	c.logger.Info("Successfully connected to server")
+	c.getLogger().Info("Successfully connected to server")
 }
 
 func (c *Client) onConnectFailedHandler(err error) {
-	c.logger.Error("Failed to connect to server", zap.Error(err))
+	c.getLogger().Error("Failed to connect to server", zap.Error(err))
 }
 
 func (c *Client) onErrorHandler(errResp *protobufs.ServerErrorResponse) {
-	c.logger.Error("Server returned an error response", zap.String("Error", errResp.GetErrorMessage()))
+	c.getLogger().Error("Server returned an error response", zap.String("Error", errResp.GetErrorMessage()))
 }
 
 func (c *Client) onMessageFuncHandler(ctx context.Context, msg *types.MessageData) {
-	c.logger.Debug("On message handler")
+	c.getLogger().Debug("On message handler")
+	if msg.AgentIdentification != nil {
+		c.onAgentIdentificationHandler(msg.AgentIdentification)
+	}
+
 	if msg.RemoteConfig != nil {
-		if err := c.onRemoteConfigHandler(ctx, msg.RemoteConfig); err != nil {
-			c.logger.Error("Error while processing Remote Config Change", zap.Error(err))
+		c.handleDiagnosticsRequest(msg.RemoteConfig)
+
+		// Applying can take a while so it's done on the apply queue instead of blocking the callback
+		if superseded := c.applyQueue.enqueue(msg.RemoteConfig); superseded != nil {
+			c.getLogger().Info("Skipping remote config superseded by a newer one", zap.Binary("hash", superseded.GetConfigHash()))
+			c.auditSuperseded(superseded)
 		}
 	}
+
+	if msg.OwnMetricsConnSettings != nil || msg.OwnLogsConnSettings != nil || msg.OwnTracesConnSettings != nil {
+		c.onOwnTelemetryHandler(msg)
+	}
+}
+
+// applyRemoteConfig is called by the apply queue to apply a remote config
+func (c *Client) applyRemoteConfig(ctx context.Context, remoteConfig *protobufs.AgentRemoteConfig) {
+	if err := c.onRemoteConfigHandler(ctx, remoteConfig); err != nil {
+		c.getLogger().Error("Error while processing Remote Config Change", zap.Error(err))
+	}
 }
 
 func (c *Client) onRemoteConfigHandler(ctx context.Context, remoteConfig *protobufs.AgentRemoteConfig) error {
-	c.logger.Debug("Remote config handler")
+	c.getLogger().Debug("Remote config handler")
+
+	c.applyMux.Lock()
+	defer c.applyMux.Unlock()
+
+	// Note the current versions so a config that fails probation can be rolled back.
+	// A config superseded while applying or during its probation is still unconfirmed, so its previous versions are used instead.
+	probation := c.getCurrentConfig().Probation
+	var versions map[string]int
+	if probation.Enabled() {
+		versions = c.unconfirmedVersions
+		if versions == nil {
+			versions = c.configVersions()
+		}
+	}
+	unconfirmed := c.unconfirmedVersions != nil
+	c.unconfirmedVersions = nil
+
+	auditEntry := c.newAuditEntry(remoteConfig)
+	before := c.snapshotConfigs()
+
+	applyStart := time.Now()
+	changed, err := c.configManager.ApplyConfigChanges(ctx, remoteConfig)
+	auditEntry.AddStep("apply", applyStart, err)
+
+	// A newer config cancelled the apply. Changes that weren't rolled back stay unconfirmed until the newer config is applied.
+	if err != nil && applySuperseded(ctx) {
+		c.getLogger().Info("Remote config superseded while applying", zap.Binary("hash", remoteConfig.GetConfigHash()), zap.Error(err))
+		err = errApplySuperseded
+	}
 
-	changed, err := c.configManager.ApplyConfigChanges(remoteConfig)
 	remoteCfgStatus := &protobufs.RemoteConfigStatus{
 		LastRemoteConfigHash: remoteConfig.GetConfigHash(),
 		Status:               protobufs.RemoteConfigStatus_APPLIED,
 	}
 
-	// If we received and error apply it to the config
-	if err != nil {
-		c.logger.Error("Failed applying remote config", zap.Error(err))
-
-		remoteCfgStatus.Status = protobufs.RemoteConfigStatus_FAILED
-		remoteCfgStatus.ErrorMessage = fmt.Sprintf("Failed to apply config changes: %s", err.Error())
+	// Only confirm the config once the collector stays healthy with it
+	if err == nil && (changed || unconfirmed) && probation.Enabled() {
+		err = c.runProbation(ctx, remoteConfig, probation, versions, auditEntry)
+	} else if err != nil && unconfirmed {
+		// The superseded config is still in place
+		c.unconfirmedVersions = versions
 	}
 
-	// Set the remote config status
-	if err := c.opampClient.SetRemoteConfigStatus(remoteCfgStatus); err != nil {
-		return fmt.Errorf("failed to set remote config status: %w", err)
+	c.writeAudit(auditEntry, remoteConfig, before, changed, err)
+
+	if errors.Is(err, errApplySuperseded) {
+		// The newer config reports the status once it's applied
+		c.unconfirmedVersions = versions
+	} else {
+		// If we received and error apply it to the config
+		if err != nil {
+			c.getLogger().Error("Failed applying remote config", zap.Error(err))
+
+			remoteCfgStatus.Status = protobufs.RemoteConfigStatus_FAILED
+			remoteCfgStatus.ErrorMessage = fmt.Sprintf("Failed to apply config changes: %s", err.Error())
+		}
+
+		// Set the remote config status
+		if err := c.setRemoteConfigStatus(remoteCfgStatus); err != nil {
+			return fmt.Errorf("failed to set remote config status: %w", err)
+		}
 	}
 
 	// If we changed the config call UpdateEffectiveConfig
 	if changed {
-		if err := c.opampClient.UpdateEffectiveConfig(ctx); err != nil {
+		if err := c.getOpAMPClient().UpdateEffectiveConfig(ctx); err != nil {
 			return fmt.Errorf("failed to update effective config: %w", err)
 		}
 	}
@@ -230,6 +603,28 @@ func (c *Client) onRemoteConfigHandler(ctx context.Context, remoteConfig *protob
 }
 
 func (c *Client) onGetEffectiveConfigHandler(_ context.Context) (*protobufs.EffectiveConfig, error) {
-	c.logger.Debug("Remote Compose Effective config handler")
-	return c.configManager.ComposeEffectiveConfig()
+	c.getLogger().Debug("Remote Compose Effective config handler")
+	effectiveConfig, err := c.configManager.ComposeEffectiveConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	c.addInventory(effectiveConfig)
+	c.addCertificateRequest(effectiveConfig)
+	c.addDiagnostics(effectiveConfig)
+	return effectiveConfig, nil
+}
+
+// reportEffectiveConfig sends the effective config to the server outside of a remote config being applied.
+// The reason describes what changed in the error logged if it can't be sent.
+func (c *Client) reportEffectiveConfig(reason string) {
+	c.opampMux.Lock()
+	defer c.opampMux.Unlock()
+	if c.disconnected {
+		return
+	}
+
+	if err := c.opampClient.UpdateEffectiveConfig(context.Background()); err != nil {
+		c.getLogger().Error("Failed to report effective config", zap.String("reason", reason), zap.Error(err))
+	}
 }
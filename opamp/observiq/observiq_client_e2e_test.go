@@ -0,0 +1,351 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package observiq
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	colmocks "github.com/observiq/observiq-otel-collector/collector/mocks"
+	"github.com/observiq/observiq-otel-collector/opamp"
+	"github.com/observiq/observiq-otel-collector/opamp/opamptest"
+	"github.com/open-telemetry/opamp-go/protobufs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// e2eTimeout is how long to wait for the agent to report to the test server
+const e2eTimeout = 10 * time.Second
+
+const (
+	e2eSecretKey       = "b92222ee-a1fc-4bb1-98db-26de3448541b"
+	e2eAgentID         = "d4691426-b0bb-41f7-84a8-320a9ec0ea2e"
+	e2eCollectorConfig = "receivers:\n  hostmetrics:\n"
+	e2eLoggingConfig   = "output: stdout\nlevel: info\n"
+)
+
+func TestClientE2E(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		testFunc func(*testing.T)
+	}{
+		{
+			desc: "Reports description and effective config",
+			testFunc: func(t *testing.T) {
+				server := opamptest.NewServer(t, opamptest.WithSecretKey(e2eSecretKey))
+				newE2EClient(t, server.Endpoint(), newE2ECollector(t))
+
+				status, err := server.WaitFor(e2eTimeout, func(status opamptest.AgentStatus) bool {
+					return status.Connected && status.Description != nil && status.EffectiveConfig != nil
+				})
+				require.NoError(t, err)
+
+				assert.Equal(t, e2eAgentID, status.InstanceUID)
+				assert.Equal(t, e2eAgentID, findAttribute(status.Description.GetIdentifyingAttributes(), "service.instance.id"))
+				assert.Equal(t, server.Endpoint(), findAttribute(status.Description.GetNonIdentifyingAttributes(), endpointAttribute))
+
+				configMap := status.EffectiveConfig.GetConfigMap().GetConfigMap()
+				assert.Equal(t, []byte(e2eCollectorConfig), configMap[CollectorConfigName].GetBody())
+				assert.Equal(t, []byte(e2eLoggingConfig), configMap[LoggingConfigName].GetBody())
+				assert.Contains(t, configMap, ManagerConfigName)
+				assert.Contains(t, configMap, InventoryConfigName)
+
+				// The full state is reported again on request
+				messages := len(server.Messages())
+				require.NoError(t, server.RequestFullState())
+				_, err = server.WaitFor(e2eTimeout, func(opamptest.AgentStatus) bool {
+					return len(server.Messages()) > messages
+				})
+				require.NoError(t, err)
+
+				latest := server.Messages()[len(server.Messages())-1]
+				assert.NotNil(t, latest.GetAgentDescription())
+				assert.NotNil(t, latest.GetEffectiveConfig())
+			},
+		},
+		{
+			desc: "Applies remote config",
+			testFunc: func(t *testing.T) {
+				server := opamptest.NewServer(t, opamptest.WithSecretKey(e2eSecretKey))
+
+				collector := newE2ECollector(t)
+				collector.On("ValidateConfig", mock.Anything, mock.Anything).Return(nil)
+				collector.On("Restart", mock.Anything).Return(nil).Once()
+				dir := newE2EClient(t, server.Endpoint(), collector)
+				waitForE2EConnect(t, server)
+
+				newCollectorConfig := []byte("receivers:\n  otlp:\n")
+				hash, err := server.PushRemoteConfig(map[string]*protobufs.AgentConfigFile{
+					CollectorConfigName: {Body: newCollectorConfig, ContentType: opamp.YAMLContentType},
+				})
+				require.NoError(t, err)
+
+				status, err := server.WaitFor(e2eTimeout, func(status opamptest.AgentStatus) bool {
+					return bytes.Equal(hash, status.RemoteConfigStatus.GetLastRemoteConfigHash()) &&
+						bytes.Equal(newCollectorConfig, status.EffectiveConfig.GetConfigMap().GetConfigMap()[CollectorConfigName].GetBody())
+				})
+				require.NoError(t, err)
+				assert.Equal(t, protobufs.RemoteConfigStatus_APPLIED, status.RemoteConfigStatus.GetStatus())
+
+				contents, err := os.ReadFile(filepath.Join(dir, CollectorConfigName))
+				require.NoError(t, err)
+				assert.Equal(t, newCollectorConfig, contents)
+			},
+		},
+		{
+			desc: "Rolls back remote config that fails to start",
+			testFunc: func(t *testing.T) {
+				server := opamptest.NewServer(t, opamptest.WithSecretKey(e2eSecretKey))
+
+				collector := newE2ECollector(t)
+				collector.On("ValidateConfig", mock.Anything, mock.Anything).Return(nil)
+				collector.On("Restart", mock.Anything).Return(errors.New("failed to start receiver")).Once()
+				collector.On("Restart", mock.Anything).Return(nil).Once()
+				dir := newE2EClient(t, server.Endpoint(), collector)
+				waitForE2EConnect(t, server)
+
+				hash, err := server.PushRemoteConfig(map[string]*protobufs.AgentConfigFile{
+					CollectorConfigName: {Body: []byte("receivers:\n  broken:\n"), ContentType: opamp.YAMLContentType},
+				})
+				require.NoError(t, err)
+
+				status, err := server.WaitFor(e2eTimeout, func(status opamptest.AgentStatus) bool {
+					return bytes.Equal(hash, status.RemoteConfigStatus.GetLastRemoteConfigHash())
+				})
+				require.NoError(t, err)
+				assert.Equal(t, protobufs.RemoteConfigStatus_FAILED, status.RemoteConfigStatus.GetStatus())
+				assert.Contains(t, status.RemoteConfigStatus.GetErrorMessage(), "failed to start receiver")
+				assert.Equal(t, []byte(e2eCollectorConfig), status.EffectiveConfig.GetConfigMap().GetConfigMap()[CollectorConfigName].GetBody())
+
+				contents, err := os.ReadFile(filepath.Join(dir, CollectorConfigName))
+				require.NoError(t, err)
+				assert.Equal(t, []byte(e2eCollectorConfig), contents)
+			},
+		},
+		{
+			desc: "Switches to offered connection settings",
+			testFunc: func(t *testing.T) {
+				server := opamptest.NewServer(t, opamptest.WithSecretKey(e2eSecretKey))
+
+				newSecretKey := "136bdd08-2074-40b7-ac1c-6706ac24c4f2"
+				newServer := opamptest.NewServer(t, opamptest.WithSecretKey(newSecretKey))
+
+				dir := newE2EClient(t, server.Endpoint(), newE2ECollector(t))
+				waitForE2EConnect(t, server)
+
+				err := server.OfferConnectionSettings(&protobufs.OpAMPConnectionSettings{
+					DestinationEndpoint: newServer.Endpoint(),
+					Headers: &protobufs.Headers{
+						Headers: []*protobufs.Header{{Key: "Authorization", Value: secretKeyAuthPrefix + newSecretKey}},
+					},
+				})
+				require.NoError(t, err)
+
+				status, err := newServer.WaitFor(e2eTimeout, func(status opamptest.AgentStatus) bool {
+					return status.Connected && status.Description != nil
+				})
+				require.NoError(t, err)
+				assert.Equal(t, newServer.Endpoint(), findAttribute(status.Description.GetNonIdentifyingAttributes(), endpointAttribute))
+
+				_, err = server.WaitFor(e2eTimeout, func(status opamptest.AgentStatus) bool {
+					return !status.Connected
+				})
+				require.NoError(t, err)
+
+				data, err := os.ReadFile(filepath.Join(dir, ManagerConfigName))
+				require.NoError(t, err)
+				var persisted opamp.Config
+				require.NoError(t, yaml.Unmarshal(data, &persisted))
+				assert.Equal(t, newServer.Endpoint(), persisted.Endpoint)
+				assert.Equal(t, newSecretKey, persisted.GetSecretKey())
+			},
+		},
+		{
+			desc: "Starts with only a manager config and awaits configuration",
+			testFunc: func(t *testing.T) {
+				server := opamptest.NewServer(t, opamptest.WithSecretKey(e2eSecretKey))
+
+				collector := newE2ECollector(t)
+				collector.On("ValidateConfig", mock.Anything, mock.Anything).Return(nil)
+				collector.On("Restart", mock.Anything).Return(nil).Once()
+				connectE2EClient(t, t.TempDir(), server.Endpoint(), collector)
+
+				status, err := server.WaitFor(e2eTimeout, func(status opamptest.AgentStatus) bool {
+					return status.Connected && status.Description != nil && status.EffectiveConfig != nil
+				})
+				require.NoError(t, err)
+				assert.Equal(t, configStatusAwaiting, findAttribute(status.Description.GetNonIdentifyingAttributes(), configStatusAttribute))
+				assert.Equal(t, bootstrapCollectorConfig, status.EffectiveConfig.GetConfigMap().GetConfigMap()[CollectorConfigName].GetBody())
+
+				_, err = server.PushRemoteConfig(map[string]*protobufs.AgentConfigFile{
+					CollectorConfigName: {Body: []byte(e2eCollectorConfig), ContentType: opamp.YAMLContentType},
+				})
+				require.NoError(t, err)
+
+				_, err = server.WaitFor(e2eTimeout, func(status opamptest.AgentStatus) bool {
+					return findAttribute(status.Description.GetNonIdentifyingAttributes(), configStatusAttribute) == configStatusConfigured
+				})
+				require.NoError(t, err)
+			},
+		},
+		{
+			desc: "Reports diagnostics are disabled when requested",
+			testFunc: func(t *testing.T) {
+				server := opamptest.NewServer(t, opamptest.WithSecretKey(e2eSecretKey))
+
+				collector := newE2ECollector(t)
+				newE2EClient(t, server.Endpoint(), collector)
+				waitForE2EConnect(t, server)
+
+				_, err := server.PushRemoteConfig(map[string]*protobufs.AgentConfigFile{
+					DiagnosticsRequestConfigName: {Body: []byte("id: one\nlog_lines: 10\n"), ContentType: opamp.YAMLContentType},
+				})
+				require.NoError(t, err)
+
+				status, err := server.WaitFor(e2eTimeout, func(status opamptest.AgentStatus) bool {
+					_, ok := status.EffectiveConfig.GetConfigMap().GetConfigMap()[DiagnosticsConfigName]
+					return ok
+				})
+				require.NoError(t, err)
+
+				var result diagnostics
+				require.NoError(t, json.Unmarshal(status.EffectiveConfig.GetConfigMap().GetConfigMap()[DiagnosticsConfigName].GetBody(), &result))
+				assert.Equal(t, "one", result.RequestID)
+				assert.Equal(t, []string{errDiagnosticsDisabled.Error()}, result.Errors)
+				assert.Empty(t, result.LogLines)
+			},
+		},
+		{
+			desc: "Reports a collector that stopped running",
+			testFunc: func(t *testing.T) {
+				originalInterval := failureCheckInterval
+				failureCheckInterval = 10 * time.Millisecond
+				t.Cleanup(func() { failureCheckInterval = originalInterval })
+
+				server := opamptest.NewServer(t)
+				collector := colmocks.NewMockCollector(t)
+				collector.On("Run", mock.Anything).Return(nil)
+				collector.On("Stop").Return().Maybe()
+				collector.On("Running").Return(false)
+				c := newE2EClientWithConfig(t, server.Endpoint(), collector)
+
+				select {
+				case err := <-c.Error():
+					assert.ErrorIs(t, err, errCollectorNotRunning)
+				case <-time.After(e2eTimeout):
+					t.Fatal("timed out waiting for failure")
+				}
+			},
+		},
+		{
+			desc: "Rejected secret key",
+			testFunc: func(t *testing.T) {
+				server := opamptest.NewServer(t, opamptest.WithSecretKey("wrong"))
+				c := newE2EClientWithConfig(t, server.Endpoint(), newE2ECollector(t))
+
+				require.Eventually(t, func() bool {
+					return c.ConnectionStatus().State == opamp.ConnectionStateAuthFailed
+				}, e2eTimeout, 10*time.Millisecond)
+				assert.Equal(t, 0, server.Status().Connections)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, tc.testFunc)
+	}
+}
+
+// newE2ECollector creates a collector that starts and stops successfully
+func newE2ECollector(t *testing.T) *colmocks.MockCollector {
+	collector := colmocks.NewMockCollector(t)
+	collector.On("Run", mock.Anything).Return(nil)
+	collector.On("Stop").Return().Maybe()
+	collector.On("Running").Return(true).Maybe()
+	return collector
+}
+
+// newE2EClient connects a client with configs in a temp directory to the endpoint and returns the directory
+func newE2EClient(t *testing.T, endpoint string, collector *colmocks.MockCollector) string {
+	c := newE2EClientWithConfig(t, endpoint, collector)
+	return filepath.Dir(c.managerConfigPath)
+}
+
+func newE2EClientWithConfig(t *testing.T, endpoint string, collector *colmocks.MockCollector) *Client {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, CollectorConfigName), []byte(e2eCollectorConfig), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, LoggingConfigName), []byte(e2eLoggingConfig), 0600))
+
+	return connectE2EClient(t, dir, endpoint, collector)
+}
+
+// connectE2EClient writes a manager config to the directory and connects a client using it
+func connectE2EClient(t *testing.T, dir, endpoint string, collector *colmocks.MockCollector) *Client {
+	secretKey := e2eSecretKey
+	cfg := opamp.Config{
+		Endpoint:  endpoint,
+		SecretKey: &secretKey,
+		AgentID:   e2eAgentID,
+		Reconnect: &opamp.ReconnectConfig{InitialInterval: 10 * time.Millisecond, MaxInterval: 50 * time.Millisecond},
+	}
+
+	managerContents, err := yaml.Marshal(cfg)
+	require.NoError(t, err)
+
+	args := &NewClientArgs{
+		DefaultLogger:       zap.NewNop(),
+		Config:              cfg,
+		Collector:           collector,
+		ManagerConfigPath:   filepath.Join(dir, ManagerConfigName),
+		CollectorConfigPath: filepath.Join(dir, CollectorConfigName),
+		LoggerConfigPath:    filepath.Join(dir, LoggingConfigName),
+	}
+	require.NoError(t, os.WriteFile(args.ManagerConfigPath, managerContents, 0600))
+
+	opampClient, err := NewClient(args)
+	require.NoError(t, err)
+
+	require.NoError(t, opampClient.Connect(context.Background()))
+	t.Cleanup(func() { _ = opampClient.Disconnect(context.Background()) })
+
+	return opampClient.(*Client)
+}
+
+// waitForE2EConnect waits for the agent to connect and report its effective config
+func waitForE2EConnect(t *testing.T, server *opamptest.Server) {
+	_, err := server.WaitFor(e2eTimeout, func(status opamptest.AgentStatus) bool {
+		return status.Connected && status.EffectiveConfig != nil
+	})
+	require.NoError(t, err)
+}
+
+// findAttribute returns the string value of the attribute with the key
+func findAttribute(attributes []*protobufs.KeyValue, key string) string {
+	for _, attribute := range attributes {
+		if attribute.GetKey() == key {
+			return attribute.GetValue().GetStringValue()
+		}
+	}
+	return ""
+}
@@ -15,13 +15,16 @@
 package observiq
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
 	colmocks "github.com/observiq/observiq-otel-collector/collector/mocks"
 	"github.com/observiq/observiq-otel-collector/internal/version"
@@ -33,6 +36,7 @@ import (
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
 )
 
 func TestNewClient(t *testing.T) {
@@ -206,6 +210,7 @@ func TestClientConnect(t *testing.T) {
 					ident:         &identity{agentID: "a69dcef0-0261-4f4f-9ac0-a483af42a6ba"},
 					configManager: nil,
 					collector:     mockCollector,
+					applyQueue:    newApplyQueue(nil),
 					currentConfig: opamp.Config{
 						Endpoint:  "ws://localhost:1234",
 						SecretKey: &secretKeyContents,
@@ -233,6 +238,7 @@ func TestClientConnect(t *testing.T) {
 					ident:         &identity{agentID: "a69dcef0-0261-4f4f-9ac0-a483af42a6ba"},
 					configManager: nil,
 					collector:     mockCollector,
+					applyQueue:    newApplyQueue(nil),
 					currentConfig: opamp.Config{
 						Endpoint:  "ws://localhost:1234",
 						SecretKey: &secretKeyContents,
@@ -261,6 +267,7 @@ func TestClientConnect(t *testing.T) {
 					},
 					configManager: nil,
 					collector:     mockCollector,
+					applyQueue:    newApplyQueue(nil),
 					currentConfig: opamp.Config{
 						Endpoint:  "ws://localhost:1234",
 						SecretKey: &secretKeyContents,
@@ -317,12 +324,49 @@ func TestClientDisconnect(t *testing.T) {
 	c := &Client{
 		opampClient: mockOpAmpClient,
 		collector:   mockCollector,
+		applyQueue:  newApplyQueue(nil),
 	}
 
 	c.Disconnect(ctx)
 	mockOpAmpClient.AssertExpectations(t)
 }
 
+func TestClientRestartCollector(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		restartErr  error
+		expectedErr string
+	}{
+		{
+			desc: "Collector restarts",
+		},
+		{
+			desc:        "Collector fails to restart",
+			restartErr:  errors.New("bad config"),
+			expectedErr: "failed to restart collector: bad config",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			mockCollector := colmocks.NewMockCollector(t)
+			mockCollector.On("Restart", mock.Anything).Return(tc.restartErr)
+
+			c := &Client{
+				logger:    zap.NewNop(),
+				collector: mockCollector,
+			}
+
+			err := c.RestartCollector(context.Background())
+			if tc.expectedErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.expectedErr)
+			}
+		})
+	}
+}
+
 func TestClient_onGetEffectiveConfigHandler(t *testing.T) {
 	mockManager := mocks.NewMockConfigManager(t)
 
@@ -348,7 +392,7 @@ func TestClient_onRemoteConfigHandler(t *testing.T) {
 				expectedErr := errors.New("oops")
 				expectedChanged := false
 				mockManager := mocks.NewMockConfigManager(t)
-				mockManager.On("ApplyConfigChanges", mock.Anything).Return(expectedChanged, expectedErr)
+				mockManager.On("ApplyConfigChanges", mock.Anything, mock.Anything).Return(expectedChanged, expectedErr)
 
 				remoteConfig := &protobufs.AgentRemoteConfig{
 					ConfigHash: []byte("hash"),
@@ -379,7 +423,7 @@ func TestClient_onRemoteConfigHandler(t *testing.T) {
 			desc: "Config Changes occur",
 			testFunc: func(*testing.T) {
 				mockManager := mocks.NewMockConfigManager(t)
-				mockManager.On("ApplyConfigChanges", mock.Anything).Return(true, nil)
+				mockManager.On("ApplyConfigChanges", mock.Anything, mock.Anything).Return(true, nil)
 
 				remoteConfig := &protobufs.AgentRemoteConfig{
 					ConfigHash: []byte("hash"),
@@ -411,7 +455,7 @@ func TestClient_onRemoteConfigHandler(t *testing.T) {
 			desc: "No Config Changes occur",
 			testFunc: func(*testing.T) {
 				mockManager := mocks.NewMockConfigManager(t)
-				mockManager.On("ApplyConfigChanges", mock.Anything).Return(false, nil)
+				mockManager.On("ApplyConfigChanges", mock.Anything, mock.Anything).Return(false, nil)
 
 				remoteConfig := &protobufs.AgentRemoteConfig{
 					ConfigHash: []byte("hash"),
@@ -444,7 +488,7 @@ func TestClient_onRemoteConfigHandler(t *testing.T) {
 				expectedErr := errors.New("oops")
 
 				mockManager := mocks.NewMockConfigManager(t)
-				mockManager.On("ApplyConfigChanges", mock.Anything).Return(false, nil)
+				mockManager.On("ApplyConfigChanges", mock.Anything, mock.Anything).Return(false, nil)
 
 				mockOpAmpClient := mocks.NewMockOpAMPClient(t)
 				mockOpAmpClient.On("SetRemoteConfigStatus", mock.Anything).Return(expectedErr)
@@ -465,7 +509,7 @@ func TestClient_onRemoteConfigHandler(t *testing.T) {
 				expectedErr := errors.New("oops")
 
 				mockManager := mocks.NewMockConfigManager(t)
-				mockManager.On("ApplyConfigChanges", mock.Anything).Return(true, nil)
+				mockManager.On("ApplyConfigChanges", mock.Anything, mock.Anything).Return(true, nil)
 
 				remoteConfig := &protobufs.AgentRemoteConfig{
 					ConfigHash: []byte("hash"),
@@ -499,3 +543,103 @@ func TestClient_onRemoteConfigHandler(t *testing.T) {
 		t.Run(tc.desc, tc.testFunc)
 	}
 }
+
+// TestClient_backToBackRemoteConfigs verifies remote configs pushed back to back are applied one at a time
+// while the client state is read concurrently. It is meant to be run with -race.
+func TestClient_backToBackRemoteConfigs(t *testing.T) {
+	tmpDir := t.TempDir()
+	managerFilePath := filepath.Join(tmpDir, ManagerConfigName)
+
+	currConfig := opamp.Config{
+		Endpoint: "ws://localhost:1234",
+		AgentID:  "d4691426-b0bb-41f7-84a8-320a9ec0ea2e",
+	}
+	currContents, err := yaml.Marshal(currConfig)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(managerFilePath, currContents, 0600))
+
+	const pushes = 20
+	lastHash := []byte(fmt.Sprintf("hash-%d", pushes-1))
+	lastApplied := make(chan struct{})
+
+	mockOpAmpClient := mocks.NewMockOpAMPClient(t)
+	mockOpAmpClient.On("SetAgentDescription", mock.Anything).Return(nil)
+	mockOpAmpClient.On("UpdateEffectiveConfig", mock.Anything).Return(nil)
+	mockOpAmpClient.On("SetRemoteConfigStatus", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		status := args.Get(0).(*protobufs.RemoteConfigStatus)
+		assert.Equal(t, protobufs.RemoteConfigStatus_APPLIED, status.GetStatus())
+		if bytes.Equal(lastHash, status.GetLastRemoteConfigHash()) {
+			close(lastApplied)
+		}
+	})
+
+	c := &Client{
+		opampClient:   mockOpAmpClient,
+		logger:        zap.NewNop(),
+		ident:         newIdentity(zap.NewNop(), currConfig),
+		configManager: NewAgentConfigManager(zap.NewNop()),
+		currentConfig: currConfig,
+	}
+	c.applyQueue = newApplyQueue(c.applyRemoteConfig)
+
+	managedConfig, err := opamp.NewManagedConfig(managerFilePath, managerReload(c, managerFilePath))
+	require.NoError(t, err)
+	c.configManager.AddConfig(ManagerConfigName, managedConfig)
+
+	c.applyQueue.start()
+	defer c.applyQueue.stop()
+
+	// Read the client state while configs are applied
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				_ = c.getCurrentConfig().AgentName
+				_ = c.telemetryResource()
+				_, _ = c.onGetEffectiveConfigHandler(context.Background())
+			}
+		}()
+	}
+
+	for i := 0; i < pushes; i++ {
+		agentName := fmt.Sprintf("agent-%d", i)
+		newConfig := currConfig
+		newConfig.AgentName = &agentName
+
+		newContents, err := yaml.Marshal(newConfig)
+		require.NoError(t, err)
+
+		c.onMessageFuncHandler(context.Background(), &types.MessageData{
+			RemoteConfig: &protobufs.AgentRemoteConfig{
+				Config: &protobufs.AgentConfigMap{
+					ConfigMap: map[string]*protobufs.AgentConfigFile{
+						ManagerConfigName: {Body: newContents},
+					},
+				},
+				ConfigHash: []byte(fmt.Sprintf("hash-%d", i)),
+			},
+		})
+	}
+
+	select {
+	case <-lastApplied:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for last config to apply")
+	}
+
+	close(done)
+	wg.Wait()
+
+	expectedName := fmt.Sprintf("agent-%d", pushes-1)
+	require.Equal(t, expectedName, *c.getCurrentConfig().AgentName)
+	require.Equal(t, expectedName, *c.getIdent().agentName)
+}
@@ -0,0 +1,236 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package observiq
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/observiq/observiq-otel-collector/internal/logging"
+	"github.com/observiq/observiq-otel-collector/internal/telemetry"
+	"github.com/observiq/observiq-otel-collector/internal/version"
+	"github.com/open-telemetry/opamp-go/client/types"
+	"github.com/open-telemetry/opamp-go/protobufs"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	// ownMetricsInterval is the interval the collector's own metrics are sent on
+	ownMetricsInterval = telemetry.DefaultMetricsInterval
+
+	// ownLogsInterval is the interval the collector's own logs are sent on
+	ownLogsInterval = telemetry.DefaultLogsInterval
+
+	// errUnsupportedTelemetryScheme is returned when a telemetry destination is not http or https
+	errUnsupportedTelemetryScheme = errors.New("destination endpoint must be http or https")
+)
+
+// onOwnTelemetryHandler applies own telemetry connection settings sent by the server.
+// Settings with an empty destination endpoint stop sending that signal.
+func (c *Client) onOwnTelemetryHandler(msg *types.MessageData) {
+	c.ownTelemetryMux.Lock()
+	defer c.ownTelemetryMux.Unlock()
+
+	if c.ownTelemetryStopped {
+		return
+	}
+
+	if msg.OwnMetricsConnSettings != nil {
+		if err := c.applyOwnMetrics(msg.OwnMetricsConnSettings); err != nil {
+			c.getLogger().Error("Failed to apply own metrics connection settings", zap.Error(err))
+		}
+	}
+
+	if msg.OwnLogsConnSettings != nil {
+		if err := c.applyOwnLogs(msg.OwnLogsConnSettings); err != nil {
+			c.getLogger().Error("Failed to apply own logs connection settings", zap.Error(err))
+		}
+	}
+
+	if msg.OwnTracesConnSettings.GetDestinationEndpoint() != "" {
+		c.getLogger().Warn("Ignoring own traces connection settings, the collector does not produce its own traces")
+	}
+}
+
+// applyOwnMetrics starts, replaces, or stops the own metrics reporter based on the settings
+func (c *Client) applyOwnMetrics(settings *protobufs.TelemetryConnectionSettings) error {
+	if proto.Equal(settings, c.ownMetricsSettings) {
+		return nil
+	}
+
+	var reporter *telemetry.MetricsReporter
+	if settings.GetDestinationEndpoint() != "" {
+		telemetrySettings, err := telemetrySettingsFromProto(settings)
+		if err != nil {
+			return err
+		}
+
+		reporter, err = telemetry.NewMetricsReporter(c.getLogger(), telemetrySettings, c.telemetryResource(), ownMetricsInterval)
+		if err != nil {
+			return err
+		}
+
+		if err := reporter.Start(); err != nil {
+			return fmt.Errorf("failed to start metrics reporter: %w", err)
+		}
+	}
+
+	if c.ownMetrics != nil {
+		c.ownMetrics.Stop()
+	}
+	c.ownMetrics = reporter
+	c.ownMetricsSettings = settings
+
+	if reporter == nil {
+		c.getLogger().Info("Stopped sending own metrics")
+	} else {
+		c.getLogger().Info("Sending own metrics", zap.String("endpoint", settings.GetDestinationEndpoint()))
+	}
+
+	return nil
+}
+
+// applyOwnLogs starts, replaces, or stops forwarding logs based on the settings
+func (c *Client) applyOwnLogs(settings *protobufs.TelemetryConnectionSettings) error {
+	if proto.Equal(settings, c.ownLogsSettings) {
+		return nil
+	}
+
+	var core *telemetry.LogsCore
+	if settings.GetDestinationEndpoint() != "" {
+		telemetrySettings, err := telemetrySettingsFromProto(settings)
+		if err != nil {
+			return err
+		}
+
+		// Levels are filtered by the logging config before reaching this core
+		core = telemetry.NewLogsCore(zapcore.DebugLevel, telemetrySettings, c.telemetryResource(), ownLogsInterval)
+		core.Start()
+	}
+
+	if core == nil {
+		logging.SetTelemetryCore(nil)
+	} else {
+		logging.SetTelemetryCore(core)
+	}
+
+	if c.ownLogs != nil {
+		c.ownLogs.Stop()
+	}
+	c.ownLogs = core
+	c.ownLogsSettings = settings
+
+	if core == nil {
+		c.getLogger().Info("Stopped sending own logs")
+	} else {
+		c.getLogger().Info("Sending own logs", zap.String("endpoint", settings.GetDestinationEndpoint()))
+	}
+
+	return nil
+}
+
+// stopOwnTelemetry stops sending all own telemetry and ignores any further settings
+func (c *Client) stopOwnTelemetry() {
+	c.ownTelemetryMux.Lock()
+	defer c.ownTelemetryMux.Unlock()
+
+	if c.ownMetrics != nil {
+		c.ownMetrics.Stop()
+		c.ownMetrics = nil
+	}
+
+	if c.ownLogs != nil {
+		logging.SetTelemetryCore(nil)
+		c.ownLogs.Stop()
+		c.ownLogs = nil
+	}
+
+	c.ownMetricsSettings = nil
+	c.ownLogsSettings = nil
+	c.ownTelemetryStopped = true
+}
+
+// telemetryResource returns the resource attributes identifying this collector in its own telemetry
+func (c *Client) telemetryResource() map[string]string {
+	ident := c.getIdent()
+	return map[string]string{
+		"service.name":        "com.observiq.collector",
+		"service.instance.id": ident.agentID,
+		"service.version":     version.Version(),
+		"host.name":           ident.hostname,
+	}
+}
+
+// telemetrySettingsFromProto converts telemetry connection settings into settings for a destination
+func telemetrySettingsFromProto(settings *protobufs.TelemetryConnectionSettings) (telemetry.Settings, error) {
+	endpoint := settings.GetDestinationEndpoint()
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil {
+		return telemetry.Settings{}, fmt.Errorf("invalid destination endpoint %s: %w", endpoint, err)
+	}
+
+	if endpointURL.Scheme != "http" && endpointURL.Scheme != "https" {
+		return telemetry.Settings{}, errUnsupportedTelemetryScheme
+	}
+
+	telemetrySettings := telemetry.Settings{
+		Endpoint: endpoint,
+		Headers:  make(map[string]string),
+	}
+
+	for _, header := range settings.GetHeaders().GetHeaders() {
+		telemetrySettings.Headers[header.GetKey()] = header.GetValue()
+	}
+
+	if certificate := settings.GetCertificate(); certificate != nil {
+		tlsCfg, err := tlsFromCertificate(certificate)
+		if err != nil {
+			return telemetry.Settings{}, fmt.Errorf("invalid certificate: %w", err)
+		}
+		telemetrySettings.TLS = tlsCfg
+	}
+
+	return telemetrySettings, nil
+}
+
+// tlsFromCertificate creates a TLS config from the offered certificate without writing it to disk
+func tlsFromCertificate(certificate *protobufs.TLSCertificate) (*tls.Config, error) {
+	tlsCfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if len(certificate.GetPublicKey()) > 0 || len(certificate.GetPrivateKey()) > 0 {
+		keyPair, err := tls.X509KeyPair(certificate.GetPublicKey(), certificate.GetPrivateKey())
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse key pair: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{keyPair}
+	}
+
+	if len(certificate.GetCaPublicKey()) > 0 {
+		pool := x509.NewCertPool()
+		if ok := pool.AppendCertsFromPEM(certificate.GetCaPublicKey()); !ok {
+			return nil, errors.New("failed to parse CA certificate")
+		}
+		tlsCfg.RootCAs = pool
+	}
+
+	return tlsCfg, nil
+}
@@ -0,0 +1,211 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package observiq
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/open-telemetry/opamp-go/client/types"
+	"github.com/open-telemetry/opamp-go/protobufs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestTelemetrySettingsFromProto(t *testing.T) {
+	certContents, err := os.ReadFile(filepath.Join("..", "testdata", "test.crt"))
+	require.NoError(t, err)
+	keyContents, err := os.ReadFile(filepath.Join("..", "testdata", "test.key"))
+	require.NoError(t, err)
+	caContents, err := os.ReadFile(filepath.Join("..", "testdata", "test-ca.crt"))
+	require.NoError(t, err)
+
+	testCases := []struct {
+		desc     string
+		testFunc func(*testing.T)
+	}{
+		{
+			desc: "Endpoint and headers",
+			testFunc: func(t *testing.T) {
+				settings, err := telemetrySettingsFromProto(&protobufs.TelemetryConnectionSettings{
+					DestinationEndpoint: "https://example.com:4318/v1/metrics",
+					Headers: &protobufs.Headers{
+						Headers: []*protobufs.Header{{Key: "Authorization", Value: "Bearer token"}},
+					},
+				})
+				require.NoError(t, err)
+				assert.Equal(t, "https://example.com:4318/v1/metrics", settings.Endpoint)
+				assert.Equal(t, map[string]string{"Authorization": "Bearer token"}, settings.Headers)
+				assert.Nil(t, settings.TLS)
+			},
+		},
+		{
+			desc: "Unsupported scheme",
+			testFunc: func(t *testing.T) {
+				_, err := telemetrySettingsFromProto(&protobufs.TelemetryConnectionSettings{
+					DestinationEndpoint: "ws://example.com:4318/v1/metrics",
+				})
+				require.ErrorIs(t, err, errUnsupportedTelemetryScheme)
+			},
+		},
+		{
+			desc: "Certificate",
+			testFunc: func(t *testing.T) {
+				settings, err := telemetrySettingsFromProto(&protobufs.TelemetryConnectionSettings{
+					DestinationEndpoint: "https://example.com:4318/v1/logs",
+					Certificate: &protobufs.TLSCertificate{
+						PublicKey:   certContents,
+						PrivateKey:  keyContents,
+						CaPublicKey: caContents,
+					},
+				})
+				require.NoError(t, err)
+				require.NotNil(t, settings.TLS)
+				assert.Len(t, settings.TLS.Certificates, 1)
+				assert.NotNil(t, settings.TLS.RootCAs)
+			},
+		},
+		{
+			desc: "Invalid certificate",
+			testFunc: func(t *testing.T) {
+				_, err := telemetrySettingsFromProto(&protobufs.TelemetryConnectionSettings{
+					DestinationEndpoint: "https://example.com:4318/v1/logs",
+					Certificate: &protobufs.TLSCertificate{
+						CaPublicKey: []byte("not a cert"),
+					},
+				})
+				require.ErrorContains(t, err, "invalid certificate")
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, tc.testFunc)
+	}
+}
+
+func TestClient_onOwnTelemetryHandler(t *testing.T) {
+	newTestClient := func() *Client {
+		return &Client{
+			logger: zap.NewNop(),
+			ident: &identity{
+				agentID:  "d4691426-b0bb-41f7-84a8-320a9ec0ea2e",
+				hostname: "test-host",
+			},
+		}
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	testCases := []struct {
+		desc     string
+		testFunc func(*testing.T)
+	}{
+		{
+			desc: "Starts and stops metrics and logs",
+			testFunc: func(t *testing.T) {
+				c := newTestClient()
+				defer c.stopOwnTelemetry()
+
+				c.onOwnTelemetryHandler(&types.MessageData{
+					OwnMetricsConnSettings: &protobufs.TelemetryConnectionSettings{DestinationEndpoint: server.URL + "/v1/metrics"},
+					OwnLogsConnSettings:    &protobufs.TelemetryConnectionSettings{DestinationEndpoint: server.URL + "/v1/logs"},
+				})
+				require.NotNil(t, c.ownMetrics)
+				require.NotNil(t, c.ownLogs)
+
+				// Empty settings withdraw the destination
+				c.onOwnTelemetryHandler(&types.MessageData{
+					OwnMetricsConnSettings: &protobufs.TelemetryConnectionSettings{},
+					OwnLogsConnSettings:    &protobufs.TelemetryConnectionSettings{},
+				})
+				require.Nil(t, c.ownMetrics)
+				require.Nil(t, c.ownLogs)
+			},
+		},
+		{
+			desc: "Unchanged settings are not reapplied",
+			testFunc: func(t *testing.T) {
+				c := newTestClient()
+				defer c.stopOwnTelemetry()
+
+				c.onOwnTelemetryHandler(&types.MessageData{
+					OwnLogsConnSettings: &protobufs.TelemetryConnectionSettings{DestinationEndpoint: server.URL + "/v1/logs"},
+				})
+				logsCore := c.ownLogs
+				require.NotNil(t, logsCore)
+
+				c.onOwnTelemetryHandler(&types.MessageData{
+					OwnLogsConnSettings: &protobufs.TelemetryConnectionSettings{DestinationEndpoint: server.URL + "/v1/logs"},
+				})
+				require.Same(t, logsCore, c.ownLogs)
+			},
+		},
+		{
+			desc: "Invalid settings keep the current destination",
+			testFunc: func(t *testing.T) {
+				c := newTestClient()
+				defer c.stopOwnTelemetry()
+
+				c.onOwnTelemetryHandler(&types.MessageData{
+					OwnMetricsConnSettings: &protobufs.TelemetryConnectionSettings{DestinationEndpoint: server.URL + "/v1/metrics"},
+				})
+				reporter := c.ownMetrics
+				require.NotNil(t, reporter)
+
+				c.onOwnTelemetryHandler(&types.MessageData{
+					OwnMetricsConnSettings: &protobufs.TelemetryConnectionSettings{DestinationEndpoint: "ftp://example.com"},
+				})
+				require.Same(t, reporter, c.ownMetrics)
+			},
+		},
+		{
+			desc: "Traces are ignored",
+			testFunc: func(t *testing.T) {
+				c := newTestClient()
+				defer c.stopOwnTelemetry()
+
+				c.onOwnTelemetryHandler(&types.MessageData{
+					OwnTracesConnSettings: &protobufs.TelemetryConnectionSettings{DestinationEndpoint: server.URL + "/v1/traces"},
+				})
+				require.Nil(t, c.ownMetrics)
+				require.Nil(t, c.ownLogs)
+			},
+		},
+		{
+			desc: "Settings are ignored after stopping",
+			testFunc: func(t *testing.T) {
+				c := newTestClient()
+				c.stopOwnTelemetry()
+
+				c.onOwnTelemetryHandler(&types.MessageData{
+					OwnLogsConnSettings: &protobufs.TelemetryConnectionSettings{DestinationEndpoint: server.URL + "/v1/logs"},
+				})
+				require.Nil(t, c.ownLogs)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, tc.testFunc)
+	}
+}
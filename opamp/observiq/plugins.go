@@ -0,0 +1,197 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package observiq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/observiq/observiq-otel-collector/factories"
+	"github.com/observiq/observiq-otel-collector/opamp"
+	"github.com/observiq/observiq-otel-collector/receiver/pluginreceiver"
+	"go.opentelemetry.io/collector/config"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// PluginsFileSetName is the name of the file set plugins are written to
+const PluginsFileSetName = "plugins"
+
+// pluginReceiverType is the type of the receiver that runs plugins
+const pluginReceiverType = "plugin"
+
+// pluginsFileSet returns the file set of the plugins in the directory
+func pluginsFileSet(pluginsDir string) opamp.FileSet {
+	return opamp.FileSet{
+		Name:     PluginsFileSetName,
+		Root:     pluginsDir,
+		Patterns: []string{"*.yaml", "*.yml"},
+	}
+}
+
+// validatePlugin loads the plugin and renders it with its default values.
+// Every component in the rendered config must be available in the collector.
+func validatePlugin(_ string, contents []byte) error {
+	// Plugins are only loaded from disk so stage the contents in a temporary file
+	tmpFile, err := os.CreateTemp("", "plugin-*.yaml")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary plugin file: %w", err)
+	}
+	defer func() {
+		_ = os.Remove(tmpFile.Name())
+	}()
+
+	_, err = tmpFile.Write(contents)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write temporary plugin file: %w", err)
+	}
+
+	plugin, err := pluginreceiver.LoadPlugin(tmpFile.Name())
+	if err != nil {
+		return err
+	}
+
+	if plugin.Template == "" {
+		return errors.New("plugin has no template")
+	}
+
+	renderedCfg, err := plugin.Render(nil)
+	if err != nil {
+		return err
+	}
+
+	return checkRenderedComponents(renderedCfg)
+}
+
+// checkRenderedComponents returns an error if a component of the rendered config isn't available in the collector
+func checkRenderedComponents(renderedCfg *pluginreceiver.RenderedConfig) error {
+	available, err := factories.DefaultFactories()
+	if err != nil {
+		return fmt.Errorf("failed to get collector components: %w", err)
+	}
+
+	for key := range renderedCfg.Receivers {
+		componentType, err := parseComponentType(key)
+		if err != nil {
+			return err
+		}
+		if _, ok := available.Receivers[componentType]; !ok {
+			return fmt.Errorf("receiver %s is not available", key)
+		}
+	}
+
+	for key := range renderedCfg.Processors {
+		componentType, err := parseComponentType(key)
+		if err != nil {
+			return err
+		}
+		if _, ok := available.Processors[componentType]; !ok {
+			return fmt.Errorf("processor %s is not available", key)
+		}
+	}
+
+	for key := range renderedCfg.Extensions {
+		componentType, err := parseComponentType(key)
+		if err != nil {
+			return err
+		}
+		if _, ok := available.Extensions[componentType]; !ok {
+			return fmt.Errorf("extension %s is not available", key)
+		}
+	}
+
+	return nil
+}
+
+// parseComponentType returns the type of a component key in the form type[/name]
+func parseComponentType(key string) (config.Type, error) {
+	id, err := config.NewComponentIDFromString(key)
+	if err != nil {
+		return "", fmt.Errorf("invalid component %s: %w", key, err)
+	}
+	return id.Type(), nil
+}
+
+// pluginsOnChange restarts the collector if its config uses any of the changed plugins
+func pluginsOnChange(client *Client, collectorConfigPath string) opamp.FileChangeFunc {
+	return func(ctx context.Context, filePaths []string) error {
+		used, err := usesPlugins(collectorConfigPath, filePaths)
+		if err != nil {
+			return err
+		}
+
+		if !used {
+			client.getLogger().Info("Changed plugins are not used by the collector config", zap.Strings("plugins", filePaths))
+			return nil
+		}
+
+		client.getLogger().Info("Restarting collector after plugins changed", zap.Strings("plugins", filePaths))
+		return client.collector.Restart(ctx)
+	}
+}
+
+// usesPlugins returns true if a plugin receiver in the collector config runs one of the plugins
+func usesPlugins(collectorConfigPath string, pluginPaths []string) (bool, error) {
+	data, err := os.ReadFile(filepath.Clean(collectorConfigPath))
+	if err != nil {
+		return false, fmt.Errorf("failed to read collector config: %w", err)
+	}
+
+	var collectorConfig struct {
+		Receivers map[string]interface{} `yaml:"receivers"`
+	}
+	if err := yaml.Unmarshal(data, &collectorConfig); err != nil {
+		return false, fmt.Errorf("failed to parse collector config: %w", err)
+	}
+
+	changed := make(map[string]struct{}, len(pluginPaths))
+	for _, pluginPath := range pluginPaths {
+		if absPath, err := filepath.Abs(pluginPath); err == nil {
+			changed[absPath] = struct{}{}
+		}
+	}
+
+	for key, receiver := range collectorConfig.Receivers {
+		if componentType, err := parseComponentType(key); err != nil || componentType != pluginReceiverType {
+			continue
+		}
+
+		receiverConfig, ok := receiver.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		pluginPath, ok := receiverConfig["path"].(string)
+		if !ok {
+			continue
+		}
+
+		// Plugin receivers resolve relative paths from the working directory
+		absPath, err := filepath.Abs(os.ExpandEnv(pluginPath))
+		if err != nil {
+			continue
+		}
+		if _, ok := changed[absPath]; ok {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,197 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package observiq
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	colmocks "github.com/observiq/observiq-otel-collector/collector/mocks"
+	"github.com/open-telemetry/opamp-go/protobufs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestValidatePlugin(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		contents    string
+		expectedErr string
+	}{
+		{
+			desc: "Valid plugin",
+			contents: `
+title: File
+template: |
+  receivers:
+    filelog:
+      include: [{{ .path }}]
+  service:
+    pipelines:
+      logs:
+        receivers: [filelog]
+parameters:
+  - name: path
+    type: string
+    default: /var/log/app.log
+`,
+		},
+		{
+			desc:        "Invalid YAML",
+			contents:    "title: [unclosed",
+			expectedErr: "failed to unmarshal plugin",
+		},
+		{
+			desc:        "Missing template",
+			contents:    "title: Empty",
+			expectedErr: "plugin has no template",
+		},
+		{
+			desc:        "Invalid template",
+			contents:    "title: Bad\ntemplate: \"{{ .path \"",
+			expectedErr: "failed to create plugin template",
+		},
+		{
+			desc:        "Unavailable receiver",
+			contents:    "title: Unknown\ntemplate: |\n  receivers:\n    unicorn:\n",
+			expectedErr: "receiver unicorn is not available",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			err := validatePlugin("plugin.yaml", []byte(tc.contents))
+			if tc.expectedErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tc.expectedErr)
+		})
+	}
+}
+
+func TestUsesPlugins(t *testing.T) {
+	tmpDir := t.TempDir()
+	collectorConfigPath := filepath.Join(tmpDir, CollectorConfigName)
+	collectorConfig := `
+receivers:
+  otlp:
+  plugin/redis:
+    path: ` + filepath.Join(tmpDir, "plugins", "redis.yaml") + `
+  plugin:
+    path: $PLUGINS_TEST_DIR/plugins/postgres.yaml
+`
+	require.NoError(t, os.WriteFile(collectorConfigPath, []byte(collectorConfig), 0600))
+	t.Setenv("PLUGINS_TEST_DIR", tmpDir)
+
+	used, err := usesPlugins(collectorConfigPath, []string{filepath.Join(tmpDir, "plugins", "redis.yaml")})
+	require.NoError(t, err)
+	assert.True(t, used)
+
+	used, err = usesPlugins(collectorConfigPath, []string{filepath.Join(tmpDir, "plugins", "postgres.yaml")})
+	require.NoError(t, err)
+	assert.True(t, used)
+
+	used, err = usesPlugins(collectorConfigPath, []string{filepath.Join(tmpDir, "plugins", "mysql.yaml")})
+	require.NoError(t, err)
+	assert.False(t, used)
+}
+
+func TestClient_pluginsFileSet(t *testing.T) {
+	validPlugin := "title: File\ntemplate: |\n  receivers:\n    filelog:\n      include: [/var/log/app.log]\n"
+
+	// setupClient creates a client managing plugins with a collector config using the redis plugin
+	setupClient := func(t *testing.T, mockCollector *colmocks.MockCollector) (*Client, string) {
+		tmpDir := t.TempDir()
+		pluginsDir := filepath.Join(tmpDir, "plugins")
+		require.NoError(t, os.MkdirAll(pluginsDir, 0750))
+
+		collectorConfigPath := filepath.Join(tmpDir, CollectorConfigName)
+		collectorConfig := "receivers:\n  plugin/redis:\n    path: " + filepath.Join(pluginsDir, "redis.yaml") + "\n"
+		require.NoError(t, os.WriteFile(collectorConfigPath, []byte(collectorConfig), 0600))
+
+		c := &Client{
+			logger:        zap.NewNop(),
+			configManager: NewAgentConfigManager(zap.NewNop()),
+			collector:     mockCollector,
+		}
+		require.NoError(t, c.configManager.AddFileSet(pluginsFileSet(pluginsDir), validatePlugin, pluginsOnChange(c, collectorConfigPath)))
+
+		return c, pluginsDir
+	}
+
+	remoteConfig := func(name, contents string) *protobufs.AgentRemoteConfig {
+		return &protobufs.AgentRemoteConfig{
+			Config: &protobufs.AgentConfigMap{
+				ConfigMap: map[string]*protobufs.AgentConfigFile{
+					name: {Body: []byte(contents)},
+				},
+			},
+		}
+	}
+
+	testCases := []struct {
+		desc     string
+		testFunc func(*testing.T)
+	}{
+		{
+			desc: "Used plugin restarts the collector",
+			testFunc: func(t *testing.T) {
+				mockCollector := colmocks.NewMockCollector(t)
+				mockCollector.On("Restart", mock.Anything).Return(nil).Once()
+
+				c, pluginsDir := setupClient(t, mockCollector)
+
+				changed, err := c.configManager.ApplyConfigChanges(context.Background(), remoteConfig("plugins/redis.yaml", validPlugin))
+				require.NoError(t, err)
+				require.True(t, changed)
+				assert.FileExists(t, filepath.Join(pluginsDir, "redis.yaml"))
+			},
+		},
+		{
+			desc: "Unused plugin doesn't restart the collector",
+			testFunc: func(t *testing.T) {
+				mockCollector := colmocks.NewMockCollector(t)
+
+				c, pluginsDir := setupClient(t, mockCollector)
+
+				changed, err := c.configManager.ApplyConfigChanges(context.Background(), remoteConfig("plugins/mysql.yaml", validPlugin))
+				require.NoError(t, err)
+				require.True(t, changed)
+				assert.FileExists(t, filepath.Join(pluginsDir, "mysql.yaml"))
+			},
+		},
+		{
+			desc: "Invalid plugin is not written",
+			testFunc: func(t *testing.T) {
+				mockCollector := colmocks.NewMockCollector(t)
+
+				c, pluginsDir := setupClient(t, mockCollector)
+
+				_, err := c.configManager.ApplyConfigChanges(context.Background(), remoteConfig("plugins/redis.yaml", "title: Empty"))
+				require.ErrorContains(t, err, "plugin has no template")
+				assert.NoFileExists(t, filepath.Join(pluginsDir, "redis.yaml"))
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, tc.testFunc)
+	}
+}
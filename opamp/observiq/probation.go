@@ -0,0 +1,182 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package observiq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/observiq/observiq-otel-collector/collector"
+	"github.com/observiq/observiq-otel-collector/internal/telemetry"
+	"github.com/observiq/observiq-otel-collector/opamp"
+	"github.com/open-telemetry/opamp-go/protobufs"
+	"go.uber.org/zap"
+)
+
+var (
+	// probationCheckInterval is how often exporter send failures are checked during probation
+	probationCheckInterval = 5 * time.Second
+
+	// sendFailures returns the number of items exporters have failed to send.
+	// It is a variable so tests can substitute it.
+	sendFailures = telemetry.SendFailures
+
+	// errProbationFailed is returned when the collector becomes unhealthy during probation
+	errProbationFailed = errors.New("config failed probation")
+)
+
+// probationConfigs are the configs rolled back when a remote config fails probation
+var probationConfigs = []string{ManagerConfigName, CollectorConfigName, LoggingConfigName}
+
+// configVersions returns the history version of each managed config's current contents.
+// Configs without a history are not included and can't be rolled back.
+func (c *Client) configVersions() map[string]int {
+	versions := make(map[string]int, len(probationConfigs))
+	for _, configName := range probationConfigs {
+		managedConfig, ok := c.configManager.GetConfig(configName)
+		if !ok {
+			continue
+		}
+
+		// Contents that aren't the latest version were changed locally
+		entry, err := managedConfig.RecordHistory(opamp.OriginLocal)
+		if err != nil {
+			c.getLogger().Warn("Failed to record config history, config won't be rolled back if probation fails", zap.String("config", configName), zap.Error(err))
+			continue
+		}
+
+		if entry.Version > 0 {
+			versions[configName] = entry.Version
+		}
+	}
+	return versions
+}
+
+// runProbation watches the collector after a remote config was applied.
+// If the collector becomes unhealthy the configs are rolled back to the versions before the apply.
+func (c *Client) runProbation(ctx context.Context, remoteConfig *protobufs.AgentRemoteConfig, probation *opamp.ProbationConfig, versions map[string]int, auditEntry *opamp.AuditEntry) error {
+	c.getLogger().Info("Watching collector health before confirming remote config", zap.Duration("duration", probation.Duration))
+
+	// Let the server know the config isn't confirmed yet
+	applyingStatus := &protobufs.RemoteConfigStatus{
+		LastRemoteConfigHash: remoteConfig.GetConfigHash(),
+		Status:               protobufs.RemoteConfigStatus_APPLYING,
+	}
+	if err := c.setRemoteConfigStatus(applyingStatus); err != nil {
+		c.getLogger().Warn("Failed to set remote config status", zap.Error(err))
+	}
+
+	probationStart := time.Now()
+	err := watchProbation(ctx, c.collector, probation)
+	auditEntry.AddStep("probation", probationStart, err)
+
+	switch {
+	case err == nil:
+		return nil
+	case applySuperseded(ctx):
+		// A newer config cancels the probation instead of waiting for it to end.
+		// The config stays in place and is watched along with the newer one.
+		c.getLogger().Info("Remote config superseded during probation", zap.Binary("hash", remoteConfig.GetConfigHash()))
+		return errApplySuperseded
+	case !errors.Is(err, errProbationFailed):
+		// The apply was cancelled so the collector is shutting down. Leave the configs in place.
+		return fmt.Errorf("probation interrupted: %w", err)
+	}
+
+	c.getLogger().Error("Rolling back remote config", zap.Error(err))
+	rollbackStart := time.Now()
+	rollbackErr := c.rollbackConfigs(versions)
+	auditEntry.AddStep("rollback", rollbackStart, rollbackErr)
+
+	if rollbackErr != nil {
+		return fmt.Errorf("%w; rollback failed: %s", err, rollbackErr)
+	}
+
+	return fmt.Errorf("%w; rolled back to previous configs", err)
+}
+
+// rollbackConfigs rolls each config back to the version. Configs already on the version are untouched.
+func (c *Client) rollbackConfigs(versions map[string]int) error {
+	var failures []string
+	for _, configName := range probationConfigs {
+		version, ok := versions[configName]
+		if !ok {
+			continue
+		}
+
+		// The rollback must not be cancelled or the collector could be left on the unhealthy config
+		if _, err := c.configManager.RollbackConfig(context.Background(), configName, version); err != nil {
+			failures = append(failures, err.Error())
+		}
+	}
+
+	if len(failures) > 0 {
+		return errors.New(strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// watchProbation returns nil if the collector stays healthy for the probation duration.
+// An error wrapping errProbationFailed is returned as soon as the collector stops running
+// or exporters fail to send more than the allowed number of items.
+func watchProbation(ctx context.Context, col collector.Collector, probation *opamp.ProbationConfig) error {
+	statusChan := col.Status()
+
+	// Statuses sent while restarting don't reflect the health of the new config
+	for drained := false; !drained; {
+		select {
+		case <-statusChan:
+		default:
+			drained = true
+		}
+	}
+
+	baseline := sendFailures()
+	checkSendFailures := func() error {
+		if failures := sendFailures() - baseline; failures > probation.MaxSendFailures {
+			return fmt.Errorf("%w: exporters failed to send %d items", errProbationFailed, failures)
+		}
+		return nil
+	}
+
+	timer := time.NewTimer(probation.Duration)
+	defer timer.Stop()
+
+	ticker := time.NewTicker(probationCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case status := <-statusChan:
+			if status.Err != nil {
+				return fmt.Errorf("%w: collector failed: %s", errProbationFailed, status.Err)
+			}
+			if !status.Running {
+				return fmt.Errorf("%w: collector stopped running", errProbationFailed)
+			}
+		case <-ticker.C:
+			if err := checkSendFailures(); err != nil {
+				return err
+			}
+		case <-timer.C:
+			return checkSendFailures()
+		}
+	}
+}
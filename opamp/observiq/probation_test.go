@@ -0,0 +1,376 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package observiq
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/observiq/observiq-otel-collector/collector"
+	colmocks "github.com/observiq/observiq-otel-collector/collector/mocks"
+	"github.com/observiq/observiq-otel-collector/opamp"
+	"github.com/observiq/observiq-otel-collector/opamp/mocks"
+	"github.com/open-telemetry/opamp-go/protobufs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// setSendFailures substitutes the send failure count for the duration of the test
+func setSendFailures(t *testing.T, count *int64) {
+	original, originalInterval := sendFailures, probationCheckInterval
+	sendFailures = func() int64 { return atomic.LoadInt64(count) }
+	probationCheckInterval = 10 * time.Millisecond
+	t.Cleanup(func() {
+		sendFailures, probationCheckInterval = original, originalInterval
+	})
+}
+
+func TestWatchProbation(t *testing.T) {
+	probation := &opamp.ProbationConfig{
+		Duration:        100 * time.Millisecond,
+		MaxSendFailures: 5,
+	}
+
+	testCases := []struct {
+		desc     string
+		testFunc func(*testing.T)
+	}{
+		{
+			desc: "Healthy collector passes",
+			testFunc: func(t *testing.T) {
+				var failures int64 = 100
+				setSendFailures(t, &failures)
+
+				// Statuses from the restart are ignored
+				statusChan := make(chan *collector.Status, 2)
+				statusChan <- &collector.Status{Running: false}
+				statusChan <- &collector.Status{Running: true}
+
+				mockCollector := colmocks.NewMockCollector(t)
+				mockCollector.On("Status").Return((<-chan *collector.Status)(statusChan))
+
+				// Failures within the allowed number
+				go func() {
+					time.Sleep(20 * time.Millisecond)
+					atomic.AddInt64(&failures, 5)
+				}()
+
+				err := watchProbation(context.Background(), mockCollector, probation)
+				require.NoError(t, err)
+			},
+		},
+		{
+			desc: "Collector error fails",
+			testFunc: func(t *testing.T) {
+				var failures int64
+				setSendFailures(t, &failures)
+
+				statusChan := make(chan *collector.Status, 1)
+				mockCollector := colmocks.NewMockCollector(t)
+				mockCollector.On("Status").Return((<-chan *collector.Status)(statusChan))
+
+				go func() {
+					time.Sleep(20 * time.Millisecond)
+					statusChan <- &collector.Status{Running: false, Err: errors.New("exporter crashed")}
+				}()
+
+				err := watchProbation(context.Background(), mockCollector, probation)
+				require.ErrorIs(t, err, errProbationFailed)
+				require.ErrorContains(t, err, "exporter crashed")
+			},
+		},
+		{
+			desc: "Collector stopping fails",
+			testFunc: func(t *testing.T) {
+				var failures int64
+				setSendFailures(t, &failures)
+
+				statusChan := make(chan *collector.Status, 1)
+				mockCollector := colmocks.NewMockCollector(t)
+				mockCollector.On("Status").Return((<-chan *collector.Status)(statusChan))
+
+				go func() {
+					time.Sleep(20 * time.Millisecond)
+					statusChan <- &collector.Status{Running: false}
+				}()
+
+				err := watchProbation(context.Background(), mockCollector, probation)
+				require.ErrorIs(t, err, errProbationFailed)
+				require.ErrorContains(t, err, "collector stopped running")
+			},
+		},
+		{
+			desc: "Send failures fail",
+			testFunc: func(t *testing.T) {
+				var failures int64 = 100
+				setSendFailures(t, &failures)
+
+				statusChan := make(chan *collector.Status)
+				mockCollector := colmocks.NewMockCollector(t)
+				mockCollector.On("Status").Return((<-chan *collector.Status)(statusChan))
+
+				go func() {
+					time.Sleep(20 * time.Millisecond)
+					atomic.AddInt64(&failures, 6)
+				}()
+
+				err := watchProbation(context.Background(), mockCollector, probation)
+				require.ErrorIs(t, err, errProbationFailed)
+				require.ErrorContains(t, err, "exporters failed to send 6 items")
+			},
+		},
+		{
+			desc: "Cancelled",
+			testFunc: func(t *testing.T) {
+				var failures int64
+				setSendFailures(t, &failures)
+
+				statusChan := make(chan *collector.Status)
+				mockCollector := colmocks.NewMockCollector(t)
+				mockCollector.On("Status").Return((<-chan *collector.Status)(statusChan))
+
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+
+				err := watchProbation(ctx, mockCollector, &opamp.ProbationConfig{Duration: time.Hour})
+				require.ErrorIs(t, err, context.Canceled)
+				require.NotErrorIs(t, err, errProbationFailed)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, tc.testFunc)
+	}
+}
+
+func TestClient_onRemoteConfigHandlerProbation(t *testing.T) {
+	currContents := []byte("current: config")
+	newContents := []byte("new: config")
+
+	remoteConfig := &protobufs.AgentRemoteConfig{
+		Config: &protobufs.AgentConfigMap{
+			ConfigMap: map[string]*protobufs.AgentConfigFile{
+				CollectorConfigName: {Body: newContents},
+			},
+		},
+		ConfigHash: []byte("hash"),
+	}
+
+	// setupClient creates a client managing a collector config with probation enabled
+	setupClient := func(t *testing.T, mockCollector *colmocks.MockCollector, mockOpAmpClient *mocks.MockOpAMPClient) (*Client, string) {
+		tmpDir := t.TempDir()
+		collectorFilePath := filepath.Join(tmpDir, CollectorConfigName)
+		require.NoError(t, os.WriteFile(collectorFilePath, currContents, 0600))
+
+		c := &Client{
+			opampClient:   mockOpAmpClient,
+			logger:        zap.NewNop(),
+			configManager: NewAgentConfigManager(zap.NewNop()),
+			collector:     mockCollector,
+			currentConfig: opamp.Config{
+				Probation: &opamp.ProbationConfig{Duration: 100 * time.Millisecond},
+			},
+		}
+
+		managedConfig, err := opamp.NewManagedConfig(collectorFilePath, collectorReload(c, collectorFilePath))
+		require.NoError(t, err)
+		c.configManager.AddConfig(CollectorConfigName, managedConfig)
+
+		return c, collectorFilePath
+	}
+
+	testCases := []struct {
+		desc     string
+		testFunc func(*testing.T)
+	}{
+		{
+			desc: "Healthy config is confirmed",
+			testFunc: func(t *testing.T) {
+				var failures int64
+				setSendFailures(t, &failures)
+
+				mockCollector := colmocks.NewMockCollector(t)
+				mockCollector.On("ValidateConfig", mock.Anything, newContents).Return(nil)
+				mockCollector.On("Restart", mock.Anything).Return(nil)
+				mockCollector.On("Status").Return((<-chan *collector.Status)(make(chan *collector.Status)))
+
+				var statuses []protobufs.RemoteConfigStatus_Status
+				mockOpAmpClient := mocks.NewMockOpAMPClient(t)
+				mockOpAmpClient.On("UpdateEffectiveConfig", mock.Anything).Return(nil)
+				mockOpAmpClient.On("SetRemoteConfigStatus", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+					statuses = append(statuses, args.Get(0).(*protobufs.RemoteConfigStatus).GetStatus())
+				})
+
+				c, collectorFilePath := setupClient(t, mockCollector, mockOpAmpClient)
+
+				err := c.onRemoteConfigHandler(context.Background(), remoteConfig)
+				require.NoError(t, err)
+				require.Equal(t, []protobufs.RemoteConfigStatus_Status{
+					protobufs.RemoteConfigStatus_APPLYING,
+					protobufs.RemoteConfigStatus_APPLIED,
+				}, statuses)
+
+				data, err := os.ReadFile(collectorFilePath)
+				require.NoError(t, err)
+				require.Equal(t, newContents, data)
+			},
+		},
+		{
+			desc: "Unhealthy config is rolled back",
+			testFunc: func(t *testing.T) {
+				var failures int64
+				setSendFailures(t, &failures)
+
+				statusChan := make(chan *collector.Status, 1)
+				mockCollector := colmocks.NewMockCollector(t)
+				mockCollector.On("ValidateConfig", mock.Anything, mock.Anything).Return(nil)
+				mockCollector.On("Restart", mock.Anything).Return(nil).Twice()
+
+				// The collector fails once probation starts watching it
+				mockCollector.On("Status").Return((<-chan *collector.Status)(statusChan)).Once().Run(func(mock.Arguments) {
+					go func() {
+						time.Sleep(20 * time.Millisecond)
+						statusChan <- &collector.Status{Running: false, Err: errors.New("bad credentials")}
+					}()
+				})
+
+				var lastStatus *protobufs.RemoteConfigStatus
+				mockOpAmpClient := mocks.NewMockOpAMPClient(t)
+				mockOpAmpClient.On("UpdateEffectiveConfig", mock.Anything).Return(nil)
+				mockOpAmpClient.On("SetRemoteConfigStatus", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+					lastStatus = args.Get(0).(*protobufs.RemoteConfigStatus)
+				})
+
+				c, collectorFilePath := setupClient(t, mockCollector, mockOpAmpClient)
+
+				err := c.onRemoteConfigHandler(context.Background(), remoteConfig)
+				require.NoError(t, err)
+
+				require.Equal(t, protobufs.RemoteConfigStatus_FAILED, lastStatus.GetStatus())
+				assert.Contains(t, lastStatus.GetErrorMessage(), "bad credentials")
+				assert.Contains(t, lastStatus.GetErrorMessage(), "rolled back")
+
+				data, err := os.ReadFile(collectorFilePath)
+				require.NoError(t, err)
+				require.Equal(t, currContents, data)
+
+				managedConfig, ok := c.configManager.GetConfig(CollectorConfigName)
+				require.True(t, ok)
+				latest, _, err := managedConfig.History.Latest()
+				require.NoError(t, err)
+				require.Equal(t, opamp.OriginRollback, latest.Origin)
+			},
+		},
+		{
+			desc: "Superseded config is rolled back with the newer config",
+			testFunc: func(t *testing.T) {
+				var failures int64
+				setSendFailures(t, &failures)
+
+				newerContents := []byte("newer: config")
+				newerConfig := &protobufs.AgentRemoteConfig{
+					Config: &protobufs.AgentConfigMap{
+						ConfigMap: map[string]*protobufs.AgentConfigFile{
+							CollectorConfigName: {Body: newerContents},
+						},
+					},
+					ConfigHash: []byte("newer"),
+				}
+
+				statusChan := make(chan *collector.Status, 1)
+				mockCollector := colmocks.NewMockCollector(t)
+				mockCollector.On("ValidateConfig", mock.Anything, mock.Anything).Return(nil)
+				mockCollector.On("Restart", mock.Anything).Return(nil).Times(3)
+
+				// The collector stays healthy for the first config and fails with the newer one
+				mockCollector.On("Status").Return((<-chan *collector.Status)(make(chan *collector.Status))).Once()
+				mockCollector.On("Status").Return((<-chan *collector.Status)(statusChan)).Once().Run(func(mock.Arguments) {
+					go func() {
+						time.Sleep(20 * time.Millisecond)
+						statusChan <- &collector.Status{Running: false, Err: errors.New("bad credentials")}
+					}()
+				})
+
+				applying := make(chan struct{}, 1)
+				var statuses []*protobufs.RemoteConfigStatus
+				mockOpAmpClient := mocks.NewMockOpAMPClient(t)
+				mockOpAmpClient.On("UpdateEffectiveConfig", mock.Anything).Return(nil)
+				mockOpAmpClient.On("SetRemoteConfigStatus", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+					status := args.Get(0).(*protobufs.RemoteConfigStatus)
+					statuses = append(statuses, status)
+					if status.GetStatus() == protobufs.RemoteConfigStatus_APPLYING {
+						select {
+						case applying <- struct{}{}:
+						default:
+						}
+					}
+				})
+
+				c, collectorFilePath := setupClient(t, mockCollector, mockOpAmpClient)
+				c.currentConfig.Probation.Duration = time.Minute
+
+				errChan := make(chan error, 2)
+				queue := newApplyQueue(func(ctx context.Context, remoteConfig *protobufs.AgentRemoteConfig) {
+					errChan <- c.onRemoteConfigHandler(ctx, remoteConfig)
+				})
+				queue.start()
+				defer queue.stop()
+
+				// The newer config is pushed while the first is in probation
+				queue.enqueue(remoteConfig)
+				<-applying
+				queue.enqueue(newerConfig)
+
+				for i := 0; i < 2; i++ {
+					select {
+					case err := <-errChan:
+						require.NoError(t, err)
+					case <-time.After(5 * time.Second):
+						t.Fatal("timed out waiting for configs to apply")
+					}
+				}
+
+				// Only the newer config reports whether it applied, and it's rolled back to the configs from before both
+				var reported []string
+				for _, status := range statuses {
+					if status.GetStatus() != protobufs.RemoteConfigStatus_APPLYING {
+						reported = append(reported, string(status.GetLastRemoteConfigHash()))
+					}
+				}
+				require.Equal(t, []string{"newer"}, reported)
+
+				lastStatus := statuses[len(statuses)-1]
+				require.Equal(t, protobufs.RemoteConfigStatus_FAILED, lastStatus.GetStatus())
+				require.Nil(t, c.unconfirmedVersions)
+
+				data, err := os.ReadFile(collectorFilePath)
+				require.NoError(t, err)
+				require.Equal(t, currContents, data)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, tc.testFunc)
+	}
+}
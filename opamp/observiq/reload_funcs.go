@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/observiq/observiq-otel-collector/internal/logging"
 	"github.com/observiq/observiq-otel-collector/opamp"
@@ -27,16 +28,23 @@ import (
 )
 
 func managerReload(client *Client, managerConfigPath string) opamp.ReloadFunc {
-	return func(contents []byte) (bool, error) {
+	return func(_ context.Context, contents []byte) (bool, error) {
 		// Unmarshal config and only pull fields out that are allowed to be updated.
 		var newConfig opamp.Config
 		if err := yaml.Unmarshal(contents, &newConfig); err != nil {
 			return false, fmt.Errorf("failed to validate config %s", ManagerConfigName)
 		}
+		if err := newConfig.Attributes.Validate(); err != nil {
+			return false, fmt.Errorf("failed to validate config %s: %w", ManagerConfigName, err)
+		}
 
 		// Check if the updatable fields are equal
 		// If so then exit
-		if client.currentConfig.CmpUpdatableFields(newConfig) {
+		currentConfig := client.getCurrentConfig()
+		if err := validateRemoteAttributes(currentConfig.Attributes, newConfig.Attributes); err != nil {
+			return false, fmt.Errorf("failed to validate config %s: %w", ManagerConfigName, err)
+		}
+		if currentConfig.CmpUpdatableFields(newConfig) {
 			return false, nil
 		}
 
@@ -49,32 +57,28 @@ func managerReload(client *Client, managerConfigPath string) opamp.ReloadFunc {
 		defer func() {
 			// Cleanup rollback
 			if err := cleanupFunc(); err != nil {
-				client.logger.Warn("Failed to cleanup rollback file", zap.Error(err))
+				client.getLogger().Warn("Failed to cleanup rollback file", zap.Error(err))
 			}
 		}()
 
-		//create a copies for rollback
-		rollBackCfg := client.currentConfig.Copy()
-		rollbackIdent := client.ident.Copy()
+		// Work on copies so the client state only changes once the update succeeds
+		updatedConfig := currentConfig.Copy()
+		updatedIdent := client.getIdent().Copy()
 
 		// Updatable config fields
-		client.currentConfig.AgentName = newConfig.AgentName
-		client.currentConfig.Labels = newConfig.Labels
+		updatedConfig.AgentName = newConfig.AgentName
+		updatedConfig.Labels = newConfig.Labels
+		updatedConfig.Attributes = newConfig.Attributes
 
 		// Update identity
-		client.ident.agentName = newConfig.AgentName
-		client.ident.labels = newConfig.Labels
+		updatedIdent.agentName = newConfig.AgentName
+		updatedIdent.labels = newConfig.Labels
+		updatedIdent.attributes = newConfig.Attributes.Expand()
 
 		// Write out new config file
 		// Marshal back into bytes
-		newContents, err := yaml.Marshal(client.currentConfig)
+		newContents, err := yaml.Marshal(updatedConfig)
 		if err != nil {
-			// Rollback file
-			if rollbackErr := rollbackFunc(); rollbackErr != nil {
-				client.logger.Error("Rollback failed for manager config", zap.Error(rollbackErr))
-			}
-			client.ident = rollbackIdent
-			client.currentConfig = *rollBackCfg
 			return false, fmt.Errorf("failed to reformat manager config: %w", err)
 		}
 
@@ -82,30 +86,69 @@ func managerReload(client *Client, managerConfigPath string) opamp.ReloadFunc {
 		if err := updateConfigFile(ManagerConfigName, managerConfigPath, newContents); err != nil {
 			// Rollback file
 			if rollbackErr := rollbackFunc(); rollbackErr != nil {
-				client.logger.Error("Rollback failed for collector config", zap.Error(rollbackErr))
+				client.getLogger().Error("Rollback failed for collector config", zap.Error(rollbackErr))
 			}
-			client.ident = rollbackIdent
-			client.currentConfig = *rollBackCfg
 			return false, err
 		}
 
 		// Set the agent description
-		if err := client.opampClient.SetAgentDescription(client.ident.ToAgentDescription()); err != nil {
+		if err := client.setAgentDescription(updatedIdent); err != nil {
 			// Rollback file
 			if rollbackErr := rollbackFunc(); rollbackErr != nil {
-				client.logger.Error("Rollback failed for collector config", zap.Error(rollbackErr))
+				client.getLogger().Error("Rollback failed for collector config", zap.Error(rollbackErr))
 			}
-			client.ident = rollbackIdent
-			client.currentConfig = *rollBackCfg
 			return false, fmt.Errorf("failed to set agent description: %w ", err)
 		}
 
+		client.setCurrentConfig(*updatedConfig, updatedIdent)
+
 		return true, nil
 	}
 }
 
+// validateRemoteAttributes rejects attribute values from the server that reference environment variables,
+// so the server can't read the agent's environment back from its description.
+// Values unchanged from the current attributes were set locally and may reference them.
+func validateRemoteAttributes(current, remote *opamp.AttributesConfig) error {
+	if remote == nil {
+		return nil
+	}
+
+	var currentIdentifying, currentNonIdentifying map[string]string
+	if current != nil {
+		currentIdentifying = current.Identifying
+		currentNonIdentifying = current.NonIdentifying
+	}
+
+	if err := checkRemoteAttributeValues(currentIdentifying, remote.Identifying); err != nil {
+		return err
+	}
+	return checkRemoteAttributeValues(currentNonIdentifying, remote.NonIdentifying)
+}
+
+// checkRemoteAttributeValues returns an error if a changed value contains a $
+func checkRemoteAttributeValues(current, remote map[string]string) error {
+	for key, value := range remote {
+		if currentValue, ok := current[key]; ok && currentValue == value {
+			continue
+		}
+
+		if strings.Contains(value, "$") {
+			return fmt.Errorf("attribute %s: values set remotely must not reference environment variables", key)
+		}
+	}
+	return nil
+}
+
 func collectorReload(client *Client, collectorConfigPath string) opamp.ReloadFunc {
-	return func(contents []byte) (bool, error) {
+	return func(ctx context.Context, contents []byte) (bool, error) {
+		// Validate the new config before touching the file or the running collector
+		if err := client.collector.ValidateConfig(ctx, contents); err != nil {
+			return false, fmt.Errorf("invalid collector config: %w", err)
+		}
+
+		wasAwaiting := isBootstrapCollectorConfig(collectorConfigPath)
+
 		rollbackFunc, cleanupFunc, err := prepRollback(collectorConfigPath)
 		if err != nil {
 			return false, fmt.Errorf("failed to prep for rollback: %w", err)
@@ -114,7 +157,7 @@ func collectorReload(client *Client, collectorConfigPath string) opamp.ReloadFun
 		defer func() {
 			// Cleanup rollback
 			if err := cleanupFunc(); err != nil {
-				client.logger.Warn("Failed to cleanup rollback file", zap.Error(err))
+				client.getLogger().Warn("Failed to cleanup rollback file", zap.Error(err))
 			}
 		}()
 
@@ -124,26 +167,35 @@ func collectorReload(client *Client, collectorConfigPath string) opamp.ReloadFun
 		}
 
 		// Reload collector
-		if err := client.collector.Restart(context.Background()); err != nil {
+		if err := client.collector.Restart(ctx); err != nil {
 			// Rollback file
 			if rollbackErr := rollbackFunc(); rollbackErr != nil {
-				client.logger.Error("Rollback failed for collector config", zap.Error(rollbackErr))
+				client.getLogger().Error("Rollback failed for collector config", zap.Error(rollbackErr))
 			}
 
-			// Restart collector with original file
+			// Restart collector with original file.
+			// The rollback must not be cancelled or the collector would be left stopped.
 			if rollbackErr := client.collector.Restart(context.Background()); rollbackErr != nil {
-				client.logger.Error("Collector failed for restart during rollback", zap.Error(rollbackErr))
+				client.getLogger().Error("Collector failed for restart during rollback", zap.Error(rollbackErr))
 			}
 
 			return false, fmt.Errorf("collector failed to restart: %w", err)
 		}
 
+		// Let the server know the collector is no longer waiting for its first config
+		if wasAwaiting {
+			client.getLogger().Info("Received configuration from server")
+			if err := client.setAgentDescription(client.getIdent()); err != nil {
+				client.getLogger().Warn("Failed to update agent description", zap.Error(err))
+			}
+		}
+
 		return true, nil
 	}
 }
 
 func loggerReload(client *Client, loggerConfigPath string) opamp.ReloadFunc {
-	return func(contents []byte) (bool, error) {
+	return func(ctx context.Context, contents []byte) (bool, error) {
 		rollbackFunc, cleanupFunc, err := prepRollback(loggerConfigPath)
 		if err != nil {
 			return false, fmt.Errorf("failed to prep for rollback: %w", err)
@@ -152,14 +204,14 @@ func loggerReload(client *Client, loggerConfigPath string) opamp.ReloadFunc {
 		defer func() {
 			// Cleanup rollback
 			if err := cleanupFunc(); err != nil {
-				client.logger.Warn("Failed to cleanup rollback file", zap.Error(err))
+				client.getLogger().Warn("Failed to cleanup rollback file", zap.Error(err))
 			}
 		}()
 
 		// Write new config file
 		if err := updateConfigFile(LoggingConfigName, loggerConfigPath, contents); err != nil {
 			if rollbackErr := rollbackFunc(); rollbackErr != nil {
-				client.logger.Error("Rollback failed for logging config", zap.Error(rollbackErr))
+				client.getLogger().Error("Rollback failed for logging config", zap.Error(rollbackErr))
 			}
 			return false, err
 		}
@@ -168,7 +220,7 @@ func loggerReload(client *Client, loggerConfigPath string) opamp.ReloadFunc {
 		l, err := logging.NewLoggerConfig(loggerConfigPath)
 		if err != nil {
 			if rollbackErr := rollbackFunc(); rollbackErr != nil {
-				client.logger.Error("Rollback failed for logging config", zap.Error(rollbackErr))
+				client.getLogger().Error("Rollback failed for logging config", zap.Error(rollbackErr))
 			}
 			return false, err
 		}
@@ -177,7 +229,7 @@ func loggerReload(client *Client, loggerConfigPath string) opamp.ReloadFunc {
 		opts, err := l.Options()
 		if err != nil {
 			if rollbackErr := rollbackFunc(); rollbackErr != nil {
-				client.logger.Error("Rollback failed for logging config", zap.Error(rollbackErr))
+				client.getLogger().Error("Rollback failed for logging config", zap.Error(rollbackErr))
 			}
 			return false, fmt.Errorf("failed updating logging config: %w", err)
 		}
@@ -186,7 +238,7 @@ func loggerReload(client *Client, loggerConfigPath string) opamp.ReloadFunc {
 		logger, err := zap.NewProduction(opts...)
 		if err != nil {
 			if rollbackErr := rollbackFunc(); rollbackErr != nil {
-				client.logger.Error("Rollback failed for logging config", zap.Error(rollbackErr))
+				client.getLogger().Error("Rollback failed for logging config", zap.Error(rollbackErr))
 			}
 			return false, fmt.Errorf("failed updating logging config: %w", err)
 		}
@@ -194,30 +246,43 @@ func loggerReload(client *Client, loggerConfigPath string) opamp.ReloadFunc {
 		// Apply logging opts to collector
 		rollbackOpts := client.collector.GetLoggingOpts()
 		client.collector.SetLoggingOpts(opts)
-		if err := client.collector.Restart(context.Background()); err != nil {
+		if err := client.collector.Restart(ctx); err != nil {
 			if rollbackErr := rollbackFunc(); rollbackErr != nil {
-				client.logger.Error("Rollback failed for logging config", zap.Error(rollbackErr))
+				client.getLogger().Error("Rollback failed for logging config", zap.Error(rollbackErr))
 			}
 
-			// Restart collector with original logging opts
+			// Restart collector with original logging opts.
+			// The rollback must not be cancelled or the collector would be left stopped.
 			client.collector.SetLoggingOpts(rollbackOpts)
 			if rollbackErr := client.collector.Restart(context.Background()); rollbackErr != nil {
-				client.logger.Error("Collector failed for restart during rollback", zap.Error(rollbackErr))
+				client.getLogger().Error("Collector failed for restart during rollback", zap.Error(rollbackErr))
 			}
 
 			return false, fmt.Errorf("failed apply logging update to collector: %w", err)
 		}
 
 		// Assign new client logger
-		client.logger = logger.Named("opamp")
+		client.setLogger(logger.Named("opamp"))
 
 		return true, nil
 	}
 }
 
+// fileSetOnChange returns the function called after files in the set change
+func fileSetOnChange(client *Client, fileSet opamp.FileSet) opamp.FileChangeFunc {
+	if fileSet.OnChange != opamp.OnChangeRestartCollector {
+		return nil
+	}
+
+	return func(ctx context.Context, filePaths []string) error {
+		client.getLogger().Info("Restarting collector after file set changed", zap.String("file_set", fileSet.Name), zap.Strings("files", filePaths))
+		return client.collector.Restart(ctx)
+	}
+}
+
 func updateConfigFile(configName, configPath string, contents []byte) error {
 	// Write file
-	if err := os.WriteFile(configPath, contents, 0600); err != nil {
+	if err := opamp.WriteFileAtomic(configPath, contents, 0600); err != nil {
 		return fmt.Errorf("failed to update config file %s: %w", configName, err)
 	}
 
@@ -253,7 +318,7 @@ func copyFile(originPath, newPath string) error {
 		return fmt.Errorf("failed to read origin file: %w", err)
 	}
 
-	err = os.WriteFile(newPath, data, 0600)
+	err = opamp.WriteFileAtomic(newPath, data, 0600)
 	if err != nil {
 		return fmt.Errorf("failed to write new file: %w", err)
 	}
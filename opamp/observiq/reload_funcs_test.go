@@ -15,6 +15,7 @@
 package observiq
 
 import (
+	"context"
 	"errors"
 	"os"
 	"path/filepath"
@@ -23,6 +24,7 @@ import (
 	colmocks "github.com/observiq/observiq-otel-collector/collector/mocks"
 	"github.com/observiq/observiq-otel-collector/opamp"
 	"github.com/observiq/observiq-otel-collector/opamp/mocks"
+	"github.com/open-telemetry/opamp-go/protobufs"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"go.uber.org/zap"
@@ -42,7 +44,7 @@ func Test_managerReload(t *testing.T) {
 
 				badContents := []byte(`\t\t\t`)
 
-				changed, err := reloadFunc(badContents)
+				changed, err := reloadFunc(context.Background(), badContents)
 				assert.ErrorContains(t, err, "failed to validate config")
 				assert.False(t, changed)
 			},
@@ -68,7 +70,7 @@ func Test_managerReload(t *testing.T) {
 				err = os.WriteFile(managerFilePath, newContents, 0600)
 				assert.NoError(t, err)
 
-				changed, err := reloadFunc(newContents)
+				changed, err := reloadFunc(context.Background(), newContents)
 				assert.NoError(t, err)
 				assert.False(t, changed)
 			},
@@ -113,7 +115,7 @@ func Test_managerReload(t *testing.T) {
 				newContents, err := yaml.Marshal(newConfig)
 				assert.NoError(t, err)
 
-				changed, err := reloadFunc(newContents)
+				changed, err := reloadFunc(context.Background(), newContents)
 				assert.NoError(t, err)
 				assert.True(t, changed)
 
@@ -127,6 +129,129 @@ func Test_managerReload(t *testing.T) {
 				assert.Equal(t, newContents, data)
 			},
 		},
+		{
+			desc: "Changes to attributes, successful update",
+			testFunc: func(*testing.T) {
+				tmpDir := t.TempDir()
+
+				managerFilePath := filepath.Join(tmpDir, ManagerConfigName)
+
+				currConfig := &opamp.Config{
+					Endpoint: "ws://localhost:1234",
+					AgentID:  "d4691426-b0bb-41f7-84a8-320a9ec0ea2e",
+				}
+
+				mockOpAmpClient := mocks.NewMockOpAMPClient(t)
+				mockOpAmpClient.On("SetAgentDescription", mock.Anything).Return(nil)
+
+				client := &Client{
+					opampClient:   mockOpAmpClient,
+					ident:         newIdentity(zap.NewNop(), *currConfig),
+					currentConfig: *currConfig,
+				}
+				reloadFunc := managerReload(client, managerFilePath)
+
+				currContents, err := yaml.Marshal(currConfig)
+				assert.NoError(t, err)
+				err = os.WriteFile(managerFilePath, currContents, 0600)
+				assert.NoError(t, err)
+
+				newConfig := &opamp.Config{
+					Endpoint: "ws://localhost:1234",
+					AgentID:  "d4691426-b0bb-41f7-84a8-320a9ec0ea2e",
+					Attributes: &opamp.AttributesConfig{
+						NonIdentifying: map[string]string{"datacenter": "east"},
+					},
+				}
+
+				newContents, err := yaml.Marshal(newConfig)
+				assert.NoError(t, err)
+
+				changed, err := reloadFunc(context.Background(), newContents)
+				assert.NoError(t, err)
+				assert.True(t, changed)
+
+				assert.Equal(t, newConfig.Attributes, client.ident.attributes)
+				assert.Equal(t, newConfig.Attributes, client.currentConfig.Attributes)
+
+				data, err := os.ReadFile(managerFilePath)
+				assert.NoError(t, err)
+				assert.Equal(t, newContents, data)
+			},
+		},
+		{
+			desc: "Invalid attributes",
+			testFunc: func(*testing.T) {
+				client := &Client{}
+				reloadFunc := managerReload(client, ManagerConfigName)
+
+				changed, err := reloadFunc(context.Background(), []byte("attributes:\n  identifying:\n    \"\": value\n"))
+				assert.ErrorContains(t, err, "attribute keys must not be empty")
+				assert.False(t, changed)
+			},
+		},
+		{
+			desc: "Remote attributes referencing environment variables are rejected",
+			testFunc: func(t *testing.T) {
+				t.Setenv("RELOAD_TEST_SECRET", "secret")
+				currConfig := opamp.Config{
+					Endpoint: "ws://localhost:1234",
+					AgentID:  "d4691426-b0bb-41f7-84a8-320a9ec0ea2e",
+				}
+				client := &Client{
+					ident:         newIdentity(zap.NewNop(), currConfig),
+					currentConfig: currConfig,
+				}
+				reloadFunc := managerReload(client, ManagerConfigName)
+
+				changed, err := reloadFunc(context.Background(), []byte("attributes:\n  non_identifying:\n    x: ${RELOAD_TEST_SECRET}\n"))
+				assert.ErrorContains(t, err, "attribute x: values set remotely must not reference environment variables")
+				assert.False(t, changed)
+				assert.Nil(t, client.ident.attributes)
+			},
+		},
+		{
+			desc: "Local attributes referencing environment variables are kept",
+			testFunc: func(t *testing.T) {
+				t.Setenv("RELOAD_TEST_DATACENTER", "east")
+				tmpDir := t.TempDir()
+				managerFilePath := filepath.Join(tmpDir, ManagerConfigName)
+
+				currConfig := opamp.Config{
+					Endpoint: "ws://localhost:1234",
+					AgentID:  "d4691426-b0bb-41f7-84a8-320a9ec0ea2e",
+					Attributes: &opamp.AttributesConfig{
+						NonIdentifying: map[string]string{"datacenter": "$RELOAD_TEST_DATACENTER"},
+					},
+				}
+
+				mockOpAmpClient := mocks.NewMockOpAMPClient(t)
+				mockOpAmpClient.On("SetAgentDescription", mock.Anything).Return(nil)
+
+				client := &Client{
+					opampClient:   mockOpAmpClient,
+					ident:         newIdentity(zap.NewNop(), currConfig),
+					currentConfig: currConfig,
+				}
+				reloadFunc := managerReload(client, managerFilePath)
+
+				currContents, err := yaml.Marshal(currConfig)
+				assert.NoError(t, err)
+				assert.NoError(t, os.WriteFile(managerFilePath, currContents, 0600))
+
+				newConfig := currConfig.Copy()
+				newConfig.Attributes.NonIdentifying["oncall"] = "platform"
+				newContents, err := yaml.Marshal(newConfig)
+				assert.NoError(t, err)
+
+				changed, err := reloadFunc(context.Background(), newContents)
+				assert.NoError(t, err)
+				assert.True(t, changed)
+
+				assert.Equal(t, map[string]string{"datacenter": "east", "oncall": "platform"}, client.ident.attributes.NonIdentifying)
+				assert.Equal(t, newConfig.Attributes, client.currentConfig.Attributes)
+			},
+		},
 		{
 			desc: "Changes to updatable fields, failure occurs, rollback happens",
 			testFunc: func(*testing.T) {
@@ -168,7 +293,7 @@ func Test_managerReload(t *testing.T) {
 				newContents, err := yaml.Marshal(newConfig)
 				assert.NoError(t, err)
 
-				changed, err := reloadFunc(newContents)
+				changed, err := reloadFunc(context.Background(), newContents)
 				assert.ErrorContains(t, err, "failed to set agent description")
 				assert.False(t, changed)
 
@@ -205,6 +330,7 @@ func Test_collectorReload(t *testing.T) {
 
 				expectedErr := errors.New("oops")
 				mockCollector := colmocks.NewMockCollector(t)
+				mockCollector.On("ValidateConfig", mock.Anything, []byte("valid: config")).Return(nil)
 				mockCollector.On("Restart", mock.Anything).Return(expectedErr).Once()
 				mockCollector.On("Restart", mock.Anything).Return(nil).Once()
 
@@ -220,7 +346,7 @@ func Test_collectorReload(t *testing.T) {
 
 				reloadFunc := collectorReload(client, collectorFilePath)
 
-				changed, err := reloadFunc([]byte("valid: config"))
+				changed, err := reloadFunc(context.Background(), []byte("valid: config"))
 				assert.ErrorIs(t, err, expectedErr)
 				assert.False(t, changed)
 
@@ -238,6 +364,7 @@ func Test_collectorReload(t *testing.T) {
 				collectorFilePath := filepath.Join(tmpDir, CollectorConfigName)
 
 				mockCollector := colmocks.NewMockCollector(t)
+				mockCollector.On("ValidateConfig", mock.Anything, []byte("valid: config")).Return(nil)
 				mockCollector.On("Restart", mock.Anything).Return(nil)
 
 				currContents := []byte("current: config")
@@ -253,7 +380,7 @@ func Test_collectorReload(t *testing.T) {
 				reloadFunc := collectorReload(client, collectorFilePath)
 
 				newContents := []byte("valid: config")
-				changed, err := reloadFunc(newContents)
+				changed, err := reloadFunc(context.Background(), newContents)
 				assert.NoError(t, err)
 				assert.True(t, changed)
 
@@ -263,6 +390,138 @@ func Test_collectorReload(t *testing.T) {
 				assert.Equal(t, newContents, data)
 			},
 		},
+		{
+			desc: "First config from server reports the agent is configured",
+			testFunc: func(t *testing.T) {
+				tmpDir := t.TempDir()
+
+				collectorFilePath := filepath.Join(tmpDir, CollectorConfigName)
+				err := os.WriteFile(collectorFilePath, bootstrapCollectorConfig, 0600)
+				assert.NoError(t, err)
+
+				mockCollector := colmocks.NewMockCollector(t)
+				mockCollector.On("ValidateConfig", mock.Anything, []byte("valid: config")).Return(nil)
+				mockCollector.On("Restart", mock.Anything).Return(nil)
+
+				mockOpAmpClient := mocks.NewMockOpAMPClient(t)
+				mockOpAmpClient.On("SetAgentDescription", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+					desc := args.Get(0).(*protobufs.AgentDescription)
+					assert.Equal(t, configStatusConfigured, findAttribute(desc.GetNonIdentifyingAttributes(), configStatusAttribute))
+				}).Once()
+
+				client := newBootstrapTestClient(t, collectorFilePath)
+				client.collector = mockCollector
+				client.opampClient = mockOpAmpClient
+
+				reloadFunc := collectorReload(client, collectorFilePath)
+
+				changed, err := reloadFunc(context.Background(), []byte("valid: config"))
+				assert.NoError(t, err)
+				assert.True(t, changed)
+			},
+		},
+		{
+			desc: "First config from server fails to restart",
+			testFunc: func(t *testing.T) {
+				tmpDir := t.TempDir()
+
+				collectorFilePath := filepath.Join(tmpDir, CollectorConfigName)
+				err := os.WriteFile(collectorFilePath, bootstrapCollectorConfig, 0600)
+				assert.NoError(t, err)
+
+				expectedErr := errors.New("oops")
+				mockCollector := colmocks.NewMockCollector(t)
+				mockCollector.On("ValidateConfig", mock.Anything, []byte("valid: config")).Return(nil)
+				mockCollector.On("Restart", mock.Anything).Return(expectedErr).Once()
+				mockCollector.On("Restart", mock.Anything).Return(nil).Once()
+
+				// Still awaiting configuration so the description isn't updated
+				client := newBootstrapTestClient(t, collectorFilePath)
+				client.collector = mockCollector
+				client.opampClient = mocks.NewMockOpAMPClient(t)
+
+				reloadFunc := collectorReload(client, collectorFilePath)
+
+				changed, err := reloadFunc(context.Background(), []byte("valid: config"))
+				assert.ErrorIs(t, err, expectedErr)
+				assert.False(t, changed)
+				assert.True(t, client.awaitingConfiguration())
+			},
+		},
+		{
+			desc: "Cancelled restart rolls back with an uncancelled restart",
+			testFunc: func(t *testing.T) {
+				tmpDir := t.TempDir()
+
+				collectorFilePath := filepath.Join(tmpDir, CollectorConfigName)
+
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+
+				mockCollector := colmocks.NewMockCollector(t)
+				mockCollector.On("ValidateConfig", mock.Anything, []byte("valid: config")).Return(nil)
+				mockCollector.On("Restart", ctx).Return(context.Canceled).Once()
+				mockCollector.On("Restart", mock.MatchedBy(func(restartCtx context.Context) bool {
+					return restartCtx.Err() == nil
+				})).Return(nil).Once()
+
+				currContents := []byte("current: config")
+
+				// Write Config file so we can verify it remained the same
+				err := os.WriteFile(collectorFilePath, currContents, 0600)
+				assert.NoError(t, err)
+
+				client := &Client{
+					collector: mockCollector,
+				}
+
+				reloadFunc := collectorReload(client, collectorFilePath)
+
+				changed, err := reloadFunc(ctx, []byte("valid: config"))
+				assert.ErrorIs(t, err, context.Canceled)
+				assert.False(t, changed)
+
+				// Verify config rolledback
+				data, err := os.ReadFile(collectorFilePath)
+				assert.NoError(t, err)
+				assert.Equal(t, currContents, data)
+			},
+		},
+		{
+			desc: "Invalid config is rejected without writing or restarting",
+			testFunc: func(t *testing.T) {
+				tmpDir := t.TempDir()
+
+				collectorFilePath := filepath.Join(tmpDir, CollectorConfigName)
+
+				expectedErr := errors.New(`unknown receivers type "bad"`)
+				mockCollector := colmocks.NewMockCollector(t)
+				mockCollector.On("ValidateConfig", mock.Anything, []byte("invalid: config")).Return(expectedErr)
+
+				currContents := []byte("current: config")
+
+				// Write Config file so we can verify it remained the same
+				err := os.WriteFile(collectorFilePath, currContents, 0600)
+				assert.NoError(t, err)
+
+				client := &Client{
+					collector: mockCollector,
+				}
+
+				reloadFunc := collectorReload(client, collectorFilePath)
+
+				changed, err := reloadFunc(context.Background(), []byte("invalid: config"))
+				assert.ErrorIs(t, err, expectedErr)
+				assert.ErrorContains(t, err, "invalid collector config")
+				assert.False(t, changed)
+
+				// Verify config untouched and no rollback file left behind
+				data, err := os.ReadFile(collectorFilePath)
+				assert.NoError(t, err)
+				assert.Equal(t, currContents, data)
+				assert.NoFileExists(t, collectorFilePath+".rollback")
+			},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -302,7 +561,7 @@ func Test_loggerReload(t *testing.T) {
 				reloadFunc := loggerReload(client, loggerFilePath)
 
 				newContents := []byte("output: stdout\nlevel: debug")
-				changed, err := reloadFunc(newContents)
+				changed, err := reloadFunc(context.Background(), newContents)
 				assert.NoError(t, err)
 				assert.True(t, changed)
 
@@ -344,7 +603,7 @@ func Test_loggerReload(t *testing.T) {
 				reloadFunc := loggerReload(client, loggerFilePath)
 
 				newContents := []byte("output: stdout\nlevel: debug")
-				changed, err := reloadFunc(newContents)
+				changed, err := reloadFunc(context.Background(), newContents)
 				assert.ErrorIs(t, err, expectedErr)
 				assert.False(t, changed)
 
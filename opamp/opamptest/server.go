@@ -0,0 +1,381 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package opamptest provides an in-process OpAMP server for testing agents end to end
+package opamptest
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/open-telemetry/opamp-go/protobufs"
+	"google.golang.org/protobuf/proto"
+)
+
+// OpAMPPath is the path the server accepts connections on
+const OpAMPPath = "/v1/opamp"
+
+// secretKeyAuthPrefix is the prefix of the Authorization header value containing the secret key
+const secretKeyAuthPrefix = "Secret-Key "
+
+// serverCapabilities are sent with every message so the first message received by an agent always has them
+const serverCapabilities = protobufs.ServerCapabilities_AcceptsStatus |
+	protobufs.ServerCapabilities_OffersRemoteConfig |
+	protobufs.ServerCapabilities_AcceptsEffectiveConfig |
+	protobufs.ServerCapabilities_OffersConnectionSettings
+
+// ErrNotConnected is returned when sending a message while no agent is connected
+var ErrNotConnected = errors.New("no agent is connected")
+
+// AgentStatus is the state reported by the agent. Agents omit fields that haven't changed since
+// their last message, so each field is the latest value reported in any message.
+type AgentStatus struct {
+	// Connected is true while the agent has a connection open
+	Connected bool
+
+	// Connections is the number of connections the agent has opened
+	Connections int
+
+	// Header is the HTTP header of the agent's latest connection
+	Header http.Header
+
+	InstanceUID        string
+	Capabilities       protobufs.AgentCapabilities
+	Description        *protobufs.AgentDescription
+	EffectiveConfig    *protobufs.EffectiveConfig
+	RemoteConfigStatus *protobufs.RemoteConfigStatus
+}
+
+// Option configures the server
+type Option func(*Server)
+
+// WithSecretKey rejects connections that don't authorize with the secret key
+func WithSecretKey(secretKey string) Option {
+	return func(s *Server) {
+		s.secretKey = &secretKey
+	}
+}
+
+// WithTLS serves connections over TLS with the config
+func WithTLS(tlsConfig *tls.Config) Option {
+	return func(s *Server) {
+		s.tlsConfig = tlsConfig
+	}
+}
+
+// Server is an OpAMP server for a single agent. It records what the agent reports and lets tests
+// script the messages sent to it.
+//
+// The opamp-go server writes responses from its read loop, which can't safely be combined with
+// messages sent from a test, so connections are handled here with a single guarded writer.
+type Server struct {
+	secretKey *string
+	tlsConfig *tls.Config
+
+	httpServer *httptest.Server
+	upgrader   websocket.Upgrader
+
+	// writeMux serializes writes to the connection
+	writeMux sync.Mutex
+
+	mux      sync.Mutex
+	conn     *websocket.Conn
+	status   AgentStatus
+	messages []*protobufs.AgentToServer
+
+	// updated is closed and replaced each time the status changes
+	updated chan struct{}
+}
+
+// NewServer starts a server on a local port. It's closed when the test finishes.
+func NewServer(t testing.TB, opts ...Option) *Server {
+	s := &Server{
+		updated: make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(OpAMPPath, s.handleConnection)
+	s.httpServer = httptest.NewUnstartedServer(mux)
+
+	if s.tlsConfig != nil {
+		s.httpServer.TLS = s.tlsConfig
+		s.httpServer.StartTLS()
+	} else {
+		s.httpServer.Start()
+	}
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// Endpoint is the websocket URL agents connect to
+func (s *Server) Endpoint() string {
+	endpoint := strings.Replace(s.httpServer.URL, "http://", "ws://", 1)
+	endpoint = strings.Replace(endpoint, "https://", "wss://", 1)
+	return endpoint + OpAMPPath
+}
+
+// Close disconnects the agent and stops the server
+func (s *Server) Close() {
+	s.mux.Lock()
+	conn := s.conn
+	s.mux.Unlock()
+
+	if conn != nil {
+		_ = conn.Close()
+	}
+	s.httpServer.Close()
+}
+
+// Status returns a copy of the latest state reported by the agent
+func (s *Server) Status() AgentStatus {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.status.copy()
+}
+
+// Messages returns copies of every message received from the agent in order
+func (s *Server) Messages() []*protobufs.AgentToServer {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	messages := make([]*protobufs.AgentToServer, 0, len(s.messages))
+	for _, msg := range s.messages {
+		messages = append(messages, proto.Clone(msg).(*protobufs.AgentToServer))
+	}
+	return messages
+}
+
+// WaitFor blocks until the agent's status satisfies the condition and returns that status.
+// An error with the last status is returned if it isn't satisfied within the timeout.
+func (s *Server) WaitFor(timeout time.Duration, condition func(AgentStatus) bool) (AgentStatus, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		s.mux.Lock()
+		status := s.status.copy()
+		updated := s.updated
+		s.mux.Unlock()
+
+		if condition(status) {
+			return status, nil
+		}
+
+		select {
+		case <-updated:
+		case <-timer.C:
+			return status, fmt.Errorf("timed out after %s waiting for agent status", timeout)
+		}
+	}
+}
+
+// Send sends the message to the connected agent
+func (s *Server) Send(msg *protobufs.ServerToAgent) error {
+	s.mux.Lock()
+	conn := s.conn
+	instanceUID := s.status.InstanceUID
+	s.mux.Unlock()
+
+	if conn == nil {
+		return ErrNotConnected
+	}
+
+	if msg.InstanceUid == "" {
+		msg.InstanceUid = instanceUID
+	}
+	return s.write(conn, msg)
+}
+
+// PushRemoteConfig offers the configs to the agent and returns the hash the agent reports in its remote config status
+func (s *Server) PushRemoteConfig(configMap map[string]*protobufs.AgentConfigFile) ([]byte, error) {
+	hash := ConfigHash(configMap)
+	err := s.Send(&protobufs.ServerToAgent{
+		RemoteConfig: &protobufs.AgentRemoteConfig{
+			Config:     &protobufs.AgentConfigMap{ConfigMap: configMap},
+			ConfigHash: hash,
+		},
+	})
+	return hash, err
+}
+
+// OfferConnectionSettings offers the agent new settings for connecting to the server
+func (s *Server) OfferConnectionSettings(settings *protobufs.OpAMPConnectionSettings) error {
+	return s.Send(&protobufs.ServerToAgent{
+		ConnectionSettings: &protobufs.ConnectionSettingsOffers{
+			Hash:  []byte(fmt.Sprintf("%x", sha256.Sum256([]byte(settings.String())))),
+			Opamp: settings,
+		},
+	})
+}
+
+// SendCommand instructs the agent to perform the command
+func (s *Server) SendCommand(commandType protobufs.ServerToAgentCommand_CommandType) error {
+	return s.Send(&protobufs.ServerToAgent{
+		Command: &protobufs.ServerToAgentCommand{Type: commandType},
+	})
+}
+
+// RequestFullState asks the agent to report its description, effective config, and remote config status again
+func (s *Server) RequestFullState() error {
+	return s.Send(&protobufs.ServerToAgent{
+		Flags: protobufs.ServerToAgent_ReportFullState,
+	})
+}
+
+// AssignAgentID instructs the agent to use a new instance UID
+func (s *Server) AssignAgentID(instanceUID string) error {
+	return s.Send(&protobufs.ServerToAgent{
+		AgentIdentification: &protobufs.AgentIdentification{NewInstanceUid: instanceUID},
+	})
+}
+
+// ConfigHash computes a hash of the configs' names and bodies
+func ConfigHash(configMap map[string]*protobufs.AgentConfigFile) []byte {
+	names := make([]string, 0, len(configMap))
+	for name := range configMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	hash := sha256.New()
+	for _, name := range names {
+		hash.Write([]byte(name))
+		hash.Write(configMap[name].GetBody())
+	}
+	return hash.Sum(nil)
+}
+
+// handleConnection authorizes and upgrades the connection then records messages until the agent disconnects
+func (s *Server) handleConnection(w http.ResponseWriter, r *http.Request) {
+	if s.secretKey != nil && r.Header.Get("Authorization") != secretKeyAuthPrefix+*s.secretKey {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	s.updateStatus(func(status *AgentStatus) {
+		// Only the latest connection is used when an agent reconnects before the old one is closed
+		if s.conn != nil {
+			_ = s.conn.Close()
+		}
+		s.conn = conn
+		status.Connected = true
+		status.Connections++
+		status.Header = r.Header.Clone()
+	})
+
+	defer s.updateStatus(func(status *AgentStatus) {
+		if s.conn == conn {
+			s.conn = nil
+			status.Connected = false
+		}
+	})
+
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if messageType != websocket.BinaryMessage {
+			continue
+		}
+
+		var msg protobufs.AgentToServer
+		if err := proto.Unmarshal(data, &msg); err != nil {
+			continue
+		}
+		s.recordMessage(&msg)
+
+		if err := s.write(conn, &protobufs.ServerToAgent{InstanceUid: msg.GetInstanceUid()}); err != nil {
+			return
+		}
+	}
+}
+
+// recordMessage merges the fields set in the message into the status
+func (s *Server) recordMessage(msg *protobufs.AgentToServer) {
+	s.updateStatus(func(status *AgentStatus) {
+		s.messages = append(s.messages, msg)
+
+		status.InstanceUID = msg.GetInstanceUid()
+		status.Capabilities = msg.GetCapabilities()
+		if msg.AgentDescription != nil {
+			status.Description = msg.AgentDescription
+		}
+		if msg.EffectiveConfig != nil {
+			status.EffectiveConfig = msg.EffectiveConfig
+		}
+		if msg.RemoteConfigStatus != nil {
+			status.RemoteConfigStatus = msg.RemoteConfigStatus
+		}
+	})
+}
+
+// updateStatus changes the status and wakes anything waiting for it
+func (s *Server) updateStatus(update func(*AgentStatus)) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	update(&s.status)
+	close(s.updated)
+	s.updated = make(chan struct{})
+}
+
+// write sends the message with the server's capabilities
+func (s *Server) write(conn *websocket.Conn, msg *protobufs.ServerToAgent) error {
+	msg.Capabilities = serverCapabilities
+
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	s.writeMux.Lock()
+	defer s.writeMux.Unlock()
+	return conn.WriteMessage(websocket.BinaryMessage, data)
+}
+
+func (a AgentStatus) copy() AgentStatus {
+	statusCopy := a
+	statusCopy.Header = a.Header.Clone()
+	if a.Description != nil {
+		statusCopy.Description = proto.Clone(a.Description).(*protobufs.AgentDescription)
+	}
+	if a.EffectiveConfig != nil {
+		statusCopy.EffectiveConfig = proto.Clone(a.EffectiveConfig).(*protobufs.EffectiveConfig)
+	}
+	if a.RemoteConfigStatus != nil {
+		statusCopy.RemoteConfigStatus = proto.Clone(a.RemoteConfigStatus).(*protobufs.RemoteConfigStatus)
+	}
+	return statusCopy
+}
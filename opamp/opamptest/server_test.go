@@ -0,0 +1,202 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opamptest
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/open-telemetry/opamp-go/client"
+	"github.com/open-telemetry/opamp-go/client/types"
+	"github.com/open-telemetry/opamp-go/protobufs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+const (
+	testSecretKey   = "b92222ee-a1fc-4bb1-98db-26de3448541b"
+	testInstanceUID = "d4691426-b0bb-41f7-84a8-320a9ec0ea2e"
+	testTimeout     = 5 * time.Second
+)
+
+func TestServer(t *testing.T) {
+	server := NewServer(t, WithSecretKey(testSecretKey))
+
+	received := make(chan *types.MessageData, 1)
+	commands := make(chan *protobufs.ServerToAgentCommand, 1)
+	offers := make(chan *protobufs.OpAMPConnectionSettings, 1)
+
+	opampClient := client.NewWebSocket(zap.NewNop().Sugar())
+	require.NoError(t, opampClient.SetAgentDescription(testDescription()))
+
+	err := opampClient.Start(context.Background(), types.StartSettings{
+		OpAMPServerURL: server.Endpoint(),
+		Header:         http.Header{"Authorization": []string{secretKeyAuthPrefix + testSecretKey}},
+		InstanceUid:    testInstanceUID,
+		Callbacks: types.CallbacksStruct{
+			OnMessageFunc: func(_ context.Context, msg *types.MessageData) {
+				// Every message is acknowledged so only keep the remote config
+				if msg.RemoteConfig != nil {
+					received <- msg
+				}
+			},
+			OnCommandFunc: func(command *protobufs.ServerToAgentCommand) error {
+				commands <- command
+				return nil
+			},
+			OnOpampConnectionSettingsFunc: func(_ context.Context, settings *protobufs.OpAMPConnectionSettings) error {
+				offers <- settings
+				return nil
+			},
+			GetEffectiveConfigFunc: func(context.Context) (*protobufs.EffectiveConfig, error) {
+				return &protobufs.EffectiveConfig{
+					ConfigMap: &protobufs.AgentConfigMap{
+						ConfigMap: map[string]*protobufs.AgentConfigFile{"config.yaml": {Body: []byte("key: value")}},
+					},
+				}, nil
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	// The agent's description is recorded
+	status, err := server.WaitFor(testTimeout, func(status AgentStatus) bool {
+		return status.Connected && status.Description != nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, testInstanceUID, status.InstanceUID)
+	assert.Equal(t, 1, status.Connections)
+	assert.Equal(t, "test-agent", status.Description.GetIdentifyingAttributes()[0].GetValue().GetStringValue())
+	assert.Equal(t, secretKeyAuthPrefix+testSecretKey, status.Header.Get("Authorization"))
+
+	// Remote configs are pushed with their hash
+	configMap := map[string]*protobufs.AgentConfigFile{"config.yaml": {Body: []byte("key: new")}}
+	hash, err := server.PushRemoteConfig(configMap)
+	require.NoError(t, err)
+	assert.Equal(t, ConfigHash(configMap), hash)
+
+	var msg *types.MessageData
+	select {
+	case msg = <-received:
+	case <-time.After(testTimeout):
+		t.Fatal("remote config was never received")
+	}
+	assert.Equal(t, hash, msg.RemoteConfig.GetConfigHash())
+	assert.Equal(t, []byte("key: new"), msg.RemoteConfig.GetConfig().GetConfigMap()["config.yaml"].GetBody())
+
+	// Remote config statuses are recorded
+	require.NoError(t, opampClient.SetRemoteConfigStatus(&protobufs.RemoteConfigStatus{
+		LastRemoteConfigHash: hash,
+		Status:               protobufs.RemoteConfigStatus_APPLIED,
+	}))
+	status, err = server.WaitFor(testTimeout, func(status AgentStatus) bool {
+		return bytes.Equal(hash, status.RemoteConfigStatus.GetLastRemoteConfigHash())
+	})
+	require.NoError(t, err)
+	assert.Equal(t, hash, status.RemoteConfigStatus.GetLastRemoteConfigHash())
+	assert.Equal(t, protobufs.RemoteConfigStatus_APPLIED, status.RemoteConfigStatus.GetStatus())
+
+	// Commands are sent
+	require.NoError(t, server.SendCommand(protobufs.ServerToAgentCommand_Restart))
+	select {
+	case command := <-commands:
+		assert.Equal(t, protobufs.ServerToAgentCommand_Restart, command.GetType())
+	case <-time.After(testTimeout):
+		t.Fatal("command was never received")
+	}
+
+	// Connection settings are offered
+	require.NoError(t, server.OfferConnectionSettings(&protobufs.OpAMPConnectionSettings{
+		DestinationEndpoint: "ws://new.localnet:1234/v1/opamp",
+	}))
+	select {
+	case offer := <-offers:
+		assert.Equal(t, "ws://new.localnet:1234/v1/opamp", offer.GetDestinationEndpoint())
+	case <-time.After(testTimeout):
+		t.Fatal("connection settings were never offered")
+	}
+
+	// The full state is reported on request
+	require.NoError(t, server.RequestFullState())
+	status, err = server.WaitFor(testTimeout, func(status AgentStatus) bool {
+		return status.EffectiveConfig != nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []byte("key: value"), status.EffectiveConfig.GetConfigMap().GetConfigMap()["config.yaml"].GetBody())
+	assert.NotEmpty(t, server.Messages())
+
+	// Disconnecting is recorded
+	require.NoError(t, opampClient.Stop(context.Background()))
+	_, err = server.WaitFor(testTimeout, func(status AgentStatus) bool {
+		return !status.Connected
+	})
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, server.RequestFullState(), ErrNotConnected)
+}
+
+func TestServerRejectsSecretKey(t *testing.T) {
+	server := NewServer(t, WithSecretKey(testSecretKey))
+
+	failed := make(chan error, 1)
+	opampClient := client.NewWebSocket(zap.NewNop().Sugar())
+	require.NoError(t, opampClient.SetAgentDescription(testDescription()))
+
+	err := opampClient.Start(context.Background(), types.StartSettings{
+		OpAMPServerURL: server.Endpoint(),
+		Header:         http.Header{"Authorization": []string{secretKeyAuthPrefix + "wrong"}},
+		InstanceUid:    testInstanceUID,
+		Callbacks: types.CallbacksStruct{
+			OnConnectFailedFunc: func(err error) {
+				select {
+				case failed <- err:
+				default:
+				}
+			},
+		},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = opampClient.Stop(context.Background()) })
+
+	select {
+	case err := <-failed:
+		assert.Error(t, err)
+	case <-time.After(testTimeout):
+		t.Fatal("connecting never failed")
+	}
+	assert.Equal(t, 0, server.Status().Connections)
+}
+
+func TestWaitForTimeout(t *testing.T) {
+	server := NewServer(t)
+
+	status, err := server.WaitFor(10*time.Millisecond, func(status AgentStatus) bool {
+		return status.Connected
+	})
+	assert.EqualError(t, err, "timed out after 10ms waiting for agent status")
+	assert.False(t, status.Connected)
+}
+
+func testDescription() *protobufs.AgentDescription {
+	return &protobufs.AgentDescription{
+		IdentifyingAttributes: []*protobufs.KeyValue{
+			{Key: "service.name", Value: &protobufs.AnyValue{Value: &protobufs.AnyValue_StringValue{StringValue: "test-agent"}}},
+		},
+	}
+}
@@ -0,0 +1,324 @@
+// Copyright  observIQ, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opamp
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redactedPrefix is the prefix of every masked value
+const redactedPrefix = "REDACTED:"
+
+// RedactionKeyFileName is the name of the file next to manager.yaml holding the key masks are computed with
+const RedactionKeyFileName = "redaction.key"
+
+// ErrMaskedValue is returned for a remote config containing a mask, which would replace the value it hides
+var ErrMaskedValue = errors.New("config contains a masked value")
+
+// maskPattern matches a mask produced by a Redactor
+var maskPattern = regexp.MustCompile(redactedPrefix + `[0-9a-f]{16}`)
+
+// defaultKeyPatterns match keys whose values are always masked
+var defaultKeyPatterns = []string{
+	`(?i)^secret[_-]?key$`,
+	`(?i)passw(or)?d`,
+	`(?i)secret$`,
+	`(?i)token$`,
+	`(?i)api[_-]?key$`,
+	`(?i)^credentials$`,
+	`(?i)^private[_-]?key$`,
+	`(?i)^authorization$`,
+}
+
+// defaultValuePatterns match string values that are always masked
+var defaultValuePatterns = []string{
+	`-----BEGIN [A-Z ]*PRIVATE KEY-----`,
+}
+
+// RedactionConfig configures additional values masked in configs reported to the server
+type RedactionConfig struct {
+	// KeyPatterns are regular expressions matched against keys. The values of matching keys are masked.
+	KeyPatterns []string `yaml:"key_patterns,omitempty"`
+
+	// ValuePatterns are regular expressions matched against string values. Matching values are masked.
+	ValuePatterns []string `yaml:"value_patterns,omitempty"`
+}
+
+// copy creates a deep copy of the redaction config
+func (r RedactionConfig) copy() *RedactionConfig {
+	redactionCopy := &RedactionConfig{}
+
+	if r.KeyPatterns != nil {
+		redactionCopy.KeyPatterns = append([]string{}, r.KeyPatterns...)
+	}
+	if r.ValuePatterns != nil {
+		redactionCopy.ValuePatterns = append([]string{}, r.ValuePatterns...)
+	}
+
+	return redactionCopy
+}
+
+// Redactor masks sensitive values in YAML and JSON configs.
+// Masked values are replaced with a keyed hash of the value so equal values always produce equal masks.
+type Redactor struct {
+	hashKey       []byte
+	keyPatterns   []*regexp.Regexp
+	valuePatterns []*regexp.Regexp
+}
+
+// NewRedactor creates a redactor that masks the default sensitive fields and those matching the config, which may be nil.
+// The hash key is used to compute masks. It must be kept secret or masks of guessable values can be reversed.
+func NewRedactor(hashKey string, cfg *RedactionConfig) (*Redactor, error) {
+	keyPatterns, valuePatterns := defaultKeyPatterns, defaultValuePatterns
+	if cfg != nil {
+		keyPatterns = append(append([]string{}, keyPatterns...), cfg.KeyPatterns...)
+		valuePatterns = append(append([]string{}, valuePatterns...), cfg.ValuePatterns...)
+	}
+
+	r := &Redactor{
+		hashKey: []byte(hashKey),
+	}
+
+	for _, pattern := range keyPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key pattern %s: %w", pattern, err)
+		}
+		r.keyPatterns = append(r.keyPatterns, re)
+	}
+
+	for _, pattern := range valuePatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value pattern %s: %w", pattern, err)
+		}
+		r.valuePatterns = append(r.valuePatterns, re)
+	}
+
+	return r, nil
+}
+
+// Redact returns the contents with sensitive values masked.
+// If nothing is masked the original contents are returned unchanged.
+// Contents that aren't YAML or JSON are masked as a whole if they contain a sensitive value.
+func (r *Redactor) Redact(contents []byte, contentType string) ([]byte, error) {
+	switch contentType {
+	case YAMLContentType, JSONContentType:
+	case PEMContentType, CSVContentType, TextContentType:
+		if r.sensitiveValue(string(contents)) {
+			return []byte(r.Mask(contents)), nil
+		}
+		return contents, nil
+	default:
+		return nil, fmt.Errorf("unable to redact content type %q", contentType)
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(contents, &root); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	changed, err := r.redactNode(&root)
+	if err != nil {
+		return nil, err
+	}
+
+	if !changed {
+		return contents, nil
+	}
+
+	if contentType == JSONContentType {
+		var value interface{}
+		if err := root.Decode(&value); err != nil {
+			return nil, fmt.Errorf("failed to decode redacted config: %w", err)
+		}
+		return json.Marshal(value)
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&root); err != nil {
+		return nil, fmt.Errorf("failed to encode redacted config: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode redacted config: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Mask returns the mask a value is replaced with
+func (r *Redactor) Mask(value []byte) string {
+	mac := hmac.New(sha256.New, r.hashKey)
+	mac.Write(value)
+	return redactedPrefix + hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// ContainsMask returns true if the contents contain a mask produced by a Redactor
+func ContainsMask(contents []byte) bool {
+	return maskPattern.Match(contents)
+}
+
+// LoadRedactionKey reads the key masks are computed with from the file, generating a random key if it doesn't exist.
+// The key never leaves the agent, so masks can't be used to guess the values they hide.
+func LoadRedactionKey(path string) (string, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	switch {
+	case err == nil:
+		key := strings.TrimSpace(string(data))
+		if key == "" {
+			return "", fmt.Errorf("redaction key %s is empty", path)
+		}
+		return key, nil
+	case !errors.Is(err, fs.ErrNotExist):
+		return "", fmt.Errorf("failed to read redaction key: %w", err)
+	}
+
+	keyBytes := make([]byte, 32)
+	if _, err := rand.Read(keyBytes); err != nil {
+		return "", fmt.Errorf("failed to generate redaction key: %w", err)
+	}
+	key := hex.EncodeToString(keyBytes)
+
+	// Only create the file if it doesn't exist so a key is never replaced
+	file, err := os.OpenFile(filepath.Clean(path), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", fmt.Errorf("failed to create redaction key: %w", err)
+	}
+
+	if _, err := file.WriteString(key); err != nil {
+		_ = file.Close()
+		return "", fmt.Errorf("failed to write redaction key: %w", err)
+	}
+
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("failed to write redaction key: %w", err)
+	}
+
+	return key, nil
+}
+
+// redactNode masks sensitive values in the node and its children, returning true if anything was masked
+func (r *Redactor) redactNode(node *yaml.Node) (bool, error) {
+	changed := false
+
+	switch node.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, child := range node.Content {
+			childChanged, err := r.redactNode(child)
+			if err != nil {
+				return false, err
+			}
+			changed = changed || childChanged
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+
+			if r.sensitiveKey(key.Value) {
+				masked, err := r.maskNode(value)
+				if err != nil {
+					return false, err
+				}
+				changed = changed || masked
+				continue
+			}
+
+			childChanged, err := r.redactNode(value)
+			if err != nil {
+				return false, err
+			}
+			changed = changed || childChanged
+		}
+	case yaml.ScalarNode:
+		if node.Tag == "!!str" && r.sensitiveValue(node.Value) {
+			return r.maskNode(node)
+		}
+	}
+
+	return changed, nil
+}
+
+// maskNode replaces the node with a masked scalar. Empty values are left as is since there is nothing to hide.
+func (r *Redactor) maskNode(node *yaml.Node) (bool, error) {
+	var value []byte
+	switch {
+	case node.Kind == yaml.ScalarNode:
+		if node.Tag == "!!null" || node.Value == "" {
+			return false, nil
+		}
+		// Already masked through another reference to the same anchor
+		if strings.HasPrefix(node.Value, redactedPrefix) {
+			return true, nil
+		}
+		value = []byte(node.Value)
+	case node.Kind == yaml.AliasNode:
+		// Mask the anchored value so it is hidden both where it is defined and where it is referenced
+		if node.Alias == nil {
+			return false, nil
+		}
+		return r.maskNode(node.Alias)
+	default:
+		encoded, err := yaml.Marshal(node)
+		if err != nil {
+			return false, fmt.Errorf("failed to encode value for masking: %w", err)
+		}
+		value = encoded
+	}
+
+	*node = yaml.Node{
+		Kind:   yaml.ScalarNode,
+		Tag:    "!!str",
+		Value:  r.Mask(value),
+		Anchor: node.Anchor,
+	}
+
+	return true, nil
+}
+
+// sensitiveKey returns true if the key matches any key pattern
+func (r *Redactor) sensitiveKey(key string) bool {
+	for _, re := range r.keyPatterns {
+		if re.MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// sensitiveValue returns true if the value matches any value pattern
+func (r *Redactor) sensitiveValue(value string) bool {
+	for _, re := range r.valuePatterns {
+		if re.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}